@@ -0,0 +1,424 @@
+package httputil
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jelech/goutils/cacheutil"
+)
+
+// Authenticator adds credentials to an outgoing request.
+// It is called once per attempt, so implementations may refresh credentials.
+type Authenticator interface {
+	Authenticate(req *http.Request) error
+}
+
+// AuthenticatorFunc adapts an ordinary function to the Authenticator interface
+type AuthenticatorFunc func(req *http.Request) error
+
+// Authenticate implements Authenticator
+func (f AuthenticatorFunc) Authenticate(req *http.Request) error {
+	return f(req)
+}
+
+// WithAuthenticator sets the authenticator applied to every request
+func WithAuthenticator(auth Authenticator) Option {
+	return func(c *Client) {
+		c.auth = auth
+	}
+}
+
+// BearerToken returns an authenticator that sends a static bearer token
+func BearerToken(token string) Authenticator {
+	return AuthenticatorFunc(func(req *http.Request) error {
+		req.Header.Set("Authorization", "Bearer "+token)
+		return nil
+	})
+}
+
+// BasicAuth returns an authenticator that uses HTTP basic authentication
+func BasicAuth(username, password string) Authenticator {
+	return AuthenticatorFunc(func(req *http.Request) error {
+		req.SetBasicAuth(username, password)
+		return nil
+	})
+}
+
+// OAuth2Config holds the configuration for the OAuth2 client credentials flow
+type OAuth2Config struct {
+	TokenURL       string
+	ClientID       string
+	ClientSecret   string
+	Scopes         []string
+	EndpointParams url.Values      // Extra form parameters sent to the token endpoint
+	RefreshBefore  time.Duration   // How long before expiry a token is refreshed (default 1 minute); shorter-lived tokens are reused for half their lifetime
+	DefaultTTL     time.Duration   // How long a token without expires_in is reused (default 5 minutes)
+	Cache          cacheutil.Cache // Token cache (default in-memory cache without a background goroutine)
+	HTTPClient     *http.Client    // Client used for token requests (default 30s timeout)
+}
+
+// minOAuth2TokenTTL is the shortest time a token with a known lifetime is cached
+const minOAuth2TokenTTL = time.Second
+
+// OAuth2ClientCredentials fetches, caches and refreshes OAuth2 access tokens
+type OAuth2ClientCredentials struct {
+	config   OAuth2Config
+	cacheKey string
+	mu       sync.Mutex
+}
+
+// oauth2Token is the token endpoint response
+type oauth2Token struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// NewOAuth2ClientCredentials creates an OAuth2 client credentials authenticator
+func NewOAuth2ClientCredentials(config OAuth2Config) *OAuth2ClientCredentials {
+	if config.RefreshBefore <= 0 {
+		config.RefreshBefore = time.Minute
+	}
+	if config.DefaultTTL <= 0 {
+		config.DefaultTTL = 5 * time.Minute
+	}
+	if config.Cache == nil {
+		config.Cache = &tokenCache{}
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = &http.Client{Timeout: time.Second * 30}
+	}
+
+	return &OAuth2ClientCredentials{
+		config:   config,
+		cacheKey: "oauth2:" + config.TokenURL + ":" + config.ClientID + ":" + strings.Join(config.Scopes, " "),
+	}
+}
+
+// Authenticate implements Authenticator
+func (o *OAuth2ClientCredentials) Authenticate(req *http.Request) error {
+	token, err := o.Token(req.Context())
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+// Token returns a valid access token, fetching a new one when the cached token
+// is missing or about to expire
+func (o *OAuth2ClientCredentials) Token(ctx context.Context) (string, error) {
+	if token, ok := o.cachedToken(); ok {
+		return token, nil
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	// Another goroutine may have refreshed the token while we waited
+	if token, ok := o.cachedToken(); ok {
+		return token, nil
+	}
+
+	token, err := o.fetchToken(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	// Tokens without a lifetime are reused for DefaultTTL; a 401 response
+	// drops them through Invalidate
+	ttl := o.config.DefaultTTL
+	if token.ExpiresIn > 0 {
+		// A token that lives no longer than RefreshBefore is still reused
+		// for half its lifetime rather than fetched for every request
+		lifetime := time.Duration(token.ExpiresIn) * time.Second
+		ttl = lifetime - o.config.RefreshBefore
+		if ttl <= 0 {
+			ttl = lifetime / 2
+			if ttl < minOAuth2TokenTTL {
+				ttl = minOAuth2TokenTTL
+			}
+		}
+	}
+	if err := o.config.Cache.Set(o.cacheKey, token.AccessToken, ttl); err != nil {
+		return "", fmt.Errorf("failed to cache OAuth2 token: %w", err)
+	}
+
+	return token.AccessToken, nil
+}
+
+// cachedToken returns the cached token. A value of another type, which a
+// shared cache may hold under the same key, counts as a miss.
+func (o *OAuth2ClientCredentials) cachedToken() (string, bool) {
+	value, ok := o.config.Cache.Get(o.cacheKey)
+	if !ok {
+		return "", false
+	}
+	token, ok := value.(string)
+	return token, ok && token != ""
+}
+
+// Invalidate drops the cached token so the next request fetches a new one.
+// Client calls it when a request is answered with 401 Unauthorized.
+func (o *OAuth2ClientCredentials) Invalidate() {
+	o.config.Cache.Delete(o.cacheKey)
+}
+
+// tokenCache is the default OAuth2 token cache. Unlike cacheutil.MemoryCache
+// it expires entries on read, so it needs no cleanup goroutine.
+type tokenCache struct {
+	mu    sync.Mutex
+	items map[string]tokenEntry
+}
+
+// tokenEntry is a tokenCache entry
+type tokenEntry struct {
+	value     interface{}
+	expiresAt time.Time
+}
+
+// Set implements cacheutil.Cache
+func (c *tokenCache) Set(key string, value interface{}, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.items == nil {
+		c.items = make(map[string]tokenEntry)
+	}
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = time.Now().Add(ttl)
+	}
+	c.items[key] = tokenEntry{value: value, expiresAt: expiresAt}
+	return nil
+}
+
+// Get implements cacheutil.Cache
+func (c *tokenCache) Get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	item, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	if !item.expiresAt.IsZero() && time.Now().After(item.expiresAt) {
+		delete(c.items, key)
+		return nil, false
+	}
+	return item.value, true
+}
+
+// Delete implements cacheutil.Cache
+func (c *tokenCache) Delete(key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.items, key)
+	return nil
+}
+
+// Clear implements cacheutil.Cache
+func (c *tokenCache) Clear() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.items = nil
+	return nil
+}
+
+// Size implements cacheutil.Cache
+func (c *tokenCache) Size() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.items)
+}
+
+// fetchToken requests a new token from the token endpoint
+func (o *OAuth2ClientCredentials) fetchToken(ctx context.Context) (*oauth2Token, error) {
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	if len(o.config.Scopes) > 0 {
+		form.Set("scope", strings.Join(o.config.Scopes, " "))
+	}
+	for k, values := range o.config.EndpointParams {
+		for _, v := range values {
+			form.Add(k, v)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.config.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(o.config.ClientID), url.QueryEscape(o.config.ClientSecret))
+
+	resp, err := o.config.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to request OAuth2 token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, defaultMaxErrorBodySize))
+		return nil, fmt.Errorf("failed to request OAuth2 token: %w",
+			&HTTPError{StatusCode: resp.StatusCode, Status: resp.Status, Header: resp.Header, Body: body})
+	}
+
+	var token oauth2Token
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return nil, fmt.Errorf("failed to decode OAuth2 token: %w", err)
+	}
+	if token.AccessToken == "" {
+		return nil, fmt.Errorf("OAuth2 token response has no access_token")
+	}
+
+	return &token, nil
+}
+
+// HMAC signing header names
+const (
+	HMACDateHeader        = "X-Date"
+	HMACContentHashHeader = "X-Content-SHA256"
+	hmacAlgorithm         = "HMAC-SHA256"
+	hmacDateFormat        = "20060102T150405Z"
+)
+
+// HMACSigner signs requests in a SigV4-like scheme. The signature covers the
+// method, path, sorted query, the signed headers and a SHA-256 of the body:
+//
+//	Authorization: HMAC-SHA256 Credential=<key id>, SignedHeaders=host;x-content-sha256;x-date, Signature=<hex>
+type HMACSigner struct {
+	KeyID         string
+	Secret        []byte
+	SignedHeaders []string         // Extra headers to sign in addition to host, x-content-sha256 and x-date
+	Now           func() time.Time // Clock used for the X-Date header (default time.Now)
+}
+
+// Authenticate implements Authenticator
+func (s *HMACSigner) Authenticate(req *http.Request) error {
+	bodyHash, err := hashRequestBody(req)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now
+	if s.Now != nil {
+		now = s.Now
+	}
+
+	req.Header.Set(HMACDateHeader, now().UTC().Format(hmacDateFormat))
+	req.Header.Set(HMACContentHashHeader, bodyHash)
+
+	signedHeaders := s.signedHeaderNames()
+	signature := s.sign(req, signedHeaders, bodyHash)
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s, SignedHeaders=%s, Signature=%s",
+		hmacAlgorithm, s.KeyID, strings.Join(signedHeaders, ";"), signature))
+	return nil
+}
+
+// signedHeaderNames returns the sorted, lower-cased names of signed headers
+func (s *HMACSigner) signedHeaderNames() []string {
+	names := []string{"host", strings.ToLower(HMACContentHashHeader), strings.ToLower(HMACDateHeader)}
+	for _, h := range s.SignedHeaders {
+		names = append(names, strings.ToLower(h))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// sign computes the hex signature of the canonical request
+func (s *HMACSigner) sign(req *http.Request, signedHeaders []string, bodyHash string) string {
+	var canonical strings.Builder
+	canonical.WriteString(req.Method + "\n")
+	canonical.WriteString(req.URL.EscapedPath() + "\n")
+	canonical.WriteString(canonicalQuery(req.URL.Query()) + "\n")
+	for _, name := range signedHeaders {
+		value := req.Header.Get(name)
+		if name == "host" {
+			value = req.Host
+			if value == "" {
+				value = req.URL.Host
+			}
+		}
+		canonical.WriteString(name + ":" + strings.TrimSpace(value) + "\n")
+	}
+	canonical.WriteString(strings.Join(signedHeaders, ";") + "\n")
+	canonical.WriteString(bodyHash)
+
+	canonicalHash := sha256.Sum256([]byte(canonical.String()))
+	stringToSign := hmacAlgorithm + "\n" + req.Header.Get(HMACDateHeader) + "\n" + hex.EncodeToString(canonicalHash[:])
+
+	mac := hmac.New(sha256.New, s.Secret)
+	mac.Write([]byte(stringToSign))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// canonicalQuery encodes query parameters sorted by key and value
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		values := append([]string(nil), query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, url.QueryEscape(k)+"="+url.QueryEscape(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// hashRequestBody returns the hex SHA-256 of the request body without consuming it
+func hashRequestBody(req *http.Request) (string, error) {
+	h := sha256.New()
+	if req.Body == nil || req.Body == http.NoBody {
+		return hex.EncodeToString(h.Sum(nil)), nil
+	}
+
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return "", fmt.Errorf("failed to read request body for signing: %w", err)
+		}
+		defer body.Close()
+		if _, err := io.Copy(h, body); err != nil {
+			return "", fmt.Errorf("failed to read request body for signing: %w", err)
+		}
+		return hex.EncodeToString(h.Sum(nil)), nil
+	}
+
+	// Buffer bodies that cannot be re-read so they can still be sent
+	data, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return "", fmt.Errorf("failed to read request body for signing: %w", err)
+	}
+	req.Body = io.NopCloser(bytes.NewReader(data))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
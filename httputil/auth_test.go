@@ -0,0 +1,249 @@
+package httputil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jelech/goutils/cacheutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBearerAndBasicAuth(t *testing.T) {
+	var authHeaders []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authHeaders = append(authHeaders, r.Header.Get("Authorization"))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	resp, err := NewClient(WithAuthenticator(BearerToken("abc"))).Get(server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	resp, err = NewClient(WithAuthenticator(BasicAuth("user", "pass"))).Get(server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	require.Len(t, authHeaders, 2)
+	assert.Equal(t, "Bearer abc", authHeaders[0])
+	assert.Equal(t, "Basic dXNlcjpwYXNz", authHeaders[1])
+}
+
+func TestClient_AuthenticatorError(t *testing.T) {
+	client := NewClient(WithAuthenticator(AuthenticatorFunc(func(*http.Request) error {
+		return errors.New("no credentials")
+	})))
+
+	_, err := client.Get("http://example.invalid")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no credentials")
+}
+
+func TestOAuth2ClientCredentials(t *testing.T) {
+	var tokenRequests int32
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&tokenRequests, 1)
+
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "client_credentials", r.PostForm.Get("grant_type"))
+		assert.Equal(t, "read write", r.PostForm.Get("scope"))
+		id, secret, ok := r.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "client-id", id)
+		assert.Equal(t, "client-secret", secret)
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token": "token-%d", "token_type": "Bearer", "expires_in": 3600}`, n)
+	}))
+	defer tokenServer.Close()
+
+	var received []string
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = append(received, r.Header.Get("Authorization"))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer api.Close()
+
+	cache := cacheutil.NewMemoryCache()
+	oauth := NewOAuth2ClientCredentials(OAuth2Config{
+		TokenURL:     tokenServer.URL,
+		ClientID:     "client-id",
+		ClientSecret: "client-secret",
+		Scopes:       []string{"read", "write"},
+		Cache:        cache,
+	})
+	client := NewClient(WithAuthenticator(oauth))
+
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get(api.URL)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&tokenRequests))
+	assert.Equal(t, []string{"Bearer token-1", "Bearer token-1", "Bearer token-1"}, received)
+	assert.Equal(t, 1, cache.Size())
+
+	oauth.Invalidate()
+	token, err := oauth.Token(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "token-2", token)
+}
+
+func TestOAuth2ClientCredentials_Error(t *testing.T) {
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"error": "invalid_client"}`))
+	}))
+	defer tokenServer.Close()
+
+	oauth := NewOAuth2ClientCredentials(OAuth2Config{TokenURL: tokenServer.URL, ClientID: "id"})
+	_, err := oauth.Token(context.Background())
+	require.Error(t, err)
+	assert.True(t, IsUnauthorized(err))
+}
+
+func TestOAuth2ClientCredentials_ShortLivedToken(t *testing.T) {
+	var tokenRequests int32
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&tokenRequests, 1)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token": "token-%d", "expires_in": 30}`, n)
+	}))
+	defer tokenServer.Close()
+
+	// The token lives less than the default RefreshBefore of one minute
+	oauth := NewOAuth2ClientCredentials(OAuth2Config{TokenURL: tokenServer.URL, ClientID: "id"})
+	for i := 0; i < 3; i++ {
+		token, err := oauth.Token(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "token-1", token)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&tokenRequests))
+}
+
+func TestOAuth2ClientCredentials_ForeignCacheValue(t *testing.T) {
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token": "fresh", "expires_in": 3600}`))
+	}))
+	defer tokenServer.Close()
+
+	cache := cacheutil.NewMemoryCache()
+	oauth := NewOAuth2ClientCredentials(OAuth2Config{TokenURL: tokenServer.URL, ClientID: "id", Cache: cache})
+	require.NoError(t, cache.Set(oauth.cacheKey, 42, time.Minute))
+
+	token, err := oauth.Token(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "fresh", token)
+}
+
+func TestOAuth2ClientCredentials_NoExpiry(t *testing.T) {
+	var tokenRequests int32
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&tokenRequests, 1)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token": "token-%d"}`, n)
+	}))
+	defer tokenServer.Close()
+
+	// The API rejects the first token, as if it had been revoked
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "Bearer token-1" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer api.Close()
+
+	oauth := NewOAuth2ClientCredentials(OAuth2Config{TokenURL: tokenServer.URL, ClientID: "id"})
+	client := NewClient(WithAuthenticator(oauth))
+
+	var statuses []int
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get(api.URL)
+		require.NoError(t, err)
+		resp.Body.Close()
+		statuses = append(statuses, resp.StatusCode)
+	}
+	assert.Equal(t, []int{http.StatusUnauthorized, http.StatusOK, http.StatusOK}, statuses)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&tokenRequests))
+}
+
+func TestTokenCache(t *testing.T) {
+	cache := &tokenCache{}
+	require.NoError(t, cache.Set("a", "x", 0))
+	require.NoError(t, cache.Set("b", "y", time.Millisecond))
+	time.Sleep(5 * time.Millisecond)
+
+	value, ok := cache.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, "x", value)
+	_, ok = cache.Get("b")
+	assert.False(t, ok)
+	assert.Equal(t, 1, cache.Size())
+
+	require.NoError(t, cache.Delete("a"))
+	assert.Zero(t, cache.Size())
+}
+
+func TestHMACSigner(t *testing.T) {
+	signer := &HMACSigner{
+		KeyID:         "key-1",
+		Secret:        []byte("secret"),
+		SignedHeaders: []string{"Content-Type"},
+		Now: func() time.Time {
+			return time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+		},
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "20240102T030405Z", r.Header.Get(HMACDateHeader))
+
+		auth := r.Header.Get("Authorization")
+		assert.True(t, strings.HasPrefix(auth, "HMAC-SHA256 Credential=key-1, SignedHeaders=content-type;host;x-content-sha256;x-date, Signature="))
+
+		// Recompute the signature on the server side
+		r.URL.Host = r.Host
+		expected := signer.sign(r, signer.signedHeaderNames(), r.Header.Get(HMACContentHashHeader))
+		assert.True(t, strings.HasSuffix(auth, "Signature="+expected))
+
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := NewClient(WithAuthenticator(signer))
+	resp, err := client.NewRequest().Method("POST").Path(server.URL+"/orders").
+		Query("b", "2").Query("a", "1").
+		JSONBody(map[string]int{"qty": 1}).
+		Do(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+}
+
+func TestHashRequestBody_NonReplayable(t *testing.T) {
+	req, err := http.NewRequest("POST", "http://example.com", strings.NewReader("data"))
+	require.NoError(t, err)
+	req.GetBody = nil
+
+	hash, err := hashRequestBody(req)
+	require.NoError(t, err)
+	assert.Equal(t, "3a6eb0790f39ac87c94f3856b2dd2c5d110e6811602261a9a923d3bb23adc8b7", hash)
+	require.NotNil(t, req.GetBody)
+
+	body, err := req.GetBody()
+	require.NoError(t, err)
+	defer body.Close()
+	data := make([]byte, 4)
+	_, err = body.Read(data)
+	require.NoError(t, err)
+	assert.Equal(t, "data", string(data))
+}
@@ -0,0 +1,305 @@
+package httputil
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// BalanceStrategy selects the endpoint used for a request
+type BalanceStrategy int
+
+const (
+	// RoundRobin cycles through healthy endpoints in order
+	RoundRobin BalanceStrategy = iota
+	// LeastInFlight picks the healthy endpoint with the fewest open requests
+	LeastInFlight
+	// Random picks a healthy endpoint at random
+	Random
+)
+
+// LoadBalancerOptions configures client-side load balancing
+type LoadBalancerOptions struct {
+	Strategy         BalanceStrategy
+	MaxFailures      int           // Consecutive failures before an endpoint is ejected (default 3)
+	EjectionDuration time.Duration // How long an ejected endpoint is skipped (default 30s)
+	MaxFailovers     int           // Other endpoints tried after a failure (default: all of them, -1 disables failover)
+}
+
+// endpoint is a single backend and its health state
+type endpoint struct {
+	url      *url.URL
+	inFlight int64 // Accessed atomically
+
+	failures     int
+	ejectedUntil time.Time
+}
+
+// loadBalancer distributes requests addressed to the primary endpoint
+type loadBalancer struct {
+	primary   *url.URL
+	rawURL    string // The first endpoint as configured
+	endpoints []*endpoint
+	options   LoadBalancerOptions
+	auth      Authenticator // Applied per attempt, after the endpoint is chosen
+	err       error
+
+	mu     sync.Mutex
+	next   int
+	random *rand.Rand
+}
+
+// WithEndpoints spreads requests over several replicas of the same service.
+// The first endpoint becomes the base URL; requests addressed to it are sent
+// to the endpoint chosen by the strategy. Endpoints that fail MaxFailures
+// times in a row (network errors, 502, 503 or 504) are ejected for
+// EjectionDuration, and failed requests are retried on another endpoint when
+// the request is idempotent and its body can be replayed. Non-idempotent
+// requests only fail over when the connection could not be established.
+//
+// The client's Authenticator runs inside the balancer once the endpoint is
+// chosen, so signatures covering the host and path (HMACSigner) match the
+// replica actually called; middleware therefore sees unauthenticated
+// requests, though WithResponseCache still partitions entries by the
+// authenticator's credentials. The base URL must stay the first endpoint: combining
+// WithEndpoints with a later WithBaseURL makes every request fail.
+func WithEndpoints(endpoints []string, options *LoadBalancerOptions) Option {
+	return func(c *Client) {
+		c.balancer = newLoadBalancer(endpoints, options)
+		if len(endpoints) > 0 {
+			c.baseURL = endpoints[0]
+		}
+	}
+}
+
+// newLoadBalancer parses the endpoints. Configuration errors are reported by
+// every request sent through the balancer.
+func newLoadBalancer(endpoints []string, options *LoadBalancerOptions) *loadBalancer {
+	lb := &loadBalancer{random: rand.New(rand.NewSource(time.Now().UnixNano()))}
+	if options != nil {
+		lb.options = *options
+	}
+	if lb.options.MaxFailures <= 0 {
+		lb.options.MaxFailures = 3
+	}
+	if lb.options.EjectionDuration <= 0 {
+		lb.options.EjectionDuration = time.Second * 30
+	}
+	if lb.options.MaxFailovers == 0 || lb.options.MaxFailovers >= len(endpoints) {
+		lb.options.MaxFailovers = len(endpoints) - 1
+	}
+
+	if len(endpoints) == 0 {
+		lb.err = errors.New("no endpoints configured")
+		return lb
+	}
+	for _, raw := range endpoints {
+		u, err := url.Parse(raw)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			lb.err = fmt.Errorf("invalid endpoint %q", raw)
+			return lb
+		}
+		u.Path = strings.TrimSuffix(u.Path, "/")
+		u.RawPath = ""
+		lb.endpoints = append(lb.endpoints, &endpoint{url: u})
+	}
+	lb.primary = lb.endpoints[0].url
+	lb.rawURL = endpoints[0]
+	return lb
+}
+
+// bind attaches the balancer to the client's final configuration
+func (lb *loadBalancer) bind(c *Client) {
+	lb.auth = c.auth
+	if lb.err == nil && c.baseURL != lb.rawURL {
+		lb.err = fmt.Errorf("base URL %q is not the first endpoint %q", c.baseURL, lb.rawURL)
+	}
+}
+
+// middleware returns the balancing round tripper around next
+func (lb *loadBalancer) middleware(next http.RoundTripper) http.RoundTripper {
+	return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if lb.err != nil {
+			return nil, fmt.Errorf("load balancer: %w", lb.err)
+		}
+		if !lb.matches(req.URL) {
+			outReq := req.Clone(req.Context())
+			if err := lb.authenticate(outReq); err != nil {
+				return nil, err
+			}
+			return next.RoundTrip(outReq)
+		}
+		return lb.roundTrip(next, req)
+	})
+}
+
+// roundTrip sends req to a selected endpoint, failing over on errors
+func (lb *loadBalancer) roundTrip(next http.RoundTripper, req *http.Request) (*http.Response, error) {
+	replayable := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+	tried := make(map[*endpoint]bool)
+
+	for attempt := 0; ; attempt++ {
+		ep := lb.pick(tried)
+		tried[ep] = true
+
+		outReq := req.Clone(req.Context())
+		outReq.URL = lb.rewrite(req.URL, ep.url)
+		outReq.Host = ""
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, fmt.Errorf("failed to rewind request body: %w", err)
+			}
+			outReq.Body = body
+		}
+		if err := lb.authenticate(outReq); err != nil {
+			return nil, err
+		}
+
+		atomic.AddInt64(&ep.inFlight, 1)
+		resp, err := next.RoundTrip(outReq)
+		if err != nil {
+			atomic.AddInt64(&ep.inFlight, -1)
+		} else {
+			resp.Body = &inFlightBody{ReadCloser: resp.Body, endpoint: ep}
+		}
+
+		failed := err != nil || isEndpointFailure(resp.StatusCode)
+		lb.report(ep, failed)
+
+		canFailover := failed && replayable && attempt < lb.options.MaxFailovers &&
+			len(tried) < len(lb.endpoints) && req.Context().Err() == nil &&
+			(isIdempotent(req) || isDialError(err))
+		if !canFailover {
+			return resp, err
+		}
+		if resp != nil {
+			drainAndClose(resp)
+		}
+	}
+}
+
+// authenticate applies the client's authenticator to req, if any
+func (lb *loadBalancer) authenticate(req *http.Request) error {
+	if lb.auth == nil {
+		return nil
+	}
+	if err := lb.auth.Authenticate(req); err != nil {
+		return fmt.Errorf("failed to authenticate request: %w", err)
+	}
+	return nil
+}
+
+// matches reports whether u is addressed to the primary endpoint
+func (lb *loadBalancer) matches(u *url.URL) bool {
+	if u.Scheme != lb.primary.Scheme || u.Host != lb.primary.Host {
+		return false
+	}
+	return u.Path == lb.primary.Path || strings.HasPrefix(u.Path, lb.primary.Path+"/") || lb.primary.Path == ""
+}
+
+// rewrite moves u from the primary endpoint to target
+func (lb *loadBalancer) rewrite(u *url.URL, target *url.URL) *url.URL {
+	rewritten := *u
+	rewritten.Scheme = target.Scheme
+	rewritten.Host = target.Host
+	rewritten.Path = target.Path + strings.TrimPrefix(u.Path, lb.primary.Path)
+	if u.RawPath != "" {
+		rewritten.RawPath = target.EscapedPath() + strings.TrimPrefix(u.RawPath, lb.primary.EscapedPath())
+	}
+	return &rewritten
+}
+
+// pick selects an endpoint that has not been tried. Healthy endpoints are
+// preferred; if all are ejected, ejected endpoints are used anyway.
+func (lb *loadBalancer) pick(tried map[*endpoint]bool) *endpoint {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	now := time.Now()
+	var healthy, untried []*endpoint
+	for _, ep := range lb.endpoints {
+		if tried[ep] {
+			continue
+		}
+		untried = append(untried, ep)
+		if !now.Before(ep.ejectedUntil) {
+			healthy = append(healthy, ep)
+		}
+	}
+
+	candidates := healthy
+	if len(candidates) == 0 {
+		candidates = untried
+	}
+
+	switch lb.options.Strategy {
+	case LeastInFlight:
+		best := candidates[0]
+		for _, ep := range candidates[1:] {
+			if atomic.LoadInt64(&ep.inFlight) < atomic.LoadInt64(&best.inFlight) {
+				best = ep
+			}
+		}
+		return best
+	case Random:
+		return candidates[lb.random.Intn(len(candidates))]
+	default:
+		ep := candidates[lb.next%len(candidates)]
+		lb.next++
+		return ep
+	}
+}
+
+// report updates the health of ep after a request
+func (lb *loadBalancer) report(ep *endpoint, failed bool) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	if !failed {
+		ep.failures = 0
+		return
+	}
+	ep.failures++
+	if ep.failures >= lb.options.MaxFailures {
+		ep.ejectedUntil = time.Now().Add(lb.options.EjectionDuration)
+		ep.failures = 0
+	}
+}
+
+// inFlightBody releases the endpoint's in-flight slot when the body is closed
+type inFlightBody struct {
+	io.ReadCloser
+	endpoint *endpoint
+	once     sync.Once
+}
+
+func (b *inFlightBody) Close() error {
+	b.once.Do(func() {
+		atomic.AddInt64(&b.endpoint.inFlight, -1)
+	})
+	return b.ReadCloser.Close()
+}
+
+// isEndpointFailure reports whether a status code indicates an unhealthy endpoint
+func isEndpointFailure(statusCode int) bool {
+	switch statusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// isDialError reports whether err happened before the request was sent
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
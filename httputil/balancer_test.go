@@ -0,0 +1,198 @@
+package httputil
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// replica is a test server that counts requests and can be made to fail
+type replica struct {
+	*httptest.Server
+	calls  int32
+	status int32
+	paths  []string
+	mu     sync.Mutex
+}
+
+func newReplica(t *testing.T, name string) *replica {
+	r := &replica{status: http.StatusOK}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&r.calls, 1)
+		r.mu.Lock()
+		r.paths = append(r.paths, req.URL.Path)
+		r.mu.Unlock()
+		w.WriteHeader(int(atomic.LoadInt32(&r.status)))
+		w.Write([]byte(name))
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func (r *replica) count() int {
+	return int(atomic.LoadInt32(&r.calls))
+}
+
+func TestWithEndpoints_RoundRobin(t *testing.T) {
+	a, b, c := newReplica(t, "a"), newReplica(t, "b"), newReplica(t, "c")
+	client := NewClient(WithEndpoints([]string{a.URL + "/api", b.URL + "/api", c.URL + "/api"}, nil))
+
+	var names []string
+	for i := 0; i < 6; i++ {
+		resp, err := client.Get("/users")
+		require.NoError(t, err)
+		names = append(names, readAll(t, resp))
+	}
+
+	assert.Equal(t, []string{"a", "b", "c", "a", "b", "c"}, names)
+	assert.Equal(t, []string{"/api/users", "/api/users"}, b.paths)
+}
+
+func TestWithEndpoints_Random(t *testing.T) {
+	a, b := newReplica(t, "a"), newReplica(t, "b")
+	client := NewClient(WithEndpoints([]string{a.URL, b.URL}, &LoadBalancerOptions{Strategy: Random}))
+
+	for i := 0; i < 50; i++ {
+		resp, err := client.Get("/")
+		require.NoError(t, err)
+		readAll(t, resp)
+	}
+
+	assert.Equal(t, 50, a.count()+b.count())
+	assert.Greater(t, a.count(), 0)
+	assert.Greater(t, b.count(), 0)
+}
+
+func TestWithEndpoints_LeastInFlight(t *testing.T) {
+	a, b := newReplica(t, "a"), newReplica(t, "b")
+	client := NewClient(WithEndpoints([]string{a.URL, b.URL}, &LoadBalancerOptions{Strategy: LeastInFlight}))
+
+	// Hold the first response open so endpoint a stays busy
+	held, err := client.Get("/")
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get("/")
+		require.NoError(t, err)
+		assert.Equal(t, "b", readAll(t, resp))
+	}
+
+	assert.Equal(t, "a", readAll(t, held))
+	resp, err := client.Get("/")
+	require.NoError(t, err)
+	assert.Equal(t, "a", readAll(t, resp))
+}
+
+func TestWithEndpoints_FailoverAndEjection(t *testing.T) {
+	a, b := newReplica(t, "a"), newReplica(t, "b")
+	atomic.StoreInt32(&a.status, http.StatusServiceUnavailable)
+
+	client := NewClient(WithEndpoints([]string{a.URL, b.URL}, &LoadBalancerOptions{
+		MaxFailures:      2,
+		EjectionDuration: time.Minute,
+	}))
+
+	for i := 0; i < 6; i++ {
+		resp, err := client.Get("/")
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "b", readAll(t, resp))
+	}
+
+	// a failed twice and was then ejected
+	assert.Equal(t, 2, a.count())
+	assert.Equal(t, 6, b.count())
+}
+
+func TestWithEndpoints_NonIdempotentFailover(t *testing.T) {
+	a, b := newReplica(t, "a"), newReplica(t, "b")
+	atomic.StoreInt32(&a.status, http.StatusServiceUnavailable)
+
+	client := NewClient(WithEndpoints([]string{a.URL, b.URL}, nil))
+	resp, err := client.Post("/", map[string]string{"k": "v"})
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	// The request reached a, so POST must not be resent
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, 0, b.count())
+
+	// A connection failure is safe to fail over, even for POST
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	deadURL := "http://" + listener.Addr().String()
+	listener.Close()
+
+	client = NewClient(WithEndpoints([]string{deadURL, b.URL}, nil))
+	resp, err = client.Post("/", map[string]string{"k": "v"})
+	require.NoError(t, err)
+	assert.Equal(t, "b", readAll(t, resp))
+}
+
+func TestWithEndpoints_DisabledFailover(t *testing.T) {
+	a, b := newReplica(t, "a"), newReplica(t, "b")
+	atomic.StoreInt32(&a.status, http.StatusBadGateway)
+
+	client := NewClient(WithEndpoints([]string{a.URL, b.URL}, &LoadBalancerOptions{MaxFailovers: -1}))
+	resp, err := client.Get("/")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+	assert.Equal(t, 0, b.count())
+}
+
+func TestWithEndpoints_OtherHostsPassThrough(t *testing.T) {
+	a, other := newReplica(t, "a"), newReplica(t, "other")
+	client := NewClient(WithEndpoints([]string{a.URL}, nil))
+
+	resp, err := client.Get(other.URL + "/x")
+	require.NoError(t, err)
+	assert.Equal(t, "other", readAll(t, resp))
+}
+
+func TestWithEndpoints_InvalidConfig(t *testing.T) {
+	client := NewClient(WithEndpoints([]string{"not a url"}, nil))
+	_, err := client.Get("http://example.com")
+	require.Error(t, err)
+	assert.True(t, strings.Contains(err.Error(), "invalid endpoint"))
+}
+
+func TestWithEndpoints_SignsForChosenEndpoint(t *testing.T) {
+	signer := &HMACSigner{KeyID: "key", Secret: []byte("secret")}
+	var valid int32
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		expected := signer.sign(r, signer.signedHeaderNames(), r.Header.Get(HMACContentHashHeader))
+		if strings.HasSuffix(r.Header.Get("Authorization"), "Signature="+expected) {
+			atomic.AddInt32(&valid, 1)
+		}
+	})
+	a := httptest.NewServer(handler)
+	defer a.Close()
+	b := httptest.NewServer(handler)
+	defer b.Close()
+
+	client := NewClient(WithEndpoints([]string{a.URL + "/api", b.URL + "/v2"}, nil), WithAuthenticator(signer))
+	for i := 0; i < 4; i++ {
+		resp, err := client.Get("/items?page=1")
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+	assert.Equal(t, int32(4), atomic.LoadInt32(&valid))
+}
+
+func TestWithEndpoints_BaseURLOverride(t *testing.T) {
+	a := newReplica(t, "a")
+	client := NewClient(WithEndpoints([]string{a.URL}, nil), WithBaseURL("http://example.com"))
+	_, err := client.Get("/x")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "is not the first endpoint")
+	assert.Equal(t, 0, a.count())
+}
@@ -0,0 +1,357 @@
+package httputil
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// errBodyNotReplayable is returned when a single-use body is opened twice
+var errBodyNotReplayable = errors.New("request body is not replayable; use BufferBody to allow retries")
+
+// bodySource produces request bodies. Replayable sources can be opened any
+// number of times, which is what allows requests to be retried.
+type bodySource struct {
+	open       func() (io.ReadCloser, error)
+	replayable bool
+	length     int64  // -1 if unknown
+	data       []byte // Set for in-memory sources
+}
+
+// bytesSource returns a replayable source over data
+func bytesSource(data []byte) *bodySource {
+	return &bodySource{
+		open: func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(data)), nil
+		},
+		replayable: true,
+		length:     int64(len(data)),
+		data:       data,
+	}
+}
+
+// readerSource returns a source for r. In-memory readers are snapshotted and
+// replayable; any other reader can only be read once.
+func readerSource(r io.Reader) (*bodySource, error) {
+	switch v := r.(type) {
+	case *bytes.Buffer:
+		return bytesSource(v.Bytes()), nil
+	case *bytes.Reader, *strings.Reader:
+		data, err := io.ReadAll(v)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read request body: %w", err)
+		}
+		return bytesSource(data), nil
+	}
+
+	var once sync.Once
+	return &bodySource{
+		open: func() (io.ReadCloser, error) {
+			var rc io.ReadCloser
+			once.Do(func() {
+				if closer, ok := r.(io.ReadCloser); ok {
+					rc = closer
+				} else {
+					rc = io.NopCloser(r)
+				}
+			})
+			if rc == nil {
+				return nil, errBodyNotReplayable
+			}
+			return rc, nil
+		},
+		length: -1,
+	}, nil
+}
+
+// bufferSource reads a single-use source into memory so it can be replayed
+func bufferSource(src *bodySource) (*bodySource, error) {
+	if src.replayable {
+		return src, nil
+	}
+
+	rc, err := src.open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to buffer request body: %w", err)
+	}
+	return bytesSource(data), nil
+}
+
+// gzipSource compresses src. In-memory sources are compressed eagerly, others
+// are compressed while streaming.
+func gzipSource(src *bodySource) (*bodySource, error) {
+	if src.data != nil {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		if _, err := gz.Write(src.data); err != nil {
+			return nil, fmt.Errorf("failed to compress request body: %w", err)
+		}
+		if err := gz.Close(); err != nil {
+			return nil, fmt.Errorf("failed to compress request body: %w", err)
+		}
+		return bytesSource(buf.Bytes()), nil
+	}
+
+	return &bodySource{
+		open: func() (io.ReadCloser, error) {
+			rc, err := src.open()
+			if err != nil {
+				return nil, err
+			}
+			return pipeBody(func(w io.Writer) error {
+				defer rc.Close()
+				gz := gzip.NewWriter(w)
+				if _, err := io.Copy(gz, rc); err != nil {
+					return err
+				}
+				return gz.Close()
+			}), nil
+		},
+		replayable: src.replayable,
+		length:     -1,
+	}, nil
+}
+
+// pipeBody streams the output of write through a pipe. Writing starts on the
+// first Read, so an unsent request does not leak a goroutine.
+func pipeBody(write func(w io.Writer) error) io.ReadCloser {
+	return &lazyPipe{write: write}
+}
+
+// lazyPipe is an io.ReadCloser backed by a pipe that is started on demand
+type lazyPipe struct {
+	write  func(w io.Writer) error
+	once   sync.Once
+	reader *io.PipeReader
+}
+
+func (p *lazyPipe) start() {
+	p.once.Do(func() {
+		pr, pw := io.Pipe()
+		p.reader = pr
+		go func() {
+			pw.CloseWithError(p.write(pw))
+		}()
+	})
+}
+
+func (p *lazyPipe) Read(b []byte) (int, error) {
+	p.start()
+	return p.reader.Read(b)
+}
+
+func (p *lazyPipe) Close() error {
+	p.start()
+	return p.reader.Close()
+}
+
+// multipartPart is a single field or file of a multipart form
+type multipartPart struct {
+	field       string
+	value       string
+	filename    string
+	contentType string
+	source      *bodySource // nil for plain fields
+}
+
+// quoteEscaper escapes quotes in Content-Disposition parameters
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// multipartSource streams a multipart/form-data body with a fixed boundary,
+// so that replays produce an identical body
+func multipartSource(parts []multipartPart, boundary string) *bodySource {
+	replayable := true
+	for _, part := range parts {
+		if part.source != nil && !part.source.replayable {
+			replayable = false
+		}
+	}
+
+	return &bodySource{
+		open: func() (io.ReadCloser, error) {
+			return pipeBody(func(w io.Writer) error {
+				mw := multipart.NewWriter(w)
+				if err := mw.SetBoundary(boundary); err != nil {
+					return err
+				}
+				for _, part := range parts {
+					if err := writeMultipartPart(mw, part); err != nil {
+						return err
+					}
+				}
+				return mw.Close()
+			}), nil
+		},
+		replayable: replayable,
+		length:     -1,
+	}
+}
+
+// writeMultipartPart writes a field or streams a file into mw
+func writeMultipartPart(mw *multipart.Writer, part multipartPart) error {
+	if part.source == nil {
+		return mw.WriteField(part.field, part.value)
+	}
+
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`,
+		quoteEscaper.Replace(part.field), quoteEscaper.Replace(part.filename)))
+	header.Set("Content-Type", part.contentType)
+
+	w, err := mw.CreatePart(header)
+	if err != nil {
+		return err
+	}
+
+	rc, err := part.source.open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	if _, err := io.Copy(w, rc); err != nil {
+		return fmt.Errorf("failed to write multipart file %s: %w", part.filename, err)
+	}
+	return nil
+}
+
+// fileContentType guesses a content type from the file extension
+func fileContentType(filename string) string {
+	if contentType := mime.TypeByExtension(filepath.Ext(filename)); contentType != "" {
+		return contentType
+	}
+	return "application/octet-stream"
+}
+
+// FormBody sets a URL-encoded form body
+func (b *RequestBuilder) FormBody(values url.Values) *RequestBuilder {
+	b.setBody(bytesSource([]byte(values.Encode())), "application/x-www-form-urlencoded")
+	return b
+}
+
+// Body sets a raw request body with an explicit content type. Bodies backed by
+// *bytes.Buffer, *bytes.Reader or *strings.Reader can be retried; other readers
+// are sent once unless BufferBody is used.
+func (b *RequestBuilder) Body(r io.Reader, contentType string) *RequestBuilder {
+	src, err := readerSource(r)
+	if err != nil {
+		b.err = err
+		return b
+	}
+
+	b.setBody(src, contentType)
+	return b
+}
+
+// BufferBody reads single-use bodies into memory when the request is built,
+// so that they can be replayed on retry
+func (b *RequestBuilder) BufferBody() *RequestBuilder {
+	b.buffer = true
+	return b
+}
+
+// Gzip compresses the request body and sets Content-Encoding: gzip
+func (b *RequestBuilder) Gzip() *RequestBuilder {
+	b.gzip = true
+	return b
+}
+
+// MultipartField adds a form field to a multipart/form-data body
+func (b *RequestBuilder) MultipartField(name, value string) *RequestBuilder {
+	b.body = nil
+	b.parts = append(b.parts, multipartPart{field: name, value: value})
+	return b
+}
+
+// MultipartFile adds a file part streamed from r to a multipart/form-data body.
+// The content type is guessed from the filename.
+func (b *RequestBuilder) MultipartFile(field, filename string, r io.Reader) *RequestBuilder {
+	src, err := readerSource(r)
+	if err != nil {
+		b.err = err
+		return b
+	}
+
+	b.body = nil
+	b.parts = append(b.parts, multipartPart{
+		field:       field,
+		filename:    filename,
+		contentType: fileContentType(filename),
+		source:      src,
+	})
+	return b
+}
+
+// MultipartFilePath adds a file part read from disk to a multipart/form-data
+// body. The file is reopened on every attempt, so the request can be retried.
+func (b *RequestBuilder) MultipartFilePath(field, path string) *RequestBuilder {
+	src := &bodySource{
+		open: func() (io.ReadCloser, error) {
+			file, err := os.Open(path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to open file %s: %w", path, err)
+			}
+			return file, nil
+		},
+		replayable: true,
+		length:     -1,
+	}
+
+	b.body = nil
+	b.parts = append(b.parts, multipartPart{
+		field:       field,
+		filename:    filepath.Base(path),
+		contentType: fileContentType(path),
+		source:      src,
+	})
+	return b
+}
+
+// setBody replaces any previously configured body
+func (b *RequestBuilder) setBody(src *bodySource, contentType string) {
+	b.body = src
+	b.parts = nil
+	b.contentType = contentType
+}
+
+// bodySource returns the final body source for the request, or nil
+func (b *RequestBuilder) bodySource() (*bodySource, string, error) {
+	src, contentType := b.body, b.contentType
+	if len(b.parts) > 0 {
+		boundary := multipart.NewWriter(io.Discard).Boundary()
+		src = multipartSource(b.parts, boundary)
+		contentType = "multipart/form-data; boundary=" + boundary
+	}
+	if src == nil {
+		return nil, contentType, nil
+	}
+
+	var err error
+	if b.buffer {
+		if src, err = bufferSource(src); err != nil {
+			return nil, "", err
+		}
+	}
+	if b.gzip {
+		if src, err = gzipSource(src); err != nil {
+			return nil, "", err
+		}
+	}
+	return src, contentType, nil
+}
@@ -0,0 +1,156 @@
+package httputil
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jelech/goutils/retryutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestBuilder_FormBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/x-www-form-urlencoded", r.Header.Get("Content-Type"))
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "john", r.PostForm.Get("user"))
+		assert.Equal(t, []string{"a", "b"}, r.PostForm["tag"])
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	resp, err := NewClient().NewRequest().Method("POST").Path(server.URL).
+		FormBody(url.Values{"user": {"john"}, "tag": {"a", "b"}}).
+		Do(context.Background())
+	require.NoError(t, err)
+	resp.Body.Close()
+}
+
+func TestRequestBuilder_Multipart(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "report.csv")
+	require.NoError(t, os.WriteFile(path, []byte("a,b\n1,2\n"), 0644))
+
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseMultipartForm(1<<20))
+		assert.Equal(t, "monthly", r.FormValue("kind"))
+
+		file, header, err := r.FormFile("report")
+		require.NoError(t, err)
+		defer file.Close()
+		data, _ := io.ReadAll(file)
+		assert.Equal(t, "report.csv", header.Filename)
+		assert.Equal(t, "a,b\n1,2\n", string(data))
+		assert.Contains(t, header.Header.Get("Content-Type"), "csv")
+
+		note, header, err := r.FormFile("note")
+		require.NoError(t, err)
+		defer note.Close()
+		data, _ = io.ReadAll(note)
+		assert.Equal(t, "note.bin", header.Filename)
+		assert.Equal(t, "application/octet-stream", header.Header.Get("Content-Type"))
+		assert.Equal(t, "hello", string(data))
+
+		if atomic.AddInt32(&attempts, 1) < 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	resp, err := NewClient().NewRequest().Method("PUT").Path(server.URL).
+		MultipartField("kind", "monthly").
+		MultipartFilePath("report", path).
+		MultipartFile("note", "note.bin", strings.NewReader("hello")).
+		DoWithRetry(context.Background(), retryutil.WithDelay(time.Millisecond))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&attempts))
+	resp.Body.Close()
+}
+
+func TestRequestBuilder_BodyAndGzip(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "text/csv", r.Header.Get("Content-Type"))
+		assert.Equal(t, "gzip", r.Header.Get("Content-Encoding"))
+
+		gz, err := gzip.NewReader(r.Body)
+		require.NoError(t, err)
+		data, _ := io.ReadAll(gz)
+		assert.Equal(t, "x,y\n", string(data))
+
+		if atomic.AddInt32(&attempts, 1) < 2 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	// A plain io.Reader is single-use; BufferBody makes it replayable
+	reader := io.MultiReader(strings.NewReader("x,y\n"))
+	resp, err := NewClient().NewRequest().Method("PUT").Path(server.URL).
+		Body(reader, "text/csv").
+		BufferBody().
+		Gzip().
+		DoWithRetry(context.Background(), retryutil.WithDelay(time.Millisecond))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&attempts))
+	resp.Body.Close()
+}
+
+func TestRequestBuilder_StreamingGzip(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gz, err := gzip.NewReader(r.Body)
+		require.NoError(t, err)
+		data, _ := io.ReadAll(gz)
+		assert.Equal(t, "streamed", string(data))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	req, err := NewClient().NewRequest().Method("POST").Path(server.URL).
+		Body(io.MultiReader(strings.NewReader("streamed")), "text/plain").
+		Gzip().
+		Build(context.Background())
+	require.NoError(t, err)
+	assert.Nil(t, req.GetBody)
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+}
+
+func TestReaderSource(t *testing.T) {
+	src, err := readerSource(bytes.NewBufferString("abc"))
+	require.NoError(t, err)
+	assert.True(t, src.replayable)
+	assert.Equal(t, int64(3), src.length)
+
+	src, err = readerSource(io.MultiReader(strings.NewReader("abc")))
+	require.NoError(t, err)
+	assert.False(t, src.replayable)
+
+	rc, err := src.open()
+	require.NoError(t, err)
+	data, _ := io.ReadAll(rc)
+	assert.Equal(t, "abc", string(data))
+
+	_, err = src.open()
+	assert.ErrorIs(t, err, errBodyNotReplayable)
+}
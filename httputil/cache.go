@@ -0,0 +1,308 @@
+package httputil
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jelech/goutils/cacheutil"
+)
+
+// CacheStatusHeader is set on responses served by the caching middleware.
+// Its value is CacheHit or CacheRevalidated.
+const CacheStatusHeader = "X-Cache"
+
+// Cache status header values
+const (
+	CacheHit         = "HIT"
+	CacheRevalidated = "REVALIDATED"
+)
+
+// CacheOptions configures the response caching middleware
+type CacheOptions struct {
+	AllowPrivate bool          // Store responses marked Cache-Control: private
+	MaxBodySize  int64         // Largest body that is cached (default 1MB)
+	StoreTTL     time.Duration // How long entries are kept for revalidation after going stale (default 24h)
+}
+
+// cachedResponse is a stored response and its freshness information
+type cachedResponse struct {
+	StatusCode int
+	Status     string
+	Header     http.Header
+	Body       []byte
+	StoredAt   time.Time
+	MaxAge     time.Duration
+	NoCache    bool              // Must be revalidated before every use
+	Vary       map[string]string // Request header values named by the response's Vary header
+}
+
+// WithResponseCache enables caching of GET responses in cache, honoring
+// Cache-Control, ETag and Last-Modified
+func WithResponseCache(cache cacheutil.Cache, options *CacheOptions) Option {
+	return WithMiddleware(CacheMiddleware(cache, options))
+}
+
+// CacheMiddleware caches GET responses in cache. Fresh responses are served
+// without a request; stale responses with validators are revalidated with
+// If-None-Match / If-Modified-Since and reused on 304 Not Modified.
+// Requests with other methods invalidate the cached entry for their URL.
+//
+// Entries are partitioned by the request's Authorization header, or by the
+// credentials of the client's authenticator, so responses are only reused
+// for the same credentials, and a stored response is only
+// used when the request headers named by its Vary header match. Responses
+// with Vary: * are not stored.
+func CacheMiddleware(cache cacheutil.Cache, options *CacheOptions) Middleware {
+	config := CacheOptions{}
+	if options != nil {
+		config = *options
+	}
+	if config.MaxBodySize <= 0 {
+		config.MaxBodySize = 1 << 20
+	}
+	if config.StoreTTL <= 0 {
+		config.StoreTTL = time.Hour * 24
+	}
+
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			key := cacheKey(req)
+
+			if req.Method != http.MethodGet {
+				resp, err := next.RoundTrip(req)
+				if err == nil && req.Method != http.MethodHead && resp.StatusCode < 400 {
+					cache.Delete(key)
+				}
+				return resp, err
+			}
+
+			reqDirectives := parseCacheControl(req.Header.Get("Cache-Control"))
+			if _, ok := reqDirectives["no-store"]; ok || hasConditionalHeaders(req) {
+				return next.RoundTrip(req)
+			}
+
+			var entry *cachedResponse
+			if value, ok := cache.Get(key); ok {
+				entry, _ = value.(*cachedResponse)
+			}
+			if entry != nil && !entry.matches(req) {
+				entry = nil
+			}
+
+			_, reqNoCache := reqDirectives["no-cache"]
+			if entry != nil && !reqNoCache && !entry.NoCache && time.Since(entry.StoredAt) < entry.MaxAge {
+				return entry.response(req, CacheHit), nil
+			}
+
+			outReq := req
+			if entry != nil {
+				outReq = req.Clone(req.Context())
+				if etag := entry.Header.Get("ETag"); etag != "" {
+					outReq.Header.Set("If-None-Match", etag)
+				}
+				if lastModified := entry.Header.Get("Last-Modified"); lastModified != "" {
+					outReq.Header.Set("If-Modified-Since", lastModified)
+				}
+			}
+
+			resp, err := next.RoundTrip(outReq)
+			if err != nil {
+				return nil, err
+			}
+
+			if entry != nil && resp.StatusCode == http.StatusNotModified {
+				drainAndClose(resp)
+
+				// Copy rather than mutate, other requests may be reading the entry
+				updated := *entry
+				updated.Header = entry.Header.Clone()
+				for k, values := range resp.Header {
+					updated.Header[k] = values
+				}
+				updated.StoredAt = time.Now()
+				updated.MaxAge, updated.NoCache, _ = freshness(updated.Header, config.AllowPrivate)
+				cache.Set(key, &updated, config.StoreTTL)
+				return updated.response(req, CacheRevalidated), nil
+			}
+
+			return storeResponse(cache, key, req, resp, config), nil
+		})
+	}
+}
+
+// storeResponse caches resp if it is cacheable and returns a response whose
+// body can still be read by the caller
+func storeResponse(cache cacheutil.Cache, key string, req *http.Request, resp *http.Response, config CacheOptions) *http.Response {
+	if resp.StatusCode != http.StatusOK {
+		return resp
+	}
+	vary, ok := varyValues(req, resp.Header)
+	if !ok {
+		return resp
+	}
+
+	maxAge, noCache, cacheable := freshness(resp.Header, config.AllowPrivate)
+	hasValidators := resp.Header.Get("ETag") != "" || resp.Header.Get("Last-Modified") != ""
+	if !cacheable || (maxAge <= 0 && !hasValidators) {
+		return resp
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, config.MaxBodySize+1))
+	if err != nil || int64(len(body)) > config.MaxBodySize {
+		// Too large or broken; hand the caller what was read plus the rest
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+		return resp
+	}
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	cache.Set(key, &cachedResponse{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Header:     resp.Header.Clone(),
+		Body:       body,
+		StoredAt:   time.Now(),
+		MaxAge:     maxAge,
+		NoCache:    noCache,
+		Vary:       vary,
+	}, config.StoreTTL)
+
+	return resp
+}
+
+// cacheKey returns the cache key of req: its URL, partitioned by a hash of
+// the Authorization header so credentials never share entries. Requests of
+// WithEndpoints clients are authenticated after the middleware, so their
+// credentials come from the request context instead.
+func cacheKey(req *http.Request) string {
+	key := "httpcache:" + req.URL.String()
+	auth := req.Header.Get("Authorization")
+	if auth == "" {
+		auth, _ = req.Context().Value(credentialsKey{}).(string)
+	}
+	if auth != "" {
+		sum := sha256.Sum256([]byte(auth))
+		key += "#auth=" + hex.EncodeToString(sum[:])
+	}
+	return key
+}
+
+// varyValues records the request header values named by the response's
+// Vary header. It returns false for Vary: *, which never matches.
+func varyValues(req *http.Request, header http.Header) (map[string]string, bool) {
+	var values map[string]string
+	for _, field := range header.Values("Vary") {
+		for _, name := range strings.Split(field, ",") {
+			name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+			if name == "" {
+				continue
+			}
+			if name == "*" {
+				return nil, false
+			}
+			if values == nil {
+				values = make(map[string]string)
+			}
+			values[name] = strings.Join(req.Header.Values(name), ", ")
+		}
+	}
+	return values, true
+}
+
+// matches reports whether req has the header values the entry varies on
+func (e *cachedResponse) matches(req *http.Request) bool {
+	for name, value := range e.Vary {
+		if strings.Join(req.Header.Values(name), ", ") != value {
+			return false
+		}
+	}
+	return true
+}
+
+// response builds a new *http.Response from the cache entry
+func (e *cachedResponse) response(req *http.Request, status string) *http.Response {
+	header := e.Header.Clone()
+	header.Set(CacheStatusHeader, status)
+
+	return &http.Response{
+		Status:        e.Status,
+		StatusCode:    e.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
+
+// freshness returns the freshness lifetime of a response, whether it must be
+// revalidated on every use, and whether it may be stored at all
+func freshness(header http.Header, allowPrivate bool) (maxAge time.Duration, noCache bool, cacheable bool) {
+	directives := parseCacheControl(header.Get("Cache-Control"))
+
+	if _, ok := directives["no-store"]; ok {
+		return 0, false, false
+	}
+	if _, ok := directives["private"]; ok && !allowPrivate {
+		return 0, false, false
+	}
+	_, noCache = directives["no-cache"]
+
+	if value, ok := directives["max-age"]; ok {
+		seconds, err := strconv.ParseInt(value, 10, 64)
+		if err == nil && seconds > 0 {
+			return time.Duration(seconds) * time.Second, noCache, true
+		}
+		return 0, noCache, true
+	}
+
+	if expires := header.Get("Expires"); expires != "" {
+		expiresAt, err := http.ParseTime(expires)
+		if err != nil {
+			return 0, noCache, true
+		}
+		date := time.Now()
+		if d, err := http.ParseTime(header.Get("Date")); err == nil {
+			date = d
+		}
+		if expiresAt.After(date) {
+			return expiresAt.Sub(date), noCache, true
+		}
+	}
+
+	return 0, noCache, true
+}
+
+// parseCacheControl parses a Cache-Control header into lower-cased directives
+func parseCacheControl(value string) map[string]string {
+	directives := make(map[string]string)
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, arg := part, ""
+		if i := strings.IndexByte(part, '='); i >= 0 {
+			name, arg = part[:i], strings.Trim(part[i+1:], `"`)
+		}
+		directives[strings.ToLower(strings.TrimSpace(name))] = arg
+	}
+	return directives
+}
+
+// hasConditionalHeaders reports whether the caller is managing validators itself
+func hasConditionalHeaders(req *http.Request) bool {
+	return req.Header.Get("If-None-Match") != "" || req.Header.Get("If-Modified-Since") != "" ||
+		req.Header.Get("Range") != ""
+}
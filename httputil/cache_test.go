@@ -0,0 +1,265 @@
+package httputil
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jelech/goutils/cacheutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readAll(t *testing.T, resp *http.Response) string {
+	t.Helper()
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestCacheMiddleware_MaxAge(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte("config-v1"))
+	}))
+	defer server.Close()
+
+	client := NewClient(WithResponseCache(cacheutil.NewLRUCache(10), nil))
+
+	resp, err := client.Get(server.URL)
+	require.NoError(t, err)
+	assert.Equal(t, "config-v1", readAll(t, resp))
+	assert.Equal(t, "", resp.Header.Get(CacheStatusHeader))
+
+	resp, err = client.Get(server.URL)
+	require.NoError(t, err)
+	assert.Equal(t, "config-v1", readAll(t, resp))
+	assert.Equal(t, CacheHit, resp.Header.Get(CacheStatusHeader))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+
+	// Unsafe methods invalidate the entry
+	resp, err = client.Post(server.URL, map[string]string{})
+	require.NoError(t, err)
+	readAll(t, resp)
+
+	resp, err = client.Get(server.URL)
+	require.NoError(t, err)
+	readAll(t, resp)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&requests))
+}
+
+func TestCacheMiddleware_ETagRevalidation(t *testing.T) {
+	var requests, notModified int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Cache-Control", "no-cache")
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			atomic.AddInt32(&notModified, 1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte(`{"flag": true}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(WithResponseCache(cacheutil.NewMemoryCache(), nil))
+
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get(server.URL)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, `{"flag": true}`, readAll(t, resp))
+		if i > 0 {
+			assert.Equal(t, CacheRevalidated, resp.Header.Get(CacheStatusHeader))
+		}
+	}
+
+	assert.Equal(t, int32(3), atomic.LoadInt32(&requests))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&notModified))
+}
+
+func TestCacheMiddleware_LastModified(t *testing.T) {
+	lastModified := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).Format(http.TimeFormat)
+	var notModified int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Last-Modified", lastModified)
+		if r.Header.Get("If-Modified-Since") == lastModified {
+			atomic.AddInt32(&notModified, 1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte("body"))
+	}))
+	defer server.Close()
+
+	client := NewClient(WithResponseCache(cacheutil.NewMemoryCache(), nil))
+	for i := 0; i < 2; i++ {
+		resp, err := client.NewRequest().Path(server.URL).Do(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "body", readAll(t, resp))
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&notModified))
+}
+
+func TestCacheMiddleware_NotStored(t *testing.T) {
+	tests := []struct {
+		name         string
+		cacheControl string
+		options      *CacheOptions
+		requests     int32
+	}{
+		{name: "no-store", cacheControl: "no-store, max-age=60", requests: 2},
+		{name: "private", cacheControl: "private, max-age=60", requests: 2},
+		{name: "private allowed", cacheControl: "private, max-age=60", options: &CacheOptions{AllowPrivate: true}, requests: 1},
+		{name: "no validators", cacheControl: "", requests: 2},
+		{name: "too large", cacheControl: "max-age=60", options: &CacheOptions{MaxBodySize: 2}, requests: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&requests, 1)
+				if tt.cacheControl != "" {
+					w.Header().Set("Cache-Control", tt.cacheControl)
+				}
+				w.Write([]byte("payload"))
+			}))
+			defer server.Close()
+
+			client := NewClient(WithResponseCache(cacheutil.NewMemoryCache(), tt.options))
+			for i := 0; i < 2; i++ {
+				resp, err := client.Get(server.URL)
+				require.NoError(t, err)
+				assert.Equal(t, "payload", readAll(t, resp))
+			}
+			assert.Equal(t, tt.requests, atomic.LoadInt32(&requests))
+		})
+	}
+}
+
+func TestCacheMiddleware_Vary(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Vary", "Accept")
+		w.Write([]byte(r.Header.Get("Accept")))
+	}))
+	defer server.Close()
+
+	client := NewClient(WithResponseCache(cacheutil.NewLRUCache(10), nil))
+	get := func(accept string) *http.Response {
+		resp, err := client.NewRequest().Path(server.URL).Header("Accept", accept).Do(context.Background())
+		require.NoError(t, err)
+		return resp
+	}
+
+	assert.Equal(t, "application/json", readAll(t, get("application/json")))
+	resp := get("text/csv")
+	assert.Equal(t, "", resp.Header.Get(CacheStatusHeader))
+	assert.Equal(t, "text/csv", readAll(t, resp))
+	resp = get("text/csv")
+	assert.Equal(t, CacheHit, resp.Header.Get(CacheStatusHeader))
+	assert.Equal(t, "text/csv", readAll(t, resp))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+}
+
+func TestCacheMiddleware_PartitionsByAuthorization(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Header().Set("Cache-Control", "private, max-age=60")
+		w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	defer server.Close()
+
+	client := NewClient(WithResponseCache(cacheutil.NewLRUCache(10), &CacheOptions{AllowPrivate: true}))
+	get := func(auth string) *http.Response {
+		resp, err := client.NewRequest().Path(server.URL).Header("Authorization", auth).Do(context.Background())
+		require.NoError(t, err)
+		return resp
+	}
+
+	assert.Equal(t, "Bearer alice", readAll(t, get("Bearer alice")))
+	assert.Equal(t, "Bearer bob", readAll(t, get("Bearer bob")))
+	resp := get("Bearer alice")
+	assert.Equal(t, CacheHit, resp.Header.Get(CacheStatusHeader))
+	assert.Equal(t, "Bearer alice", readAll(t, resp))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+}
+
+func TestVaryValues(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	values, ok := varyValues(req, http.Header{"Vary": {"accept-encoding, Accept"}})
+	require.True(t, ok)
+	assert.Equal(t, map[string]string{"Accept-Encoding": "gzip", "Accept": ""}, values)
+
+	_, ok = varyValues(req, http.Header{"Vary": {"*"}})
+	assert.False(t, ok)
+}
+
+func TestFreshness(t *testing.T) {
+	now := time.Now().UTC()
+	header := http.Header{}
+	header.Set("Date", now.Format(http.TimeFormat))
+	header.Set("Expires", now.Add(time.Minute).Format(http.TimeFormat))
+
+	maxAge, noCache, cacheable := freshness(header, false)
+	assert.Equal(t, time.Minute, maxAge)
+	assert.False(t, noCache)
+	assert.True(t, cacheable)
+
+	header.Set("Cache-Control", "public, max-age=10")
+	maxAge, _, _ = freshness(header, false)
+	assert.Equal(t, time.Second*10, maxAge)
+}
+
+func TestParseCacheControl(t *testing.T) {
+	directives := parseCacheControl(`Max-Age=30, no-cache, private="Set-Cookie"`)
+	assert.Equal(t, "30", directives["max-age"])
+	assert.Contains(t, directives, "no-cache")
+	assert.Equal(t, "Set-Cookie", directives["private"])
+}
+
+func TestCacheMiddleware_PartitionsEndpointCredentials(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Header().Set("Cache-Control", "private, max-age=60")
+		w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	defer server.Close()
+
+	cache := cacheutil.NewLRUCache(10)
+	newClient := func(token string) *Client {
+		return NewClient(
+			WithEndpoints([]string{server.URL}, nil),
+			WithAuthenticator(BearerToken(token)),
+			WithResponseCache(cache, &CacheOptions{AllowPrivate: true}),
+		)
+	}
+	alice, bob := newClient("alice"), newClient("bob")
+	get := func(client *Client) *http.Response {
+		resp, err := client.NewRequest().Path("/data").Do(context.Background())
+		require.NoError(t, err)
+		return resp
+	}
+
+	assert.Equal(t, "Bearer alice", readAll(t, get(alice)))
+	assert.Equal(t, "Bearer bob", readAll(t, get(bob)))
+	resp := get(alice)
+	assert.Equal(t, CacheHit, resp.Header.Get(CacheStatusHeader))
+	assert.Equal(t, "Bearer alice", readAll(t, resp))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+}
@@ -2,11 +2,9 @@
 package httputil
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
 	"time"
 
@@ -15,9 +13,16 @@ import (
 
 // Client represents an HTTP client with retry capabilities
 type Client struct {
-	client  *http.Client
-	baseURL string
-	headers map[string]string
+	client           *http.Client
+	baseURL          string
+	headers          map[string]string
+	maxErrorBodySize int64
+	errorPayload     func() interface{}
+	middlewares      []Middleware
+	auth             Authenticator
+	retryOptions     []retryutil.Option
+	transportOptions []transportOption
+	balancer         *loadBalancer
 }
 
 // Option represents a configuration option for HTTP client
@@ -56,19 +61,46 @@ func WithHTTPClient(client *http.Client) Option {
 	}
 }
 
+// WithMaxErrorBodySize limits how many bytes of an error response body are kept in HTTPError
+func WithMaxErrorBodySize(size int64) Option {
+	return func(c *Client) {
+		c.maxErrorBodySize = size
+	}
+}
+
+// WithErrorPayload sets a constructor for the struct that error response bodies
+// are decoded into. The decoded value is exposed as HTTPError.Payload.
+func WithErrorPayload(newPayload func() interface{}) Option {
+	return func(c *Client) {
+		c.errorPayload = newPayload
+	}
+}
+
+// WithRetry sets the default retry options used by DoWithRetry, streaming and
+// download helpers. Options passed per call take precedence.
+func WithRetry(options ...retryutil.Option) Option {
+	return func(c *Client) {
+		c.retryOptions = append(c.retryOptions, options...)
+	}
+}
+
 // NewClient creates a new HTTP client with the given options
 func NewClient(options ...Option) *Client {
 	client := &Client{
 		client: &http.Client{
 			Timeout: time.Second * 30,
 		},
-		headers: make(map[string]string),
+		headers:          make(map[string]string),
+		maxErrorBodySize: defaultMaxErrorBodySize,
 	}
 
 	for _, option := range options {
 		option(client)
 	}
 
+	client.applyTransport()
+	client.applyMiddleware()
+
 	return client
 }
 
@@ -94,33 +126,7 @@ func (c *Client) Delete(url string) (*http.Response, error) {
 
 // Request performs an HTTP request with the specified method, URL, and body
 func (c *Client) Request(method, url string, body interface{}) (*http.Response, error) {
-	fullURL := c.buildURL(url)
-
-	var bodyReader io.Reader
-	if body != nil {
-		bodyBytes, err := json.Marshal(body)
-		if err != nil {
-			return nil, fmt.Errorf("failed to marshal request body: %w", err)
-		}
-		bodyReader = bytes.NewReader(bodyBytes)
-	}
-
-	req, err := http.NewRequest(method, fullURL, bodyReader)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	// Set default headers
-	for k, v := range c.headers {
-		req.Header.Set(k, v)
-	}
-
-	// Set content type for JSON body
-	if body != nil {
-		req.Header.Set("Content-Type", "application/json")
-	}
-
-	return c.client.Do(req)
+	return c.RequestWithContext(context.Background(), method, url, body)
 }
 
 // GetWithRetry performs a GET request with retry logic
@@ -133,68 +139,81 @@ func (c *Client) PostWithRetry(url string, body interface{}, maxAttempts int) (*
 	return c.RequestWithRetry("POST", url, body, maxAttempts)
 }
 
-// RequestWithRetry performs an HTTP request with retry logic
+// RequestWithRetry performs an HTTP request with retry logic.
+// Unlike RequestWithRetryContext it retries any method, for compatibility.
 func (c *Client) RequestWithRetry(method, url string, body interface{}, maxAttempts int) (*http.Response, error) {
-	var response *http.Response
-	var lastErr error
-
-	err := retryutil.Do(func() error {
-		resp, err := c.Request(method, url, body)
-		if err != nil {
-			lastErr = err
-			return err
-		}
-
-		// Check if the response indicates a retryable error
-		if c.isRetryableStatusCode(resp.StatusCode) {
-			resp.Body.Close()
-			lastErr = fmt.Errorf("HTTP %d: %s", resp.StatusCode, resp.Status)
-			return lastErr
-		}
-
-		response = resp
-		return nil
-	}, retryutil.WithMaxAttempts(maxAttempts), retryutil.WithRetryIf(func(err error) bool {
-		// Retry on network errors and 5xx status codes
-		return true
-	}))
+	ctx := context.Background()
+	builder := c.NewRequest().Method(method).Path(url)
+	if body != nil {
+		builder.JSONBody(body)
+	}
 
+	req, err := builder.Build(ctx)
 	if err != nil {
-		return nil, lastErr
+		return nil, err
 	}
 
-	return response, nil
+	return c.doWithRetry(ctx, req, true, retryutil.WithMaxAttempts(maxAttempts))
 }
 
 // RequestWithContext performs an HTTP request with context
 func (c *Client) RequestWithContext(ctx context.Context, method, url string, body interface{}) (*http.Response, error) {
-	fullURL := c.buildURL(url)
-
-	var bodyReader io.Reader
+	builder := c.NewRequest().Method(method).Path(url)
 	if body != nil {
-		bodyBytes, err := json.Marshal(body)
-		if err != nil {
-			return nil, fmt.Errorf("failed to marshal request body: %w", err)
-		}
-		bodyReader = bytes.NewReader(bodyBytes)
+		builder.JSONBody(body)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, method, fullURL, bodyReader)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
+	return builder.Do(ctx)
+}
 
-	// Set default headers
-	for k, v := range c.headers {
-		req.Header.Set(k, v)
+// Do sends a prepared request using the client's underlying HTTP client.
+// The client's authenticator, if any, is applied to a copy of req; with
+// WithEndpoints the load balancer applies it instead, per attempt. A 401
+// response calls the authenticator's Invalidate method, if it has one.
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	if c.auth != nil && c.balancer == nil {
+		req = req.Clone(req.Context())
+		if err := c.auth.Authenticate(req); err != nil {
+			return nil, fmt.Errorf("failed to authenticate request: %w", err)
+		}
+	} else if c.auth != nil {
+		// Middleware runs before the balancer authenticates, so pass the
+		// credentials on for the response cache to partition by
+		credentials, err := c.credentials(req)
+		if err != nil {
+			return nil, err
+		}
+		if credentials != "" {
+			req = req.WithContext(context.WithValue(req.Context(), credentialsKey{}, credentials))
+		}
 	}
 
-	// Set content type for JSON body
-	if body != nil {
-		req.Header.Set("Content-Type", "application/json")
+	resp, err := c.client.Do(req)
+	if err == nil && resp.StatusCode == http.StatusUnauthorized {
+		// Drop cached credentials, such as an OAuth2 token, that were rejected
+		if invalidator, ok := c.auth.(interface{ Invalidate() }); ok {
+			invalidator.Invalidate()
+		}
 	}
+	return resp, err
+}
 
-	return c.client.Do(req)
+// credentialsKey is the context key of the Authorization value that
+// WithEndpoints clients apply later in the balancer
+type credentialsKey struct{}
+
+// credentials returns the Authorization header the authenticator sets for
+// req. The request body is left untouched, so body signatures differ from
+// the real request; the value only identifies the credentials.
+func (c *Client) credentials(req *http.Request) (string, error) {
+	probe := req.Clone(req.Context())
+	probe.Body = http.NoBody
+	probe.GetBody = nil
+	probe.ContentLength = 0
+	if err := c.auth.Authenticate(probe); err != nil {
+		return "", fmt.Errorf("failed to authenticate request: %w", err)
+	}
+	return probe.Header.Get("Authorization"), nil
 }
 
 // DecodeJSON decodes JSON response body into the provided interface
@@ -202,8 +221,7 @@ func (c *Client) DecodeJSON(resp *http.Response, v interface{}) error {
 	defer resp.Body.Close()
 
 	if resp.StatusCode >= 400 {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(bodyBytes))
+		return c.newHTTPError(resp)
 	}
 
 	decoder := json.NewDecoder(resp.Body)
@@ -216,6 +234,10 @@ func (c *Client) buildURL(url string) string {
 		return url
 	}
 
+	if url == "" {
+		return c.baseURL
+	}
+
 	baseURL := c.baseURL
 	if baseURL[len(baseURL)-1] == '/' {
 		baseURL = baseURL[:len(baseURL)-1]
@@ -235,6 +257,11 @@ func isAbsoluteURL(url string) bool {
 
 // isRetryableStatusCode checks if the HTTP status code is retryable
 func (c *Client) isRetryableStatusCode(statusCode int) bool {
+	return isRetryableStatusCode(statusCode)
+}
+
+// isRetryableStatusCode reports whether a status code indicates a transient failure
+func isRetryableStatusCode(statusCode int) bool {
 	switch statusCode {
 	case http.StatusInternalServerError,
 		http.StatusBadGateway,
@@ -0,0 +1,115 @@
+package httputil
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// defaultMaxErrorBodySize is the default number of error body bytes kept in HTTPError
+const defaultMaxErrorBodySize = 64 * 1024
+
+// HTTPError represents a response with a 4xx or 5xx status code
+type HTTPError struct {
+	StatusCode int
+	Status     string
+	Header     http.Header
+	Body       []byte      // Raw response body, bounded by the client's max error body size
+	Truncated  bool        // Whether Body was cut off at the size limit
+	Payload    interface{} // Decoded error body, set when the client has an error payload type
+}
+
+// Error implements the error interface
+func (e *HTTPError) Error() string {
+	if len(e.Body) == 0 {
+		return fmt.Sprintf("HTTP %d: %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("HTTP %d: %s", e.StatusCode, string(e.Body))
+}
+
+// newHTTPError reads a bounded amount of the response body and builds an HTTPError.
+// The caller remains responsible for closing the response body.
+func (c *Client) newHTTPError(resp *http.Response) *HTTPError {
+	limit := c.maxErrorBodySize
+	if limit <= 0 {
+		limit = defaultMaxErrorBodySize
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	truncated := int64(len(body)) > limit
+	if truncated {
+		body = body[:limit]
+	}
+
+	httpErr := &HTTPError{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Header:     resp.Header,
+		Body:       body,
+		Truncated:  truncated,
+	}
+
+	if c.errorPayload != nil && len(body) > 0 && !truncated {
+		payload := c.errorPayload()
+		if err := json.Unmarshal(body, payload); err == nil {
+			httpErr.Payload = payload
+		}
+	}
+
+	return httpErr
+}
+
+// AsHTTPError extracts an *HTTPError from err if there is one
+func AsHTTPError(err error) (*HTTPError, bool) {
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr, true
+	}
+	return nil, false
+}
+
+// StatusCode returns the HTTP status code carried by err, or 0 if there is none
+func StatusCode(err error) int {
+	if httpErr, ok := AsHTTPError(err); ok {
+		return httpErr.StatusCode
+	}
+	return 0
+}
+
+// IsNotFound reports whether err is an HTTP 404 error
+func IsNotFound(err error) bool {
+	return StatusCode(err) == http.StatusNotFound
+}
+
+// IsUnauthorized reports whether err is an HTTP 401 error
+func IsUnauthorized(err error) bool {
+	return StatusCode(err) == http.StatusUnauthorized
+}
+
+// IsForbidden reports whether err is an HTTP 403 error
+func IsForbidden(err error) bool {
+	return StatusCode(err) == http.StatusForbidden
+}
+
+// IsConflict reports whether err is an HTTP 409 error
+func IsConflict(err error) bool {
+	return StatusCode(err) == http.StatusConflict
+}
+
+// IsClientError reports whether err is an HTTP 4xx error
+func IsClientError(err error) bool {
+	code := StatusCode(err)
+	return code >= 400 && code < 500
+}
+
+// IsServerError reports whether err is an HTTP 5xx error
+func IsServerError(err error) bool {
+	return StatusCode(err) >= 500
+}
+
+// IsRetryable reports whether err is an HTTP error with a retryable status code
+func IsRetryable(err error) bool {
+	return isRetryableStatusCode(StatusCode(err))
+}
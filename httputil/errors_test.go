@@ -0,0 +1,83 @@
+package httputil
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type apiError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func TestClient_DecodeJSON_HTTPError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Trace-ID", "trace-1")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"code": "user_not_found", "message": "no such user"}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(WithErrorPayload(func() interface{} { return &apiError{} }))
+	resp, err := client.Get(server.URL)
+	require.NoError(t, err)
+
+	var result map[string]interface{}
+	err = client.DecodeJSON(resp, &result)
+	require.Error(t, err)
+
+	httpErr, ok := AsHTTPError(err)
+	require.True(t, ok)
+	assert.Equal(t, http.StatusNotFound, httpErr.StatusCode)
+	assert.Equal(t, "trace-1", httpErr.Header.Get("X-Trace-ID"))
+	assert.False(t, httpErr.Truncated)
+
+	payload, ok := httpErr.Payload.(*apiError)
+	require.True(t, ok)
+	assert.Equal(t, "user_not_found", payload.Code)
+}
+
+func TestHTTPError_Truncated(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(strings.Repeat("x", 100)))
+	}))
+	defer server.Close()
+
+	client := NewClient(WithMaxErrorBodySize(10))
+	resp, err := client.Get(server.URL)
+	require.NoError(t, err)
+
+	err = client.DecodeJSON(resp, &struct{}{})
+	httpErr, ok := AsHTTPError(err)
+	require.True(t, ok)
+	assert.Len(t, httpErr.Body, 10)
+	assert.True(t, httpErr.Truncated)
+	assert.Nil(t, httpErr.Payload)
+}
+
+func TestHTTPErrorHelpers(t *testing.T) {
+	wrap := func(code int) error {
+		return fmt.Errorf("call failed: %w", &HTTPError{StatusCode: code})
+	}
+
+	assert.True(t, IsNotFound(wrap(http.StatusNotFound)))
+	assert.True(t, IsUnauthorized(wrap(http.StatusUnauthorized)))
+	assert.True(t, IsForbidden(wrap(http.StatusForbidden)))
+	assert.True(t, IsConflict(wrap(http.StatusConflict)))
+	assert.True(t, IsClientError(wrap(http.StatusBadRequest)))
+	assert.True(t, IsServerError(wrap(http.StatusBadGateway)))
+	assert.True(t, IsRetryable(wrap(http.StatusServiceUnavailable)))
+	assert.False(t, IsRetryable(wrap(http.StatusBadRequest)))
+
+	plain := fmt.Errorf("network down")
+	assert.False(t, IsNotFound(plain))
+	assert.Equal(t, 0, StatusCode(plain))
+	assert.Equal(t, 0, StatusCode(nil))
+}
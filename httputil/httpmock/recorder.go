@@ -0,0 +1,318 @@
+package httpmock
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/jelech/goutils/httputil"
+)
+
+// Mode selects whether a Recorder talks to the network
+type Mode int
+
+const (
+	// ModeReplay serves responses from the golden file and never uses the network
+	ModeReplay Mode = iota
+	// ModeRecord forwards requests and records the interactions
+	ModeRecord
+	// ModeAuto replays if the golden file exists and records otherwise
+	ModeAuto
+)
+
+// ErrNoInteraction is returned in replay mode when no recorded interaction matches
+var ErrNoInteraction = errors.New("httpmock: no recorded interaction matches request")
+
+// RecordedRequest is the request half of an interaction
+type RecordedRequest struct {
+	Method     string      `json:"method"`
+	URL        string      `json:"url"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+	BodyBase64 string      `json:"body_base64,omitempty"`
+}
+
+// RecordedResponse is the response half of an interaction
+type RecordedResponse struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+	BodyBase64 string      `json:"body_base64,omitempty"`
+}
+
+// Interaction is a recorded request and its response
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// Recorder is an http.RoundTripper that records interactions to a golden
+// file or replays them from it, so tests can run offline
+type Recorder struct {
+	path string
+	mode Mode
+
+	mu           sync.Mutex
+	interactions []Interaction
+	used         []bool
+}
+
+// NewRecorder creates a recorder for the golden file at path. In replay mode
+// the file must exist. ModeAuto resolves to replay or record at creation time.
+func NewRecorder(path string, mode Mode) (*Recorder, error) {
+	r := &Recorder{path: path, mode: mode}
+
+	if mode == ModeAuto {
+		r.mode = ModeRecord
+		if _, err := os.Stat(path); err == nil {
+			r.mode = ModeReplay
+		}
+	}
+
+	if r.mode == ModeReplay {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read golden file %s: %w", path, err)
+		}
+		if err := json.Unmarshal(data, &r.interactions); err != nil {
+			return nil, fmt.Errorf("failed to parse golden file %s: %w", path, err)
+		}
+		r.used = make([]bool, len(r.interactions))
+	}
+
+	return r, nil
+}
+
+// Mode returns the effective mode of the recorder
+func (r *Recorder) Mode() Mode {
+	return r.mode
+}
+
+// Middleware returns an httputil middleware that routes requests through the
+// recorder. Each client forwards recorded requests to its own transport chain.
+func (r *Recorder) Middleware() httputil.Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return httputil.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return r.roundTrip(req, next)
+		})
+	}
+}
+
+// Interactions returns the recorded or loaded interactions
+func (r *Recorder) Interactions() []Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]Interaction(nil), r.interactions...)
+}
+
+// RoundTrip implements http.RoundTripper, recording through http.DefaultTransport
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	return r.roundTrip(req, http.DefaultTransport)
+}
+
+// roundTrip replays req or records it by forwarding it to next
+func (r *Recorder) roundTrip(req *http.Request, next http.RoundTripper) (*http.Response, error) {
+	// RoundTrippers must not modify the caller's request
+	req = req.Clone(req.Context())
+	reqBody, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.mode == ModeReplay {
+		return r.replay(req, reqBody)
+	}
+	return r.record(req, reqBody, next)
+}
+
+// Save writes recorded interactions to the golden file. It does nothing in replay mode.
+func (r *Recorder) Save() error {
+	if r.mode == ModeReplay {
+		return nil
+	}
+
+	r.mu.Lock()
+	data, err := json.MarshalIndent(r.interactions, "", "  ")
+	r.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to encode interactions: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(r.path), 0755); err != nil {
+		return fmt.Errorf("failed to create directories: %w", err)
+	}
+	if err := os.WriteFile(r.path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write golden file %s: %w", r.path, err)
+	}
+	return nil
+}
+
+// record forwards the request and stores the interaction
+func (r *Recorder) record(req *http.Request, reqBody []byte, next http.RoundTripper) (*http.Response, error) {
+	resp, err := next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	interaction := Interaction{
+		Request: RecordedRequest{
+			Method: req.Method,
+			URL:    req.URL.String(),
+			Header: httputil.RedactHeaders(req.Header),
+		},
+		Response: RecordedResponse{
+			StatusCode: resp.StatusCode,
+			Header:     httputil.RedactHeaders(resp.Header),
+		},
+	}
+	interaction.Request.Body, interaction.Request.BodyBase64 = encodeBody(reqBody)
+	interaction.Response.Body, interaction.Response.BodyBase64 = encodeBody(respBody)
+
+	r.mu.Lock()
+	r.interactions = append(r.interactions, interaction)
+	r.mu.Unlock()
+
+	return resp, nil
+}
+
+// replay returns the first unused interaction matching method, URL and body.
+// Multipart bodies are compared part by part, since the boundary is random.
+func (r *Recorder) replay(req *http.Request, reqBody []byte) (*http.Response, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, interaction := range r.interactions {
+		if r.used[i] || interaction.Request.Method != req.Method || interaction.Request.URL != req.URL.String() {
+			continue
+		}
+		recordedBody, err := decodeBody(interaction.Request.Body, interaction.Request.BodyBase64)
+		if err != nil || !bodiesMatch(interaction.Request.Header, recordedBody, req.Header, reqBody) {
+			continue
+		}
+
+		respBody, err := decodeBody(interaction.Response.Body, interaction.Response.BodyBase64)
+		if err != nil {
+			return nil, fmt.Errorf("httpmock: invalid recorded body: %w", err)
+		}
+		r.used[i] = true
+
+		header := interaction.Response.Header.Clone()
+		if header == nil {
+			header = make(http.Header)
+		}
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", interaction.Response.StatusCode, http.StatusText(interaction.Response.StatusCode)),
+			StatusCode:    interaction.Response.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        header,
+			Body:          io.NopCloser(bytes.NewReader(respBody)),
+			ContentLength: int64(len(respBody)),
+			Request:       req,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s %s", ErrNoInteraction, req.Method, req.URL)
+}
+
+// bodiesMatch reports whether a recorded request body equals body. Multipart
+// bodies match when their parts have the same headers and contents.
+func bodiesMatch(recordedHeader http.Header, recorded []byte, header http.Header, body []byte) bool {
+	if bytes.Equal(recorded, body) {
+		return true
+	}
+	recordedParts, ok := multipartParts(recordedHeader, recorded)
+	if !ok {
+		return false
+	}
+	parts, ok := multipartParts(header, body)
+	return ok && reflect.DeepEqual(recordedParts, parts)
+}
+
+// multipartPart is a decoded part of a multipart body
+type multipartPart struct {
+	Header textproto.MIMEHeader
+	Body   []byte
+}
+
+// multipartParts splits a multipart body into its parts, or returns false if
+// the body is not multipart
+func multipartParts(header http.Header, body []byte) ([]multipartPart, bool) {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") || params["boundary"] == "" {
+		return nil, false
+	}
+
+	reader := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	var parts []multipartPart
+	for {
+		part, err := reader.NextRawPart()
+		if err == io.EOF {
+			return parts, true
+		}
+		if err != nil {
+			return nil, false
+		}
+		data, err := io.ReadAll(part)
+		if err != nil {
+			return nil, false
+		}
+		parts = append(parts, multipartPart{Header: part.Header, Body: data})
+	}
+}
+
+// readRequestBody reads the request body and restores it for forwarding
+func readRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request body: %w", err)
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// encodeBody stores text bodies as strings and binary bodies as base64
+func encodeBody(body []byte) (text string, encoded string) {
+	if utf8.Valid(body) {
+		return string(body), ""
+	}
+	return "", base64.StdEncoding.EncodeToString(body)
+}
+
+// decodeBody reverses encodeBody
+func decodeBody(text, encoded string) ([]byte, error) {
+	if encoded != "" {
+		return base64.StdEncoding.DecodeString(encoded)
+	}
+	if text == "" {
+		return nil, nil
+	}
+	return []byte(text), nil
+}
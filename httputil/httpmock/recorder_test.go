@@ -0,0 +1,157 @@
+package httpmock
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jelech/goutils/httputil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecorder_RecordAndReplay(t *testing.T) {
+	server := NewServer()
+	server.On("GET", "/config").ReplyJSON(http.StatusOK, map[string]bool{"enabled": true})
+	server.On("POST", "/blobs").ReplyString(http.StatusCreated, "\xff\xfe binary")
+
+	golden := filepath.Join(t.TempDir(), "testdata", "config.json")
+
+	recorder, err := NewRecorder(golden, ModeAuto)
+	require.NoError(t, err)
+	assert.Equal(t, ModeRecord, recorder.Mode())
+
+	client := httputil.NewClient(
+		httputil.WithBaseURL(server.URL),
+		httputil.WithAuthenticator(httputil.BearerToken("secret")),
+		httputil.WithMiddleware(recorder.Middleware()),
+	)
+
+	resp, err := client.Get("/config")
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.JSONEq(t, `{"enabled": true}`, string(body))
+
+	resp, err = client.Post("/blobs", map[string]string{"k": "v"})
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	require.NoError(t, recorder.Save())
+	server.Close()
+
+	data, err := os.ReadFile(golden)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "secret")
+	assert.Contains(t, string(data), "body_base64")
+
+	// Replay against the golden file with the server gone
+	replayer, err := NewRecorder(golden, ModeAuto)
+	require.NoError(t, err)
+	assert.Equal(t, ModeReplay, replayer.Mode())
+	assert.Len(t, replayer.Interactions(), 2)
+
+	client = httputil.NewClient(
+		httputil.WithBaseURL(server.URL),
+		httputil.WithMiddleware(replayer.Middleware()),
+	)
+
+	resp, err = client.Get("/config")
+	require.NoError(t, err)
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.JSONEq(t, `{"enabled": true}`, string(body))
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+
+	resp, err = client.Post("/blobs", map[string]string{"k": "v"})
+	require.NoError(t, err)
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "\xff\xfe binary", string(body))
+
+	// Each interaction is replayed once
+	_, err = client.Get("/config")
+	assert.True(t, errors.Is(err, ErrNoInteraction))
+}
+
+func TestNewRecorder_MissingGoldenFile(t *testing.T) {
+	_, err := NewRecorder(filepath.Join(t.TempDir(), "missing.json"), ModeReplay)
+	assert.Error(t, err)
+}
+
+func TestRecorder_ReplayMultipart(t *testing.T) {
+	server := NewServer()
+	server.On("POST", "/upload").ReplyString(http.StatusCreated, "stored")
+
+	golden := filepath.Join(t.TempDir(), "upload.json")
+	recorder, err := NewRecorder(golden, ModeRecord)
+	require.NoError(t, err)
+
+	upload := func(client *httputil.Client, name string) (*http.Response, error) {
+		return client.NewRequest().Method("POST").Path("/upload").
+			MultipartField("name", name).
+			MultipartFile("file", "a.txt", strings.NewReader("contents")).
+			Do(context.Background())
+	}
+
+	client := httputil.NewClient(httputil.WithBaseURL(server.URL), httputil.WithMiddleware(recorder.Middleware()))
+	resp, err := upload(client, "report")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.NoError(t, recorder.Save())
+	server.Close()
+
+	// The replayed request has a new random boundary
+	replayer, err := NewRecorder(golden, ModeReplay)
+	require.NoError(t, err)
+	client = httputil.NewClient(httputil.WithBaseURL(server.URL), httputil.WithMiddleware(replayer.Middleware()))
+
+	_, err = upload(client, "other")
+	assert.True(t, errors.Is(err, ErrNoInteraction))
+
+	resp, err = upload(client, "report")
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "stored", string(body))
+}
+
+func TestRecorder_SharedByClients(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	server.On("GET", "/*").Reply(http.StatusOK)
+
+	recorder, err := NewRecorder(filepath.Join(t.TempDir(), "shared.json"), ModeRecord)
+	require.NoError(t, err)
+
+	// Each client tags its requests further down its own transport chain
+	tagging := func(name string) httputil.Middleware {
+		return func(next http.RoundTripper) http.RoundTripper {
+			return httputil.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				req.Header.Set("X-Client", name)
+				return next.RoundTrip(req)
+			})
+		}
+	}
+	first := httputil.NewClient(httputil.WithBaseURL(server.URL),
+		httputil.WithMiddleware(recorder.Middleware()), httputil.WithMiddleware(tagging("first")))
+	second := httputil.NewClient(httputil.WithBaseURL(server.URL),
+		httputil.WithMiddleware(recorder.Middleware()), httputil.WithMiddleware(tagging("second")))
+
+	for _, client := range []*httputil.Client{first, second} {
+		resp, err := client.Get("/ping")
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	calls := server.Calls()
+	require.Len(t, calls, 2)
+	assert.Equal(t, "first", calls[0].Header.Get("X-Client"))
+	assert.Equal(t, "second", calls[1].Header.Get("X-Client"))
+}
@@ -0,0 +1,444 @@
+// Package httpmock provides a programmable mock HTTP server and a
+// record/replay transport for testing code built on httputil.Client.
+package httpmock
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Fault simulates a broken server response
+type Fault int
+
+const (
+	// NoFault sends the configured response
+	NoFault Fault = iota
+	// FaultCloseConnection closes the connection without sending a response
+	FaultCloseConnection
+	// FaultMalformedResponse writes an invalid HTTP response and closes the connection
+	FaultMalformedResponse
+	// FaultTruncatedBody announces the full Content-Length but sends only half of the body
+	FaultTruncatedBody
+)
+
+// Call is a request received by the mock server
+type Call struct {
+	Method string
+	Path   string
+	Query  map[string][]string
+	Header http.Header
+	Body   []byte
+	Route  *Route // nil if no route matched
+}
+
+// Server is a mock HTTP server with programmable routes
+type Server struct {
+	*httptest.Server
+
+	mu     sync.Mutex
+	routes []*Route
+	calls  []Call
+}
+
+// NewServer starts a new mock server. Call Close when done.
+func NewServer() *Server {
+	s := &Server{}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// On registers a route for method and path. The path may contain path.Match
+// wildcards such as /users/*. Routes are matched in registration order.
+func (s *Server) On(method, pattern string) *Route {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	route := &Route{
+		mu:      &s.mu,
+		method:  method,
+		pattern: pattern,
+		status:  http.StatusOK,
+		header:  make(http.Header),
+		times:   -1,
+	}
+	s.routes = append(s.routes, route)
+	return route
+}
+
+// Calls returns all requests received so far
+func (s *Server) Calls() []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Call(nil), s.calls...)
+}
+
+// Reset removes all routes and recorded calls
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.routes = nil
+	s.calls = nil
+}
+
+// CallCount returns the number of received requests with the given method and path
+func (s *Server) CallCount(method, path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	count := 0
+	for _, call := range s.calls {
+		if call.Method == method && call.Path == path {
+			count++
+		}
+	}
+	return count
+}
+
+// AssertCalled fails the test unless a request with method and path was received
+func (s *Server) AssertCalled(t testing.TB, method, path string) bool {
+	t.Helper()
+	if s.CallCount(method, path) == 0 {
+		t.Errorf("httpmock: expected a call to %s %s", method, path)
+		return false
+	}
+	return true
+}
+
+// AssertNotCalled fails the test if a request with method and path was received
+func (s *Server) AssertNotCalled(t testing.TB, method, path string) bool {
+	t.Helper()
+	if n := s.CallCount(method, path); n > 0 {
+		t.Errorf("httpmock: expected no calls to %s %s, got %d", method, path, n)
+		return false
+	}
+	return true
+}
+
+// AssertNumberOfCalls fails the test unless exactly n requests with method and path were received
+func (s *Server) AssertNumberOfCalls(t testing.TB, method, path string, n int) bool {
+	t.Helper()
+	if got := s.CallCount(method, path); got != n {
+		t.Errorf("httpmock: expected %d calls to %s %s, got %d", n, method, path, got)
+		return false
+	}
+	return true
+}
+
+// AssertExpectations fails the test if any route was never matched, if a route
+// limited with Times was not used up, or if a request matched no route
+func (s *Server) AssertExpectations(t testing.TB) bool {
+	t.Helper()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ok := true
+	for _, route := range s.routes {
+		if route.calls == 0 || (route.times > 0 && route.calls < route.times) {
+			t.Errorf("httpmock: route %s %s matched %d times", route.method, route.pattern, route.calls)
+			ok = false
+		}
+		if route.err != nil {
+			t.Errorf("httpmock: route %s %s: %v", route.method, route.pattern, route.err)
+			ok = false
+		}
+	}
+	for _, call := range s.calls {
+		if call.Route == nil {
+			t.Errorf("httpmock: unexpected request %s %s", call.Method, call.Path)
+			ok = false
+		}
+	}
+	return ok
+}
+
+// handle dispatches a request to the first matching route
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	r.Body.Close()
+	// Let ReplyFunc handlers read the body again
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	s.mu.Lock()
+	var matched, reply *Route
+	for _, route := range s.routes {
+		if route.matches(r, body) {
+			matched = route
+			route.calls++
+			reply = route.reply()
+			break
+		}
+	}
+	s.calls = append(s.calls, Call{
+		Method: r.Method,
+		Path:   r.URL.Path,
+		Query:  r.URL.Query(),
+		Header: r.Header.Clone(),
+		Body:   body,
+		Route:  matched,
+	})
+	s.mu.Unlock()
+
+	if matched == nil {
+		http.Error(w, fmt.Sprintf("httpmock: no route for %s %s", r.Method, r.URL.Path), http.StatusNotImplemented)
+		return
+	}
+
+	reply.respond(w, r)
+}
+
+// Route matches requests and describes the canned response
+type Route struct {
+	mu       *sync.Mutex
+	method   string
+	pattern  string
+	query    map[string]string
+	headers  map[string]string
+	body     func([]byte) bool
+	status   int
+	header   http.Header
+	respBody []byte
+	delay    time.Duration
+	fault    Fault
+	handler  http.HandlerFunc
+	err      error // Reported when the route answers
+	times    int   // -1 for unlimited
+	calls    int
+}
+
+// WithQuery requires a query parameter to have the given value
+func (r *Route) WithQuery(key, value string) *Route {
+	return r.set(func() {
+		if r.query == nil {
+			r.query = make(map[string]string)
+		}
+		r.query[key] = value
+	})
+}
+
+// WithHeader requires a request header to have the given value
+func (r *Route) WithHeader(key, value string) *Route {
+	return r.set(func() {
+		if r.headers == nil {
+			r.headers = make(map[string]string)
+		}
+		r.headers[key] = value
+	})
+}
+
+// WithBody requires the request body to equal body
+func (r *Route) WithBody(body string) *Route {
+	return r.WithBodyMatcher(func(b []byte) bool {
+		return string(b) == body
+	})
+}
+
+// WithJSONBody requires the request body to be JSON equal to v
+func (r *Route) WithJSONBody(v interface{}) *Route {
+	expected, err := normalizeJSON(v)
+	return r.WithBodyMatcher(func(b []byte) bool {
+		var actual interface{}
+		if err != nil || json.Unmarshal(b, &actual) != nil {
+			return false
+		}
+		actualJSON, _ := json.Marshal(actual)
+		return bytes.Equal(expected, actualJSON)
+	})
+}
+
+// WithBodyMatcher requires the request body to satisfy fn
+func (r *Route) WithBodyMatcher(fn func(body []byte) bool) *Route {
+	return r.set(func() { r.body = fn })
+}
+
+// Times limits how many requests the route answers. Once the limit is reached
+// the next matching route is used, which allows response sequences.
+func (r *Route) Times(n int) *Route {
+	return r.set(func() { r.times = n })
+}
+
+// Once is shorthand for Times(1)
+func (r *Route) Once() *Route {
+	return r.Times(1)
+}
+
+// Reply sets the response status code
+func (r *Route) Reply(status int) *Route {
+	return r.set(func() { r.status = status })
+}
+
+// ReplyString sets the response status and a text body
+func (r *Route) ReplyString(status int, body string) *Route {
+	return r.set(func() {
+		r.status = status
+		r.respBody = []byte(body)
+	})
+}
+
+// ReplyJSON sets the response status and a JSON body. If v cannot be
+// marshaled the route answers 500 and AssertExpectations fails.
+func (r *Route) ReplyJSON(status int, v interface{}) *Route {
+	data, err := json.Marshal(v)
+	return r.set(func() {
+		if err != nil {
+			r.err = fmt.Errorf("httpmock: failed to marshal reply: %w", err)
+			return
+		}
+		r.status = status
+		r.respBody = data
+		r.header.Set("Content-Type", "application/json")
+	})
+}
+
+// ReplyHeader sets a response header
+func (r *Route) ReplyHeader(key, value string) *Route {
+	return r.set(func() { r.header.Set(key, value) })
+}
+
+// ReplyFunc answers with a custom handler instead of a canned response
+func (r *Route) ReplyFunc(handler http.HandlerFunc) *Route {
+	return r.set(func() { r.handler = handler })
+}
+
+// Delay waits before responding, simulating latency
+func (r *Route) Delay(d time.Duration) *Route {
+	return r.set(func() { r.delay = d })
+}
+
+// Fail simulates a broken response instead of a normal reply
+func (r *Route) Fail(fault Fault) *Route {
+	return r.set(func() { r.fault = fault })
+}
+
+// set applies a builder change under the server lock, so routes can be
+// changed while the server is handling requests
+func (r *Route) set(fn func()) *Route {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	fn()
+	return r
+}
+
+// reply returns a copy of the route's response settings. Called with the server lock held.
+func (r *Route) reply() *Route {
+	reply := *r
+	reply.header = r.header.Clone()
+	return &reply
+}
+
+// CallCount returns how many requests the route has answered
+func (r *Route) CallCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.calls
+}
+
+// matches reports whether the route accepts the request. Called with the server lock held.
+func (r *Route) matches(req *http.Request, body []byte) bool {
+	if r.times >= 0 && r.calls >= r.times {
+		return false
+	}
+	if r.method != "" && r.method != req.Method {
+		return false
+	}
+	if ok, _ := path.Match(r.pattern, req.URL.Path); !ok {
+		return false
+	}
+
+	query := req.URL.Query()
+	for k, v := range r.query {
+		if query.Get(k) != v {
+			return false
+		}
+	}
+	for k, v := range r.headers {
+		if req.Header.Get(k) != v {
+			return false
+		}
+	}
+	if r.body != nil && !r.body(body) {
+		return false
+	}
+	return true
+}
+
+// respond writes the canned response, applying latency and faults
+func (r *Route) respond(w http.ResponseWriter, req *http.Request) {
+	if r.err != nil {
+		http.Error(w, r.err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if r.delay > 0 {
+		timer := time.NewTimer(r.delay)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+
+	switch r.fault {
+	case FaultCloseConnection, FaultMalformedResponse:
+		hijacker, ok := w.(http.Hijacker)
+		if !ok {
+			panic(http.ErrAbortHandler)
+		}
+		conn, buf, err := hijacker.Hijack()
+		if err != nil {
+			return
+		}
+		if r.fault == FaultMalformedResponse {
+			buf.WriteString("NOT-HTTP garbage\r\n\r\n")
+			buf.Flush()
+		}
+		conn.Close()
+		return
+	case FaultTruncatedBody:
+		for k, values := range r.header {
+			w.Header()[k] = values
+		}
+		w.Header().Set("Content-Length", fmt.Sprint(len(r.respBody)))
+		w.WriteHeader(r.status)
+		w.Write(r.respBody[:len(r.respBody)/2])
+		if flusher, ok := w.(http.Flusher); ok {
+			flusher.Flush()
+		}
+		panic(http.ErrAbortHandler)
+	}
+
+	if r.handler != nil {
+		r.handler(w, req)
+		return
+	}
+
+	for k, values := range r.header {
+		w.Header()[k] = values
+	}
+	w.WriteHeader(r.status)
+	w.Write(r.respBody)
+}
+
+// normalizeJSON marshals v through a generic value so key order does not matter
+func normalizeJSON(v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var generic interface{}
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return nil, err
+	}
+	return json.Marshal(generic)
+}
@@ -0,0 +1,194 @@
+package httpmock
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jelech/goutils/httputil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_Routes(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	server.On("GET", "/users/*").
+		WithQuery("expand", "true").
+		WithHeader("Authorization", "Bearer token").
+		ReplyJSON(http.StatusOK, map[string]string{"name": "John"}).
+		ReplyHeader("X-Trace", "1")
+	server.On("POST", "/users").
+		WithJSONBody(map[string]interface{}{"name": "Jane", "age": 30}).
+		ReplyString(http.StatusCreated, "created")
+
+	client := httputil.NewClient(
+		httputil.WithBaseURL(server.URL),
+		httputil.WithAuthenticator(httputil.BearerToken("token")),
+	)
+	ctx := context.Background()
+
+	resp, err := client.NewRequest().Path("/users/{id}", 1).Query("expand", "true").Do(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "1", resp.Header.Get("X-Trace"))
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.JSONEq(t, `{"name": "John"}`, string(body))
+
+	resp, err = client.Post("/users", map[string]interface{}{"age": 30, "name": "Jane"})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	resp.Body.Close()
+
+	server.AssertCalled(t, "GET", "/users/1")
+	server.AssertNumberOfCalls(t, "POST", "/users", 1)
+	server.AssertNotCalled(t, "DELETE", "/users/1")
+	server.AssertExpectations(t)
+
+	calls := server.Calls()
+	require.Len(t, calls, 2)
+	assert.Equal(t, "true", calls[0].Query["expand"][0])
+}
+
+func TestServer_UnmatchedRequest(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	server.On("GET", "/users").Reply(http.StatusOK)
+
+	resp, err := http.Get(server.URL + "/other")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotImplemented, resp.StatusCode)
+
+	recorder := &failureRecorder{TB: t}
+	assert.False(t, server.AssertExpectations(recorder))
+	assert.Len(t, recorder.errors, 2)
+}
+
+// failureRecorder captures assertion failures instead of failing the test
+type failureRecorder struct {
+	testing.TB
+	errors []string
+}
+
+func (f *failureRecorder) Helper() {}
+
+func (f *failureRecorder) Errorf(format string, args ...interface{}) {
+	f.errors = append(f.errors, fmt.Sprintf(format, args...))
+}
+
+func TestServer_Sequence(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	first := server.On("GET", "/flaky").Times(2).Reply(http.StatusServiceUnavailable)
+	server.On("GET", "/flaky").ReplyString(http.StatusOK, "ok")
+
+	client := httputil.NewClient(httputil.WithBaseURL(server.URL))
+	resp, err := client.GetWithRetry("/flaky", 5)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+
+	assert.Equal(t, 2, first.CallCount())
+	server.AssertNumberOfCalls(t, "GET", "/flaky", 3)
+}
+
+func TestServer_LatencyAndFaults(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	server.On("GET", "/slow").Delay(time.Millisecond * 200).Reply(http.StatusOK)
+	server.On("GET", "/reset").Fail(FaultCloseConnection)
+	server.On("GET", "/garbage").Fail(FaultMalformedResponse)
+	server.On("GET", "/truncated").ReplyString(http.StatusOK, "0123456789").Fail(FaultTruncatedBody)
+
+	client := httputil.NewClient(httputil.WithBaseURL(server.URL), httputil.WithTimeout(time.Millisecond*50))
+	_, err := client.Get("/slow")
+	assert.Error(t, err)
+
+	client = httputil.NewClient(httputil.WithBaseURL(server.URL))
+	_, err = client.Get("/reset")
+	assert.Error(t, err)
+
+	_, err = client.Get("/garbage")
+	assert.Error(t, err)
+
+	resp, err := client.Get("/truncated")
+	require.NoError(t, err)
+	_, err = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Error(t, err)
+}
+
+func TestServer_ReplyFunc(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	server.On("PUT", "/echo").ReplyFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Method", r.Method)
+		w.WriteHeader(http.StatusAccepted)
+		io.Copy(w, r.Body)
+	})
+
+	client := httputil.NewClient(httputil.WithBaseURL(server.URL))
+	resp, err := client.Put("/echo", map[string]int{"n": 1})
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	assert.Equal(t, "PUT", resp.Header.Get("X-Method"))
+	assert.Equal(t, `{"n":1}`, string(body))
+	assert.Equal(t, `{"n":1}`, string(server.Calls()[0].Body))
+}
+
+func TestServer_ReplyJSONError(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	server.On("GET", "/bad").ReplyJSON(http.StatusOK, make(chan int))
+
+	resp, err := http.Get(server.URL + "/bad")
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	assert.Contains(t, string(body), "failed to marshal reply")
+
+	recorder := &failureRecorder{TB: t}
+	assert.False(t, server.AssertExpectations(recorder))
+	require.Len(t, recorder.errors, 1)
+	assert.Contains(t, recorder.errors[0], "failed to marshal reply")
+}
+
+func TestServer_ConcurrentRouteChanges(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	route := server.On("GET", "/status").ReplyString(http.StatusOK, "ok")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				resp, err := http.Get(server.URL + "/status")
+				if assert.NoError(t, err) {
+					resp.Body.Close()
+				}
+			}
+		}()
+	}
+	for i := 0; i < 20; i++ {
+		route.ReplyHeader("X-Version", fmt.Sprint(i)).ReplyString(http.StatusOK, fmt.Sprint(i)).WithHeader("X-Any", "")
+	}
+	wg.Wait()
+	assert.Equal(t, 80, route.CallCount())
+}
@@ -0,0 +1,54 @@
+package httputil
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// DoJSON sends req with client and decodes a successful JSON response into Resp.
+// Responses with a 4xx or 5xx status are returned as *HTTPError.
+func DoJSON[Resp any](ctx context.Context, client *Client, req *http.Request) (Resp, error) {
+	var result Resp
+
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return result, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return result, client.newHTTPError(resp)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil && !errors.Is(err, io.EOF) {
+		return result, fmt.Errorf("failed to decode response body: %w", err)
+	}
+
+	return result, nil
+}
+
+// GetJSON performs a GET request and decodes the JSON response into Resp
+func GetJSON[Resp any](ctx context.Context, client *Client, url string) (Resp, error) {
+	req, err := client.NewRequest().Path(url).Build(ctx)
+	if err != nil {
+		var zero Resp
+		return zero, err
+	}
+
+	return DoJSON[Resp](ctx, client, req)
+}
+
+// PostJSON performs a POST request with a JSON body and decodes the JSON response into Resp
+func PostJSON[Resp any](ctx context.Context, client *Client, url string, body interface{}) (Resp, error) {
+	req, err := client.NewRequest().Method(http.MethodPost).Path(url).JSONBody(body).Build(ctx)
+	if err != nil {
+		var zero Resp
+		return zero, err
+	}
+
+	return DoJSON[Resp](ctx, client, req)
+}
@@ -0,0 +1,52 @@
+package httputil
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type user struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestDoJSON(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/users/1":
+			w.Write([]byte(`{"id": 1, "name": "John"}`))
+		case "/users":
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"id": 2, "name": "Jane"}`))
+		case "/empty":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	client := NewClient(WithBaseURL(server.URL))
+
+	req, err := client.NewRequest().Path("/users/{id}", 1).Build(ctx)
+	require.NoError(t, err)
+	got, err := DoJSON[user](ctx, client, req)
+	require.NoError(t, err)
+	assert.Equal(t, user{ID: 1, Name: "John"}, got)
+
+	created, err := PostJSON[*user](ctx, client, "/users", user{Name: "Jane"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, created.ID)
+
+	_, err = GetJSON[struct{}](ctx, client, "/empty")
+	assert.NoError(t, err)
+
+	_, err = GetJSON[user](ctx, client, "/missing")
+	assert.True(t, IsNotFound(err))
+}
@@ -0,0 +1,231 @@
+package httputil
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jelech/goutils/strutil"
+	"github.com/jelech/goutils/timeutil"
+)
+
+// Middleware decorates an http.RoundTripper with additional behavior
+type Middleware func(http.RoundTripper) http.RoundTripper
+
+// RoundTripperFunc adapts an ordinary function to the http.RoundTripper interface
+type RoundTripperFunc func(*http.Request) (*http.Response, error)
+
+// RoundTrip implements http.RoundTripper
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Logger interface for custom logging implementations
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// defaultLogger uses the standard log package
+type defaultLogger struct{}
+
+func (d defaultLogger) Printf(format string, v ...interface{}) {
+	if log.Writer() != nil {
+		log.Printf(format, v...)
+	}
+}
+
+// WithMiddleware adds round tripper middleware around the client's transport.
+// Middleware is applied after all other options, so it also wraps a client set
+// by WithHTTPClient. The first middleware given is the outermost.
+func WithMiddleware(middlewares ...Middleware) Option {
+	return func(c *Client) {
+		c.middlewares = append(c.middlewares, middlewares...)
+	}
+}
+
+// Chain composes middlewares around a base round tripper, first middleware outermost
+func Chain(base http.RoundTripper, middlewares ...Middleware) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		base = middlewares[i](base)
+	}
+	return base
+}
+
+// applyMiddleware wraps the transport of a copy of the underlying HTTP client.
+// The load balancer, if any, is the innermost layer so that other middleware
+// sees requests addressed to the primary endpoint.
+func (c *Client) applyMiddleware() {
+	middlewares := c.middlewares
+	if c.balancer != nil {
+		c.balancer.bind(c)
+		middlewares = append(append([]Middleware{}, middlewares...), c.balancer.middleware)
+	}
+	if len(middlewares) == 0 {
+		return
+	}
+
+	httpClient := *c.client
+	httpClient.Transport = Chain(httpClient.Transport, middlewares...)
+	c.client = &httpClient
+}
+
+// DefaultRedactedHeaders lists the headers redacted by RedactHeaders when none are given
+var DefaultRedactedHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"Set-Cookie",
+	"X-Api-Key",
+}
+
+// redactedValue replaces the values of sensitive headers
+const redactedValue = "[REDACTED]"
+
+// RedactHeaders returns a copy of headers with sensitive values replaced.
+// If no header names are given, DefaultRedactedHeaders is used.
+func RedactHeaders(headers http.Header, sensitive ...string) http.Header {
+	if len(sensitive) == 0 {
+		sensitive = DefaultRedactedHeaders
+	}
+
+	result := make(http.Header, len(headers))
+	for k, values := range headers {
+		if strutil.ContainsIgnoreCase(sensitive, k) {
+			result[k] = []string{redactedValue}
+			continue
+		}
+		result[k] = append([]string(nil), values...)
+	}
+	return result
+}
+
+// formatHeaders renders headers on a single line for logging
+func formatHeaders(headers http.Header) string {
+	parts := make([]string, 0, len(headers))
+	for k, values := range headers {
+		parts = append(parts, fmt.Sprintf("%s=%s", k, strings.Join(values, ",")))
+	}
+	return strings.Join(parts, " ")
+}
+
+// LoggingMiddleware logs each request and its outcome. When logHeaders is true,
+// request headers are logged with sensitive values redacted.
+func LoggingMiddleware(logger Logger, logHeaders bool) Middleware {
+	if logger == nil {
+		logger = defaultLogger{}
+	}
+
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if logHeaders {
+				logger.Printf("[HTTP] --> %s %s %s", req.Method, req.URL.Redacted(), formatHeaders(RedactHeaders(req.Header)))
+			} else {
+				logger.Printf("[HTTP] --> %s %s", req.Method, req.URL.Redacted())
+			}
+
+			start := time.Now()
+			resp, err := next.RoundTrip(req)
+			elapsed := time.Since(start)
+
+			if err != nil {
+				logger.Printf("[HTTP] <-- %s %s failed after %v: %v", req.Method, req.URL.Redacted(), elapsed, err)
+				return resp, err
+			}
+
+			logger.Printf("[HTTP] <-- %s %s %d (%v)", req.Method, req.URL.Redacted(), resp.StatusCode, elapsed)
+			return resp, nil
+		})
+	}
+}
+
+// requestIDKey is the context key for request IDs
+type requestIDKey struct{}
+
+// DefaultRequestIDHeader is the header used to propagate request IDs
+const DefaultRequestIDHeader = "X-Request-ID"
+
+// ContextWithRequestID returns a context carrying the given request ID
+func ContextWithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestIDFromContext returns the request ID stored in ctx, if any
+func RequestIDFromContext(ctx context.Context) (string, bool) {
+	requestID, ok := ctx.Value(requestIDKey{}).(string)
+	return requestID, ok && requestID != ""
+}
+
+// RequestIDMiddleware propagates a request ID header. The ID is taken from the
+// request context if present, otherwise an existing header is kept, otherwise a
+// new random ID is generated. An empty header name uses DefaultRequestIDHeader.
+func RequestIDMiddleware(header string) Middleware {
+	if header == "" {
+		header = DefaultRequestIDHeader
+	}
+
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			requestID, ok := RequestIDFromContext(req.Context())
+			if !ok {
+				if req.Header.Get(header) != "" {
+					return next.RoundTrip(req)
+				}
+
+				generated, err := strutil.RandomString(16)
+				if err != nil {
+					return nil, fmt.Errorf("failed to generate request ID: %w", err)
+				}
+				requestID = generated
+			}
+
+			// RoundTrippers must not modify the caller's request
+			req = req.Clone(req.Context())
+			req.Header.Set(header, requestID)
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+// TimingMiddleware records the duration of each round trip into recorder.
+// Operations are named "METHOD host" unless nameFn is given.
+func TimingMiddleware(recorder *timeutil.Recorder, nameFn func(*http.Request) string) Middleware {
+	if nameFn == nil {
+		nameFn = func(req *http.Request) string {
+			return req.Method + " " + req.URL.Host
+		}
+	}
+
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			resp, err := next.RoundTrip(req)
+			if recorder != nil {
+				recorder.Record(nameFn(req), time.Since(start))
+			} else {
+				timeutil.Record(nameFn(req), time.Since(start))
+			}
+			return resp, err
+		})
+	}
+}
+
+// RecoverMiddleware converts panics raised by inner round trippers into errors
+func RecoverMiddleware() Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (resp *http.Response, err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					resp = nil
+					err = fmt.Errorf("panic in round tripper for %s %s: %v", req.Method, req.URL.Redacted(), r)
+				}
+			}()
+			return next.RoundTrip(req)
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package httputil
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jelech/goutils/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type captureLogger struct {
+	lines []string
+}
+
+func (l *captureLogger) Printf(format string, v ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprintf(format, v...))
+}
+
+func TestWithMiddleware_Order(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "outer,inner", r.Header.Get("X-Trace"))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	tag := func(name string) Middleware {
+		return func(next http.RoundTripper) http.RoundTripper {
+			return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				req = req.Clone(req.Context())
+				if existing := req.Header.Get("X-Trace"); existing != "" {
+					name = existing + "," + name
+				}
+				req.Header.Set("X-Trace", name)
+				return next.RoundTrip(req)
+			})
+		}
+	}
+
+	custom := &http.Client{}
+	client := NewClient(WithMiddleware(tag("outer"), tag("inner")), WithHTTPClient(custom))
+
+	resp, err := client.Get(server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Nil(t, custom.Transport, "caller's http.Client must not be modified")
+}
+
+func TestLoggingMiddleware(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	logger := &captureLogger{}
+	client := NewClient(
+		WithHeaders(map[string]string{"Authorization": "Bearer secret"}),
+		WithMiddleware(LoggingMiddleware(logger, true)),
+	)
+
+	resp, err := client.Get(server.URL + "/items")
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	require.Len(t, logger.lines, 2)
+	assert.Contains(t, logger.lines[0], "GET")
+	assert.Contains(t, logger.lines[0], "[REDACTED]")
+	assert.NotContains(t, logger.lines[0], "secret")
+	assert.Contains(t, logger.lines[1], "202")
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = append(received, r.Header.Get(DefaultRequestIDHeader))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := NewClient(WithMiddleware(RequestIDMiddleware("")))
+
+	ctx := ContextWithRequestID(context.Background(), "from-context")
+	resp, err := client.RequestWithContext(ctx, "GET", server.URL, nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	resp, err = client.NewRequest().Path(server.URL).Header(DefaultRequestIDHeader, "explicit").Do(context.Background())
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	resp, err = client.Get(server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	require.Len(t, received, 3)
+	assert.Equal(t, "from-context", received[0])
+	assert.Equal(t, "explicit", received[1])
+	assert.Len(t, received[2], 16)
+}
+
+func TestTimingMiddleware(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	recorder := timeutil.NewRecorder()
+	client := NewClient(WithMiddleware(TimingMiddleware(recorder, func(req *http.Request) string {
+		return "api." + strings.ToLower(req.Method)
+	})))
+
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(server.URL)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	stats, ok := recorder.Get("api.get")
+	require.True(t, ok)
+	assert.Equal(t, int64(2), stats.Count)
+}
+
+func TestRecoverMiddleware(t *testing.T) {
+	panicking := func(http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(*http.Request) (*http.Response, error) {
+			panic("boom")
+		})
+	}
+
+	client := NewClient(WithMiddleware(RecoverMiddleware(), panicking))
+	_, err := client.Get("http://example.invalid")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "boom")
+}
+
+func TestRedactHeaders(t *testing.T) {
+	headers := http.Header{
+		"Authorization": {"Bearer token"},
+		"Content-Type":  {"application/json"},
+		"X-Secret":      {"value"},
+	}
+
+	redacted := RedactHeaders(headers)
+	assert.Equal(t, "[REDACTED]", redacted.Get("Authorization"))
+	assert.Equal(t, "application/json", redacted.Get("Content-Type"))
+	assert.Equal(t, "value", redacted.Get("X-Secret"))
+	assert.Equal(t, "Bearer token", headers.Get("Authorization"))
+
+	redacted = RedactHeaders(headers, "X-Secret")
+	assert.Equal(t, "[REDACTED]", redacted.Get("X-Secret"))
+	assert.Equal(t, "Bearer token", redacted.Get("Authorization"))
+}
@@ -0,0 +1,381 @@
+package httputil
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/jelech/goutils/retryutil"
+)
+
+// PageStrategy extracts the items from a page response and builds the request
+// for the following page. It returns a nil next request on the last page.
+type PageStrategy[T any] interface {
+	ParsePage(req *http.Request, resp *http.Response) (items []T, next *http.Request, err error)
+}
+
+// PageStrategyFunc adapts a function to a PageStrategy
+type PageStrategyFunc[T any] func(req *http.Request, resp *http.Response) ([]T, *http.Request, error)
+
+// ParsePage implements PageStrategy
+func (f PageStrategyFunc[T]) ParsePage(req *http.Request, resp *http.Response) ([]T, *http.Request, error) {
+	return f(req, resp)
+}
+
+// pagePreparer is implemented by strategies that adjust the first request
+type pagePreparer interface {
+	prepare(req *http.Request) *http.Request
+}
+
+// Pager lazily iterates over the items of a paginated API. Pages are fetched
+// on demand as Next is called.
+type Pager[T any] struct {
+	ctx      context.Context
+	client   *Client
+	strategy PageStrategy[T]
+	options  []retryutil.Option
+
+	next    *http.Request
+	items   []T
+	index   int
+	pages   int
+	current T
+	err     error
+}
+
+// Paginate returns an iterator over all items reachable from req. Every page
+// is fetched with DoWithRetry using the client's retry settings and options.
+func Paginate[T any](ctx context.Context, client *Client, req *http.Request, strategy PageStrategy[T], options ...retryutil.Option) *Pager[T] {
+	if preparer, ok := strategy.(pagePreparer); ok {
+		req = preparer.prepare(req)
+	}
+
+	return &Pager[T]{
+		ctx:      ctx,
+		client:   client,
+		strategy: strategy,
+		options:  options,
+		next:     req,
+	}
+}
+
+// Next advances to the next item, fetching the next page when needed. It
+// returns false when all pages are consumed or on error.
+func (p *Pager[T]) Next() bool {
+	for p.err == nil {
+		if p.index < len(p.items) {
+			p.current = p.items[p.index]
+			p.index++
+			return true
+		}
+		if p.next == nil {
+			return false
+		}
+		if err := p.fetch(); err != nil {
+			p.err = err
+		}
+	}
+	return false
+}
+
+// Item returns the item produced by the last call to Next
+func (p *Pager[T]) Item() T {
+	return p.current
+}
+
+// Pages returns the number of pages fetched so far
+func (p *Pager[T]) Pages() int {
+	return p.pages
+}
+
+// Err returns the first error encountered while iterating
+func (p *Pager[T]) Err() error {
+	return p.err
+}
+
+// All consumes the remaining items and returns them
+func (p *Pager[T]) All() ([]T, error) {
+	var items []T
+	for p.Next() {
+		items = append(items, p.Item())
+	}
+	return items, p.Err()
+}
+
+// fetch requests the next page and hands it to the strategy
+func (p *Pager[T]) fetch() error {
+	if err := p.ctx.Err(); err != nil {
+		return err
+	}
+
+	req := p.next.WithContext(p.ctx)
+	resp, err := p.client.DoWithRetry(p.ctx, req, p.options...)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return p.client.newHTTPError(resp)
+	}
+
+	items, next, err := p.strategy.ParsePage(req, resp)
+	if err != nil {
+		return fmt.Errorf("failed to parse page %d: %w", p.pages+1, err)
+	}
+
+	p.pages++
+	p.items, p.index, p.next = items, 0, next
+	return nil
+}
+
+// LinkHeader pages through RFC 5988 Link headers, following rel="next".
+// Items are decoded from itemsField of the JSON body, or from the body itself
+// when it is a JSON array and itemsField is empty.
+func LinkHeader[T any](itemsField string) PageStrategy[T] {
+	return PageStrategyFunc[T](func(req *http.Request, resp *http.Response) ([]T, *http.Request, error) {
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read response body: %w", err)
+		}
+
+		items, err := decodeItems[T](body, itemsField)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		link, ok := ParseLinkHeader(resp.Header.Values("Link"))["next"]
+		if !ok {
+			return items, nil, nil
+		}
+
+		nextURL, err := req.URL.Parse(link)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid next link %q: %w", link, err)
+		}
+		next, err := nextPage(req, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		next.URL = nextURL
+		next.Host = ""
+		return items, next, nil
+	})
+}
+
+// JSONCursor pages with a cursor returned in the JSON body. Items are read
+// from itemsField and the cursor from cursorField; both accept dotted paths
+// such as "meta.next_cursor". The cursor is sent in the cursorParam query
+// parameter, and pagination stops when it is empty or missing. A server that
+// returns the cursor it was just sent fails the pager instead of looping.
+func JSONCursor[T any](itemsField, cursorField, cursorParam string) PageStrategy[T] {
+	return PageStrategyFunc[T](func(req *http.Request, resp *http.Response) ([]T, *http.Request, error) {
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read response body: %w", err)
+		}
+
+		items, err := decodeItems[T](body, itemsField)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		raw, err := jsonField(body, cursorField)
+		if err != nil || raw == nil {
+			return items, nil, err
+		}
+		cursor, err := jsonScalar(raw)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid cursor field %s: %w", cursorField, err)
+		}
+		if cursor == "" {
+			return items, nil, nil
+		}
+		if cursor == req.URL.Query().Get(cursorParam) {
+			return nil, nil, fmt.Errorf("server returned the same cursor %q again", cursor)
+		}
+
+		next, err := nextPage(req, map[string]string{cursorParam: cursor})
+		if err != nil {
+			return nil, nil, err
+		}
+		return items, next, nil
+	})
+}
+
+// offsetLimit implements the OffsetLimit strategy
+type offsetLimit[T any] struct {
+	itemsField  string
+	offsetParam string
+	limitParam  string
+	limit       int
+}
+
+// OffsetLimit pages with offset and limit query parameters. The first request
+// starts at its own offset (0 if unset) and is sent with limit set. Pagination
+// stops at the first page holding fewer than limit items.
+func OffsetLimit[T any](itemsField, offsetParam, limitParam string, limit int) PageStrategy[T] {
+	return &offsetLimit[T]{
+		itemsField:  itemsField,
+		offsetParam: offsetParam,
+		limitParam:  limitParam,
+		limit:       limit,
+	}
+}
+
+// prepare sets the limit on the first request
+func (s *offsetLimit[T]) prepare(req *http.Request) *http.Request {
+	return withQueryParams(req, map[string]string{s.limitParam: strconv.Itoa(s.limit)})
+}
+
+// ParsePage implements PageStrategy
+func (s *offsetLimit[T]) ParsePage(req *http.Request, resp *http.Response) ([]T, *http.Request, error) {
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	items, err := decodeItems[T](body, s.itemsField)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(items) == 0 || len(items) < s.limit {
+		return items, nil, nil
+	}
+
+	offset := 0
+	if value := req.URL.Query().Get(s.offsetParam); value != "" {
+		if offset, err = strconv.Atoi(value); err != nil {
+			return nil, nil, fmt.Errorf("invalid %s parameter %q: %w", s.offsetParam, value, err)
+		}
+	}
+
+	next, err := nextPage(req, map[string]string{
+		s.offsetParam: strconv.Itoa(offset + len(items)),
+		s.limitParam:  strconv.Itoa(s.limit),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return items, next, nil
+}
+
+// ParseLinkHeader parses RFC 5988 Link header values into a map from rel to URL
+func ParseLinkHeader(values []string) map[string]string {
+	links := make(map[string]string)
+	for _, value := range values {
+		for _, link := range strings.Split(value, ",") {
+			parts := strings.Split(link, ";")
+			target := strings.TrimSpace(parts[0])
+			if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+			target = target[1 : len(target)-1]
+
+			for _, param := range parts[1:] {
+				name, arg, ok := strings.Cut(strings.TrimSpace(param), "=")
+				if !ok || !strings.EqualFold(strings.TrimSpace(name), "rel") {
+					continue
+				}
+				// rel may hold several space-separated relation types
+				for _, rel := range strings.Fields(strings.Trim(strings.TrimSpace(arg), `"`)) {
+					rel = strings.ToLower(rel)
+					if _, exists := links[rel]; !exists {
+						links[rel] = target
+					}
+				}
+			}
+		}
+	}
+	return links
+}
+
+// decodeItems decodes the items array at field, or the whole body if field is empty
+func decodeItems[T any](body []byte, field string) ([]T, error) {
+	raw := json.RawMessage(body)
+	if field != "" {
+		var err error
+		if raw, err = jsonField(body, field); err != nil {
+			return nil, err
+		}
+		if raw == nil {
+			return nil, nil
+		}
+	}
+
+	var items []T
+	if err := json.Unmarshal(raw, &items); err != nil {
+		return nil, fmt.Errorf("failed to decode items: %w", err)
+	}
+	return items, nil
+}
+
+// jsonField returns the raw value at a dotted path in a JSON object, or nil
+// if the path does not exist or is null
+func jsonField(body []byte, path string) (json.RawMessage, error) {
+	raw := json.RawMessage(body)
+	for _, key := range strings.Split(path, ".") {
+		var object map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &object); err != nil {
+			return nil, fmt.Errorf("failed to decode field %s: %w", path, err)
+		}
+		value, ok := object[key]
+		if !ok {
+			return nil, nil
+		}
+		raw = value
+	}
+
+	if bytes.Equal(bytes.TrimSpace(raw), []byte("null")) {
+		return nil, nil
+	}
+	return raw, nil
+}
+
+// jsonScalar converts a JSON string or number to its string form
+func jsonScalar(raw json.RawMessage) (string, error) {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s, nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(raw, &n); err != nil {
+		return "", err
+	}
+	return n.String(), nil
+}
+
+// withQueryParams returns a copy of req with the query parameters set
+func withQueryParams(req *http.Request, params map[string]string) *http.Request {
+	next := req.Clone(req.Context())
+	query := next.URL.Query()
+	for k, v := range params {
+		query.Set(k, v)
+	}
+	next.URL.RawQuery = query.Encode()
+	return next
+}
+
+// nextPage returns a copy of req with the query parameters set and a fresh
+// body, since the body of req was consumed when its page was sent
+func nextPage(req *http.Request, params map[string]string) (*http.Request, error) {
+	next := withQueryParams(req, params)
+	if req.Body == nil || req.Body == http.NoBody {
+		return next, nil
+	}
+	if req.GetBody == nil {
+		return nil, errors.New("request body cannot be sent again for the next page: GetBody is nil")
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, fmt.Errorf("failed to rebuild request body: %w", err)
+	}
+	next.Body = body
+	return next, nil
+}
@@ -0,0 +1,213 @@
+package httputil
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jelech/goutils/retryutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pagedUsers returns users [offset, offset+limit) out of total
+func pagedUsers(offset, limit, total int) []user {
+	var users []user
+	for i := offset; i < offset+limit && i < total; i++ {
+		users = append(users, user{ID: i, Name: fmt.Sprintf("user-%d", i)})
+	}
+	return users
+}
+
+func TestPaginate_LinkHeader(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if page < 2 {
+			w.Header().Add("Link", fmt.Sprintf(`<%s/users?page=%d>; rel="next", <%s/users?page=2>; rel="last"`, server.URL, page+1, server.URL))
+		}
+		json.NewEncoder(w).Encode(pagedUsers(page*2, 2, 6))
+	}))
+	defer server.Close()
+
+	client := NewClient(WithBaseURL(server.URL))
+	req, err := client.NewRequest().Path("/users").Build(context.Background())
+	require.NoError(t, err)
+
+	pager := Paginate(context.Background(), client, req, LinkHeader[user](""))
+	items, err := pager.All()
+	require.NoError(t, err)
+	assert.Len(t, items, 6)
+	assert.Equal(t, 5, items[5].ID)
+	assert.Equal(t, 3, pager.Pages())
+}
+
+func TestPaginate_JSONCursor(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cursor, _ := strconv.Atoi(r.URL.Query().Get("cursor"))
+		next := interface{}(nil)
+		if cursor+3 < 7 {
+			next = strconv.Itoa(cursor + 3)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": pagedUsers(cursor, 3, 7),
+			"meta": map[string]interface{}{"next_cursor": next},
+		})
+	}))
+	defer server.Close()
+
+	client := NewClient()
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/users", nil)
+	require.NoError(t, err)
+
+	pager := Paginate(context.Background(), client, req, JSONCursor[user]("data", "meta.next_cursor", "cursor"))
+	var ids []int
+	for pager.Next() {
+		ids = append(ids, pager.Item().ID)
+	}
+	require.NoError(t, pager.Err())
+	assert.Equal(t, []int{0, 1, 2, 3, 4, 5, 6}, ids)
+	assert.Equal(t, 3, pager.Pages())
+}
+
+func TestPaginate_OffsetLimit(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.RawQuery)
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		json.NewEncoder(w).Encode(map[string]interface{}{"items": pagedUsers(offset, limit, 5)})
+	}))
+	defer server.Close()
+
+	client := NewClient()
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/users", nil)
+	require.NoError(t, err)
+
+	items, err := Paginate(context.Background(), client, req, OffsetLimit[user]("items", "offset", "limit", 2)).All()
+	require.NoError(t, err)
+	assert.Len(t, items, 5)
+	assert.Equal(t, []string{"limit=2", "limit=2&offset=2", "limit=2&offset=4"}, requests)
+}
+
+func TestPaginate_IsLazy(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		json.NewEncoder(w).Encode(map[string]interface{}{"items": pagedUsers(0, 2, 2), "next": "more"})
+	}))
+	defer server.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	pager := Paginate(context.Background(), NewClient(), req, JSONCursor[user]("items", "next", "cursor"))
+	assert.Equal(t, int32(0), atomic.LoadInt32(&calls))
+
+	require.True(t, pager.Next())
+	require.True(t, pager.Next())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestPaginate_RetriesPage(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(pagedUsers(0, 2, 2))
+	}))
+	defer server.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	items, err := Paginate(context.Background(), NewClient(), req, LinkHeader[user](""),
+		retryutil.WithMaxAttempts(3), retryutil.WithDelay(time.Millisecond)).All()
+	require.NoError(t, err)
+	assert.Len(t, items, 2)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestPaginate_Errors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("cursor") != "" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"items": pagedUsers(0, 1, 1), "next": 2})
+	}))
+	defer server.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	pager := Paginate(context.Background(), NewClient(), req, JSONCursor[user]("items", "next", "cursor"))
+	items, err := pager.All()
+	assert.Len(t, items, 1)
+	assert.True(t, IsNotFound(err))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	pager = Paginate(ctx, NewClient(), req, JSONCursor[user]("items", "next", "cursor"))
+	assert.False(t, pager.Next())
+	assert.ErrorIs(t, pager.Err(), context.Canceled)
+}
+
+func TestPaginate_PostBody(t *testing.T) {
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		json.NewEncoder(w).Encode(pagedUsers(offset, 2, 5))
+	}))
+	defer server.Close()
+
+	client := NewClient(WithBaseURL(server.URL))
+	req, err := client.NewRequest().Method("POST").Path("/search").JSONBody(map[string]string{"q": "x"}).Build(context.Background())
+	require.NoError(t, err)
+
+	items, err := Paginate(context.Background(), client, req, OffsetLimit[user]("", "offset", "limit", 2)).All()
+	require.NoError(t, err)
+	assert.Len(t, items, 5)
+	assert.Equal(t, []string{`{"q":"x"}`, `{"q":"x"}`, `{"q":"x"}`}, bodies)
+
+	// A body that cannot be rebuilt fails instead of sending an empty page request
+	req, err = http.NewRequest(http.MethodPost, server.URL+"/search", io.NopCloser(strings.NewReader(`{"q":"x"}`)))
+	require.NoError(t, err)
+	_, err = Paginate(context.Background(), client, req, OffsetLimit[user]("", "offset", "limit", 2)).All()
+	assert.ErrorContains(t, err, "GetBody")
+}
+
+func TestPaginate_RepeatedCursor(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		json.NewEncoder(w).Encode(map[string]interface{}{"items": pagedUsers(0, 1, 1), "next": "abc"})
+	}))
+	defer server.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	items, err := Paginate(context.Background(), NewClient(), req, JSONCursor[user]("items", "next", "cursor")).All()
+	assert.ErrorContains(t, err, `same cursor "abc"`)
+	assert.Len(t, items, 1)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+}
+
+func TestParseLinkHeader(t *testing.T) {
+	links := ParseLinkHeader([]string{
+		`<https://api.example.com/items?page=2>; rel="next", <https://api.example.com/items?page=9>; rel="last"`,
+		`<https://api.example.com/items?page=1>; rel="first prev"`,
+		`invalid`,
+	})
+
+	assert.Equal(t, "https://api.example.com/items?page=2", links["next"])
+	assert.Equal(t, "https://api.example.com/items?page=9", links["last"])
+	assert.Equal(t, "https://api.example.com/items?page=1", links["first"])
+	assert.Equal(t, "https://api.example.com/items?page=1", links["prev"])
+	assert.Len(t, links, 4)
+}
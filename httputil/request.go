@@ -0,0 +1,210 @@
+package httputil
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// RequestBuilder builds a single HTTP request using a fluent API
+type RequestBuilder struct {
+	client      *Client
+	method      string
+	path        string
+	pathParams  []interface{}
+	query       url.Values
+	headers     http.Header
+	cookies     []*http.Cookie
+	body        *bodySource
+	parts       []multipartPart
+	contentType string
+	buffer      bool
+	gzip        bool
+	err         error
+}
+
+// NewRequest creates a new request builder bound to the client.
+// The builder reuses the client's base URL and default headers.
+func (c *Client) NewRequest() *RequestBuilder {
+	return &RequestBuilder{
+		client:  c,
+		method:  http.MethodGet,
+		query:   make(url.Values),
+		headers: make(http.Header),
+	}
+}
+
+// Method sets the HTTP method
+func (b *RequestBuilder) Method(method string) *RequestBuilder {
+	b.method = strings.ToUpper(method)
+	return b
+}
+
+// Path sets the request path or URL. Placeholders such as {id} are replaced
+// in order by the given params, which are path-escaped.
+func (b *RequestBuilder) Path(path string, params ...interface{}) *RequestBuilder {
+	b.path = path
+	b.pathParams = params
+	return b
+}
+
+// Query adds a query parameter
+func (b *RequestBuilder) Query(key, value string) *RequestBuilder {
+	b.query.Add(key, value)
+	return b
+}
+
+// QueryParams adds all the given query parameters
+func (b *RequestBuilder) QueryParams(params url.Values) *RequestBuilder {
+	for k, values := range params {
+		for _, v := range values {
+			b.query.Add(k, v)
+		}
+	}
+	return b
+}
+
+// Header sets a request header, overriding any client default
+func (b *RequestBuilder) Header(key, value string) *RequestBuilder {
+	b.headers.Set(key, value)
+	return b
+}
+
+// Cookie adds a cookie to the request
+func (b *RequestBuilder) Cookie(cookie *http.Cookie) *RequestBuilder {
+	b.cookies = append(b.cookies, cookie)
+	return b
+}
+
+// JSONBody sets the request body to the JSON encoding of v
+func (b *RequestBuilder) JSONBody(v interface{}) *RequestBuilder {
+	data, err := json.Marshal(v)
+	if err != nil {
+		b.err = fmt.Errorf("failed to marshal request body: %w", err)
+		return b
+	}
+
+	b.setBody(bytesSource(data), "application/json")
+	return b
+}
+
+// Build creates the *http.Request without sending it
+func (b *RequestBuilder) Build(ctx context.Context) (*http.Request, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+
+	path, err := expandPath(b.path, b.pathParams)
+	if err != nil {
+		return nil, err
+	}
+
+	fullURL, err := url.Parse(b.client.buildURL(path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse URL: %w", err)
+	}
+
+	if len(b.query) > 0 {
+		query := fullURL.Query()
+		for k, values := range b.query {
+			for _, v := range values {
+				query.Add(k, v)
+			}
+		}
+		fullURL.RawQuery = query.Encode()
+	}
+
+	body, contentType, err := b.bodySource()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, b.method, fullURL.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	if body != nil {
+		if req.Body, err = body.open(); err != nil {
+			return nil, err
+		}
+		if body.length >= 0 {
+			req.ContentLength = body.length
+		}
+		if body.replayable {
+			req.GetBody = body.open
+		}
+	}
+
+	// Set default headers
+	for k, v := range b.client.headers {
+		req.Header.Set(k, v)
+	}
+
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if body != nil && b.gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+
+	// Per-request headers take precedence over defaults
+	for k, values := range b.headers {
+		req.Header[k] = values
+	}
+
+	for _, cookie := range b.cookies {
+		req.AddCookie(cookie)
+	}
+
+	return req, nil
+}
+
+// Do builds and sends the request
+func (b *RequestBuilder) Do(ctx context.Context) (*http.Response, error) {
+	req, err := b.Build(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.client.Do(req)
+}
+
+// expandPath replaces {name} placeholders in path with the given params in order
+func expandPath(path string, params []interface{}) (string, error) {
+	if len(params) == 0 {
+		return path, nil
+	}
+
+	var sb strings.Builder
+	rest := path
+	used := 0
+	for {
+		start := strings.IndexByte(rest, '{')
+		if start == -1 {
+			break
+		}
+		end := strings.IndexByte(rest[start:], '}')
+		if end == -1 {
+			return "", fmt.Errorf("unclosed placeholder in path %q", path)
+		}
+		if used >= len(params) {
+			return "", fmt.Errorf("missing value for placeholder %s in path %q", rest[start:start+end+1], path)
+		}
+
+		sb.WriteString(rest[:start])
+		sb.WriteString(url.PathEscape(fmt.Sprint(params[used])))
+		used++
+		rest = rest[start+end+1:]
+	}
+	sb.WriteString(rest)
+
+	if used != len(params) {
+		return "", fmt.Errorf("path %q has %d placeholders but %d values were given", path, used, len(params))
+	}
+
+	return sb.String(), nil
+}
@@ -0,0 +1,122 @@
+package httputil
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestBuilder_Do(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "PATCH", r.Method)
+		assert.Equal(t, "/api/users/john%20doe", r.URL.EscapedPath())
+		assert.Equal(t, "1", r.URL.Query().Get("page"))
+		assert.Equal(t, []string{"a", "b"}, r.URL.Query()["tag"])
+		assert.Equal(t, "req-1", r.Header.Get("X-Request-ID"))
+		assert.Equal(t, "override", r.Header.Get("User-Agent"))
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+
+		cookie, err := r.Cookie("session")
+		require.NoError(t, err)
+		assert.Equal(t, "abc", cookie.Value)
+
+		var body map[string]string
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, "test", body["name"])
+
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := NewClient(
+		WithBaseURL(server.URL+"/api"),
+		WithHeaders(map[string]string{"User-Agent": "default"}),
+	)
+
+	resp, err := client.NewRequest().
+		Method("patch").
+		Path("/users/{id}", "john doe").
+		Query("page", "1").
+		QueryParams(url.Values{"tag": {"a", "b"}}).
+		Header("X-Request-ID", "req-1").
+		Header("User-Agent", "override").
+		Cookie(&http.Cookie{Name: "session", Value: "abc"}).
+		JSONBody(map[string]string{"name": "test"}).
+		Do(context.Background())
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+}
+
+func TestRequestBuilder_Build(t *testing.T) {
+	client := NewClient(WithBaseURL("https://api.example.com"))
+
+	req, err := client.NewRequest().Path("/search?q=go").Query("page", "2").Build(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "GET", req.Method)
+	assert.Equal(t, "go", req.URL.Query().Get("q"))
+	assert.Equal(t, "2", req.URL.Query().Get("page"))
+	assert.Nil(t, req.Body)
+
+	_, err = client.NewRequest().JSONBody(make(chan int)).Build(context.Background())
+	assert.Error(t, err)
+}
+
+func TestExpandPath(t *testing.T) {
+	tests := []struct {
+		name        string
+		path        string
+		params      []interface{}
+		expected    string
+		expectError bool
+	}{
+		{
+			name:     "no params",
+			path:     "/users/{id}",
+			expected: "/users/{id}",
+		},
+		{
+			name:     "multiple params",
+			path:     "/users/{id}/posts/{post}",
+			params:   []interface{}{42, "a/b"},
+			expected: "/users/42/posts/a%2Fb",
+		},
+		{
+			name:        "too few params",
+			path:        "/users/{id}/posts/{post}",
+			params:      []interface{}{42},
+			expectError: true,
+		},
+		{
+			name:        "too many params",
+			path:        "/users/{id}",
+			params:      []interface{}{1, 2},
+			expectError: true,
+		},
+		{
+			name:        "unclosed placeholder",
+			path:        "/users/{id",
+			params:      []interface{}{1},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := expandPath(tt.path, tt.params)
+			if tt.expectError {
+				assert.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tt.expected, result)
+			}
+		})
+	}
+}
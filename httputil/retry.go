@@ -0,0 +1,144 @@
+package httputil
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/jelech/goutils/retryutil"
+)
+
+// IdempotencyKeyHeader marks a non-idempotent request as safe to retry
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// maxDrainBytes bounds how much of a discarded response body is read so the
+// connection can be reused
+const maxDrainBytes = 64 * 1024
+
+// DoWithRetry sends req, retrying network errors and retryable status codes.
+//
+// Only idempotent methods, or requests carrying an Idempotency-Key header, are
+// retried. Request bodies are replayed through req.GetBody; requests with a
+// body but no GetBody are sent once. Responses from failed attempts are drained
+// and closed. When all attempts return a retryable status, the last response is
+// returned with a nil error, like any other response status.
+func (c *Client) DoWithRetry(ctx context.Context, req *http.Request, options ...retryutil.Option) (*http.Response, error) {
+	return c.doWithRetry(ctx, req, false, options...)
+}
+
+// RequestWithRetryContext performs an HTTP request with a JSON body and
+// context-aware retry logic. See DoWithRetry for the retry rules.
+func (c *Client) RequestWithRetryContext(ctx context.Context, method, url string, body interface{}, options ...retryutil.Option) (*http.Response, error) {
+	builder := c.NewRequest().Method(method).Path(url)
+	if body != nil {
+		builder.JSONBody(body)
+	}
+
+	return builder.DoWithRetry(ctx, options...)
+}
+
+// DoWithRetry builds the request and sends it with retry logic
+func (b *RequestBuilder) DoWithRetry(ctx context.Context, options ...retryutil.Option) (*http.Response, error) {
+	req, err := b.Build(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.client.DoWithRetry(ctx, req, options...)
+}
+
+// doWithRetry implements DoWithRetry. allowNonIdempotent skips the method check
+// for the legacy *WithRetry helpers.
+func (c *Client) doWithRetry(ctx context.Context, req *http.Request, allowNonIdempotent bool, options ...retryutil.Option) (*http.Response, error) {
+	retryable := allowNonIdempotent || isIdempotent(req)
+	replayable := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+
+	options = append(append([]retryutil.Option{}, c.retryOptions...), options...)
+
+	// Read the caller's RetryIf so it can be combined with the safety checks
+	config := &retryutil.Config{}
+	for _, option := range options {
+		option(config)
+	}
+	userRetryIf := config.RetryIf
+
+	var (
+		lastResp *http.Response
+		lastErr  error
+		attempt  int
+	)
+
+	retryOptions := append([]retryutil.Option{}, options...)
+	retryOptions = append(retryOptions,
+		retryutil.WithContext(ctx),
+		retryutil.WithRetryIf(func(err error) bool {
+			if !retryable || !replayable || retryutil.IsPermanent(err) || ctx.Err() != nil {
+				return false
+			}
+			return userRetryIf == nil || userRetryIf(err)
+		}),
+	)
+
+	err := retryutil.Do(func() error {
+		if lastResp != nil {
+			drainAndClose(lastResp)
+			lastResp = nil
+		}
+
+		attemptReq := req.WithContext(ctx)
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				lastErr = fmt.Errorf("failed to rewind request body: %w", err)
+				return retryutil.Permanent(lastErr)
+			}
+			attemptReq.Body = body
+		}
+		attempt++
+
+		resp, err := c.Do(attemptReq)
+		if err != nil {
+			lastErr = err
+			return err
+		}
+
+		lastResp = resp
+		if isRetryableStatusCode(resp.StatusCode) {
+			lastErr = &HTTPError{StatusCode: resp.StatusCode, Status: resp.Status, Header: resp.Header}
+			return lastErr
+		}
+
+		lastErr = nil
+		return nil
+	}, retryOptions...)
+
+	if err != nil && ctx.Err() != nil {
+		if lastResp != nil {
+			drainAndClose(lastResp)
+		}
+		return nil, ctx.Err()
+	}
+
+	if lastResp != nil {
+		return lastResp, nil
+	}
+
+	return nil, lastErr
+}
+
+// isIdempotent reports whether a request can be safely sent more than once
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace,
+		http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get(IdempotencyKeyHeader) != ""
+}
+
+// drainAndClose discards a bounded amount of the body and closes it
+func drainAndClose(resp *http.Response) {
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxDrainBytes))
+	resp.Body.Close()
+}
@@ -0,0 +1,127 @@
+package httputil
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jelech/goutils/retryutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_DoWithRetry_ReplaysBody(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		assert.Equal(t, "raw payload", string(body))
+		if atomic.AddInt32(&attempts, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := NewClient()
+	req, err := http.NewRequest(http.MethodPut, server.URL, strings.NewReader("raw payload"))
+	require.NoError(t, err)
+
+	resp, err := client.DoWithRetry(context.Background(), req, retryutil.WithDelay(time.Millisecond))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&attempts))
+	resp.Body.Close()
+}
+
+func TestClient_DoWithRetry_Idempotency(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	client := NewClient()
+
+	resp, err := client.RequestWithRetryContext(ctx, "POST", server.URL, map[string]int{"n": 1},
+		retryutil.WithMaxAttempts(3), retryutil.WithDelay(time.Millisecond))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&attempts), "POST without idempotency key must not be retried")
+	resp.Body.Close()
+
+	atomic.StoreInt32(&attempts, 0)
+	resp, err = client.NewRequest().Method("POST").Path(server.URL).
+		Header(IdempotencyKeyHeader, "key-1").
+		JSONBody(map[string]int{"n": 1}).
+		DoWithRetry(ctx, retryutil.WithMaxAttempts(3), retryutil.WithDelay(time.Millisecond))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode, "last response is returned after exhausting retries")
+	assert.Equal(t, int32(3), atomic.LoadInt32(&attempts))
+	resp.Body.Close()
+}
+
+func TestClient_DoWithRetry_NonReplayableBody(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	client := NewClient()
+	req, err := http.NewRequest(http.MethodPut, server.URL, io.NopCloser(strings.NewReader("stream")))
+	require.NoError(t, err)
+	require.Nil(t, req.GetBody)
+
+	resp, err := client.DoWithRetry(context.Background(), req, retryutil.WithDelay(time.Millisecond))
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&attempts))
+	resp.Body.Close()
+}
+
+func TestClient_DoWithRetry_ContextCanceled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+
+	client := NewClient()
+	resp, err := client.RequestWithRetryContext(ctx, "GET", server.URL, nil,
+		retryutil.WithMaxAttempts(100), retryutil.WithDelay(time.Millisecond*20), retryutil.WithJitter(false),
+		retryutil.WithBackoff(retryutil.FixedDelay))
+
+	assert.Nil(t, resp)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+}
+
+func TestClient_DoWithRetry_RetryIf(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	client := NewClient()
+	resp, err := client.RequestWithRetryContext(context.Background(), "GET", server.URL, nil,
+		retryutil.WithDelay(time.Millisecond),
+		retryutil.WithRetryIf(func(err error) bool {
+			return StatusCode(err) != http.StatusTooManyRequests
+		}))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&attempts))
+	resp.Body.Close()
+}
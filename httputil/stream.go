@@ -0,0 +1,525 @@
+package httputil
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jelech/goutils/retryutil"
+)
+
+// NDJSONStream iterates over a newline-delimited JSON response body.
+// Long-lived streams should use a client without a timeout (WithTimeout(0)),
+// since http.Client.Timeout also bounds reading the body.
+type NDJSONStream[T any] struct {
+	resp    *http.Response
+	decoder *json.Decoder
+	current T
+	err     error
+}
+
+// StreamNDJSON sends req and returns an iterator over the JSON values in the
+// response. The request is sent with the client's retry settings.
+func StreamNDJSON[T any](ctx context.Context, client *Client, req *http.Request) (*NDJSONStream[T], error) {
+	if req.Header.Get("Accept") == "" {
+		req.Header.Set("Accept", "application/x-ndjson")
+	}
+
+	resp, err := client.DoWithRetry(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		return nil, client.newHTTPError(resp)
+	}
+
+	return &NDJSONStream[T]{
+		resp:    resp,
+		decoder: json.NewDecoder(resp.Body),
+	}, nil
+}
+
+// Next decodes the next value. It returns false at the end of the stream or on error.
+func (s *NDJSONStream[T]) Next() bool {
+	if s.err != nil {
+		return false
+	}
+
+	var item T
+	if err := s.decoder.Decode(&item); err != nil {
+		if !errors.Is(err, io.EOF) {
+			s.err = fmt.Errorf("failed to decode NDJSON item: %w", err)
+		}
+		return false
+	}
+
+	s.current = item
+	return true
+}
+
+// Item returns the value decoded by the last call to Next
+func (s *NDJSONStream[T]) Item() T {
+	return s.current
+}
+
+// Err returns the first error encountered while iterating
+func (s *NDJSONStream[T]) Err() error {
+	return s.err
+}
+
+// Close closes the response body
+func (s *NDJSONStream[T]) Close() error {
+	return s.resp.Body.Close()
+}
+
+// SSEEvent is a single server-sent event
+type SSEEvent struct {
+	ID    string
+	Event string
+	Data  string
+	Retry time.Duration
+}
+
+// SSEOption represents a configuration option for SSE streams
+type SSEOption func(*sseConfig)
+
+// sseConfig holds SSE stream settings
+type sseConfig struct {
+	reconnectDelay time.Duration
+	maxReconnects  int
+	lastEventID    string
+}
+
+// WithReconnectDelay sets the initial delay before reconnecting. A retry field
+// sent by the server overrides it.
+func WithReconnectDelay(delay time.Duration) SSEOption {
+	return func(c *sseConfig) {
+		c.reconnectDelay = delay
+	}
+}
+
+// WithMaxReconnects limits consecutive reconnects without receiving an event.
+// A negative value allows unlimited reconnects.
+func WithMaxReconnects(n int) SSEOption {
+	return func(c *sseConfig) {
+		c.maxReconnects = n
+	}
+}
+
+// WithLastEventID resumes a stream from the given event ID
+func WithLastEventID(id string) SSEOption {
+	return func(c *sseConfig) {
+		c.lastEventID = id
+	}
+}
+
+// SSEStream reads server-sent events and reconnects with Last-Event-ID when
+// the connection drops
+type SSEStream struct {
+	ctx        context.Context
+	client     *Client
+	req        *http.Request
+	config     sseConfig
+	resp       *http.Response
+	reader     *bufio.Reader
+	current    SSEEvent
+	reconnects int
+	err        error
+}
+
+// StreamSSE returns a server-sent event stream for req. The connection is
+// opened lazily by the first call to Next.
+func (c *Client) StreamSSE(ctx context.Context, req *http.Request, options ...SSEOption) *SSEStream {
+	config := sseConfig{
+		reconnectDelay: time.Second * 3,
+		maxReconnects:  5,
+	}
+	for _, option := range options {
+		option(&config)
+	}
+
+	return &SSEStream{
+		ctx:    ctx,
+		client: c,
+		req:    req,
+		config: config,
+	}
+}
+
+// Next reads the next event. It returns false when the stream ends, the
+// server responds with 204 No Content, the context is done, or reconnects
+// are exhausted.
+func (s *SSEStream) Next() bool {
+	for s.err == nil {
+		if s.resp == nil {
+			if !s.connect() {
+				return false
+			}
+		}
+
+		event, err := s.readEvent()
+		if err == nil {
+			s.reconnects = 0
+			s.current = event
+			return true
+		}
+
+		s.resp.Body.Close()
+		s.resp = nil
+
+		if s.ctx.Err() != nil {
+			s.err = s.ctx.Err()
+			return false
+		}
+		if !s.waitReconnect() {
+			return false
+		}
+	}
+	return false
+}
+
+// Event returns the event read by the last call to Next
+func (s *SSEStream) Event() SSEEvent {
+	return s.current
+}
+
+// LastEventID returns the ID of the last event that carried one
+func (s *SSEStream) LastEventID() string {
+	return s.config.lastEventID
+}
+
+// Err returns the error that stopped the stream, if any
+func (s *SSEStream) Err() error {
+	return s.err
+}
+
+// Close closes the current connection
+func (s *SSEStream) Close() error {
+	if s.resp == nil {
+		return nil
+	}
+	err := s.resp.Body.Close()
+	s.resp = nil
+	return err
+}
+
+// connect opens a new connection, reconnecting as configured on failure
+func (s *SSEStream) connect() bool {
+	for {
+		req := s.req.Clone(s.ctx)
+		req.Header.Set("Accept", "text/event-stream")
+		req.Header.Set("Cache-Control", "no-cache")
+		if s.config.lastEventID != "" {
+			req.Header.Set("Last-Event-ID", s.config.lastEventID)
+		}
+
+		resp, err := s.client.Do(req)
+		if err == nil {
+			switch {
+			case resp.StatusCode == http.StatusNoContent:
+				resp.Body.Close()
+				return false
+			case resp.StatusCode >= 400:
+				httpErr := s.client.newHTTPError(resp)
+				resp.Body.Close()
+				if !isRetryableStatusCode(resp.StatusCode) {
+					s.err = httpErr
+					return false
+				}
+				err = httpErr
+			default:
+				s.resp = resp
+				s.reader = bufio.NewReader(resp.Body)
+				return true
+			}
+		}
+
+		if s.ctx.Err() != nil {
+			s.err = s.ctx.Err()
+			return false
+		}
+		if !s.waitReconnect() {
+			if s.err == nil {
+				s.err = err
+			}
+			return false
+		}
+	}
+}
+
+// waitReconnect sleeps for the reconnect delay, returning false if no more
+// reconnects are allowed or the context is done
+func (s *SSEStream) waitReconnect() bool {
+	if s.config.maxReconnects >= 0 && s.reconnects >= s.config.maxReconnects {
+		if s.err == nil {
+			s.err = fmt.Errorf("SSE stream closed after %d reconnect attempts", s.reconnects)
+		}
+		return false
+	}
+	s.reconnects++
+
+	timer := time.NewTimer(s.config.reconnectDelay)
+	defer timer.Stop()
+	select {
+	case <-s.ctx.Done():
+		s.err = s.ctx.Err()
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// readEvent parses lines until a complete event is dispatched
+func (s *SSEStream) readEvent() (SSEEvent, error) {
+	var (
+		event   SSEEvent
+		data    strings.Builder
+		hasData bool
+	)
+
+	for {
+		line, err := s.reader.ReadString('\n')
+		if err != nil {
+			return SSEEvent{}, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		if line == "" {
+			if !hasData {
+				event = SSEEvent{}
+				continue
+			}
+			event.Data = data.String()
+			if event.ID == "" {
+				event.ID = s.config.lastEventID
+			}
+			return event, nil
+		}
+
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value := line, ""
+		if i := strings.IndexByte(line, ':'); i >= 0 {
+			field, value = line[:i], strings.TrimPrefix(line[i+1:], " ")
+		}
+
+		switch field {
+		case "data":
+			if hasData {
+				data.WriteByte('\n')
+			}
+			data.WriteString(value)
+			hasData = true
+		case "event":
+			event.Event = value
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				event.ID = value
+				s.config.lastEventID = value
+			}
+		case "retry":
+			if ms, err := strconv.Atoi(value); err == nil {
+				event.Retry = time.Duration(ms) * time.Millisecond
+				s.config.reconnectDelay = event.Retry
+			}
+		}
+	}
+}
+
+// DownloadFile downloads url to filename. If the file already holds a partial
+// download, the transfer resumes with a Range request. Interrupted transfers
+// are retried with the client's retry settings and resume where they stopped.
+// It returns the final file size.
+//
+// The ETag or Last-Modified of the first response is sent as If-Range when
+// resuming and kept in filename + ".validator" until the download completes,
+// so a file that changed between attempts or runs is downloaded again from
+// the start instead of being stitched onto the old content. An existing file
+// without a stored validator, such as a finished download, cannot be checked
+// and is downloaded again in full.
+func (c *Client) DownloadFile(ctx context.Context, url, filename string, options ...retryutil.Option) (int64, error) {
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return 0, fmt.Errorf("failed to create directories: %w", err)
+	}
+
+	file, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open file %s: %w", filename, err)
+	}
+	defer file.Close()
+
+	retryOptions := append(append([]retryutil.Option{}, c.retryOptions...), options...)
+	retryOptions = append(retryOptions,
+		retryutil.WithContext(ctx),
+		retryutil.WithRetryIf(func(err error) bool {
+			return !retryutil.IsPermanent(err) && ctx.Err() == nil
+		}),
+	)
+
+	state := &downloadState{validatorFile: filename + ".validator"}
+	if data, err := os.ReadFile(state.validatorFile); err == nil {
+		state.validator = string(data)
+	}
+	if state.validator == "" {
+		if err := restart(file); err != nil {
+			return 0, fmt.Errorf("failed to truncate file %s: %w", filename, err)
+		}
+	}
+
+	var lastErr error
+	err = retryutil.Do(func() error {
+		lastErr = c.downloadAttempt(ctx, url, file, state)
+		return lastErr
+	}, retryOptions...)
+	if err != nil {
+		if ctx.Err() != nil {
+			return 0, ctx.Err()
+		}
+		var permErr retryutil.PermanentError
+		if errors.As(lastErr, &permErr) {
+			lastErr = permErr.Err
+		}
+		return 0, fmt.Errorf("failed to download %s to %s: %w", url, filename, lastErr)
+	}
+
+	size, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, fmt.Errorf("failed to stat file %s: %w", filename, err)
+	}
+	os.Remove(state.validatorFile)
+	return size, nil
+}
+
+// downloadState carries the resume validator across download attempts
+type downloadState struct {
+	validator     string // ETag or Last-Modified of the content being downloaded
+	validatorFile string
+}
+
+// remember records the validator of resp, if it has a usable one. Weak ETags
+// cannot be used with If-Range.
+func (s *downloadState) remember(resp *http.Response) {
+	validator := resp.Header.Get("ETag")
+	if validator == "" || strings.HasPrefix(validator, "W/") {
+		validator = resp.Header.Get("Last-Modified")
+	}
+	if validator == "" || validator == s.validator {
+		return
+	}
+	s.validator = validator
+	os.WriteFile(s.validatorFile, []byte(validator), 0644)
+}
+
+// restart truncates file so the next attempt downloads everything again
+func restart(file *os.File) error {
+	if err := file.Truncate(0); err != nil {
+		return retryutil.Permanent(err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return retryutil.Permanent(err)
+	}
+	return nil
+}
+
+// downloadAttempt fetches the remainder of url into file
+func (c *Client) downloadAttempt(ctx context.Context, url string, file *os.File, state *downloadState) error {
+	offset, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return retryutil.Permanent(err)
+	}
+
+	builder := c.NewRequest().Path(url)
+	if offset > 0 {
+		builder.Header("Range", fmt.Sprintf("bytes=%d-", offset))
+		if state.validator != "" {
+			builder.Header("If-Range", state.validator)
+		}
+	}
+
+	resp, err := builder.Do(ctx)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusPartialContent:
+		start, err := parseContentRangeStart(resp.Header.Get("Content-Range"))
+		if err != nil || start != offset {
+			// The server ignored our offset; start over on the next attempt
+			if err := restart(file); err != nil {
+				return err
+			}
+			return fmt.Errorf("unexpected Content-Range %q for offset %d", resp.Header.Get("Content-Range"), offset)
+		}
+		if etag := resp.Header.Get("ETag"); etag != "" && strings.HasPrefix(state.validator, `"`) && etag != state.validator {
+			// The server ignored If-Range and sent part of different content
+			if err := restart(file); err != nil {
+				return err
+			}
+			return fmt.Errorf("remote file changed: ETag %s, expected %s", etag, state.validator)
+		}
+		state.remember(resp)
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		// The file is complete only if it has the remote length
+		size, err := parseContentRangeSize(resp.Header.Get("Content-Range"))
+		if err == nil && size == offset {
+			return nil
+		}
+		if err := restart(file); err != nil {
+			return err
+		}
+		return fmt.Errorf("partial file of %d bytes does not match remote Content-Range %q", offset, resp.Header.Get("Content-Range"))
+	case resp.StatusCode >= 400:
+		httpErr := c.newHTTPError(resp)
+		if isRetryableStatusCode(resp.StatusCode) {
+			return httpErr
+		}
+		return retryutil.Permanent(httpErr)
+	default:
+		// Full content, either the first request or the content changed
+		if err := restart(file); err != nil {
+			return err
+		}
+		state.remember(resp)
+	}
+
+	if _, err := io.Copy(file, resp.Body); err != nil {
+		return fmt.Errorf("failed to write response body: %w", err)
+	}
+	return nil
+}
+
+// parseContentRangeSize extracts the complete length from a Content-Range
+// header such as "bytes */1000" or "bytes 0-99/1000"
+func parseContentRangeSize(contentRange string) (int64, error) {
+	slash := strings.LastIndexByte(contentRange, '/')
+	if !strings.HasPrefix(contentRange, "bytes ") || slash == -1 {
+		return 0, fmt.Errorf("invalid Content-Range %q", contentRange)
+	}
+	return strconv.ParseInt(contentRange[slash+1:], 10, 64)
+}
+
+// parseContentRangeStart returns the first byte position of a Content-Range header
+func parseContentRangeStart(contentRange string) (int64, error) {
+	// Format: bytes <start>-<end>/<size>
+	rest := strings.TrimPrefix(contentRange, "bytes ")
+	dash := strings.IndexByte(rest, '-')
+	if rest == contentRange || dash == -1 {
+		return 0, fmt.Errorf("invalid Content-Range %q", contentRange)
+	}
+	return strconv.ParseInt(rest[:dash], 10, 64)
+}
@@ -0,0 +1,290 @@
+package httputil
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jelech/goutils/retryutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamNDJSON(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/x-ndjson", r.Header.Get("Accept"))
+		w.Write([]byte("{\"id\": 1, \"name\": \"a\"}\n{\"id\": 2, \"name\": \"b\"}\n\n{\"id\": 3, \"name\": \"c\"}\n"))
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	client := NewClient(WithBaseURL(server.URL))
+	req, err := client.NewRequest().Path("/events").Build(ctx)
+	require.NoError(t, err)
+
+	stream, err := StreamNDJSON[user](ctx, client, req)
+	require.NoError(t, err)
+	defer stream.Close()
+
+	var ids []int
+	for stream.Next() {
+		ids = append(ids, stream.Item().ID)
+	}
+	require.NoError(t, stream.Err())
+	assert.Equal(t, []int{1, 2, 3}, ids)
+}
+
+func TestStreamNDJSON_DecodeError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("{\"id\": 1}\nnot-json\n"))
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	client := NewClient()
+	req, err := client.NewRequest().Path(server.URL).Build(ctx)
+	require.NoError(t, err)
+
+	stream, err := StreamNDJSON[user](ctx, client, req)
+	require.NoError(t, err)
+	defer stream.Close()
+
+	assert.True(t, stream.Next())
+	assert.False(t, stream.Next())
+	assert.Error(t, stream.Err())
+}
+
+func TestClient_StreamSSE_Reconnect(t *testing.T) {
+	var connections int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "text/event-stream", r.Header.Get("Accept"))
+		w.Header().Set("Content-Type", "text/event-stream")
+
+		switch atomic.AddInt32(&connections, 1) {
+		case 1:
+			assert.Equal(t, "", r.Header.Get("Last-Event-ID"))
+			fmt.Fprint(w, ": welcome\n\nretry: 10\nid: 1\nevent: update\ndata: first\ndata: line\n\n")
+		case 2:
+			assert.Equal(t, "1", r.Header.Get("Last-Event-ID"))
+			fmt.Fprint(w, "id: 2\r\ndata: second\r\n\r\n")
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	client := NewClient()
+	req, err := client.NewRequest().Path(server.URL).Build(ctx)
+	require.NoError(t, err)
+
+	stream := client.StreamSSE(ctx, req, WithReconnectDelay(time.Second))
+	defer stream.Close()
+
+	var events []SSEEvent
+	for stream.Next() {
+		events = append(events, stream.Event())
+	}
+	require.NoError(t, stream.Err())
+	require.Len(t, events, 2)
+
+	assert.Equal(t, SSEEvent{ID: "1", Event: "update", Data: "first\nline", Retry: time.Millisecond * 10}, events[0])
+	assert.Equal(t, "second", events[1].Data)
+	assert.Equal(t, "2", stream.LastEventID())
+	assert.Equal(t, int32(3), atomic.LoadInt32(&connections))
+}
+
+func TestClient_StreamSSE_Errors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	client := NewClient()
+	req, err := client.NewRequest().Path(server.URL).Build(ctx)
+	require.NoError(t, err)
+
+	stream := client.StreamSSE(ctx, req)
+	assert.False(t, stream.Next())
+	assert.True(t, IsForbidden(stream.Err()))
+
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer flaky.Close()
+
+	req, err = client.NewRequest().Path(flaky.URL).Build(ctx)
+	require.NoError(t, err)
+	stream = client.StreamSSE(ctx, req, WithMaxReconnects(2), WithReconnectDelay(time.Millisecond))
+	assert.False(t, stream.Next())
+	assert.Error(t, stream.Err())
+}
+
+func TestClient_DownloadFile_Resume(t *testing.T) {
+	content := strings.Repeat("0123456789", 100)
+	var requests int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&requests, 1)
+		rangeHeader := r.Header.Get("Range")
+
+		w.Header().Set("ETag", `"v1"`)
+		if n == 1 {
+			// Drop the connection half way through the first response
+			assert.Equal(t, "", rangeHeader)
+			w.Header().Set("Content-Length", fmt.Sprint(len(content)))
+			w.Write([]byte(content[:400]))
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+
+		assert.Equal(t, "bytes=400-", rangeHeader)
+		assert.Equal(t, `"v1"`, r.Header.Get("If-Range"))
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes 400-%d/%d", len(content)-1, len(content)))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write([]byte(content[400:]))
+	}))
+	defer server.Close()
+
+	filename := filepath.Join(t.TempDir(), "nested", "file.bin")
+	client := NewClient(WithRetry(retryutil.WithDelay(time.Millisecond)))
+
+	size, err := client.DownloadFile(context.Background(), server.URL, filename)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(content)), size)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+
+	data, err := os.ReadFile(filename)
+	require.NoError(t, err)
+	assert.Equal(t, content, string(data))
+	assert.NoFileExists(t, filename+".validator")
+}
+
+func TestClient_DownloadFile_RemoteChanged(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Serves the new version: a range is only honoured for its own ETag
+		w.Header().Set("ETag", `"v2"`)
+		if r.Header.Get("Range") != "" && r.Header.Get("If-Range") == `"v2"` {
+			w.Header().Set("Content-Range", "bytes 3-5/6")
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write([]byte("new"))
+			return
+		}
+		w.Write([]byte("newnew"))
+	}))
+	defer server.Close()
+
+	// A previous run stored half of version 1
+	filename := filepath.Join(t.TempDir(), "file.txt")
+	require.NoError(t, os.WriteFile(filename, []byte("old"), 0644))
+	require.NoError(t, os.WriteFile(filename+".validator", []byte(`"v1"`), 0644))
+
+	size, err := NewClient().DownloadFile(context.Background(), server.URL, filename)
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), size)
+	data, err := os.ReadFile(filename)
+	require.NoError(t, err)
+	assert.Equal(t, "newnew", string(data))
+}
+
+func TestClient_DownloadFile_Complete(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") != "" {
+			w.Header().Set("Content-Range", "bytes */5")
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		w.Write([]byte("hello"))
+	}))
+	defer server.Close()
+
+	// An interrupted run stored the whole file but not the completion
+	filename := filepath.Join(t.TempDir(), "file.txt")
+	require.NoError(t, os.WriteFile(filename, []byte("hello"), 0644))
+	require.NoError(t, os.WriteFile(filename+".validator", []byte(`"v1"`), 0644))
+
+	size, err := NewClient().DownloadFile(context.Background(), server.URL, filename)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), size)
+	assert.NoFileExists(t, filename+".validator")
+
+	// A longer local file is not complete; it is downloaded again
+	require.NoError(t, os.WriteFile(filename, []byte("hello world"), 0644))
+	require.NoError(t, os.WriteFile(filename+".validator", []byte(`"v1"`), 0644))
+	size, err = NewClient(WithRetry(retryutil.WithDelay(time.Millisecond))).DownloadFile(context.Background(), server.URL, filename)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), size)
+	data, err := os.ReadFile(filename)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+}
+
+func TestClient_DownloadFile_Again(t *testing.T) {
+	content := "version one"
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		w.Write([]byte(content))
+	}))
+	defer server.Close()
+
+	filename := filepath.Join(t.TempDir(), "file.txt")
+	_, err := NewClient().DownloadFile(context.Background(), server.URL, filename)
+	require.NoError(t, err)
+
+	// The remote file grew; the finished local copy has no validator to resume with
+	content = "version two, longer"
+	size, err := NewClient().DownloadFile(context.Background(), server.URL, filename)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(content)), size)
+	data, err := os.ReadFile(filename)
+	require.NoError(t, err)
+	assert.Equal(t, content, string(data))
+	assert.Equal(t, []string{"", ""}, ranges)
+}
+
+func TestClient_DownloadFile_NotFound(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	_, err := NewClient().DownloadFile(context.Background(), server.URL, filepath.Join(t.TempDir(), "missing"))
+	require.Error(t, err)
+	assert.True(t, IsNotFound(err))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+}
+
+func TestParseContentRangeStart(t *testing.T) {
+	start, err := parseContentRangeStart("bytes 100-199/200")
+	require.NoError(t, err)
+	assert.Equal(t, int64(100), start)
+
+	_, err = parseContentRangeStart("items 1-2/3")
+	assert.Error(t, err)
+}
+
+func TestParseContentRangeSize(t *testing.T) {
+	size, err := parseContentRangeSize("bytes */200")
+	require.NoError(t, err)
+	assert.Equal(t, int64(200), size)
+
+	size, err = parseContentRangeSize("bytes 0-9/10")
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), size)
+
+	_, err = parseContentRangeSize("bytes */*")
+	assert.Error(t, err)
+	_, err = parseContentRangeSize("")
+	assert.Error(t, err)
+}
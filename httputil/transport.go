@@ -0,0 +1,467 @@
+package httputil
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/jelech/goutils/timeutil"
+)
+
+// transportSettings collects transport options before the transport is built
+type transportSettings struct {
+	transport     *http.Transport
+	dialer        *net.Dialer
+	dialerChanged bool
+	dnsTimeout    time.Duration
+}
+
+// tlsConfig returns the transport's TLS config, creating it if needed
+func (s *transportSettings) tlsConfig() *tls.Config {
+	if s.transport.TLSClientConfig == nil {
+		s.transport.TLSClientConfig = &tls.Config{}
+	}
+	return s.transport.TLSClientConfig
+}
+
+// dialContext dials with the configured dialer, resolving host names first
+// when a DNS timeout is set. Resolved addresses are dialled the way
+// net.Dialer dials them: the dial timeout is split across the addresses of
+// each family, and the other family is raced after the fallback delay.
+func (s *transportSettings) dialContext() func(ctx context.Context, network, addr string) (net.Conn, error) {
+	dialer, dnsTimeout := s.dialer, s.dnsTimeout
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if dnsTimeout <= 0 || err != nil || net.ParseIP(host) != nil {
+			return dialer.DialContext(ctx, network, addr)
+		}
+
+		lookupCtx, cancel := context.WithTimeout(ctx, dnsTimeout)
+		ips, err := net.DefaultResolver.LookupIPAddr(lookupCtx, host)
+		cancel()
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve %s: %w", host, err)
+		}
+
+		var deadline time.Time
+		if dialer.Timeout > 0 {
+			deadline = time.Now().Add(dialer.Timeout)
+		}
+		if d, ok := ctx.Deadline(); ok && (deadline.IsZero() || d.Before(deadline)) {
+			deadline = d
+		}
+
+		primaries, fallbacks := splitAddrs(network, ips, port)
+		if len(primaries) == 0 {
+			return nil, fmt.Errorf("no %s addresses found for %s", network, host)
+		}
+		dial := func(ctx context.Context, addr string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, addr)
+		}
+		if len(fallbacks) == 0 || dialer.FallbackDelay < 0 {
+			return dialSerial(ctx, dial, primaries, deadline)
+		}
+		fallbackDelay := dialer.FallbackDelay
+		if fallbackDelay == 0 {
+			fallbackDelay = time.Millisecond * 300
+		}
+		return dialParallel(ctx, dial, primaries, fallbacks, deadline, fallbackDelay)
+	}
+}
+
+// dialFunc dials a single resolved address
+type dialFunc func(ctx context.Context, addr string) (net.Conn, error)
+
+// splitAddrs returns the addresses usable with network, split into those of
+// the first address's family and those of the other family
+func splitAddrs(network string, ips []net.IPAddr, port string) (primaries, fallbacks []string) {
+	var primaryIPv4 bool
+	for _, ip := range ips {
+		isIPv4 := ip.IP.To4() != nil
+		if (network == "tcp4" && !isIPv4) || (network == "tcp6" && isIPv4) {
+			continue
+		}
+		addr := net.JoinHostPort(ip.String(), port)
+		if len(primaries) == 0 {
+			primaryIPv4 = isIPv4
+		}
+		if isIPv4 == primaryIPv4 {
+			primaries = append(primaries, addr)
+		} else {
+			fallbacks = append(fallbacks, addr)
+		}
+	}
+	return primaries, fallbacks
+}
+
+// dialParallel dials primaries and, once the fallback delay has passed or
+// the primaries failed, fallbacks, returning the first connection
+func dialParallel(ctx context.Context, dial dialFunc, primaries, fallbacks []string, deadline time.Time, fallbackDelay time.Duration) (net.Conn, error) {
+	type result struct {
+		conn    net.Conn
+		err     error
+		primary bool
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan result)
+	returned := make(chan struct{})
+	defer close(returned)
+	start := func(addrs []string, primary bool) {
+		go func() {
+			conn, err := dialSerial(ctx, dial, addrs, deadline)
+			select {
+			case results <- result{conn: conn, err: err, primary: primary}:
+			case <-returned:
+				// The other family won, so close the extra connection
+				if conn != nil {
+					conn.Close()
+				}
+			}
+		}()
+	}
+
+	start(primaries, true)
+	timer := time.NewTimer(fallbackDelay)
+	defer timer.Stop()
+
+	var primaryErr error
+	fallbackStarted, pending := false, 1
+	for {
+		select {
+		case <-timer.C:
+			if !fallbackStarted {
+				start(fallbacks, false)
+				fallbackStarted, pending = true, pending+1
+			}
+		case res := <-results:
+			if res.err == nil {
+				return res.conn, nil
+			}
+			pending--
+			if res.primary {
+				primaryErr = res.err
+			}
+			if !fallbackStarted {
+				timer.Stop()
+				start(fallbacks, false)
+				fallbackStarted, pending = true, pending+1
+			} else if pending == 0 {
+				return nil, primaryErr
+			}
+		}
+	}
+}
+
+// dialSerial dials addrs in order. Each attempt gets an equal share of the
+// time left before deadline, but at least two seconds, as in net.Dialer.
+func dialSerial(ctx context.Context, dial dialFunc, addrs []string, deadline time.Time) (net.Conn, error) {
+	var lastErr error
+	for i, addr := range addrs {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		dialCtx, cancel := ctx, context.CancelFunc(func() {})
+		if !deadline.IsZero() {
+			dialCtx, cancel = context.WithDeadline(ctx, partialDeadline(time.Now(), deadline, len(addrs)-i))
+		}
+		conn, err := dial(dialCtx, addr)
+		cancel()
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// partialDeadline returns the deadline of one of the remaining addresses
+func partialDeadline(now, deadline time.Time, addrsRemaining int) time.Time {
+	const saneMinimum = time.Second * 2
+	timeRemaining := deadline.Sub(now)
+	if timeRemaining <= 0 {
+		return deadline
+	}
+	timeout := timeRemaining / time.Duration(addrsRemaining)
+	if timeout < saneMinimum {
+		timeout = saneMinimum
+		if timeRemaining < saneMinimum {
+			timeout = timeRemaining
+		}
+	}
+	return now.Add(timeout)
+}
+
+// transportOption configures the client's *http.Transport
+type transportOption func(*transportSettings)
+
+// withTransport wraps a transport option as a client option
+func withTransport(option transportOption) Option {
+	return func(c *Client) {
+		c.transportOptions = append(c.transportOptions, option)
+	}
+}
+
+// applyTransport builds a tuned transport for a copy of the underlying HTTP
+// client. Transport options only apply when the client's transport is nil or
+// an *http.Transport, which is cloned rather than modified.
+func (c *Client) applyTransport() {
+	if len(c.transportOptions) == 0 {
+		return
+	}
+
+	var base *http.Transport
+	switch t := c.client.Transport.(type) {
+	case nil:
+		base = http.DefaultTransport.(*http.Transport)
+	case *http.Transport:
+		base = t
+	default:
+		return
+	}
+
+	settings := &transportSettings{
+		transport: base.Clone(),
+		dialer: &net.Dialer{
+			Timeout:   time.Second * 30,
+			KeepAlive: time.Second * 30,
+		},
+	}
+	for _, option := range c.transportOptions {
+		option(settings)
+	}
+	if settings.dialerChanged || settings.dnsTimeout > 0 {
+		settings.transport.DialContext = settings.dialContext()
+	}
+
+	httpClient := *c.client
+	httpClient.Transport = settings.transport
+	c.client = &httpClient
+}
+
+// WithMaxIdleConns sets the maximum number of idle connections across all hosts
+func WithMaxIdleConns(n int) Option {
+	return withTransport(func(s *transportSettings) {
+		s.transport.MaxIdleConns = n
+	})
+}
+
+// WithMaxIdleConnsPerHost sets the maximum number of idle connections per host
+func WithMaxIdleConnsPerHost(n int) Option {
+	return withTransport(func(s *transportSettings) {
+		s.transport.MaxIdleConnsPerHost = n
+	})
+}
+
+// WithMaxConnsPerHost limits the total number of connections per host
+func WithMaxConnsPerHost(n int) Option {
+	return withTransport(func(s *transportSettings) {
+		s.transport.MaxConnsPerHost = n
+	})
+}
+
+// WithIdleConnTimeout sets how long idle connections are kept open
+func WithIdleConnTimeout(timeout time.Duration) Option {
+	return withTransport(func(s *transportSettings) {
+		s.transport.IdleConnTimeout = timeout
+	})
+}
+
+// WithDialTimeout sets the timeout for establishing TCP connections
+func WithDialTimeout(timeout time.Duration) Option {
+	return withTransport(func(s *transportSettings) {
+		s.dialer.Timeout = timeout
+		s.dialerChanged = true
+	})
+}
+
+// WithKeepAlive sets the TCP keep-alive period. A negative value disables keep-alives.
+func WithKeepAlive(period time.Duration) Option {
+	return withTransport(func(s *transportSettings) {
+		s.dialer.KeepAlive = period
+		s.dialerChanged = true
+	})
+}
+
+// WithDNSTimeout bounds how long host name resolution may take
+func WithDNSTimeout(timeout time.Duration) Option {
+	return withTransport(func(s *transportSettings) {
+		s.dnsTimeout = timeout
+	})
+}
+
+// WithTLSHandshakeTimeout sets the timeout for TLS handshakes
+func WithTLSHandshakeTimeout(timeout time.Duration) Option {
+	return withTransport(func(s *transportSettings) {
+		s.transport.TLSHandshakeTimeout = timeout
+	})
+}
+
+// WithResponseHeaderTimeout bounds the wait for response headers after the request is written
+func WithResponseHeaderTimeout(timeout time.Duration) Option {
+	return withTransport(func(s *transportSettings) {
+		s.transport.ResponseHeaderTimeout = timeout
+	})
+}
+
+// WithTLSConfig sets the TLS configuration. It is cloned, and later TLS options
+// are applied on top of it.
+func WithTLSConfig(config *tls.Config) Option {
+	return withTransport(func(s *transportSettings) {
+		s.transport.TLSClientConfig = config.Clone()
+	})
+}
+
+// WithRootCAs sets the certificate authorities used to verify servers
+func WithRootCAs(pool *x509.CertPool) Option {
+	return withTransport(func(s *transportSettings) {
+		s.tlsConfig().RootCAs = pool
+	})
+}
+
+// WithClientCertificates sets the certificates presented for mutual TLS
+func WithClientCertificates(certs ...tls.Certificate) Option {
+	return withTransport(func(s *transportSettings) {
+		s.tlsConfig().Certificates = certs
+	})
+}
+
+// WithTLSMinVersion sets the minimum TLS version, e.g. tls.VersionTLS12
+func WithTLSMinVersion(version uint16) Option {
+	return withTransport(func(s *transportSettings) {
+		s.tlsConfig().MinVersion = version
+	})
+}
+
+// WithProxy routes requests through the given proxy. A nil URL disables
+// proxying, including proxies set in the environment.
+func WithProxy(proxyURL *url.URL) Option {
+	return withTransport(func(s *transportSettings) {
+		if proxyURL == nil {
+			s.transport.Proxy = nil
+			return
+		}
+		s.transport.Proxy = http.ProxyURL(proxyURL)
+	})
+}
+
+// WithHTTP2 enables or disables HTTP/2 over TLS
+func WithHTTP2(enabled bool) Option {
+	return withTransport(func(s *transportSettings) {
+		s.transport.ForceAttemptHTTP2 = enabled
+		if !enabled {
+			// A non-nil empty map disables the transport's built-in HTTP/2 support
+			s.transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+			if s.transport.TLSClientConfig != nil {
+				s.transport.TLSClientConfig.NextProtos = nil
+			}
+		}
+	})
+}
+
+// LoadCertPool builds a certificate pool from PEM files, starting from the
+// system pool when it is available
+func LoadCertPool(pemFiles ...string) (*x509.CertPool, error) {
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+
+	for _, file := range pemFiles {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file %s: %w", file, err)
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates found in %s", file)
+		}
+	}
+
+	return pool, nil
+}
+
+// WithConnectionStats records DNS, connect, TLS and time-to-first-byte
+// durations for every request into recorder
+func WithConnectionStats(recorder *timeutil.Recorder) Option {
+	return WithMiddleware(TraceMiddleware(recorder))
+}
+
+// TraceMiddleware records connection-level timings using httptrace. Durations
+// are recorded as "<host> dns", "<host> connect", "<host> tls" and "<host> ttfb".
+// Phases that do not happen, such as DNS on a reused connection, are not recorded.
+// A nil recorder uses the timeutil global recorder.
+func TraceMiddleware(recorder *timeutil.Recorder) Middleware {
+	record := timeutil.Record
+	if recorder != nil {
+		record = recorder.Record
+	}
+
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			host := req.URL.Host
+			// Happy Eyeballs dials several addresses in parallel, so the
+			// hooks can run concurrently and connects are keyed by address
+			var mu sync.Mutex
+			var start, dnsStart, tlsStart time.Time
+			connectStarts := make(map[string]time.Time)
+			since := func(t *time.Time) (time.Duration, bool) {
+				mu.Lock()
+				defer mu.Unlock()
+				return time.Since(*t), !t.IsZero()
+			}
+			mark := func(t *time.Time) {
+				mu.Lock()
+				*t = time.Now()
+				mu.Unlock()
+			}
+
+			trace := &httptrace.ClientTrace{
+				GetConn:  func(string) { mark(&start) },
+				DNSStart: func(httptrace.DNSStartInfo) { mark(&dnsStart) },
+				DNSDone: func(httptrace.DNSDoneInfo) {
+					if d, ok := since(&dnsStart); ok {
+						record(host+" dns", d)
+					}
+				},
+				ConnectStart: func(network, addr string) {
+					mu.Lock()
+					connectStarts[network+" "+addr] = time.Now()
+					mu.Unlock()
+				},
+				ConnectDone: func(network, addr string, err error) {
+					mu.Lock()
+					connectStart, ok := connectStarts[network+" "+addr]
+					delete(connectStarts, network+" "+addr)
+					mu.Unlock()
+					if err == nil && ok {
+						record(host+" connect", time.Since(connectStart))
+					}
+				},
+				TLSHandshakeStart: func() { mark(&tlsStart) },
+				TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+					if d, ok := since(&tlsStart); err == nil && ok {
+						record(host+" tls", d)
+					}
+				},
+				GotFirstResponseByte: func() {
+					if d, ok := since(&start); ok {
+						record(host+" ttfb", d)
+					}
+				},
+			}
+
+			req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+			return next.RoundTrip(req)
+		})
+	}
+}
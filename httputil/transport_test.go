@@ -0,0 +1,251 @@
+package httputil
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jelech/goutils/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransportOptions(t *testing.T) {
+	proxyURL, _ := url.Parse("http://proxy.local:8080")
+	client := NewClient(
+		WithMaxIdleConns(10),
+		WithMaxIdleConnsPerHost(5),
+		WithMaxConnsPerHost(20),
+		WithIdleConnTimeout(time.Minute),
+		WithTLSHandshakeTimeout(time.Second*3),
+		WithResponseHeaderTimeout(time.Second*4),
+		WithTLSMinVersion(tls.VersionTLS12),
+		WithProxy(proxyURL),
+		WithDialTimeout(time.Second),
+	)
+
+	transport, ok := client.client.Transport.(*http.Transport)
+	require.True(t, ok)
+	assert.Equal(t, 10, transport.MaxIdleConns)
+	assert.Equal(t, 5, transport.MaxIdleConnsPerHost)
+	assert.Equal(t, 20, transport.MaxConnsPerHost)
+	assert.Equal(t, time.Minute, transport.IdleConnTimeout)
+	assert.Equal(t, time.Second*3, transport.TLSHandshakeTimeout)
+	assert.Equal(t, time.Second*4, transport.ResponseHeaderTimeout)
+	assert.Equal(t, uint16(tls.VersionTLS12), transport.TLSClientConfig.MinVersion)
+	assert.NotNil(t, transport.DialContext)
+
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+	proxy, err := transport.Proxy(req)
+	require.NoError(t, err)
+	assert.Equal(t, proxyURL, proxy)
+
+	// The default transport must not be modified
+	assert.NotSame(t, http.DefaultTransport, transport)
+	assert.NotEqual(t, 10, http.DefaultTransport.(*http.Transport).MaxIdleConnsPerHost)
+}
+
+func TestTransportOptions_CustomRoundTripperUntouched(t *testing.T) {
+	custom := RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return nil, nil
+	})
+	client := NewClient(WithHTTPClient(&http.Client{Transport: custom}), WithMaxIdleConns(1))
+
+	_, ok := client.client.Transport.(*http.Transport)
+	assert.False(t, ok)
+}
+
+func TestTransport_TLSWithRootCAs(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Certificate())
+
+	client := NewClient(WithRootCAs(pool))
+	resp, err := client.Get(server.URL)
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/2.0", readAll(t, resp))
+
+	client = NewClient(WithRootCAs(pool), WithHTTP2(false))
+	resp, err = client.Get(server.URL)
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1", readAll(t, resp))
+
+	// Without the CA the server certificate is rejected
+	client = NewClient(WithRootCAs(x509.NewCertPool()))
+	_, err = client.Get(server.URL)
+	assert.Error(t, err)
+}
+
+func TestTransport_DNSTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL)
+	client := NewClient(WithDNSTimeout(time.Second*5), WithKeepAlive(-1))
+	resp, err := client.Get("http://localhost:" + u.Port())
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+}
+
+func TestSplitAddrs(t *testing.T) {
+	ips := []net.IPAddr{{IP: net.ParseIP("::1")}, {IP: net.ParseIP("10.0.0.1")}, {IP: net.ParseIP("::2")}}
+
+	primaries, fallbacks := splitAddrs("tcp", ips, "80")
+	assert.Equal(t, []string{"[::1]:80", "[::2]:80"}, primaries)
+	assert.Equal(t, []string{"10.0.0.1:80"}, fallbacks)
+
+	primaries, fallbacks = splitAddrs("tcp4", ips, "80")
+	assert.Equal(t, []string{"10.0.0.1:80"}, primaries)
+	assert.Empty(t, fallbacks)
+}
+
+func TestDialSerial_SplitsTimeout(t *testing.T) {
+	now := time.Now()
+	deadline := now.Add(time.Second * 10)
+	var timeouts []time.Duration
+	dial := func(ctx context.Context, addr string) (net.Conn, error) {
+		d, _ := ctx.Deadline()
+		timeouts = append(timeouts, d.Sub(now))
+		return nil, errors.New("refused")
+	}
+
+	_, err := dialSerial(context.Background(), dial, []string{"a:1", "b:1"}, deadline)
+	assert.EqualError(t, err, "refused")
+	require.Len(t, timeouts, 2)
+	assert.InDelta(t, float64(time.Second*5), float64(timeouts[0]), float64(time.Millisecond*100))
+	assert.InDelta(t, float64(time.Second*10), float64(timeouts[1]), float64(time.Millisecond*100))
+
+	assert.Equal(t, now.Add(time.Second*2), partialDeadline(now, now.Add(time.Second*5), 4))
+	assert.Equal(t, now.Add(time.Second), partialDeadline(now, now.Add(time.Second), 4))
+}
+
+func TestDialParallel_Fallback(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	dial := func(ctx context.Context, addr string) (net.Conn, error) {
+		if addr == "[::1]:80" {
+			// The primary family blackholes connections
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		return client, nil
+	}
+
+	start := time.Now()
+	conn, err := dialParallel(context.Background(), dial, []string{"[::1]:80"}, []string{"127.0.0.1:80"},
+		start.Add(time.Second*30), time.Millisecond*50)
+	require.NoError(t, err)
+	assert.Same(t, client, conn)
+	assert.Less(t, time.Since(start), time.Second)
+	conn.Close()
+}
+
+func TestLoadCertPool(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	require.NoError(t, os.WriteFile(caFile, data, 0644))
+
+	pool, err := LoadCertPool(caFile)
+	require.NoError(t, err)
+
+	resp, err := NewClient(WithRootCAs(pool)).Get(server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	emptyFile := filepath.Join(dir, "empty.pem")
+	require.NoError(t, os.WriteFile(emptyFile, []byte("nothing here"), 0644))
+	_, err = LoadCertPool(emptyFile)
+	assert.Error(t, err)
+
+	_, err = LoadCertPool(filepath.Join(dir, "missing.pem"))
+	assert.Error(t, err)
+}
+
+func TestWithConnectionStats(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Certificate())
+
+	recorder := timeutil.NewRecorder()
+	client := NewClient(WithRootCAs(pool), WithConnectionStats(recorder))
+
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(server.URL)
+		require.NoError(t, err)
+		readAll(t, resp)
+	}
+
+	host := server.Listener.Addr().String()
+	connect, ok := recorder.Get(host + " connect")
+	require.True(t, ok)
+	assert.Equal(t, int64(1), connect.Count) // Second request reuses the connection
+
+	tlsStats, ok := recorder.Get(host + " tls")
+	require.True(t, ok)
+	assert.Equal(t, int64(1), tlsStats.Count)
+
+	ttfb, ok := recorder.Get(host + " ttfb")
+	require.True(t, ok)
+	assert.Equal(t, int64(2), ttfb.Count)
+}
+
+func TestTraceMiddleware_ParallelDials(t *testing.T) {
+	recorder := timeutil.NewRecorder()
+	// Simulate Happy Eyeballs: the IPv6 dial succeeds while a later IPv4
+	// fallback dial, racing it on another goroutine, fails
+	dial := RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		trace := httptrace.ContextClientTrace(req.Context())
+		trace.ConnectStart("tcp", "[::1]:80")
+		time.Sleep(20 * time.Millisecond)
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			trace.ConnectStart("tcp", "127.0.0.1:80")
+			trace.ConnectDone("tcp", "127.0.0.1:80", errors.New("connection refused"))
+		}()
+		trace.ConnectDone("tcp", "[::1]:80", nil)
+		wg.Wait()
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+	})
+
+	req, err := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+	require.NoError(t, err)
+	_, err = TraceMiddleware(recorder)(dial).RoundTrip(req)
+	require.NoError(t, err)
+
+	connect, ok := recorder.Get("example.com connect")
+	require.True(t, ok)
+	assert.Equal(t, int64(1), connect.Count)
+	assert.GreaterOrEqual(t, connect.TotalTime, 20*time.Millisecond)
+}
@@ -110,12 +110,24 @@ func defaultConfig() *Config {
 	}
 }
 
-// Do executes the given function with retry logic
-func Do(fn RetryableFunc, options ...Option) error {
+// NewConfig returns the default configuration with options applied. It is
+// useful for driving retries from another loop, such as an SDK retryer.
+func NewConfig(options ...Option) *Config {
 	config := defaultConfig()
 	for _, option := range options {
 		option(config)
 	}
+	return config
+}
+
+// Delay returns how long to wait after the given failed attempt (starting at 1)
+func (c *Config) Delay(attempt int) time.Duration {
+	return calculateDelay(c, attempt)
+}
+
+// Do executes the given function with retry logic
+func Do(fn RetryableFunc, options ...Option) error {
+	config := NewConfig(options...)
 
 	var lastErr error
 	for attempt := 1; attempt <= config.MaxAttempts; attempt++ {
@@ -174,6 +174,14 @@ func TestCalculateDelay_WithJitter(t *testing.T) {
 	assert.True(t, delay <= time.Second)
 }
 
+func TestNewConfig(t *testing.T) {
+	config := NewConfig(WithMaxAttempts(5), WithDelay(time.Second), WithBackoff(LinearBackoff), WithJitter(false))
+
+	assert.Equal(t, 5, config.MaxAttempts)
+	assert.Equal(t, time.Second*30, config.MaxDelay, "unset options keep their defaults")
+	assert.Equal(t, time.Second*3, config.Delay(3))
+}
+
 func TestPermanentError(t *testing.T) {
 	originalErr := errors.New("original error")
 	permErr := Permanent(originalErr)
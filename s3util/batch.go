@@ -0,0 +1,374 @@
+package s3util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+const (
+	// maxDeleteBatch is the most keys a single DeleteObjects call accepts
+	maxDeleteBatch = 1000
+	// maxCopyObjectSize is the largest object CopyObject can copy in one request
+	maxCopyObjectSize = 5 * 1024 * 1024 * 1024
+)
+
+// KeyError is a failure for a single key in a batch operation
+type KeyError struct {
+	Key     string
+	Code    string
+	Message string
+}
+
+func (e *KeyError) Error() string {
+	return fmt.Sprintf("%s: %s: %s", e.Key, e.Code, e.Message)
+}
+
+// BatchResult reports the outcome of a batch operation per key
+type BatchResult struct {
+	Succeeded []string
+	Failed    map[string]error
+}
+
+// newBatchResult creates an empty BatchResult
+func newBatchResult() *BatchResult {
+	return &BatchResult{Failed: make(map[string]error)}
+}
+
+// err summarizes failed keys as an error
+func (r *BatchResult) err(operation string) error {
+	if len(r.Failed) == 0 {
+		return nil
+	}
+	return fmt.Errorf("failed to %s %d objects", operation, len(r.Failed))
+}
+
+// CopyOptions contains options for CopyPrefix and MovePrefix
+type CopyOptions struct {
+	Concurrency        int   // Objects copied in parallel (default 8)
+	MultipartThreshold int64 // Objects larger than this are copied with UploadPartCopy (default and maximum 5GB)
+	PartSize           int64 // Part size for multipart copies (default 512MB, at least 5MB); raised if an object would need over 10000 parts
+}
+
+// DeleteObjects deletes keys in batches of 1000 using the DeleteObjects API.
+// Keys that fail are listed in the result with a *KeyError, and an error is
+// returned if any key could not be deleted.
+func (c *Client) DeleteObjects(bucket string, keys []string) (*BatchResult, error) {
+	return c.DeleteObjectsWithContext(context.Background(), bucket, keys)
+}
+
+// DeleteObjectsWithContext is like DeleteObjects but uses ctx for the S3 requests
+func (c *Client) DeleteObjectsWithContext(ctx context.Context, bucket string, keys []string) (*BatchResult, error) {
+	result := newBatchResult()
+	for start := 0; start < len(keys); start += maxDeleteBatch {
+		end := start + maxDeleteBatch
+		if end > len(keys) {
+			end = len(keys)
+		}
+		if err := c.deleteBatch(ctx, bucket, keys[start:end], result); err != nil {
+			return result, err
+		}
+	}
+	return result, result.err("delete")
+}
+
+// deleteBatch deletes up to 1000 keys and records the outcome in result
+func (c *Client) deleteBatch(ctx context.Context, bucket string, keys []string, result *BatchResult) error {
+	objects := make([]*s3.ObjectIdentifier, 0, len(keys))
+	for _, key := range keys {
+		objects = append(objects, &s3.ObjectIdentifier{Key: aws.String(key)})
+	}
+
+	output, err := c.s3Client.DeleteObjectsWithContext(ctx, &s3.DeleteObjectsInput{
+		Bucket: aws.String(bucket),
+		Delete: &s3.Delete{
+			Objects: objects,
+			Quiet:   aws.Bool(true),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete objects in s3://%s: %w", bucket, err)
+	}
+
+	failed := make(map[string]bool, len(output.Errors))
+	for _, e := range output.Errors {
+		key := aws.StringValue(e.Key)
+		failed[key] = true
+		result.Failed[key] = &KeyError{Key: key, Code: aws.StringValue(e.Code), Message: aws.StringValue(e.Message)}
+	}
+	for _, key := range keys {
+		if !failed[key] {
+			result.Succeeded = append(result.Succeeded, key)
+		}
+	}
+	return nil
+}
+
+// DeletePrefix deletes every object under prefix, listing and deleting in
+// batches of 1000. An empty prefix is rejected to avoid emptying a bucket by mistake.
+func (c *Client) DeletePrefix(bucket, prefix string) (*BatchResult, error) {
+	return c.DeletePrefixWithContext(context.Background(), bucket, prefix)
+}
+
+// DeletePrefixWithContext is like DeletePrefix but uses ctx for the S3 requests
+func (c *Client) DeletePrefixWithContext(ctx context.Context, bucket, prefix string) (*BatchResult, error) {
+	if prefix == "" {
+		return nil, errors.New("refusing to delete with an empty prefix")
+	}
+
+	result := newBatchResult()
+	batch := make([]string, 0, maxDeleteBatch)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		err := c.deleteBatch(ctx, bucket, batch, result)
+		batch = batch[:0]
+		return err
+	}
+
+	it := c.IterateWithContext(ctx, bucket, &ListOptions{Prefix: prefix})
+	for it.Next() {
+		batch = append(batch, it.Object().Key)
+		if len(batch) == maxDeleteBatch {
+			if err := flush(); err != nil {
+				return result, err
+			}
+		}
+	}
+	if err := it.Err(); err != nil {
+		return result, err
+	}
+	if err := flush(); err != nil {
+		return result, err
+	}
+
+	return result, result.err("delete")
+}
+
+// CopyPrefix copies every object under srcPrefix to dstPrefix, keeping the
+// key suffix. Objects above the multipart threshold are copied with UploadPartCopy.
+func (c *Client) CopyPrefix(srcBucket, srcPrefix, dstBucket, dstPrefix string, options *CopyOptions) (*BatchResult, error) {
+	return c.CopyPrefixWithContext(context.Background(), srcBucket, srcPrefix, dstBucket, dstPrefix, options)
+}
+
+// CopyPrefixWithContext is like CopyPrefix but uses ctx for the S3 requests
+func (c *Client) CopyPrefixWithContext(ctx context.Context, srcBucket, srcPrefix, dstBucket, dstPrefix string, options *CopyOptions) (*BatchResult, error) {
+	config := copyDefaults(options)
+	result := newBatchResult()
+
+	var (
+		mu  sync.Mutex
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, config.Concurrency)
+	)
+	it := c.IterateWithContext(ctx, srcBucket, &ListOptions{Prefix: srcPrefix})
+	for it.Next() {
+		object := it.Object()
+		dstKey := dstPrefix + strings.TrimPrefix(object.Key, srcPrefix)
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			var err error
+			if object.Size > config.MultipartThreshold {
+				err = c.MultipartCopyWithContext(ctx, srcBucket, object.Key, dstBucket, dstKey, object.Size, config.PartSize)
+			} else {
+				err = c.CopyObjectWithContext(ctx, srcBucket, object.Key, dstBucket, dstKey)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				result.Failed[object.Key] = err
+				return
+			}
+			result.Succeeded = append(result.Succeeded, object.Key)
+		}()
+	}
+	wg.Wait()
+	sort.Strings(result.Succeeded)
+
+	if err := it.Err(); err != nil {
+		return result, err
+	}
+	return result, result.err("copy")
+}
+
+// MovePrefix copies every object under srcPrefix to dstPrefix and then
+// deletes the sources that were copied successfully
+func (c *Client) MovePrefix(srcBucket, srcPrefix, dstBucket, dstPrefix string, options *CopyOptions) (*BatchResult, error) {
+	return c.MovePrefixWithContext(context.Background(), srcBucket, srcPrefix, dstBucket, dstPrefix, options)
+}
+
+// MovePrefixWithContext is like MovePrefix but uses ctx for the S3 requests
+func (c *Client) MovePrefixWithContext(ctx context.Context, srcBucket, srcPrefix, dstBucket, dstPrefix string, options *CopyOptions) (*BatchResult, error) {
+	copied, copyErr := c.CopyPrefixWithContext(ctx, srcBucket, srcPrefix, dstBucket, dstPrefix, options)
+	if copied == nil {
+		return nil, copyErr
+	}
+
+	deleted, err := c.DeleteObjectsWithContext(ctx, srcBucket, copied.Succeeded)
+	for key, keyErr := range copied.Failed {
+		deleted.Failed[key] = keyErr
+	}
+	if copyErr != nil && err == nil {
+		err = copyErr
+	}
+	if err != nil {
+		return deleted, err
+	}
+	return deleted, deleted.err("move")
+}
+
+// MultipartCopy copies an object of the given size with server-side
+// UploadPartCopy requests, which is required for objects over 5GB. Like
+// CopyObject it keeps the source's content headers, user metadata, tags,
+// storage class and encryption. The copy fails if the source changes while
+// its parts are copied.
+func (c *Client) MultipartCopy(srcBucket, srcKey, dstBucket, dstKey string, size, partSize int64) error {
+	return c.MultipartCopyWithContext(context.Background(), srcBucket, srcKey, dstBucket, dstKey, size, partSize)
+}
+
+// MultipartCopyWithContext is like MultipartCopy but uses ctx for the S3 requests
+func (c *Client) MultipartCopyWithContext(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey string, size, partSize int64) error {
+	if size <= 0 {
+		return fmt.Errorf("invalid size %d for multipart copy of s3://%s/%s", size, srcBucket, srcKey)
+	}
+
+	info, err := c.HeadObjectWithContext(ctx, srcBucket, srcKey)
+	if err != nil {
+		return fmt.Errorf("failed to start multipart copy: %w", err)
+	}
+	tags, err := c.GetObjectTaggingWithContext(ctx, srcBucket, srcKey)
+	if err != nil {
+		return fmt.Errorf("failed to start multipart copy: %w", err)
+	}
+	return c.multipartCopy(ctx, srcBucket, srcKey, info.ETag, copyUploadInput(dstBucket, dstKey, info, tags), size, partSize)
+}
+
+// copyUploadInput creates the multipart upload for a copy of an object
+// described by info. CreateMultipartUpload copies nothing from the source,
+// so the headers, metadata and tags are set explicitly.
+func copyUploadInput(bucket, key string, info *ObjectInfo, tags map[string]string) *s3.CreateMultipartUploadInput {
+	input := &s3.CreateMultipartUploadInput{
+		Bucket:             aws.String(bucket),
+		Key:                aws.String(key),
+		Metadata:           aws.StringMap(info.Metadata),
+		ContentType:        optionalString(info.ContentType),
+		ContentEncoding:    optionalString(info.ContentEncoding),
+		ContentLanguage:    optionalString(info.ContentLanguage),
+		ContentDisposition: optionalString(info.ContentDisposition),
+		CacheControl:       optionalString(info.CacheControl),
+		StorageClass:       optionalString(info.StorageClass),
+		Tagging:            optionalString(encodeTagging(tags)),
+	}
+	if info.ServerSideEncryption != "" {
+		input.ServerSideEncryption = aws.String(info.ServerSideEncryption)
+		input.SSEKMSKeyId = optionalString(info.KMSKeyID)
+	}
+	return input
+}
+
+// multipartCopy copies srcBucket/srcKey into the upload created by create,
+// which sets the destination and its metadata. Every part is copied only if
+// the source still has etag, so a source changed mid-copy fails the copy.
+func (c *Client) multipartCopy(ctx context.Context, srcBucket, srcKey, etag string, create *s3.CreateMultipartUploadInput, size, partSize int64) error {
+	if partSize <= 0 {
+		partSize = copyDefaults(nil).PartSize
+	}
+	dstBucket, dstKey := aws.StringValue(create.Bucket), aws.StringValue(create.Key)
+	partSize, err := resumablePartSize(size, partSize)
+	if err != nil {
+		return fmt.Errorf("failed to copy s3://%s/%s: %w", srcBucket, srcKey, err)
+	}
+
+	created, err := c.s3Client.CreateMultipartUploadWithContext(ctx, create)
+	if err != nil {
+		return fmt.Errorf("failed to start multipart copy to s3://%s/%s: %w", dstBucket, dstKey, err)
+	}
+
+	var parts []*s3.CompletedPart
+	for start, number := int64(0), int64(1); start < size; start, number = start+partSize, number+1 {
+		end := start + partSize - 1
+		if end >= size {
+			end = size - 1
+		}
+
+		output, err := c.s3Client.UploadPartCopyWithContext(ctx, &s3.UploadPartCopyInput{
+			Bucket:            aws.String(dstBucket),
+			Key:               aws.String(dstKey),
+			UploadId:          created.UploadId,
+			PartNumber:        aws.Int64(number),
+			CopySource:        aws.String(copySource(srcBucket, srcKey)),
+			CopySourceRange:   aws.String(fmt.Sprintf("bytes=%d-%d", start, end)),
+			CopySourceIfMatch: aws.String(`"` + etag + `"`),
+		})
+		if err != nil {
+			c.abortUpload(dstBucket, dstKey, created.UploadId)
+			return fmt.Errorf("failed to copy part %d of s3://%s/%s: %w", number, srcBucket, srcKey, err)
+		}
+		parts = append(parts, &s3.CompletedPart{ETag: output.CopyPartResult.ETag, PartNumber: aws.Int64(number)})
+	}
+
+	_, err = c.s3Client.CompleteMultipartUploadWithContext(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(dstBucket),
+		Key:             aws.String(dstKey),
+		UploadId:        created.UploadId,
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: parts},
+	})
+	if err != nil {
+		c.abortUpload(dstBucket, dstKey, created.UploadId)
+		return fmt.Errorf("failed to complete multipart copy to s3://%s/%s: %w", dstBucket, dstKey, err)
+	}
+
+	return nil
+}
+
+// abortUpload aborts a multipart upload, ignoring errors. It deliberately
+// does not use the caller's context, which may already be cancelled.
+func (c *Client) abortUpload(bucket, key string, uploadID *string) {
+	c.s3Client.AbortMultipartUpload(&s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(bucket),
+		Key:      aws.String(key),
+		UploadId: uploadID,
+	})
+}
+
+// copySource builds a URL-encoded x-amz-copy-source value. "+" is escaped
+// too, since S3 would otherwise decode it as a space.
+func copySource(bucket, key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = strings.ReplaceAll(url.QueryEscape(segment), "+", "%20")
+	}
+	return bucket + "/" + strings.Join(segments, "/")
+}
+
+// copyDefaults returns a copy of options with defaults applied
+func copyDefaults(options *CopyOptions) *CopyOptions {
+	config := CopyOptions{}
+	if options != nil {
+		config = *options
+	}
+	if config.Concurrency <= 0 {
+		config.Concurrency = 8
+	}
+	if config.MultipartThreshold <= 0 || config.MultipartThreshold > maxCopyObjectSize {
+		config.MultipartThreshold = maxCopyObjectSize
+	}
+	if config.PartSize <= 0 {
+		config.PartSize = 512 * 1024 * 1024
+	}
+	return &config
+}
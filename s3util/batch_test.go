@@ -0,0 +1,162 @@
+package s3util
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/jelech/goutils/s3util/s3test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countRequests counts logged requests starting with prefix
+func countRequests(f *s3test.Server, prefix string) int {
+	count := 0
+	for _, request := range f.Requests() {
+		if strings.HasPrefix(request, prefix) {
+			count++
+		}
+	}
+	return count
+}
+
+func TestDeleteObjects_Batches(t *testing.T) {
+	f, client := newFakeS3(t)
+	seedObjects(f, "bucket", "k", 2500)
+
+	var keys []string
+	for i := 0; i < 2500; i++ {
+		keys = append(keys, fmt.Sprintf("k%04d", i))
+	}
+
+	result, err := client.DeleteObjects("bucket", keys)
+	require.NoError(t, err)
+	assert.Len(t, result.Succeeded, 2500)
+	assert.Empty(t, result.Failed)
+	assert.Empty(t, f.Keys("bucket"))
+	assert.Equal(t, 3, countRequests(f, "POST /bucket?delete"))
+}
+
+func TestDeleteObjects_PerKeyErrors(t *testing.T) {
+	f, client := newFakeS3(t)
+	seedObjects(f, "bucket", "k", 3)
+	f.FailDelete("k0001")
+
+	result, err := client.DeleteObjects("bucket", []string{"k0000", "k0001", "k0002"})
+	require.Error(t, err)
+	assert.Equal(t, []string{"k0000", "k0002"}, result.Succeeded)
+	require.Contains(t, result.Failed, "k0001")
+
+	keyErr, ok := result.Failed["k0001"].(*KeyError)
+	require.True(t, ok)
+	assert.Equal(t, "AccessDenied", keyErr.Code)
+	assert.Equal(t, []string{"k0001"}, f.Keys("bucket"))
+}
+
+func TestDeletePrefix(t *testing.T) {
+	f, client := newFakeS3(t)
+	seedObjects(f, "bucket", "old/", 1500)
+	seedObjects(f, "bucket", "keep/", 2)
+
+	result, err := client.DeletePrefix("bucket", "old/")
+	require.NoError(t, err)
+	assert.Len(t, result.Succeeded, 1500)
+	assert.Equal(t, []string{"keep/0000", "keep/0001"}, f.Keys("bucket"))
+
+	_, err = client.DeletePrefix("bucket", "")
+	assert.Error(t, err)
+}
+
+func TestCopyPrefix(t *testing.T) {
+	f, client := newFakeS3(t)
+	f.PutObject("src", "data/a b.txt", []byte("hello"))
+	f.PutObject("src", "data/nested/c.txt", []byte("world"))
+	f.PutObject("src", "other/x", []byte("x"))
+
+	result, err := client.CopyPrefix("src", "data/", "dst", "backup/", &CopyOptions{Concurrency: 2})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"data/a b.txt", "data/nested/c.txt"}, result.Succeeded)
+	assert.Equal(t, []string{"backup/a b.txt", "backup/nested/c.txt"}, f.Keys("dst"))
+
+	obj, ok := f.Object("dst", "backup/a b.txt")
+	require.True(t, ok)
+	assert.Equal(t, "hello", string(obj.Data))
+}
+
+func TestCopyPrefix_MultipartCopy(t *testing.T) {
+	allowSmallParts(t)
+	f, client := newFakeS3(t)
+	data := []byte(strings.Repeat("0123456789", 10))
+	_, err := client.UploadFromReader("bucket", "big/object", bytes.NewReader(data), &UploadOptions{
+		ContentType:  "text/plain",
+		Metadata:     map[string]*string{"Owner": aws.String("alice")},
+		StorageClass: s3.StorageClassStandardIa,
+	})
+	require.NoError(t, err)
+	require.NoError(t, client.PutObjectTagging("bucket", "big/object", map[string]string{"team": "data"}))
+	f.PutObject("bucket", "big/small", []byte("tiny"))
+
+	result, err := client.CopyPrefix("bucket", "big/", "bucket", "copy/", &CopyOptions{
+		MultipartThreshold: 50,
+		PartSize:           30,
+	})
+	require.NoError(t, err)
+	assert.Len(t, result.Succeeded, 2)
+
+	obj, ok := f.Object("bucket", "copy/object")
+	require.True(t, ok)
+	assert.Equal(t, data, obj.Data)
+	assert.True(t, strings.HasSuffix(obj.ETag, "-4"))
+	assert.Equal(t, 4, countRequests(f, "PUT /bucket/copy/object?partNumber="))
+	assert.Equal(t, "text/plain", obj.ContentType)
+	assert.Equal(t, map[string]string{"owner": "alice"}, obj.Metadata)
+	assert.Equal(t, s3.StorageClassStandardIa, obj.StorageClass)
+	assert.Equal(t, map[string]string{"team": "data"}, obj.Tags)
+
+	// The small object used a plain CopyObject
+	small, ok := f.Object("bucket", "copy/small")
+	require.True(t, ok)
+	assert.Equal(t, "tiny", string(small.Data))
+}
+
+func TestMovePrefix(t *testing.T) {
+	f, client := newFakeS3(t)
+	seedObjects(f, "bucket", "in/", 5)
+	f.FailDelete("in/0003")
+
+	result, err := client.MovePrefix("bucket", "in/", "bucket", "out/", nil)
+	require.Error(t, err)
+	assert.Len(t, result.Succeeded, 4)
+	assert.Contains(t, result.Failed, "in/0003")
+
+	keys := f.Keys("bucket")
+	assert.Contains(t, keys, "in/0003")
+	assert.Contains(t, keys, "out/0003")
+	assert.NotContains(t, keys, "in/0000")
+	assert.Len(t, keys, 6)
+}
+
+func TestCopySource(t *testing.T) {
+	assert.Equal(t, "bucket/a%20b/c%2Bd.txt", copySource("bucket", "a b/c+d.txt"))
+}
+
+func TestMultipartCopy_InvalidSize(t *testing.T) {
+	f, client := newFakeS3(t)
+	f.PutObject("bucket", "empty", nil)
+
+	assert.Error(t, client.MultipartCopy("bucket", "empty", "bucket", "copy", 0, 0))
+	assert.Zero(t, countRequests(f, "POST /bucket/copy?uploads"))
+}
+
+func TestMultipartCopy_PartSize(t *testing.T) {
+	f, client := newFakeS3(t)
+	f.PutObject("bucket", "src", []byte(strings.Repeat("x", 100)))
+
+	err := client.MultipartCopy("bucket", "src", "bucket", "copy", 100, 1<<20)
+	assert.ErrorContains(t, err, "below the S3 minimum")
+	assert.Zero(t, countRequests(f, "POST /bucket/copy?uploads"))
+}
@@ -0,0 +1,462 @@
+package s3util
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// ChecksumAlgorithm selects an additional checksum that S3 validates and
+// stores alongside the object
+type ChecksumAlgorithm string
+
+const (
+	ChecksumSHA256 ChecksumAlgorithm = s3.ChecksumAlgorithmSha256
+	ChecksumCRC32C ChecksumAlgorithm = s3.ChecksumAlgorithmCrc32c
+)
+
+// ErrIntegrity is returned (wrapped) when transferred data does not match
+// its expected size, ETag or checksum
+var ErrIntegrity = errors.New("integrity check failed")
+
+// newHash returns a hash for the algorithm
+func (a ChecksumAlgorithm) newHash() (hash.Hash, error) {
+	switch a {
+	case ChecksumSHA256:
+		return sha256.New(), nil
+	case ChecksumCRC32C:
+		return crc32.New(crc32.MakeTable(crc32.Castagnoli)), nil
+	default:
+		return nil, fmt.Errorf("unsupported checksum algorithm %q", a)
+	}
+}
+
+// sum returns the raw checksum of data
+func (a ChecksumAlgorithm) sum(data []byte) ([]byte, error) {
+	h, err := a.newHash()
+	if err != nil {
+		return nil, err
+	}
+	h.Write(data)
+	return h.Sum(nil), nil
+}
+
+// checkedPart is an uploaded part with the digests needed to verify the object
+type checkedPart struct {
+	number   int64
+	etag     string
+	md5      []byte
+	checksum []byte
+}
+
+// checkedUpload uploads reader in parts of partSize with bounded concurrency.
+// Every request carries Content-MD5 and, if configured, an x-amz-checksum-*
+// header. With options.Verify the returned ETags are checked against the MD5
+// of the data sent: a plain MD5 for single-part objects, or the MD5 of the
+// concatenated part MD5s followed by "-N" for multipart objects.
+func (c *Client) checkedUpload(ctx context.Context, bucket, key string, reader io.Reader, partSize int64, concurrency int, options *UploadOptions) (*s3manager.UploadOutput, error) {
+	if partSize <= 0 {
+		partSize = c.uploader.PartSize
+	}
+	if concurrency <= 0 {
+		concurrency = c.uploader.Concurrency
+	}
+	if options.ChecksumAlgorithm != "" {
+		if _, err := options.ChecksumAlgorithm.newHash(); err != nil {
+			return nil, err
+		}
+	}
+
+	first := make([]byte, partSize)
+	n, err := io.ReadFull(reader, first)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return c.checkedPut(ctx, bucket, key, first[:n], options)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read upload data: %w", err)
+	}
+
+	input := createUploadInput(bucket, key, options)
+	if options.ChecksumAlgorithm != "" {
+		input.ChecksumAlgorithm = aws.String(string(options.ChecksumAlgorithm))
+	}
+	created, err := c.s3Client.CreateMultipartUploadWithContext(ctx, input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start multipart upload to s3://%s/%s: %w", bucket, key, err)
+	}
+	uploadID := aws.StringValue(created.UploadId)
+
+	parts, err := c.uploadCheckedParts(ctx, bucket, key, uploadID, first, reader, partSize, concurrency, options)
+	if err != nil {
+		c.abortUpload(bucket, key, created.UploadId)
+		return nil, err
+	}
+
+	output, err := c.completeCheckedUpload(ctx, bucket, key, uploadID, parts, options)
+	if err != nil {
+		c.abortUpload(bucket, key, created.UploadId)
+		return nil, err
+	}
+	return output, nil
+}
+
+// uploadCheckedParts uploads first and then the rest of reader as numbered parts
+func (c *Client) uploadCheckedParts(ctx context.Context, bucket, key, uploadID string, first []byte, reader io.Reader, partSize int64, concurrency int, options *UploadOptions) ([]checkedPart, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		parts    []checkedPart
+		firstErr error
+		sem      = make(chan struct{}, concurrency)
+	)
+
+	data := first
+	for number := int64(1); ; number++ {
+		sem <- struct{}{}
+		if ctx.Err() != nil {
+			<-sem
+			break
+		}
+
+		number, part := number, data
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			uploaded, err := c.uploadCheckedPart(ctx, bucket, key, uploadID, number, part, options)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+					cancel()
+				}
+				return
+			}
+			parts = append(parts, uploaded)
+		}()
+
+		data = make([]byte, partSize)
+		n, err := io.ReadFull(reader, data)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+			mu.Lock()
+			if firstErr == nil {
+				firstErr = fmt.Errorf("failed to read upload data: %w", err)
+			}
+			mu.Unlock()
+			break
+		}
+		data = data[:n]
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	sort.Slice(parts, func(i, j int) bool { return parts[i].number < parts[j].number })
+	return parts, nil
+}
+
+// uploadCheckedPart uploads one part with Content-MD5 and the optional checksum
+func (c *Client) uploadCheckedPart(ctx context.Context, bucket, key, uploadID string, number int64, data []byte, options *UploadOptions) (checkedPart, error) {
+	digest := md5.Sum(data)
+	part := checkedPart{number: number, md5: digest[:]}
+
+	input := &s3.UploadPartInput{
+		Bucket:     aws.String(bucket),
+		Key:        aws.String(key),
+		UploadId:   aws.String(uploadID),
+		PartNumber: aws.Int64(number),
+		Body:       bytes.NewReader(data),
+		ContentMD5: aws.String(base64.StdEncoding.EncodeToString(digest[:])),
+	}
+	if options.ChecksumAlgorithm != "" {
+		sum, err := options.ChecksumAlgorithm.sum(data)
+		if err != nil {
+			return part, err
+		}
+		part.checksum = sum
+		encoded := aws.String(base64.StdEncoding.EncodeToString(sum))
+		input.ChecksumAlgorithm = aws.String(string(options.ChecksumAlgorithm))
+		switch options.ChecksumAlgorithm {
+		case ChecksumSHA256:
+			input.ChecksumSHA256 = encoded
+		case ChecksumCRC32C:
+			input.ChecksumCRC32C = encoded
+		}
+	}
+
+	output, err := c.s3Client.UploadPartWithContext(ctx, input)
+	if err != nil {
+		return part, fmt.Errorf("failed to upload part %d of s3://%s/%s: %w", number, bucket, key, err)
+	}
+	part.etag = strings.Trim(aws.StringValue(output.ETag), `"`)
+
+	if options.Verify && etagIsMD5(options) && part.etag != hex.EncodeToString(part.md5) {
+		return part, fmt.Errorf("%w: part %d of s3://%s/%s has ETag %s, expected %s",
+			ErrIntegrity, number, bucket, key, part.etag, hex.EncodeToString(part.md5))
+	}
+	return part, nil
+}
+
+// completeCheckedUpload completes the upload and verifies the composite ETag
+func (c *Client) completeCheckedUpload(ctx context.Context, bucket, key, uploadID string, parts []checkedPart, options *UploadOptions) (*s3manager.UploadOutput, error) {
+	completed := make([]*s3.CompletedPart, 0, len(parts))
+	digests := make([][]byte, 0, len(parts))
+	for _, part := range parts {
+		cp := &s3.CompletedPart{PartNumber: aws.Int64(part.number), ETag: aws.String(`"` + part.etag + `"`)}
+		if part.checksum != nil {
+			encoded := aws.String(base64.StdEncoding.EncodeToString(part.checksum))
+			switch options.ChecksumAlgorithm {
+			case ChecksumSHA256:
+				cp.ChecksumSHA256 = encoded
+			case ChecksumCRC32C:
+				cp.ChecksumCRC32C = encoded
+			}
+		}
+		completed = append(completed, cp)
+		digests = append(digests, part.md5)
+	}
+
+	output, err := c.s3Client.CompleteMultipartUploadWithContext(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(bucket),
+		Key:             aws.String(key),
+		UploadId:        aws.String(uploadID),
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: completed},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to complete upload to s3://%s/%s: %w", bucket, key, err)
+	}
+
+	etag := strings.Trim(aws.StringValue(output.ETag), `"`)
+	if expected := compositeETag(digests); options.Verify && etagIsMD5(options) && etag != expected {
+		return nil, fmt.Errorf("%w: s3://%s/%s has ETag %s, expected %s", ErrIntegrity, bucket, key, etag, expected)
+	}
+
+	return &s3manager.UploadOutput{
+		Location:  aws.StringValue(output.Location),
+		VersionID: output.VersionId,
+		UploadID:  uploadID,
+		ETag:      output.ETag,
+	}, nil
+}
+
+// checkedPut uploads data with a single PutObject request
+func (c *Client) checkedPut(ctx context.Context, bucket, key string, data []byte, options *UploadOptions) (*s3manager.UploadOutput, error) {
+	digest := md5.Sum(data)
+	created := createUploadInput(bucket, key, options)
+	input := &s3.PutObjectInput{
+		Bucket:               created.Bucket,
+		Key:                  created.Key,
+		Body:                 bytes.NewReader(data),
+		ContentMD5:           aws.String(base64.StdEncoding.EncodeToString(digest[:])),
+		ContentType:          created.ContentType,
+		ContentEncoding:      created.ContentEncoding,
+		Metadata:             created.Metadata,
+		ACL:                  created.ACL,
+		StorageClass:         created.StorageClass,
+		ServerSideEncryption: created.ServerSideEncryption,
+		SSEKMSKeyId:          created.SSEKMSKeyId,
+	}
+	if options.ChecksumAlgorithm != "" {
+		sum, err := options.ChecksumAlgorithm.sum(data)
+		if err != nil {
+			return nil, err
+		}
+		encoded := aws.String(base64.StdEncoding.EncodeToString(sum))
+		input.ChecksumAlgorithm = aws.String(string(options.ChecksumAlgorithm))
+		switch options.ChecksumAlgorithm {
+		case ChecksumSHA256:
+			input.ChecksumSHA256 = encoded
+		case ChecksumCRC32C:
+			input.ChecksumCRC32C = encoded
+		}
+	}
+
+	req, output := c.s3Client.PutObjectRequest(input)
+	req.SetContext(ctx)
+	if err := req.Send(); err != nil {
+		return nil, fmt.Errorf("failed to upload to s3://%s/%s: %w", bucket, key, err)
+	}
+
+	etag := strings.Trim(aws.StringValue(output.ETag), `"`)
+	if expected := hex.EncodeToString(digest[:]); options.Verify && etagIsMD5(options) && etag != expected {
+		return nil, fmt.Errorf("%w: s3://%s/%s has ETag %s, expected %s", ErrIntegrity, bucket, key, etag, expected)
+	}
+
+	return &s3manager.UploadOutput{
+		Location:  req.HTTPRequest.URL.String(),
+		VersionID: output.VersionId,
+		ETag:      output.ETag,
+	}, nil
+}
+
+// verifyDownload checks size bytes readable from src against the object
+// described by head: its length, then the stored checksum if there is one,
+// otherwise the ETag when it is an MD5 digest. Multipart checksums and ETags
+// are recomputed with the size of part 1, which assumes uniform part sizes.
+func (c *Client) verifyDownload(ctx context.Context, bucket, key string, head *s3.HeadObjectOutput, src io.ReaderAt, size int64) error {
+	location := fmt.Sprintf("s3://%s/%s", bucket, key)
+	if expected := aws.Int64Value(head.ContentLength); size != expected {
+		return fmt.Errorf("%w: %s downloaded %d of %d bytes", ErrIntegrity, location, size, expected)
+	}
+
+	var (
+		algorithm ChecksumAlgorithm
+		expected  = aws.StringValue(head.ChecksumSHA256)
+	)
+	switch {
+	case expected != "":
+		algorithm = ChecksumSHA256
+	case aws.StringValue(head.ChecksumCRC32C) != "":
+		algorithm, expected = ChecksumCRC32C, aws.StringValue(head.ChecksumCRC32C)
+	default:
+		expected = strings.Trim(aws.StringValue(head.ETag), `"`)
+		if expected == "" || aws.StringValue(head.SSECustomerAlgorithm) != "" ||
+			aws.StringValue(head.ServerSideEncryption) == s3.ServerSideEncryptionAwsKms {
+			return nil // The ETag is not an MD5 digest
+		}
+	}
+
+	digest, partCount, composite := expected, 0, false
+	if i := strings.LastIndexByte(expected, '-'); i >= 0 {
+		count, err := strconv.Atoi(expected[i+1:])
+		if err != nil {
+			return nil // Unrecognised format
+		}
+		digest, partCount, composite = expected[:i], count, true
+	}
+
+	partSize := size
+	if composite {
+		part, err := c.s3Client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+			Bucket:     aws.String(bucket),
+			Key:        aws.String(key),
+			VersionId:  head.VersionId,
+			PartNumber: aws.Int64(1),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to get part size of %s: %w", location, err)
+		}
+		partSize = aws.Int64Value(part.ContentLength)
+		if partSize <= 0 || (size+partSize-1)/partSize != int64(partCount) {
+			return nil // Non-uniform parts cannot be recomputed
+		}
+	}
+
+	newHash := md5.New
+	if algorithm != "" {
+		newHash = func() hash.Hash {
+			h, _ := algorithm.newHash()
+			return h
+		}
+	}
+	sums, err := partSums(src, size, partSize, newHash)
+	if err != nil {
+		return fmt.Errorf("failed to read downloaded data: %w", err)
+	}
+
+	var actual string
+	switch {
+	case !composite && algorithm == "":
+		actual = hex.EncodeToString(sums[0])
+	case !composite:
+		actual = base64.StdEncoding.EncodeToString(sums[0])
+	case algorithm == "":
+		actual = strings.TrimSuffix(compositeETag(sums), fmt.Sprintf("-%d", partCount))
+	default:
+		h := newHash()
+		for _, sum := range sums {
+			h.Write(sum)
+		}
+		actual = base64.StdEncoding.EncodeToString(h.Sum(nil))
+	}
+
+	if actual != digest {
+		return fmt.Errorf("%w: %s has checksum %s, downloaded data has %s", ErrIntegrity, location, expected, actual)
+	}
+	return nil
+}
+
+// partSums hashes src in consecutive parts of partSize bytes
+func partSums(src io.ReaderAt, size, partSize int64, newHash func() hash.Hash) ([][]byte, error) {
+	if size == 0 {
+		return [][]byte{newHash().Sum(nil)}, nil
+	}
+
+	var sums [][]byte
+	for offset := int64(0); offset < size; offset += partSize {
+		length := partSize
+		if offset+length > size {
+			length = size - offset
+		}
+		h := newHash()
+		if _, err := io.Copy(h, io.NewSectionReader(src, offset, length)); err != nil {
+			return nil, err
+		}
+		sums = append(sums, h.Sum(nil))
+	}
+	return sums, nil
+}
+
+// compositeETag returns the ETag S3 assigns to a multipart object: the MD5 of
+// the concatenated part MD5s, followed by "-" and the part count
+func compositeETag(partMD5s [][]byte) string {
+	h := md5.New()
+	for _, sum := range partMD5s {
+		h.Write(sum)
+	}
+	return fmt.Sprintf("%s-%d", hex.EncodeToString(h.Sum(nil)), len(partMD5s))
+}
+
+// etagIsMD5 reports whether S3 will return MD5 ETags for these options;
+// objects encrypted with SSE-KMS get opaque ETags
+func etagIsMD5(options *UploadOptions) bool {
+	return options.ServerSideEncryption != s3.ServerSideEncryptionAwsKms
+}
+
+// integrityRequested reports whether an upload needs the checked upload path
+func (o *UploadOptions) integrityRequested() bool {
+	return o != nil && (o.Verify || o.ChecksumAlgorithm != "")
+}
+
+// readerAtFor returns a reader over data written to writer, if it can be read back
+func readerAtFor(writer io.WriterAt) (io.ReaderAt, bool) {
+	switch w := writer.(type) {
+	case *aws.WriteAtBuffer:
+		return bytes.NewReader(w.Bytes()), true
+	case *progressWriterWrapper:
+		return readerAtFor(w.WriterAt)
+	case io.ReaderAt:
+		return w, true
+	default:
+		return nil, false
+	}
+}
@@ -0,0 +1,147 @@
+package s3util
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUploadVerify_SinglePart(t *testing.T) {
+	f, client := newFakeS3(t)
+
+	output, err := client.UploadString("bucket", "a.txt", "hello", &UploadOptions{Verify: true})
+	require.NoError(t, err)
+	sum := md5.Sum([]byte("hello"))
+	assert.Equal(t, `"`+hex.EncodeToString(sum[:])+`"`, aws.StringValue(output.ETag))
+	assert.Contains(t, output.Location, "/bucket/a.txt")
+
+	obj, ok := f.Object("bucket", "a.txt")
+	require.True(t, ok)
+	assert.Equal(t, "hello", string(obj.Data))
+}
+
+func TestUploadVerify_Multipart(t *testing.T) {
+	for _, algorithm := range []ChecksumAlgorithm{"", ChecksumSHA256, ChecksumCRC32C} {
+		t.Run(string(algorithm), func(t *testing.T) {
+			f, client := newFakeS3(t)
+			data := strings.Repeat("0123456789", 10)
+
+			options := &UploadOptions{Verify: true, ChecksumAlgorithm: algorithm}
+			_, err := client.ConcurrentUpload("bucket", "big", strings.NewReader(data), 30, 2, options)
+			require.NoError(t, err)
+
+			obj, ok := f.Object("bucket", "big")
+			require.True(t, ok)
+			assert.Equal(t, data, string(obj.Data))
+			assert.Equal(t, []int{30, 30, 30, 10}, obj.PartSizes)
+			if algorithm != "" {
+				assert.Len(t, obj.Checksums, 1)
+			}
+
+			// The stored checksum or composite ETag verifies on download
+			buf := &aws.WriteAtBuffer{}
+			n, err := client.DownloadToWriter("bucket", "big", buf, &DownloadOptions{Verify: true})
+			require.NoError(t, err)
+			assert.Equal(t, int64(100), n)
+			assert.Equal(t, data, string(buf.Bytes()))
+		})
+	}
+}
+
+func TestUploadChecksum_SinglePart(t *testing.T) {
+	f, client := newFakeS3(t)
+
+	_, err := client.UploadBytes("bucket", "k", []byte("abc"), &UploadOptions{ChecksumAlgorithm: ChecksumSHA256})
+	require.NoError(t, err)
+	obj, _ := f.Object("bucket", "k")
+	assert.Equal(t, "ungWv48Bz+pBQUDeXa4iI7ADYaOWF3qctBD/YfIAFa0=", obj.Checksums["x-amz-checksum-sha256"])
+
+	_, err = client.UploadBytes("bucket", "k", []byte("abc"), &UploadOptions{ChecksumAlgorithm: "MD4"})
+	assert.Error(t, err)
+}
+
+func TestDownloadVerify_DetectsCorruption(t *testing.T) {
+	for _, name := range []string{"plain", "checksum", "multipart"} {
+		t.Run(name, func(t *testing.T) {
+			f, client := newFakeS3(t)
+			data := strings.Repeat("z", 50)
+			switch name {
+			case "plain":
+				f.PutObject("bucket", "obj", []byte(data))
+			case "checksum":
+				_, err := client.UploadString("bucket", "obj", data, &UploadOptions{ChecksumAlgorithm: ChecksumCRC32C})
+				require.NoError(t, err)
+			case "multipart":
+				_, err := client.MultipartUpload("bucket", "obj", strings.NewReader(data), 20, &UploadOptions{Verify: true})
+				require.NoError(t, err)
+			}
+
+			_, err := client.DownloadBytes("bucket", "obj", &DownloadOptions{Verify: true})
+			require.NoError(t, err)
+
+			f.Corrupt("bucket", "obj")
+			_, err = client.DownloadBytes("bucket", "obj", &DownloadOptions{Verify: true})
+			assert.ErrorIs(t, err, ErrIntegrity)
+
+			// Without Verify the corruption goes unnoticed
+			_, err = client.DownloadBytes("bucket", "obj", nil)
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestDownloadFileAdvanced_VerifyRemovesCorruptFile(t *testing.T) {
+	f, client := newFakeS3(t)
+	f.PutObject("bucket", "obj", []byte("some content"))
+	f.Corrupt("bucket", "obj")
+
+	filename := filepath.Join(t.TempDir(), "out", "obj")
+	err := client.DownloadFileAdvanced("bucket", "obj", filename, &DownloadOptions{Verify: true})
+	assert.ErrorIs(t, err, ErrIntegrity)
+	assert.NoFileExists(t, filename)
+}
+
+func TestVerifyDownload_Truncated(t *testing.T) {
+	f, client := newFakeS3(t)
+	f.PutObject("bucket", "obj", []byte("0123456789"))
+
+	head, err := client.GetS3Client().HeadObject(&s3.HeadObjectInput{Bucket: aws.String("bucket"), Key: aws.String("obj")})
+	require.NoError(t, err)
+	err = client.verifyDownload(context.Background(), "bucket", "obj", head, bytes.NewReader([]byte("01234")), 5)
+	assert.ErrorIs(t, err, ErrIntegrity)
+	assert.Contains(t, err.Error(), "downloaded 5 of 10 bytes")
+}
+
+// writeOnly hides everything but WriteAt
+type writeOnly struct {
+	io.WriterAt
+}
+
+func TestDownloadVerify_UnreadableWriter(t *testing.T) {
+	f, client := newFakeS3(t)
+	f.PutObject("bucket", "obj", []byte("x"))
+
+	file, err := os.CreateTemp(t.TempDir(), "obj")
+	require.NoError(t, err)
+	defer file.Close()
+	_, err = client.DownloadToWriter("bucket", "obj", writeOnly{file}, &DownloadOptions{Verify: true})
+	assert.Error(t, err)
+}
+
+func TestCompositeETag(t *testing.T) {
+	a, b := md5.Sum([]byte("a")), md5.Sum([]byte("b"))
+	etag := compositeETag([][]byte{a[:], b[:]})
+	assert.True(t, strings.HasSuffix(etag, "-2"))
+	assert.Len(t, etag, 34)
+}
@@ -0,0 +1,155 @@
+package s3util
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/jelech/goutils/retryutil"
+)
+
+// Logger receives request logs; *log.Logger satisfies it
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// newSession creates an AWS session from config
+func newSession(config *Config) (*session.Session, error) {
+	awsConfig := &aws.Config{}
+
+	if config.Region != "" {
+		awsConfig.Region = aws.String(config.Region)
+	}
+
+	if config.Endpoint != "" {
+		awsConfig.Endpoint = aws.String(config.Endpoint)
+	}
+
+	if config.DisableSSL {
+		awsConfig.DisableSSL = aws.Bool(true)
+	}
+
+	if config.S3ForcePathStyle {
+		awsConfig.S3ForcePathStyle = aws.Bool(true)
+	}
+
+	if config.AccessKeyID != "" || config.SecretAccessKey != "" {
+		awsConfig.Credentials = credentials.NewStaticCredentials(config.AccessKeyID, config.SecretAccessKey, config.SessionToken)
+	}
+
+	if config.HTTPClient != nil {
+		awsConfig.HTTPClient = config.HTTPClient
+	}
+
+	if len(config.RetryOptions) > 0 {
+		awsConfig.Retryer = newRetryer(retryutil.NewConfig(config.RetryOptions...))
+	} else if config.MaxRetries < 0 {
+		awsConfig.MaxRetries = aws.Int(0)
+	} else if config.MaxRetries > 0 {
+		awsConfig.MaxRetries = aws.Int(config.MaxRetries)
+	}
+
+	if config.Logger != nil && config.LogLevel != aws.LogOff {
+		awsConfig.LogLevel = aws.LogLevel(config.LogLevel)
+		awsConfig.Logger = aws.LoggerFunc(func(args ...interface{}) {
+			config.Logger.Printf("%s", fmt.Sprint(args...))
+		})
+	}
+
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            *awsConfig,
+		Profile:           config.Profile,
+		SharedConfigState: sharedConfigState(config),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AWS session: %w", err)
+	}
+
+	if config.RoleARN != "" {
+		// Endpoint and DisableSSL are meant for S3, so STS uses its defaults
+		stsClient := sts.New(sess, &aws.Config{Endpoint: aws.String(""), DisableSSL: aws.Bool(false)})
+		creds := stscreds.NewCredentialsWithClient(stsClient, config.RoleARN, func(p *stscreds.AssumeRoleProvider) {
+			if config.RoleSessionName != "" {
+				p.RoleSessionName = config.RoleSessionName
+			}
+			if config.ExternalID != "" {
+				p.ExternalID = aws.String(config.ExternalID)
+			}
+			if config.RoleDuration > 0 {
+				p.Duration = config.RoleDuration
+			}
+		})
+		sess = sess.Copy(&aws.Config{Credentials: creds})
+	}
+
+	if config.Logger != nil {
+		sess.Handlers.Complete.PushBackNamed(request.NamedHandler{
+			Name: "s3util.RequestLogger",
+			Fn:   logRequest(config.Logger),
+		})
+	}
+
+	return sess, nil
+}
+
+// sharedConfigState enables the shared config file when a profile is named,
+// so profiles that only exist in ~/.aws/config (e.g. role profiles) work
+func sharedConfigState(config *Config) session.SharedConfigState {
+	if config.Profile != "" {
+		return session.SharedConfigEnable
+	}
+	return session.SharedConfigStateFromEnv
+}
+
+// logRequest returns a handler that logs each completed request
+func logRequest(logger Logger) func(*request.Request) {
+	return func(r *request.Request) {
+		status := 0
+		if r.HTTPResponse != nil {
+			status = r.HTTPResponse.StatusCode
+		}
+		line := fmt.Sprintf("s3 %s %s %s status=%d retries=%d duration=%s",
+			r.Operation.Name, r.Operation.HTTPMethod, r.HTTPRequest.URL.Path, status, r.RetryCount, time.Since(r.Time).Round(time.Millisecond))
+		if r.Error != nil {
+			line += fmt.Sprintf(" error=%q", r.Error.Error())
+		}
+		logger.Printf("%s", line)
+	}
+}
+
+// retryer adapts a retryutil configuration to the SDK's request.Retryer.
+// Errors are retried when the SDK considers them retryable and RetryIf agrees.
+type retryer struct {
+	client.DefaultRetryer
+	config *retryutil.Config
+}
+
+// newRetryer creates a retryer from config
+func newRetryer(config *retryutil.Config) request.Retryer {
+	retries := config.MaxAttempts - 1
+	if retries < 0 {
+		retries = 0
+	}
+	return retryer{
+		DefaultRetryer: client.DefaultRetryer{NumMaxRetries: retries},
+		config:         config,
+	}
+}
+
+// ShouldRetry implements request.Retryer
+func (r retryer) ShouldRetry(req *request.Request) bool {
+	return r.DefaultRetryer.ShouldRetry(req) && r.config.RetryIf(req.Error)
+}
+
+// RetryRules implements request.Retryer. It also reports the retry to OnRetry.
+func (r retryer) RetryRules(req *request.Request) time.Duration {
+	attempt := req.RetryCount + 1
+	r.config.OnRetry(attempt, req.Error)
+	return r.config.Delay(attempt)
+}
@@ -0,0 +1,280 @@
+package s3util
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/jelech/goutils/retryutil"
+	"github.com/jelech/goutils/s3util/s3test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// roundTripFunc adapts a function to http.RoundTripper
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// recordingClient returns an HTTP client that records requests before
+// passing them to next, or to the default transport when next is nil
+func recordingClient(next roundTripFunc) (*http.Client, func() []*http.Request) {
+	var mu sync.Mutex
+	var requests []*http.Request
+	client := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		mu.Lock()
+		requests = append(requests, r)
+		mu.Unlock()
+		if next != nil {
+			return next(r)
+		}
+		return http.DefaultTransport.RoundTrip(r)
+	})}
+	return client, func() []*http.Request {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]*http.Request(nil), requests...)
+	}
+}
+
+// fakeConfig returns a Config with static credentials pointed at f. It
+// clears AWS_CA_BUNDLE, which the SDK cannot apply to a custom transport.
+func fakeConfig(t *testing.T, f *s3test.Server) *Config {
+	t.Setenv("AWS_CA_BUNDLE", "")
+	config := testConfig(f)
+	config.AccessKeyID = "AKIDSTATIC"
+	return config
+}
+
+func TestNewClient_StaticCredentials(t *testing.T) {
+	f, _ := newFakeS3(t)
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDENV")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "env")
+
+	httpClient, requests := recordingClient(nil)
+	config := fakeConfig(t, f)
+	config.SessionToken = "token"
+	config.HTTPClient = httpClient
+
+	client, err := NewClient(config)
+	require.NoError(t, err)
+	require.NoError(t, client.PutObject("bucket", "key", []byte("data"), ""))
+
+	require.Len(t, requests(), 1)
+	req := requests()[0]
+	assert.Contains(t, req.Header.Get("Authorization"), "Credential=AKIDSTATIC/")
+	assert.Equal(t, "token", req.Header.Get("X-Amz-Security-Token"))
+	_, ok := f.Object("bucket", "key")
+	assert.True(t, ok)
+}
+
+func TestNewClient_Profile(t *testing.T) {
+	dir := t.TempDir()
+	credentialsFile := filepath.Join(dir, "credentials")
+	configFile := filepath.Join(dir, "config")
+	require.NoError(t, os.WriteFile(credentialsFile, []byte("[dev]\naws_access_key_id = AKIDPROFILE\naws_secret_access_key = profile\n"), 0600))
+	require.NoError(t, os.WriteFile(configFile, []byte("[profile dev]\nregion = eu-west-1\n"), 0600))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", credentialsFile)
+	t.Setenv("AWS_CONFIG_FILE", configFile)
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+	t.Setenv("AWS_REGION", "")
+
+	client, err := NewClient(&Config{Profile: "dev"})
+	require.NoError(t, err)
+
+	creds, err := client.session.Config.Credentials.Get()
+	require.NoError(t, err)
+	assert.Equal(t, "AKIDPROFILE", creds.AccessKeyID)
+	assert.Equal(t, "eu-west-1", client.region)
+
+	client, err = NewClient(&Config{Profile: "missing"})
+	require.NoError(t, err)
+	_, err = client.session.Config.Credentials.Get()
+	assert.Error(t, err)
+}
+
+func TestNewClient_AssumeRole(t *testing.T) {
+	f, _ := newFakeS3(t)
+
+	var stsForm url.Values
+	httpClient, requests := recordingClient(func(r *http.Request) (*http.Response, error) {
+		if !strings.HasPrefix(r.URL.Host, "sts.") {
+			return http.DefaultTransport.RoundTrip(r)
+		}
+		body, _ := io.ReadAll(r.Body)
+		stsForm, _ = url.ParseQuery(string(body))
+		response := fmt.Sprintf(`<AssumeRoleResponse><AssumeRoleResult><Credentials>
+			<AccessKeyId>ASIAROLE</AccessKeyId><SecretAccessKey>role</SecretAccessKey>
+			<SessionToken>role-token</SessionToken><Expiration>%s</Expiration>
+			</Credentials></AssumeRoleResult></AssumeRoleResponse>`, time.Now().Add(time.Hour).UTC().Format(time.RFC3339))
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": {"text/xml"}},
+			Body:       io.NopCloser(strings.NewReader(response)),
+			Request:    r,
+		}, nil
+	})
+
+	config := fakeConfig(t, f)
+	config.HTTPClient = httpClient
+	config.RoleARN = "arn:aws:iam::123456789012:role/uploader"
+	config.RoleSessionName = "tests"
+	config.ExternalID = "external"
+
+	client, err := NewClient(config)
+	require.NoError(t, err)
+	require.NoError(t, client.PutObject("bucket", "key", []byte("data"), ""))
+
+	require.Len(t, requests(), 2)
+	sts, put := requests()[0], requests()[1]
+	assert.Equal(t, "https", sts.URL.Scheme)
+	assert.Contains(t, sts.Header.Get("Authorization"), "Credential=AKIDSTATIC/")
+	assert.Equal(t, "AssumeRole", stsForm.Get("Action"))
+	assert.Equal(t, config.RoleARN, stsForm.Get("RoleArn"))
+	assert.Equal(t, "tests", stsForm.Get("RoleSessionName"))
+	assert.Equal(t, "external", stsForm.Get("ExternalId"))
+
+	assert.Contains(t, put.Header.Get("Authorization"), "Credential=ASIAROLE/")
+	assert.Equal(t, "role-token", put.Header.Get("X-Amz-Security-Token"))
+}
+
+// failingTransport returns 503 SlowDown for the first failures requests
+func failingTransport(failures int) roundTripFunc {
+	var mu sync.Mutex
+	return func(r *http.Request) (*http.Response, error) {
+		mu.Lock()
+		fail := failures > 0
+		failures--
+		mu.Unlock()
+		if !fail {
+			return http.DefaultTransport.RoundTrip(r)
+		}
+		return &http.Response{
+			StatusCode: http.StatusServiceUnavailable,
+			Body:       io.NopCloser(strings.NewReader("<Error><Code>SlowDown</Code></Error>")),
+			Request:    r,
+		}, nil
+	}
+}
+
+func TestNewClient_Retries(t *testing.T) {
+	f, _ := newFakeS3(t)
+	f.PutObject("bucket", "key", []byte("data"))
+
+	t.Run("disabled", func(t *testing.T) {
+		httpClient, requests := recordingClient(failingTransport(1))
+		config := fakeConfig(t, f)
+		config.HTTPClient = httpClient
+		config.MaxRetries = -1
+
+		client, err := NewClient(config)
+		require.NoError(t, err)
+		_, err = client.GetObject("bucket", "key")
+		assert.Error(t, err)
+		assert.Len(t, requests(), 1)
+	})
+
+	t.Run("retryutil", func(t *testing.T) {
+		httpClient, requests := recordingClient(failingTransport(2))
+		var retries []int
+		config := fakeConfig(t, f)
+		config.HTTPClient = httpClient
+		config.RetryOptions = []retryutil.Option{
+			retryutil.WithMaxAttempts(3),
+			retryutil.WithDelay(time.Millisecond),
+			retryutil.WithOnRetry(func(attempt int, err error) { retries = append(retries, attempt) }),
+		}
+
+		client, err := NewClient(config)
+		require.NoError(t, err)
+		data, err := client.GetObject("bucket", "key")
+		require.NoError(t, err)
+		assert.Equal(t, "data", string(data))
+		assert.Len(t, requests(), 3)
+		assert.Equal(t, []int{1, 2}, retries)
+	})
+
+	t.Run("retry if", func(t *testing.T) {
+		httpClient, requests := recordingClient(failingTransport(1))
+		config := fakeConfig(t, f)
+		config.HTTPClient = httpClient
+		config.RetryOptions = []retryutil.Option{
+			retryutil.WithRetryIf(func(error) bool { return false }),
+		}
+
+		client, err := NewClient(config)
+		require.NoError(t, err)
+		_, err = client.GetObject("bucket", "key")
+		assert.Error(t, err)
+		assert.Len(t, requests(), 1)
+	})
+}
+
+func TestNewClient_Logger(t *testing.T) {
+	f, _ := newFakeS3(t)
+
+	var buf bytes.Buffer
+	config := fakeConfig(t, f)
+	config.Logger = &bufferLogger{buf: &buf}
+
+	client, err := NewClient(config)
+	require.NoError(t, err)
+	require.NoError(t, client.PutObject("bucket", "key", []byte("data"), ""))
+	_, err = client.GetObject("bucket", "missing")
+	require.Error(t, err)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+	assert.True(t, strings.HasPrefix(lines[0], "s3 PutObject PUT /bucket/key status=200 retries=0 duration="), lines[0])
+	assert.Contains(t, lines[1], "s3 GetObject GET /bucket/missing status=404")
+	assert.Contains(t, lines[1], "error=")
+
+	buf.Reset()
+	config.LogLevel = aws.LogDebug
+	client, err = NewClient(config)
+	require.NoError(t, err)
+	require.NoError(t, client.PutObject("bucket", "key", []byte("data"), ""))
+	assert.Contains(t, buf.String(), "DEBUG: Request s3/PutObject Details")
+}
+
+func TestNewClient_TransferDefaults(t *testing.T) {
+	f, _ := newFakeS3(t)
+
+	client, err := NewClient(fakeConfig(t, f))
+	require.NoError(t, err)
+	assert.Equal(t, int64(5*1024*1024), client.uploader.PartSize)
+
+	config := fakeConfig(t, f)
+	config.PartSize = 16 * 1024 * 1024
+	config.Concurrency = 8
+	client, err = NewClient(config)
+	require.NoError(t, err)
+	assert.Equal(t, int64(16*1024*1024), client.uploader.PartSize)
+	assert.Equal(t, 8, client.uploader.Concurrency)
+	assert.Equal(t, int64(16*1024*1024), client.downloader.PartSize)
+	assert.Equal(t, 8, client.downloader.Concurrency)
+}
+
+// bufferLogger writes log lines to a buffer
+type bufferLogger struct {
+	mu  sync.Mutex
+	buf *bytes.Buffer
+}
+
+func (l *bufferLogger) Printf(format string, v ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fmt.Fprintf(l.buf, format+"\n", v...)
+}
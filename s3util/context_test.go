@@ -0,0 +1,63 @@
+package s3util
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithContext_Cancelled(t *testing.T) {
+	f, client := newFakeS3(t)
+	f.PutObject("bucket", "obj", []byte("data"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := client.GetObjectWithContext(ctx, "bucket", "obj")
+	assert.ErrorContains(t, err, request.CanceledErrorCode)
+
+	_, err = client.UploadFromReaderWithContext(ctx, "bucket", "new", strings.NewReader("x"), nil)
+	assert.Error(t, err)
+
+	_, err = client.DownloadToWriterWithContext(ctx, "bucket", "obj", &aws.WriteAtBuffer{}, nil)
+	assert.Error(t, err)
+
+	_, err = client.ListAllWithContext(ctx, "bucket", nil)
+	assert.ErrorContains(t, err, request.CanceledErrorCode)
+
+	// Files up to one part take the single-request path
+	filename := filepath.Join(t.TempDir(), "small.txt")
+	require.NoError(t, os.WriteFile(filename, []byte("x"), 0644))
+	_, err = client.ResumableUploadWithContext(ctx, "bucket", "new", filename, nil)
+	assert.Error(t, err)
+
+	_, ok := f.Object("bucket", "new")
+	assert.False(t, ok)
+	assert.Empty(t, f.Requests())
+}
+
+func TestWithContext_Deadline(t *testing.T) {
+	f, client := newFakeS3(t)
+	f.PutObject("bucket", "obj", []byte("data"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	data, err := client.GetObjectWithContext(ctx, "bucket", "obj")
+	require.NoError(t, err)
+	assert.Equal(t, "data", string(data))
+
+	require.NoError(t, client.PutObjectWithContext(ctx, "bucket", "copy", bytes.ToUpper(data), "text/plain"))
+	text, err := client.DownloadStringWithContext(ctx, "bucket", "copy", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "DATA", text)
+}
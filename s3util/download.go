@@ -2,6 +2,8 @@ package s3util
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -21,10 +23,20 @@ type DownloadOptions struct {
 	IfNoneMatch       string
 	IfModifiedSince   *time.Time
 	IfUnmodifiedSince *time.Time
+
+	// Verify checks the downloaded length and the stored checksum, or the ETag
+	// when it is an MD5 digest. The writer must be readable (io.ReaderAt or
+	// *aws.WriteAtBuffer). Ranged downloads are not verified.
+	Verify bool
 }
 
 // DownloadToWriter downloads an S3 object to an io.Writer
 func (c *Client) DownloadToWriter(bucket, key string, writer io.WriterAt, options *DownloadOptions) (int64, error) {
+	return c.DownloadToWriterWithContext(context.Background(), bucket, key, writer, options)
+}
+
+// DownloadToWriterWithContext is like DownloadToWriter but uses ctx for the S3 requests
+func (c *Client) DownloadToWriterWithContext(ctx context.Context, bucket, key string, writer io.WriterAt, options *DownloadOptions) (int64, error) {
 	input := &s3.GetObjectInput{
 		Bucket: aws.String(bucket),
 		Key:    aws.String(key),
@@ -51,29 +63,68 @@ func (c *Client) DownloadToWriter(bucket, key string, writer io.WriterAt, option
 		}
 	}
 
-	numBytes, err := c.downloader.Download(writer, input)
+	verify := options != nil && options.Verify && input.Range == nil
+	var head *s3.HeadObjectOutput
+	if verify {
+		if _, ok := readerAtFor(writer); !ok {
+			return 0, fmt.Errorf("cannot verify download of s3://%s/%s: writer is not readable", bucket, key)
+		}
+		var err error
+		head, err = c.s3Client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+			Bucket:       input.Bucket,
+			Key:          input.Key,
+			VersionId:    input.VersionId,
+			ChecksumMode: aws.String(s3.ChecksumModeEnabled),
+		})
+		if err != nil {
+			return 0, fmt.Errorf("failed to get metadata of s3://%s/%s: %w", bucket, key, err)
+		}
+		// Make sure the download is the version the checksum describes
+		if input.IfMatch == nil {
+			input.IfMatch = head.ETag
+		}
+	}
+
+	numBytes, err := c.downloader.DownloadWithContext(ctx, writer, input)
 	if err != nil {
 		return 0, fmt.Errorf("failed to download s3://%s/%s: %w", bucket, key, err)
 	}
 
+	if verify {
+		src, _ := readerAtFor(writer)
+		if err := c.verifyDownload(ctx, bucket, key, head, src, numBytes); err != nil {
+			return numBytes, err
+		}
+	}
+
 	return numBytes, nil
 }
 
 // DownloadToWriterFromPath downloads using S3 path string to a writer
 func (c *Client) DownloadToWriterFromPath(s3Path string, writer io.WriterAt, options *DownloadOptions) (int64, error) {
+	return c.DownloadToWriterFromPathWithContext(context.Background(), s3Path, writer, options)
+}
+
+// DownloadToWriterFromPathWithContext is like DownloadToWriterFromPath but uses ctx for the S3 requests
+func (c *Client) DownloadToWriterFromPathWithContext(ctx context.Context, s3Path string, writer io.WriterAt, options *DownloadOptions) (int64, error) {
 	path, err := ParseS3Path(s3Path)
 	if err != nil {
 		return 0, err
 	}
 
-	return c.DownloadToWriter(path.Bucket, path.Key, writer, options)
+	return c.DownloadToWriterWithContext(ctx, path.Bucket, path.Key, writer, options)
 }
 
 // DownloadToBuffer downloads an S3 object to a bytes.Buffer
 func (c *Client) DownloadToBuffer(bucket, key string, options *DownloadOptions) (*bytes.Buffer, error) {
+	return c.DownloadToBufferWithContext(context.Background(), bucket, key, options)
+}
+
+// DownloadToBufferWithContext is like DownloadToBuffer but uses ctx for the S3 requests
+func (c *Client) DownloadToBufferWithContext(ctx context.Context, bucket, key string, options *DownloadOptions) (*bytes.Buffer, error) {
 	buf := &aws.WriteAtBuffer{}
 
-	_, err := c.DownloadToWriter(bucket, key, buf, options)
+	_, err := c.DownloadToWriterWithContext(ctx, bucket, key, buf, options)
 	if err != nil {
 		return nil, err
 	}
@@ -83,17 +134,27 @@ func (c *Client) DownloadToBuffer(bucket, key string, options *DownloadOptions)
 
 // DownloadToBufferFromPath downloads using S3 path string to a buffer
 func (c *Client) DownloadToBufferFromPath(s3Path string, options *DownloadOptions) (*bytes.Buffer, error) {
+	return c.DownloadToBufferFromPathWithContext(context.Background(), s3Path, options)
+}
+
+// DownloadToBufferFromPathWithContext is like DownloadToBufferFromPath but uses ctx for the S3 requests
+func (c *Client) DownloadToBufferFromPathWithContext(ctx context.Context, s3Path string, options *DownloadOptions) (*bytes.Buffer, error) {
 	path, err := ParseS3Path(s3Path)
 	if err != nil {
 		return nil, err
 	}
 
-	return c.DownloadToBuffer(path.Bucket, path.Key, options)
+	return c.DownloadToBufferWithContext(ctx, path.Bucket, path.Key, options)
 }
 
 // DownloadBytes downloads an S3 object and returns its content as bytes
 func (c *Client) DownloadBytes(bucket, key string, options *DownloadOptions) ([]byte, error) {
-	buf, err := c.DownloadToBuffer(bucket, key, options)
+	return c.DownloadBytesWithContext(context.Background(), bucket, key, options)
+}
+
+// DownloadBytesWithContext is like DownloadBytes but uses ctx for the S3 requests
+func (c *Client) DownloadBytesWithContext(ctx context.Context, bucket, key string, options *DownloadOptions) ([]byte, error) {
+	buf, err := c.DownloadToBufferWithContext(ctx, bucket, key, options)
 	if err != nil {
 		return nil, err
 	}
@@ -103,17 +164,27 @@ func (c *Client) DownloadBytes(bucket, key string, options *DownloadOptions) ([]
 
 // DownloadBytesFromPath downloads using S3 path string and returns bytes
 func (c *Client) DownloadBytesFromPath(s3Path string, options *DownloadOptions) ([]byte, error) {
+	return c.DownloadBytesFromPathWithContext(context.Background(), s3Path, options)
+}
+
+// DownloadBytesFromPathWithContext is like DownloadBytesFromPath but uses ctx for the S3 requests
+func (c *Client) DownloadBytesFromPathWithContext(ctx context.Context, s3Path string, options *DownloadOptions) ([]byte, error) {
 	path, err := ParseS3Path(s3Path)
 	if err != nil {
 		return nil, err
 	}
 
-	return c.DownloadBytes(path.Bucket, path.Key, options)
+	return c.DownloadBytesWithContext(ctx, path.Bucket, path.Key, options)
 }
 
 // DownloadString downloads an S3 object and returns its content as string
 func (c *Client) DownloadString(bucket, key string, options *DownloadOptions) (string, error) {
-	data, err := c.DownloadBytes(bucket, key, options)
+	return c.DownloadStringWithContext(context.Background(), bucket, key, options)
+}
+
+// DownloadStringWithContext is like DownloadString but uses ctx for the S3 requests
+func (c *Client) DownloadStringWithContext(ctx context.Context, bucket, key string, options *DownloadOptions) (string, error) {
+	data, err := c.DownloadBytesWithContext(ctx, bucket, key, options)
 	if err != nil {
 		return "", err
 	}
@@ -123,7 +194,12 @@ func (c *Client) DownloadString(bucket, key string, options *DownloadOptions) (s
 
 // DownloadStringFromPath downloads using S3 path string and returns string
 func (c *Client) DownloadStringFromPath(s3Path string, options *DownloadOptions) (string, error) {
-	data, err := c.DownloadBytesFromPath(s3Path, options)
+	return c.DownloadStringFromPathWithContext(context.Background(), s3Path, options)
+}
+
+// DownloadStringFromPathWithContext is like DownloadStringFromPath but uses ctx for the S3 requests
+func (c *Client) DownloadStringFromPathWithContext(ctx context.Context, s3Path string, options *DownloadOptions) (string, error) {
+	data, err := c.DownloadBytesFromPathWithContext(ctx, s3Path, options)
 	if err != nil {
 		return "", err
 	}
@@ -133,6 +209,11 @@ func (c *Client) DownloadStringFromPath(s3Path string, options *DownloadOptions)
 
 // DownloadFileAdvanced downloads an S3 object directly to a file with options
 func (c *Client) DownloadFileAdvanced(bucket, key, filename string, options *DownloadOptions) error {
+	return c.DownloadFileAdvancedWithContext(context.Background(), bucket, key, filename, options)
+}
+
+// DownloadFileAdvancedWithContext is like DownloadFileAdvanced but uses ctx for the S3 requests
+func (c *Client) DownloadFileAdvancedWithContext(ctx context.Context, bucket, key, filename string, options *DownloadOptions) error {
 	// Create the directories in the path if they don't exist
 	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
 		return fmt.Errorf("failed to create directories: %w", err)
@@ -146,8 +227,13 @@ func (c *Client) DownloadFileAdvanced(bucket, key, filename string, options *Dow
 	defer file.Close()
 
 	// Download the file
-	_, err = c.DownloadToWriter(bucket, key, file, options)
+	_, err = c.DownloadToWriterWithContext(ctx, bucket, key, file, options)
 	if err != nil {
+		if errors.Is(err, ErrIntegrity) {
+			// Never leave corrupt data behind
+			file.Close()
+			os.Remove(filename)
+		}
 		return fmt.Errorf("failed to download s3://%s/%s to %s: %w", bucket, key, filename, err)
 	}
 
@@ -156,21 +242,31 @@ func (c *Client) DownloadFileAdvanced(bucket, key, filename string, options *Dow
 
 // DownloadFileAdvancedFromPath downloads using S3 path string with options
 func (c *Client) DownloadFileAdvancedFromPath(s3Path, filename string, options *DownloadOptions) error {
+	return c.DownloadFileAdvancedFromPathWithContext(context.Background(), s3Path, filename, options)
+}
+
+// DownloadFileAdvancedFromPathWithContext is like DownloadFileAdvancedFromPath but uses ctx for the S3 requests
+func (c *Client) DownloadFileAdvancedFromPathWithContext(ctx context.Context, s3Path, filename string, options *DownloadOptions) error {
 	path, err := ParseS3Path(s3Path)
 	if err != nil {
 		return err
 	}
 
-	return c.DownloadFileAdvanced(path.Bucket, path.Key, filename, options)
+	return c.DownloadFileAdvancedWithContext(ctx, path.Bucket, path.Key, filename, options)
 }
 
 // StreamDownload downloads with progress callback
 func (c *Client) StreamDownload(bucket, key string, writer io.WriterAt, progressFn func(written, total int64)) (int64, error) {
+	return c.StreamDownloadWithContext(context.Background(), bucket, key, writer, progressFn)
+}
+
+// StreamDownloadWithContext is like StreamDownload but uses ctx for the S3 requests
+func (c *Client) StreamDownloadWithContext(ctx context.Context, bucket, key string, writer io.WriterAt, progressFn func(written, total int64)) (int64, error) {
 	var progressWriter io.WriterAt = writer
 
 	if progressFn != nil {
 		// Get object size first
-		headOutput, err := c.s3Client.HeadObject(&s3.HeadObjectInput{
+		headOutput, err := c.s3Client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
 			Bucket: aws.String(bucket),
 			Key:    aws.String(key),
 		})
@@ -186,7 +282,7 @@ func (c *Client) StreamDownload(bucket, key string, writer io.WriterAt, progress
 		}
 	}
 
-	return c.DownloadToWriter(bucket, key, progressWriter, nil)
+	return c.DownloadToWriterWithContext(ctx, bucket, key, progressWriter, nil)
 }
 
 // progressWriterWrapper wraps an io.WriterAt to track progress
@@ -210,6 +306,11 @@ func (pw *progressWriterWrapper) WriteAt(p []byte, off int64) (int, error) {
 
 // ConcurrentDownload downloads using multiple concurrent parts
 func (c *Client) ConcurrentDownload(bucket, key string, writer io.WriterAt, partSize int64, concurrency int) (int64, error) {
+	return c.ConcurrentDownloadWithContext(context.Background(), bucket, key, writer, partSize, concurrency)
+}
+
+// ConcurrentDownloadWithContext is like ConcurrentDownload but uses ctx for the S3 requests
+func (c *Client) ConcurrentDownloadWithContext(ctx context.Context, bucket, key string, writer io.WriterAt, partSize int64, concurrency int) (int64, error) {
 	downloader := s3manager.NewDownloaderWithClient(c.s3Client, func(d *s3manager.Downloader) {
 		if partSize > 0 {
 			d.PartSize = partSize
@@ -224,7 +325,7 @@ func (c *Client) ConcurrentDownload(bucket, key string, writer io.WriterAt, part
 		Key:    aws.String(key),
 	}
 
-	numBytes, err := downloader.Download(writer, input)
+	numBytes, err := downloader.DownloadWithContext(ctx, writer, input)
 	if err != nil {
 		return 0, fmt.Errorf("failed to concurrent download s3://%s/%s: %w", bucket, key, err)
 	}
@@ -234,9 +335,14 @@ func (c *Client) ConcurrentDownload(bucket, key string, writer io.WriterAt, part
 
 // PartialDownload downloads a specific range of bytes
 func (c *Client) PartialDownload(bucket, key string, start, end int64, writer io.WriterAt) (int64, error) {
+	return c.PartialDownloadWithContext(context.Background(), bucket, key, start, end, writer)
+}
+
+// PartialDownloadWithContext is like PartialDownload but uses ctx for the S3 requests
+func (c *Client) PartialDownloadWithContext(ctx context.Context, bucket, key string, start, end int64, writer io.WriterAt) (int64, error) {
 	options := &DownloadOptions{
 		Range: fmt.Sprintf("bytes=%d-%d", start, end),
 	}
 
-	return c.DownloadToWriter(bucket, key, writer, options)
+	return c.DownloadToWriterWithContext(ctx, bucket, key, writer, options)
 }
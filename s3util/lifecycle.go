@@ -0,0 +1,314 @@
+package s3util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// LifecycleTransition moves objects to StorageClass after Days
+type LifecycleTransition struct {
+	Days         int
+	StorageClass string
+}
+
+// LifecycleRule is a bucket lifecycle rule. Rules apply to objects matching
+// Prefix and all Tags; an empty filter matches the whole bucket. Day counts
+// of zero are unset.
+//
+//	rule := s3util.NewLifecycleRule("logs").
+//		WithPrefix("logs/").
+//		TransitionAfter(30, s3.StorageClassGlacier).
+//		ExpireAfter(365).
+//		AbortIncompleteUploadsAfter(7)
+type LifecycleRule struct {
+	ID      string
+	Prefix  string
+	Tags    map[string]string
+	Enabled bool
+
+	ExpirationDays int
+	// ExpiredObjectDeleteMarker removes delete markers with no noncurrent
+	// versions; it cannot be combined with ExpirationDays or Tags
+	ExpiredObjectDeleteMarker bool
+	NoncurrentExpirationDays  int
+	Transitions               []LifecycleTransition
+	NoncurrentTransitions     []LifecycleTransition
+	// AbortIncompleteUploadDays aborts multipart uploads this many days
+	// after they start; it cannot be combined with Tags
+	AbortIncompleteUploadDays int
+}
+
+// NewLifecycleRule creates an enabled rule with no filter and no actions
+func NewLifecycleRule(id string) *LifecycleRule {
+	return &LifecycleRule{ID: id, Enabled: true}
+}
+
+// WithPrefix limits the rule to keys starting with prefix
+func (r *LifecycleRule) WithPrefix(prefix string) *LifecycleRule {
+	r.Prefix = prefix
+	return r
+}
+
+// WithTag limits the rule to objects tagged key=value
+func (r *LifecycleRule) WithTag(key, value string) *LifecycleRule {
+	if r.Tags == nil {
+		r.Tags = make(map[string]string)
+	}
+	r.Tags[key] = value
+	return r
+}
+
+// ExpireAfter deletes current object versions days after creation
+func (r *LifecycleRule) ExpireAfter(days int) *LifecycleRule {
+	r.ExpirationDays = days
+	return r
+}
+
+// RemoveExpiredDeleteMarkers removes delete markers left without noncurrent versions
+func (r *LifecycleRule) RemoveExpiredDeleteMarkers() *LifecycleRule {
+	r.ExpiredObjectDeleteMarker = true
+	return r
+}
+
+// ExpireNoncurrentAfter permanently deletes versions days after they become noncurrent
+func (r *LifecycleRule) ExpireNoncurrentAfter(days int) *LifecycleRule {
+	r.NoncurrentExpirationDays = days
+	return r
+}
+
+// TransitionAfter moves current versions to storageClass days after creation
+func (r *LifecycleRule) TransitionAfter(days int, storageClass string) *LifecycleRule {
+	r.Transitions = append(r.Transitions, LifecycleTransition{Days: days, StorageClass: storageClass})
+	return r
+}
+
+// TransitionNoncurrentAfter moves versions to storageClass days after they become noncurrent
+func (r *LifecycleRule) TransitionNoncurrentAfter(days int, storageClass string) *LifecycleRule {
+	r.NoncurrentTransitions = append(r.NoncurrentTransitions, LifecycleTransition{Days: days, StorageClass: storageClass})
+	return r
+}
+
+// AbortIncompleteUploadsAfter aborts multipart uploads days after they start
+func (r *LifecycleRule) AbortIncompleteUploadsAfter(days int) *LifecycleRule {
+	r.AbortIncompleteUploadDays = days
+	return r
+}
+
+// Disabled keeps the rule in the configuration without applying it
+func (r *LifecycleRule) Disabled() *LifecycleRule {
+	r.Enabled = false
+	return r
+}
+
+// validate checks the rule for mistakes S3 would reject
+func (r *LifecycleRule) validate() error {
+	if r.ID == "" || len(r.ID) > 255 {
+		return fmt.Errorf("lifecycle rule ID must be 1 to 255 characters, got %q", r.ID)
+	}
+	if r.ExpirationDays == 0 && !r.ExpiredObjectDeleteMarker && r.NoncurrentExpirationDays == 0 &&
+		len(r.Transitions) == 0 && len(r.NoncurrentTransitions) == 0 && r.AbortIncompleteUploadDays == 0 {
+		return fmt.Errorf("lifecycle rule %q has no actions", r.ID)
+	}
+	if r.ExpirationDays < 0 || r.NoncurrentExpirationDays < 0 || r.AbortIncompleteUploadDays < 0 {
+		return fmt.Errorf("lifecycle rule %q has negative days", r.ID)
+	}
+	if r.ExpiredObjectDeleteMarker && (r.ExpirationDays > 0 || len(r.Tags) > 0) {
+		return fmt.Errorf("lifecycle rule %q cannot remove delete markers together with an expiration or tag filter", r.ID)
+	}
+	if r.AbortIncompleteUploadDays > 0 && len(r.Tags) > 0 {
+		return fmt.Errorf("lifecycle rule %q cannot abort incomplete uploads with a tag filter", r.ID)
+	}
+	for _, transitions := range [][]LifecycleTransition{r.Transitions, r.NoncurrentTransitions} {
+		for _, transition := range transitions {
+			if transition.StorageClass == "" || transition.Days < 0 {
+				return fmt.Errorf("lifecycle rule %q has an invalid transition: %+v", r.ID, transition)
+			}
+		}
+	}
+	for _, transition := range r.Transitions {
+		if r.ExpirationDays > 0 && transition.Days >= r.ExpirationDays {
+			return fmt.Errorf("lifecycle rule %q transitions to %s after it expires", r.ID, transition.StorageClass)
+		}
+	}
+	for _, transition := range r.NoncurrentTransitions {
+		if r.NoncurrentExpirationDays > 0 && transition.Days >= r.NoncurrentExpirationDays {
+			return fmt.Errorf("lifecycle rule %q transitions noncurrent versions to %s after they expire", r.ID, transition.StorageClass)
+		}
+	}
+	return nil
+}
+
+// toS3 converts the rule to the SDK type
+func (r *LifecycleRule) toS3() *s3.LifecycleRule {
+	rule := &s3.LifecycleRule{
+		ID:     aws.String(r.ID),
+		Status: aws.String(s3.ExpirationStatusDisabled),
+	}
+	if r.Enabled {
+		rule.Status = aws.String(s3.ExpirationStatusEnabled)
+	}
+
+	switch {
+	case len(r.Tags) == 0:
+		rule.Filter = &s3.LifecycleRuleFilter{Prefix: aws.String(r.Prefix)}
+	case len(r.Tags) == 1 && r.Prefix == "":
+		rule.Filter = &s3.LifecycleRuleFilter{Tag: tagSet(r.Tags)[0]}
+	default:
+		rule.Filter = &s3.LifecycleRuleFilter{And: &s3.LifecycleRuleAndOperator{
+			Prefix: optionalString(r.Prefix),
+			Tags:   tagSet(r.Tags),
+		}}
+	}
+
+	if r.ExpirationDays > 0 {
+		rule.Expiration = &s3.LifecycleExpiration{Days: aws.Int64(int64(r.ExpirationDays))}
+	} else if r.ExpiredObjectDeleteMarker {
+		rule.Expiration = &s3.LifecycleExpiration{ExpiredObjectDeleteMarker: aws.Bool(true)}
+	}
+	if r.NoncurrentExpirationDays > 0 {
+		rule.NoncurrentVersionExpiration = &s3.NoncurrentVersionExpiration{NoncurrentDays: aws.Int64(int64(r.NoncurrentExpirationDays))}
+	}
+	for _, transition := range r.Transitions {
+		rule.Transitions = append(rule.Transitions, &s3.Transition{
+			Days:         aws.Int64(int64(transition.Days)),
+			StorageClass: aws.String(transition.StorageClass),
+		})
+	}
+	for _, transition := range r.NoncurrentTransitions {
+		rule.NoncurrentVersionTransitions = append(rule.NoncurrentVersionTransitions, &s3.NoncurrentVersionTransition{
+			NoncurrentDays: aws.Int64(int64(transition.Days)),
+			StorageClass:   aws.String(transition.StorageClass),
+		})
+	}
+	if r.AbortIncompleteUploadDays > 0 {
+		rule.AbortIncompleteMultipartUpload = &s3.AbortIncompleteMultipartUpload{
+			DaysAfterInitiation: aws.Int64(int64(r.AbortIncompleteUploadDays)),
+		}
+	}
+	return rule
+}
+
+// lifecycleRuleFromS3 converts an SDK rule. Date-based expirations and
+// transitions have no equivalent and are dropped.
+func lifecycleRuleFromS3(rule *s3.LifecycleRule) *LifecycleRule {
+	r := &LifecycleRule{
+		ID:      aws.StringValue(rule.ID),
+		Prefix:  aws.StringValue(rule.Prefix), // Deprecated top-level prefix
+		Enabled: aws.StringValue(rule.Status) == s3.ExpirationStatusEnabled,
+	}
+
+	if filter := rule.Filter; filter != nil {
+		if filter.Prefix != nil {
+			r.Prefix = aws.StringValue(filter.Prefix)
+		}
+		if filter.Tag != nil {
+			r.WithTag(aws.StringValue(filter.Tag.Key), aws.StringValue(filter.Tag.Value))
+		}
+		if filter.And != nil {
+			r.Prefix = aws.StringValue(filter.And.Prefix)
+			for _, tag := range filter.And.Tags {
+				r.WithTag(aws.StringValue(tag.Key), aws.StringValue(tag.Value))
+			}
+		}
+	}
+
+	if rule.Expiration != nil {
+		r.ExpirationDays = int(aws.Int64Value(rule.Expiration.Days))
+		r.ExpiredObjectDeleteMarker = aws.BoolValue(rule.Expiration.ExpiredObjectDeleteMarker)
+	}
+	if rule.NoncurrentVersionExpiration != nil {
+		r.NoncurrentExpirationDays = int(aws.Int64Value(rule.NoncurrentVersionExpiration.NoncurrentDays))
+	}
+	for _, transition := range rule.Transitions {
+		if transition.Days != nil {
+			r.TransitionAfter(int(*transition.Days), aws.StringValue(transition.StorageClass))
+		}
+	}
+	for _, transition := range rule.NoncurrentVersionTransitions {
+		r.TransitionNoncurrentAfter(int(aws.Int64Value(transition.NoncurrentDays)), aws.StringValue(transition.StorageClass))
+	}
+	if rule.AbortIncompleteMultipartUpload != nil {
+		r.AbortIncompleteUploadDays = int(aws.Int64Value(rule.AbortIncompleteMultipartUpload.DaysAfterInitiation))
+	}
+	return r
+}
+
+// PutLifecycleRules replaces the bucket's lifecycle configuration with rules
+func (c *Client) PutLifecycleRules(bucket string, rules ...*LifecycleRule) error {
+	return c.PutLifecycleRulesWithContext(context.Background(), bucket, rules...)
+}
+
+// PutLifecycleRulesWithContext is like PutLifecycleRules but uses ctx for the S3 requests
+func (c *Client) PutLifecycleRulesWithContext(ctx context.Context, bucket string, rules ...*LifecycleRule) error {
+	if len(rules) == 0 {
+		return fmt.Errorf("no lifecycle rules for bucket %s; use DeleteLifecycleRules to remove them", bucket)
+	}
+
+	ids := make(map[string]bool, len(rules))
+	config := &s3.BucketLifecycleConfiguration{}
+	for _, rule := range rules {
+		if err := rule.validate(); err != nil {
+			return err
+		}
+		if ids[rule.ID] {
+			return fmt.Errorf("duplicate lifecycle rule ID %q", rule.ID)
+		}
+		ids[rule.ID] = true
+		config.Rules = append(config.Rules, rule.toS3())
+	}
+
+	_, err := c.s3Client.PutBucketLifecycleConfigurationWithContext(ctx, &s3.PutBucketLifecycleConfigurationInput{
+		Bucket:                 aws.String(bucket),
+		LifecycleConfiguration: config,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put lifecycle rules for bucket %s: %w", bucket, err)
+	}
+	return nil
+}
+
+// GetLifecycleRules returns the bucket's lifecycle rules, or nil if it has none
+func (c *Client) GetLifecycleRules(bucket string) ([]*LifecycleRule, error) {
+	return c.GetLifecycleRulesWithContext(context.Background(), bucket)
+}
+
+// GetLifecycleRulesWithContext is like GetLifecycleRules but uses ctx for the S3 requests
+func (c *Client) GetLifecycleRulesWithContext(ctx context.Context, bucket string) ([]*LifecycleRule, error) {
+	output, err := c.s3Client.GetBucketLifecycleConfigurationWithContext(ctx, &s3.GetBucketLifecycleConfigurationInput{
+		Bucket: aws.String(bucket),
+	})
+	if err != nil {
+		var awsErr awserr.Error
+		if errors.As(err, &awsErr) && awsErr.Code() == "NoSuchLifecycleConfiguration" {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get lifecycle rules for bucket %s: %w", bucket, err)
+	}
+
+	rules := make([]*LifecycleRule, 0, len(output.Rules))
+	for _, rule := range output.Rules {
+		rules = append(rules, lifecycleRuleFromS3(rule))
+	}
+	return rules, nil
+}
+
+// DeleteLifecycleRules removes the bucket's lifecycle configuration
+func (c *Client) DeleteLifecycleRules(bucket string) error {
+	return c.DeleteLifecycleRulesWithContext(context.Background(), bucket)
+}
+
+// DeleteLifecycleRulesWithContext is like DeleteLifecycleRules but uses ctx for the S3 requests
+func (c *Client) DeleteLifecycleRulesWithContext(ctx context.Context, bucket string) error {
+	_, err := c.s3Client.DeleteBucketLifecycleWithContext(ctx, &s3.DeleteBucketLifecycleInput{
+		Bucket: aws.String(bucket),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete lifecycle rules for bucket %s: %w", bucket, err)
+	}
+	return nil
+}
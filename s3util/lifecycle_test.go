@@ -0,0 +1,70 @@
+package s3util
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLifecycleRules(t *testing.T) {
+	f, client := newFakeS3(t)
+
+	rules, err := client.GetLifecycleRules("bucket")
+	require.NoError(t, err)
+	assert.Nil(t, rules)
+
+	logs := NewLifecycleRule("logs").
+		WithPrefix("logs/").
+		TransitionAfter(30, s3.StorageClassStandardIa).
+		TransitionAfter(90, s3.StorageClassGlacier).
+		ExpireAfter(365).
+		AbortIncompleteUploadsAfter(7)
+	scratch := NewLifecycleRule("scratch").
+		WithTag("temporary", "true").
+		ExpireAfter(1)
+	versions := NewLifecycleRule("versions").
+		WithPrefix("data/").
+		WithTag("tier", "archive").
+		TransitionNoncurrentAfter(10, s3.StorageClassGlacier).
+		ExpireNoncurrentAfter(30).
+		Disabled()
+	markers := NewLifecycleRule("markers").RemoveExpiredDeleteMarkers()
+	require.NoError(t, client.PutLifecycleRules("bucket", logs, scratch, versions, markers))
+
+	raw, ok := f.LifecycleConfiguration("bucket")
+	require.True(t, ok)
+	assert.Contains(t, string(raw), "<DaysAfterInitiation>7</DaysAfterInitiation>")
+
+	rules, err = client.GetLifecycleRules("bucket")
+	require.NoError(t, err)
+	assert.Equal(t, []*LifecycleRule{logs, scratch, versions, markers}, rules)
+
+	require.NoError(t, client.DeleteLifecycleRules("bucket"))
+	rules, err = client.GetLifecycleRules("bucket")
+	require.NoError(t, err)
+	assert.Nil(t, rules)
+}
+
+func TestLifecycleRules_Validation(t *testing.T) {
+	_, client := newFakeS3(t)
+
+	invalid := map[string]*LifecycleRule{
+		"no actions":             NewLifecycleRule("a").WithPrefix("x/"),
+		"no ID":                  NewLifecycleRule("").ExpireAfter(1),
+		"negative days":          NewLifecycleRule("a").ExpireAfter(-1),
+		"markers and expiration": NewLifecycleRule("a").ExpireAfter(1).RemoveExpiredDeleteMarkers(),
+		"markers with tags":      NewLifecycleRule("a").WithTag("k", "v").RemoveExpiredDeleteMarkers(),
+		"abort with tags":        NewLifecycleRule("a").WithTag("k", "v").AbortIncompleteUploadsAfter(1),
+		"no storage class":       NewLifecycleRule("a").TransitionAfter(30, ""),
+		"transition too late":    NewLifecycleRule("a").TransitionAfter(60, s3.StorageClassGlacier).ExpireAfter(30),
+		"noncurrent too late":    NewLifecycleRule("a").TransitionNoncurrentAfter(5, s3.StorageClassGlacier).ExpireNoncurrentAfter(5),
+	}
+	for name, rule := range invalid {
+		assert.Error(t, client.PutLifecycleRules("bucket", rule), name)
+	}
+
+	assert.Error(t, client.PutLifecycleRules("bucket"))
+	assert.Error(t, client.PutLifecycleRules("bucket", NewLifecycleRule("a").ExpireAfter(1), NewLifecycleRule("a").ExpireAfter(2)))
+}
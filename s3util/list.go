@@ -0,0 +1,337 @@
+package s3util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// ErrStopWalk can be returned from a WalkPrefix callback to stop walking without error
+var ErrStopWalk = errors.New("stop walk")
+
+// ListOptions contains options for listing operations
+type ListOptions struct {
+	Prefix     string
+	Delimiter  string // e.g. "/" to list a single directory level
+	StartAfter string // List keys after this key
+	PageSize   int64  // Keys requested per call (S3 caps this at 1000)
+	MaxKeys    int    // Stop after this many entries (0 for no limit)
+	FetchOwner bool
+}
+
+// ObjectSummary describes an object, or a common prefix when listing with a delimiter
+type ObjectSummary struct {
+	Key          string
+	Size         int64
+	ETag         string
+	LastModified time.Time
+	StorageClass string
+	Owner        string
+	IsPrefix     bool // A CommonPrefixes entry; only Key is set
+}
+
+// ObjectVersion describes a version of an object or a delete marker
+type ObjectVersion struct {
+	Key            string
+	VersionID      string
+	IsLatest       bool
+	IsDeleteMarker bool
+	Size           int64
+	ETag           string
+	LastModified   time.Time
+	StorageClass   string
+	IsPrefix       bool // A CommonPrefixes entry; only Key is set
+}
+
+// ObjectIterator lazily iterates over a listing, fetching pages as needed
+type ObjectIterator struct {
+	ctx     context.Context
+	client  *Client
+	input   *s3.ListObjectsV2Input
+	maxKeys int
+
+	items   []ObjectSummary
+	index   int
+	count   int
+	done    bool
+	current ObjectSummary
+	err     error
+}
+
+// Iterate returns an iterator over all objects and common prefixes in bucket.
+// Objects and prefixes are returned in the order S3 lists them.
+func (c *Client) Iterate(bucket string, options *ListOptions) *ObjectIterator {
+	return c.IterateWithContext(context.Background(), bucket, options)
+}
+
+// IterateWithContext is like Iterate but uses ctx for the S3 requests. Cancelling
+// ctx ends the iteration with the context error.
+func (c *Client) IterateWithContext(ctx context.Context, bucket string, options *ListOptions) *ObjectIterator {
+	if options == nil {
+		options = &ListOptions{}
+	}
+
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+	}
+	if options.Prefix != "" {
+		input.Prefix = aws.String(options.Prefix)
+	}
+	if options.Delimiter != "" {
+		input.Delimiter = aws.String(options.Delimiter)
+	}
+	if options.StartAfter != "" {
+		input.StartAfter = aws.String(options.StartAfter)
+	}
+	if options.PageSize > 0 {
+		input.MaxKeys = aws.Int64(options.PageSize)
+	}
+	if options.FetchOwner {
+		input.FetchOwner = aws.Bool(true)
+	}
+
+	return &ObjectIterator{
+		ctx:     ctx,
+		client:  c,
+		input:   input,
+		maxKeys: options.MaxKeys,
+	}
+}
+
+// Next advances to the next entry. It returns false when the listing is
+// exhausted or an error occurs.
+func (it *ObjectIterator) Next() bool {
+	for it.err == nil {
+		if it.maxKeys > 0 && it.count >= it.maxKeys {
+			return false
+		}
+		if it.index < len(it.items) {
+			it.current = it.items[it.index]
+			it.index++
+			it.count++
+			return true
+		}
+		if it.done {
+			return false
+		}
+		it.err = it.fetch()
+	}
+	return false
+}
+
+// Object returns the entry produced by the last call to Next
+func (it *ObjectIterator) Object() ObjectSummary {
+	return it.current
+}
+
+// Err returns the first error encountered while listing
+func (it *ObjectIterator) Err() error {
+	return it.err
+}
+
+// fetch requests the next page of the listing
+func (it *ObjectIterator) fetch() error {
+	result, err := it.client.s3Client.ListObjectsV2WithContext(it.ctx, it.input)
+	if err != nil {
+		return fmt.Errorf("failed to list objects in s3://%s: %w", aws.StringValue(it.input.Bucket), err)
+	}
+
+	it.items = it.items[:0]
+	it.index = 0
+	for _, object := range result.Contents {
+		it.items = append(it.items, objectSummary(object))
+	}
+	for _, prefix := range result.CommonPrefixes {
+		it.items = append(it.items, ObjectSummary{Key: aws.StringValue(prefix.Prefix), IsPrefix: true})
+	}
+	sortSummaries(it.items)
+
+	if aws.BoolValue(result.IsTruncated) && aws.StringValue(result.NextContinuationToken) != "" {
+		it.input.ContinuationToken = result.NextContinuationToken
+	} else {
+		it.done = true
+	}
+	return nil
+}
+
+// ListAll returns every object and common prefix in bucket, following
+// continuation tokens past the 1000-key page limit
+func (c *Client) ListAll(bucket string, options *ListOptions) ([]ObjectSummary, error) {
+	return c.ListAllWithContext(context.Background(), bucket, options)
+}
+
+// ListAllWithContext is like ListAll but uses ctx for the S3 requests
+func (c *Client) ListAllWithContext(ctx context.Context, bucket string, options *ListOptions) ([]ObjectSummary, error) {
+	var objects []ObjectSummary
+	it := c.IterateWithContext(ctx, bucket, options)
+	for it.Next() {
+		objects = append(objects, it.Object())
+	}
+	return objects, it.Err()
+}
+
+// WalkPrefix calls fn for every object under prefix, across all pages.
+// Returning ErrStopWalk from fn stops the walk and WalkPrefix returns nil.
+func (c *Client) WalkPrefix(bucket, prefix string, fn func(ObjectSummary) error) error {
+	return c.WalkPrefixWithContext(context.Background(), bucket, prefix, fn)
+}
+
+// WalkPrefixWithContext is like WalkPrefix but uses ctx for the S3 requests
+func (c *Client) WalkPrefixWithContext(ctx context.Context, bucket, prefix string, fn func(ObjectSummary) error) error {
+	return walk(c.IterateWithContext(ctx, bucket, &ListOptions{Prefix: prefix}), fn)
+}
+
+// walk drives an iterator through fn
+func walk(it *ObjectIterator, fn func(ObjectSummary) error) error {
+	for it.Next() {
+		if err := fn(it.Object()); err != nil {
+			if errors.Is(err, ErrStopWalk) {
+				return nil
+			}
+			return err
+		}
+	}
+	return it.Err()
+}
+
+// ListChan streams the listing over a channel. The object channel is closed
+// when the listing ends; the error channel then receives at most one error.
+// Cancel ctx to stop early.
+func (c *Client) ListChan(ctx context.Context, bucket string, options *ListOptions) (<-chan ObjectSummary, <-chan error) {
+	objects := make(chan ObjectSummary)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(errs)
+		defer close(objects)
+
+		it := c.IterateWithContext(ctx, bucket, options)
+		for it.Next() {
+			select {
+			case objects <- it.Object():
+			case <-ctx.Done():
+				errs <- ctx.Err()
+				return
+			}
+		}
+		if err := it.Err(); err != nil {
+			errs <- err
+		}
+	}()
+
+	return objects, errs
+}
+
+// ListVersions returns every object version and delete marker in bucket.
+// StartAfter is used as the key marker; FetchOwner is ignored.
+func (c *Client) ListVersions(bucket string, options *ListOptions) ([]ObjectVersion, error) {
+	return c.ListVersionsWithContext(context.Background(), bucket, options)
+}
+
+// ListVersionsWithContext is like ListVersions but uses ctx for the S3 requests
+func (c *Client) ListVersionsWithContext(ctx context.Context, bucket string, options *ListOptions) ([]ObjectVersion, error) {
+	if options == nil {
+		options = &ListOptions{}
+	}
+
+	input := &s3.ListObjectVersionsInput{
+		Bucket: aws.String(bucket),
+	}
+	if options.Prefix != "" {
+		input.Prefix = aws.String(options.Prefix)
+	}
+	if options.Delimiter != "" {
+		input.Delimiter = aws.String(options.Delimiter)
+	}
+	if options.StartAfter != "" {
+		input.KeyMarker = aws.String(options.StartAfter)
+	}
+	if options.PageSize > 0 {
+		input.MaxKeys = aws.Int64(options.PageSize)
+	}
+
+	var versions []ObjectVersion
+	limitReached := func() bool {
+		return options.MaxKeys > 0 && len(versions) >= options.MaxKeys
+	}
+
+	err := c.s3Client.ListObjectVersionsPagesWithContext(ctx, input, func(page *s3.ListObjectVersionsOutput, lastPage bool) bool {
+		var pageVersions []ObjectVersion
+		for _, v := range page.Versions {
+			pageVersions = append(pageVersions, ObjectVersion{
+				Key:          aws.StringValue(v.Key),
+				VersionID:    aws.StringValue(v.VersionId),
+				IsLatest:     aws.BoolValue(v.IsLatest),
+				Size:         aws.Int64Value(v.Size),
+				ETag:         strings.Trim(aws.StringValue(v.ETag), `"`),
+				LastModified: aws.TimeValue(v.LastModified),
+				StorageClass: aws.StringValue(v.StorageClass),
+			})
+		}
+		for _, m := range page.DeleteMarkers {
+			pageVersions = append(pageVersions, ObjectVersion{
+				Key:            aws.StringValue(m.Key),
+				VersionID:      aws.StringValue(m.VersionId),
+				IsLatest:       aws.BoolValue(m.IsLatest),
+				IsDeleteMarker: true,
+				LastModified:   aws.TimeValue(m.LastModified),
+			})
+		}
+		for _, p := range page.CommonPrefixes {
+			pageVersions = append(pageVersions, ObjectVersion{Key: aws.StringValue(p.Prefix), IsPrefix: true})
+		}
+		sortVersions(pageVersions)
+
+		for _, v := range pageVersions {
+			if limitReached() {
+				return false
+			}
+			versions = append(versions, v)
+		}
+		return !limitReached()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list object versions in s3://%s: %w", bucket, err)
+	}
+
+	return versions, nil
+}
+
+// objectSummary converts an SDK object
+func objectSummary(object *s3.Object) ObjectSummary {
+	summary := ObjectSummary{
+		Key:          aws.StringValue(object.Key),
+		Size:         aws.Int64Value(object.Size),
+		ETag:         strings.Trim(aws.StringValue(object.ETag), `"`),
+		LastModified: aws.TimeValue(object.LastModified),
+		StorageClass: aws.StringValue(object.StorageClass),
+	}
+	if object.Owner != nil {
+		summary.Owner = aws.StringValue(object.Owner.ID)
+	}
+	return summary
+}
+
+// sortSummaries orders a page by key, merging objects and common prefixes
+// the way S3 lists them
+func sortSummaries(items []ObjectSummary) {
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Key < items[j].Key
+	})
+}
+
+// sortVersions orders a page by key, keeping S3's newest-first order within a key
+func sortVersions(items []ObjectVersion) {
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].Key != items[j].Key {
+			return items[i].Key < items[j].Key
+		}
+		return items[i].LastModified.After(items[j].LastModified)
+	})
+}
@@ -0,0 +1,165 @@
+package s3util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jelech/goutils/s3util/s3test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// seedObjects stores n objects named prefix0000, prefix0001, ...
+func seedObjects(f *s3test.Server, bucket, prefix string, n int) {
+	for i := 0; i < n; i++ {
+		f.PutObject(bucket, fmt.Sprintf("%s%04d", prefix, i), []byte(fmt.Sprintf("data-%d", i)))
+	}
+}
+
+func TestListAll_FollowsContinuationTokens(t *testing.T) {
+	f, client := newFakeS3(t)
+	seedObjects(f, "bucket", "logs/", 2500)
+	seedObjects(f, "bucket", "other/", 3)
+
+	objects, err := client.ListAll("bucket", &ListOptions{Prefix: "logs/"})
+	require.NoError(t, err)
+	require.Len(t, objects, 2500)
+	assert.Equal(t, "logs/0000", objects[0].Key)
+	assert.Equal(t, "logs/2499", objects[2499].Key)
+	assert.Equal(t, int64(len("data-0")), objects[0].Size)
+	assert.NotEmpty(t, objects[0].ETag)
+	assert.False(t, objects[0].LastModified.IsZero())
+	assert.Equal(t, "STANDARD", objects[0].StorageClass)
+
+	// The legacy helper paginates too
+	legacy, err := client.ListObjects("bucket", "logs/", 0)
+	require.NoError(t, err)
+	assert.Len(t, legacy, 2500)
+
+	limited, err := client.ListObjects("bucket", "logs/", 1200)
+	require.NoError(t, err)
+	assert.Len(t, limited, 1200)
+}
+
+func TestListAll_DelimiterAndStartAfter(t *testing.T) {
+	f, client := newFakeS3(t)
+	for _, key := range []string{"a.txt", "dir1/x", "dir1/y", "dir2/sub/z", "z.txt"} {
+		f.PutObject("bucket", key, []byte(key))
+	}
+
+	entries, err := client.ListAll("bucket", &ListOptions{Delimiter: "/", PageSize: 2})
+	require.NoError(t, err)
+
+	var keys []string
+	var prefixes int
+	for _, entry := range entries {
+		keys = append(keys, entry.Key)
+		if entry.IsPrefix {
+			prefixes++
+		}
+	}
+	assert.Equal(t, []string{"a.txt", "dir1/", "dir2/", "z.txt"}, keys)
+	assert.Equal(t, 2, prefixes)
+
+	entries, err = client.ListAll("bucket", &ListOptions{StartAfter: "dir1/y"})
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "dir2/sub/z", entries[0].Key)
+
+	entries, err = client.ListAll("bucket", &ListOptions{MaxKeys: 3, PageSize: 2})
+	require.NoError(t, err)
+	assert.Len(t, entries, 3)
+}
+
+func TestIterate_IsLazy(t *testing.T) {
+	f, client := newFakeS3(t)
+	seedObjects(f, "bucket", "k", 10)
+
+	it := client.Iterate("bucket", &ListOptions{PageSize: 4})
+	assert.Empty(t, f.Requests())
+
+	for i := 0; i < 4; i++ {
+		require.True(t, it.Next())
+	}
+	assert.Len(t, f.Requests(), 1)
+	require.True(t, it.Next())
+	assert.Len(t, f.Requests(), 2)
+	assert.Equal(t, "k0004", it.Object().Key)
+}
+
+func TestWalkPrefix(t *testing.T) {
+	f, client := newFakeS3(t)
+	seedObjects(f, "bucket", "p/", 1500)
+
+	count := 0
+	err := client.WalkPrefix("bucket", "p/", func(object ObjectSummary) error {
+		count++
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1500, count)
+
+	count = 0
+	err = client.WalkPrefix("bucket", "p/", func(object ObjectSummary) error {
+		count++
+		if count == 10 {
+			return ErrStopWalk
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 10, count)
+
+	boom := errors.New("boom")
+	err = client.WalkPrefix("bucket", "p/", func(object ObjectSummary) error { return boom })
+	assert.ErrorIs(t, err, boom)
+}
+
+func TestListChan(t *testing.T) {
+	f, client := newFakeS3(t)
+	seedObjects(f, "bucket", "c/", 1100)
+
+	objects, errs := client.ListChan(context.Background(), "bucket", &ListOptions{Prefix: "c/"})
+	count := 0
+	for range objects {
+		count++
+	}
+	assert.NoError(t, <-errs)
+	assert.Equal(t, 1100, count)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	objects, errs = client.ListChan(ctx, "bucket", &ListOptions{Prefix: "c/"})
+	<-objects
+	cancel()
+	for range objects {
+	}
+	assert.ErrorIs(t, <-errs, context.Canceled)
+}
+
+func TestListVersions(t *testing.T) {
+	f, client := newFakeS3(t)
+	f.PutObject("bucket", "a", []byte("1"))
+	f.PutObject("bucket", "a", []byte("22"))
+	f.PutObject("bucket", "b", []byte("333"))
+	require.NoError(t, client.DeleteObject("bucket", "b"))
+
+	versions, err := client.ListVersions("bucket", &ListOptions{PageSize: 1})
+	require.NoError(t, err)
+	require.Len(t, versions, 4)
+
+	assert.Equal(t, "a", versions[0].Key)
+	assert.True(t, versions[0].IsLatest)
+	assert.Equal(t, int64(2), versions[0].Size)
+	assert.False(t, versions[1].IsLatest)
+
+	assert.Equal(t, "b", versions[2].Key)
+	assert.True(t, versions[2].IsDeleteMarker)
+	assert.True(t, versions[2].IsLatest)
+	assert.Equal(t, int64(3), versions[3].Size)
+
+	versions, err = client.ListVersions("bucket", &ListOptions{MaxKeys: 3})
+	require.NoError(t, err)
+	assert.Len(t, versions, 3)
+}
@@ -0,0 +1,220 @@
+package s3util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// LocalStore is an ObjectStore backed by a directory. Keys map to files
+// below the root; "/" in keys becomes the OS path separator.
+type LocalStore struct {
+	root string
+}
+
+// NewLocalStore creates a store rooted at dir, creating the directory if needed
+func NewLocalStore(dir string) (*LocalStore, error) {
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve directory %s: %w", dir, err)
+	}
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory %s: %w", root, err)
+	}
+	return &LocalStore{root: root}, nil
+}
+
+// Root returns the store's directory
+func (s *LocalStore) Root() string {
+	return s.root
+}
+
+// Get implements ObjectStore
+func (s *LocalStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	return s.GetRange(ctx, key, 0, -1)
+}
+
+// GetRange implements ObjectStore
+func (s *LocalStore) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if empty, err := emptyRange(key, offset, length); empty || err != nil {
+		return emptyReader(err)
+	}
+	name, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, s.wrapError("get", key, err)
+	}
+	if offset > 0 {
+		if _, err := file.Seek(offset, io.SeekStart); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to seek %s: %w", key, err)
+		}
+	}
+	if length < 0 {
+		return file, nil
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(file, length), file}, nil
+}
+
+// Put implements ObjectStore. The file is written to a temporary name and
+// renamed into place, so readers never see partial content.
+func (s *LocalStore) Put(ctx context.Context, key string, r io.Reader, contentType string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	name, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", key, err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".tmp-"+filepath.Base(name)+"-*")
+	if err != nil {
+		return fmt.Errorf("failed to create file for %s: %w", key, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", key, err)
+	}
+	// CreateTemp uses 0600; give the file the mode os.Create would
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", key, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", key, err)
+	}
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		return fmt.Errorf("failed to write %s: %w", key, err)
+	}
+	return nil
+}
+
+// Stat implements ObjectStore. The ETag is left empty to avoid hashing the file.
+func (s *LocalStore) Stat(ctx context.Context, key string) (ObjectSummary, error) {
+	name, err := s.path(key)
+	if err != nil {
+		return ObjectSummary{}, err
+	}
+	info, err := os.Stat(name)
+	if err != nil {
+		return ObjectSummary{}, s.wrapError("stat", key, err)
+	}
+	if info.IsDir() {
+		return ObjectSummary{}, fmt.Errorf("failed to stat %s: %w", key, ErrNotExist)
+	}
+	return ObjectSummary{Key: key, Size: info.Size(), LastModified: info.ModTime()}, nil
+}
+
+// List implements ObjectStore
+func (s *LocalStore) List(ctx context.Context, prefix string, fn func(ObjectSummary) error) error {
+	var objects []ObjectSummary
+	err := filepath.WalkDir(s.root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() || strings.HasPrefix(d.Name(), ".tmp-") {
+			return nil
+		}
+		rel, err := filepath.Rel(s.root, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, ObjectSummary{Key: key, Size: info.Size(), LastModified: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list %s: %w", s.root, err)
+	}
+
+	// WalkDir orders by path, which differs from key order when names contain
+	// characters that sort before "/"
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	for _, object := range objects {
+		if err := fn(object); err != nil {
+			if errors.Is(err, ErrStopWalk) {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete implements ObjectStore
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	name, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to delete %s: %w", key, err)
+	}
+	return nil
+}
+
+// Copy implements ObjectStore
+func (s *LocalStore) Copy(ctx context.Context, srcKey, dstKey string) error {
+	src, err := s.Get(ctx, srcKey)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	return s.Put(ctx, dstKey, src, "")
+}
+
+// PresignGet is not supported by LocalStore
+func (s *LocalStore) PresignGet(ctx context.Context, key string, expiration time.Duration) (string, error) {
+	return "", ErrNotSupported
+}
+
+// path maps a key to a file below the root, rejecting keys that escape it
+func (s *LocalStore) path(key string) (string, error) {
+	// A cleaned key only keeps ".." elements at its start, so rejecting those
+	// keeps every key below the root, whatever the root is (even "/")
+	clean := filepath.Clean(filepath.FromSlash(key))
+	if key == "" || clean == "." || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid key %q", key)
+	}
+	return filepath.Join(s.root, clean), nil
+}
+
+// wrapError adds context to a file error, mapping missing files to ErrNotExist
+func (s *LocalStore) wrapError(operation, key string, err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to %s %s: %w", operation, key, ErrNotExist)
+	}
+	return fmt.Errorf("failed to %s %s: %w", operation, key, err)
+}
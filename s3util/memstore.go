@@ -0,0 +1,184 @@
+package s3util
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	memoryStoresMu sync.Mutex
+	memoryStores   = make(map[string]*MemoryStore)
+)
+
+// MemoryStore is an in-memory ObjectStore, intended for tests
+type MemoryStore struct {
+	mu      sync.RWMutex
+	objects map[string]memoryObject
+}
+
+// memoryObject is a stored object; data is never modified after creation
+type memoryObject struct {
+	data        []byte
+	etag        string
+	contentType string
+	modified    time.Time
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{objects: make(map[string]memoryObject)}
+}
+
+// SharedMemoryStore returns the process-wide store registered under name,
+// creating it on first use. OpenStore uses it for mem:// URLs.
+func SharedMemoryStore(name string) *MemoryStore {
+	memoryStoresMu.Lock()
+	defer memoryStoresMu.Unlock()
+
+	store, ok := memoryStores[name]
+	if !ok {
+		store = NewMemoryStore()
+		memoryStores[name] = store
+	}
+	return store
+}
+
+// Get implements ObjectStore
+func (s *MemoryStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	return s.GetRange(ctx, key, 0, -1)
+}
+
+// GetRange implements ObjectStore
+func (s *MemoryStore) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if empty, err := emptyRange(key, offset, length); empty || err != nil {
+		return emptyReader(err)
+	}
+	object, err := s.object("get", key)
+	if err != nil {
+		return nil, err
+	}
+
+	data := object.data
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	data = data[offset:]
+	if length >= 0 && length < int64(len(data)) {
+		data = data[:length]
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// Put implements ObjectStore
+func (s *MemoryStore) Put(ctx context.Context, key string, r io.Reader, contentType string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", key, err)
+	}
+
+	sum := md5.Sum(data)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[key] = memoryObject{
+		data:        data,
+		etag:        hex.EncodeToString(sum[:]),
+		contentType: contentType,
+		modified:    time.Now(),
+	}
+	return nil
+}
+
+// Stat implements ObjectStore
+func (s *MemoryStore) Stat(ctx context.Context, key string) (ObjectSummary, error) {
+	object, err := s.object("stat", key)
+	if err != nil {
+		return ObjectSummary{}, err
+	}
+	return object.summary(key), nil
+}
+
+// List implements ObjectStore. fn runs on a snapshot, so it may modify the store.
+func (s *MemoryStore) List(ctx context.Context, prefix string, fn func(ObjectSummary) error) error {
+	s.mu.RLock()
+	objects := make([]ObjectSummary, 0, len(s.objects))
+	for key, object := range s.objects {
+		if strings.HasPrefix(key, prefix) {
+			objects = append(objects, object.summary(key))
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	for _, object := range objects {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(object); err != nil {
+			if errors.Is(err, ErrStopWalk) {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete implements ObjectStore
+func (s *MemoryStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.objects, key)
+	return nil
+}
+
+// Copy implements ObjectStore
+func (s *MemoryStore) Copy(ctx context.Context, srcKey, dstKey string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	object, ok := s.objects[srcKey]
+	if !ok {
+		return fmt.Errorf("failed to copy %s: %w", srcKey, ErrNotExist)
+	}
+	object.modified = time.Now()
+	s.objects[dstKey] = object
+	return nil
+}
+
+// PresignGet is not supported by MemoryStore
+func (s *MemoryStore) PresignGet(ctx context.Context, key string, expiration time.Duration) (string, error) {
+	return "", ErrNotSupported
+}
+
+// object returns the object stored under key
+func (s *MemoryStore) object(operation, key string) (memoryObject, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	object, ok := s.objects[key]
+	if !ok {
+		return memoryObject{}, fmt.Errorf("failed to %s %s: %w", operation, key, ErrNotExist)
+	}
+	return object, nil
+}
+
+// summary describes the object as an ObjectSummary
+func (o memoryObject) summary(key string) ObjectSummary {
+	return ObjectSummary{Key: key, Size: int64(len(o.data)), ETag: o.etag, LastModified: o.modified}
+}
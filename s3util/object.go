@@ -0,0 +1,248 @@
+package s3util
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// ObjectInfo describes an object as returned by HeadObject
+type ObjectInfo struct {
+	Key                  string
+	Size                 int64
+	ETag                 string // Without quotes
+	ContentType          string
+	ContentEncoding      string
+	ContentLanguage      string
+	ContentDisposition   string
+	CacheControl         string
+	LastModified         time.Time
+	StorageClass         string // "STANDARD" when S3 omits it
+	VersionID            string
+	ServerSideEncryption string
+	KMSKeyID             string
+	Metadata             map[string]string // User metadata with lower-case keys, without the x-amz-meta- prefix
+}
+
+// HeadObject returns an object's size, ETag, content headers and user
+// metadata. A missing object returns an error wrapping ErrNotExist.
+func (c *Client) HeadObject(bucket, key string) (*ObjectInfo, error) {
+	return c.HeadObjectWithContext(context.Background(), bucket, key)
+}
+
+// HeadObjectWithContext is like HeadObject but uses ctx for the S3 requests
+func (c *Client) HeadObjectWithContext(ctx context.Context, bucket, key string) (*ObjectInfo, error) {
+	output, err := c.s3Client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, wrapObjectError("head", bucket, key, err)
+	}
+
+	info := &ObjectInfo{
+		Key:                  key,
+		Size:                 aws.Int64Value(output.ContentLength),
+		ETag:                 strings.Trim(aws.StringValue(output.ETag), `"`),
+		ContentType:          aws.StringValue(output.ContentType),
+		ContentEncoding:      aws.StringValue(output.ContentEncoding),
+		ContentLanguage:      aws.StringValue(output.ContentLanguage),
+		ContentDisposition:   aws.StringValue(output.ContentDisposition),
+		CacheControl:         aws.StringValue(output.CacheControl),
+		LastModified:         aws.TimeValue(output.LastModified),
+		StorageClass:         aws.StringValue(output.StorageClass),
+		VersionID:            aws.StringValue(output.VersionId),
+		ServerSideEncryption: aws.StringValue(output.ServerSideEncryption),
+		KMSKeyID:             aws.StringValue(output.SSEKMSKeyId),
+		Metadata:             make(map[string]string, len(output.Metadata)),
+	}
+	if info.StorageClass == "" {
+		info.StorageClass = s3.StorageClassStandard
+	}
+	for name, value := range output.Metadata {
+		info.Metadata[strings.ToLower(name)] = aws.StringValue(value)
+	}
+	return info, nil
+}
+
+// GetObjectTagging returns the tags of an object. An object without tags
+// returns an empty map.
+func (c *Client) GetObjectTagging(bucket, key string) (map[string]string, error) {
+	return c.GetObjectTaggingWithContext(context.Background(), bucket, key)
+}
+
+// GetObjectTaggingWithContext is like GetObjectTagging but uses ctx for the S3 requests
+func (c *Client) GetObjectTaggingWithContext(ctx context.Context, bucket, key string) (map[string]string, error) {
+	output, err := c.s3Client.GetObjectTaggingWithContext(ctx, &s3.GetObjectTaggingInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, wrapObjectError("get tags of", bucket, key, err)
+	}
+
+	tags := make(map[string]string, len(output.TagSet))
+	for _, tag := range output.TagSet {
+		tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+	}
+	return tags, nil
+}
+
+// PutObjectTagging replaces all tags of an object with tags
+func (c *Client) PutObjectTagging(bucket, key string, tags map[string]string) error {
+	return c.PutObjectTaggingWithContext(context.Background(), bucket, key, tags)
+}
+
+// PutObjectTaggingWithContext is like PutObjectTagging but uses ctx for the S3 requests
+func (c *Client) PutObjectTaggingWithContext(ctx context.Context, bucket, key string, tags map[string]string) error {
+	_, err := c.s3Client.PutObjectTaggingWithContext(ctx, &s3.PutObjectTaggingInput{
+		Bucket:  aws.String(bucket),
+		Key:     aws.String(key),
+		Tagging: &s3.Tagging{TagSet: tagSet(tags)},
+	})
+	if err != nil {
+		return wrapObjectError("put tags of", bucket, key, err)
+	}
+	return nil
+}
+
+// DeleteObjectTagging removes all tags of an object
+func (c *Client) DeleteObjectTagging(bucket, key string) error {
+	return c.DeleteObjectTaggingWithContext(context.Background(), bucket, key)
+}
+
+// DeleteObjectTaggingWithContext is like DeleteObjectTagging but uses ctx for the S3 requests
+func (c *Client) DeleteObjectTaggingWithContext(ctx context.Context, bucket, key string) error {
+	_, err := c.s3Client.DeleteObjectTaggingWithContext(ctx, &s3.DeleteObjectTaggingInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return wrapObjectError("delete tags of", bucket, key, err)
+	}
+	return nil
+}
+
+// MetadataUpdate describes the changes made by ReplaceMetadata. Empty fields
+// keep the object's current values. A nil Metadata keeps the current user
+// metadata; any other map, including an empty one, replaces it.
+type MetadataUpdate struct {
+	Metadata           map[string]string
+	ContentType        string
+	ContentEncoding    string
+	ContentLanguage    string
+	ContentDisposition string
+	CacheControl       string
+	StorageClass       string
+}
+
+// ReplaceMetadata changes an object's metadata by copying it onto itself,
+// keeping its tags, storage class and encryption unless update changes
+// them. Every copy request is conditional on the ETag read first, so the
+// update fails rather than overwrite a concurrent change; objects over 5GB
+// are copied part by part with the same condition. Headers not covered by
+// MetadataUpdate, such as Expires, are dropped.
+func (c *Client) ReplaceMetadata(bucket, key string, update *MetadataUpdate) error {
+	return c.ReplaceMetadataWithContext(context.Background(), bucket, key, update)
+}
+
+// ReplaceMetadataWithContext is like ReplaceMetadata but uses ctx for the S3 requests
+func (c *Client) ReplaceMetadataWithContext(ctx context.Context, bucket, key string, update *MetadataUpdate) error {
+	if update == nil {
+		update = &MetadataUpdate{}
+	}
+	info, err := c.HeadObjectWithContext(ctx, bucket, key)
+	if err != nil {
+		return fmt.Errorf("failed to replace metadata: %w", err)
+	}
+
+	merged := *info
+	merged.ContentType = firstNonEmpty(update.ContentType, info.ContentType)
+	merged.ContentEncoding = firstNonEmpty(update.ContentEncoding, info.ContentEncoding)
+	merged.ContentLanguage = firstNonEmpty(update.ContentLanguage, info.ContentLanguage)
+	merged.ContentDisposition = firstNonEmpty(update.ContentDisposition, info.ContentDisposition)
+	merged.CacheControl = firstNonEmpty(update.CacheControl, info.CacheControl)
+	merged.StorageClass = firstNonEmpty(update.StorageClass, info.StorageClass)
+	if update.Metadata != nil {
+		merged.Metadata = update.Metadata
+	}
+
+	if info.Size > maxCopyObjectSize {
+		tags, err := c.GetObjectTaggingWithContext(ctx, bucket, key)
+		if err != nil {
+			return fmt.Errorf("failed to replace metadata: %w", err)
+		}
+		return c.multipartCopy(ctx, bucket, key, info.ETag, copyUploadInput(bucket, key, &merged, tags), info.Size, 0)
+	}
+
+	input := &s3.CopyObjectInput{
+		Bucket:             aws.String(bucket),
+		Key:                aws.String(key),
+		CopySource:         aws.String(copySource(bucket, key)),
+		CopySourceIfMatch:  aws.String(`"` + info.ETag + `"`),
+		MetadataDirective:  aws.String(s3.MetadataDirectiveReplace),
+		Metadata:           aws.StringMap(merged.Metadata),
+		ContentType:        optionalString(merged.ContentType),
+		ContentEncoding:    optionalString(merged.ContentEncoding),
+		ContentLanguage:    optionalString(merged.ContentLanguage),
+		ContentDisposition: optionalString(merged.ContentDisposition),
+		CacheControl:       optionalString(merged.CacheControl),
+		StorageClass:       optionalString(merged.StorageClass),
+	}
+	if info.ServerSideEncryption != "" {
+		input.ServerSideEncryption = aws.String(info.ServerSideEncryption)
+		input.SSEKMSKeyId = optionalString(info.KMSKeyID)
+	}
+	if _, err := c.s3Client.CopyObjectWithContext(ctx, input); err != nil {
+		return fmt.Errorf("failed to replace metadata of s3://%s/%s: %w", bucket, key, err)
+	}
+	return nil
+}
+
+// wrapObjectError adds context to an S3 error, mapping missing objects to ErrNotExist
+func wrapObjectError(operation, bucket, key string, err error) error {
+	if isNotFound(err) {
+		return fmt.Errorf("failed to %s s3://%s/%s: %w", operation, bucket, key, ErrNotExist)
+	}
+	return fmt.Errorf("failed to %s s3://%s/%s: %w", operation, bucket, key, err)
+}
+
+// tagSet converts tags to an S3 tag set sorted by key
+func tagSet(tags map[string]string) []*s3.Tag {
+	set := make([]*s3.Tag, 0, len(tags))
+	for _, key := range sortedKeys(tags) {
+		set = append(set, &s3.Tag{Key: aws.String(key), Value: aws.String(tags[key])})
+	}
+	return set
+}
+
+// encodeTagging formats tags as an x-amz-tagging header value
+func encodeTagging(tags map[string]string) string {
+	values := make(url.Values, len(tags))
+	for key, value := range tags {
+		values.Set(key, value)
+	}
+	return values.Encode()
+}
+
+// optionalString returns nil for an empty string
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return aws.String(s)
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,124 @@
+package s3util
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHeadObject(t *testing.T) {
+	_, client := newFakeS3(t)
+
+	_, err := client.UploadFromReader("bucket", "report.csv", bytes.NewReader([]byte("a,b\n")), &UploadOptions{
+		ContentType:     "text/csv",
+		ContentEncoding: "identity",
+		Metadata:        map[string]*string{"Owner": aws.String("alice")},
+		StorageClass:    s3.StorageClassStandardIa,
+	})
+	require.NoError(t, err)
+
+	info, err := client.HeadObject("bucket", "report.csv")
+	require.NoError(t, err)
+	assert.Equal(t, "report.csv", info.Key)
+	assert.Equal(t, int64(4), info.Size)
+	assert.Len(t, info.ETag, 32)
+	assert.Equal(t, "text/csv", info.ContentType)
+	assert.Equal(t, "identity", info.ContentEncoding)
+	assert.Equal(t, map[string]string{"owner": "alice"}, info.Metadata)
+	assert.Equal(t, s3.StorageClassStandardIa, info.StorageClass)
+	assert.NotEmpty(t, info.VersionID)
+	assert.False(t, info.LastModified.IsZero())
+
+	require.NoError(t, client.PutObject("bucket", "plain", []byte("x"), ""))
+	info, err = client.HeadObject("bucket", "plain")
+	require.NoError(t, err)
+	assert.Equal(t, s3.StorageClassStandard, info.StorageClass)
+	assert.Empty(t, info.Metadata)
+
+	_, err = client.HeadObject("bucket", "missing")
+	assert.ErrorIs(t, err, ErrNotExist)
+}
+
+func TestObjectTagging(t *testing.T) {
+	f, client := newFakeS3(t)
+	f.PutObject("bucket", "key", []byte("data"))
+
+	tags, err := client.GetObjectTagging("bucket", "key")
+	require.NoError(t, err)
+	assert.Empty(t, tags)
+
+	require.NoError(t, client.PutObjectTagging("bucket", "key", map[string]string{"team": "data", "retention": "30d"}))
+	tags, err = client.GetObjectTagging("bucket", "key")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"team": "data", "retention": "30d"}, tags)
+
+	require.NoError(t, client.DeleteObjectTagging("bucket", "key"))
+	obj, _ := f.Object("bucket", "key")
+	assert.Empty(t, obj.Tags)
+
+	_, err = client.GetObjectTagging("bucket", "missing")
+	assert.ErrorIs(t, err, ErrNotExist)
+	assert.ErrorIs(t, client.PutObjectTagging("bucket", "missing", map[string]string{"a": "b"}), ErrNotExist)
+}
+
+func TestReplaceMetadata(t *testing.T) {
+	f, client := newFakeS3(t)
+	_, err := client.UploadFromReader("bucket", "page.html", bytes.NewReader([]byte("<html>")), &UploadOptions{
+		ContentType:  "text/html",
+		Metadata:     map[string]*string{"Owner": aws.String("alice")},
+		StorageClass: s3.StorageClassStandardIa,
+	})
+	require.NoError(t, err)
+	require.NoError(t, client.PutObjectTagging("bucket", "page.html", map[string]string{"team": "web"}))
+
+	require.NoError(t, client.ReplaceMetadata("bucket", "page.html", &MetadataUpdate{
+		Metadata:     map[string]string{"owner": "bob", "reviewed": "yes"},
+		CacheControl: "max-age=60",
+	}))
+	obj, ok := f.Object("bucket", "page.html")
+	require.True(t, ok)
+	assert.Equal(t, "<html>", string(obj.Data))
+	assert.Equal(t, map[string]string{"owner": "bob", "reviewed": "yes"}, obj.Metadata)
+	assert.Equal(t, "text/html", obj.ContentType, "unset fields are kept")
+	assert.Equal(t, s3.StorageClassStandardIa, obj.StorageClass)
+	assert.Equal(t, map[string]string{"team": "web"}, obj.Tags)
+
+	info, err := client.HeadObject("bucket", "page.html")
+	require.NoError(t, err)
+	assert.Equal(t, "max-age=60", info.CacheControl)
+
+	// A nil Metadata keeps the user metadata
+	require.NoError(t, client.ReplaceMetadata("bucket", "page.html", &MetadataUpdate{ContentType: "text/html; charset=utf-8"}))
+	obj, _ = f.Object("bucket", "page.html")
+	assert.Equal(t, "text/html; charset=utf-8", obj.ContentType)
+	assert.Equal(t, map[string]string{"owner": "bob", "reviewed": "yes"}, obj.Metadata)
+
+	// An empty map clears it
+	require.NoError(t, client.ReplaceMetadata("bucket", "page.html", &MetadataUpdate{Metadata: map[string]string{}}))
+	obj, _ = f.Object("bucket", "page.html")
+	assert.Empty(t, obj.Metadata)
+
+	assert.ErrorIs(t, client.ReplaceMetadata("bucket", "missing", nil), ErrNotExist)
+}
+
+func TestMultipartCopy_SourceChanged(t *testing.T) {
+	allowSmallParts(t)
+	f, client := newFakeS3(t)
+	stale := f.PutObject("bucket", "src", []byte("0123456789"))
+	f.PutObject("bucket", "src", []byte("abcdefghij"))
+
+	create := &s3.CreateMultipartUploadInput{Bucket: aws.String("bucket"), Key: aws.String("dst")}
+	err := client.multipartCopy(context.Background(), "bucket", "src", stale.ETag, create, 10, 5)
+	assert.ErrorContains(t, err, "PreconditionFailed")
+	_, ok := f.Object("bucket", "dst")
+	assert.False(t, ok)
+
+	uploads, err := client.ListIncompleteUploads("bucket", "")
+	require.NoError(t, err)
+	assert.Empty(t, uploads, "the failed copy is aborted")
+}
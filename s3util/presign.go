@@ -0,0 +1,363 @@
+package s3util
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// maxPostObjectSize is the largest object a browser POST upload can store
+const maxPostObjectSize = 5 * 1024 * 1024 * 1024
+
+// PresignedRequest is a presigned HTTP request. The client must send Header
+// with the request, otherwise the signature does not match.
+type PresignedRequest struct {
+	Method  string
+	URL     string
+	Header  http.Header
+	Expires time.Time
+}
+
+// PresignPutOptions contains options for PresignPut. Every field that is set
+// is signed, so the uploader cannot change it.
+type PresignPutOptions struct {
+	ContentType  string
+	ContentMD5   string // Base64-encoded MD5 the body must match; also pins its size
+	Metadata     map[string]string
+	ACL          string
+	StorageClass string
+}
+
+// PresignPut generates a presigned URL for uploading an object with a PUT.
+// S3 does not enforce a size limit on presigned PUTs; use PresignPost with
+// MaxContentLength for that.
+func (c *Client) PresignPut(bucket, key string, expiration time.Duration, options *PresignPutOptions) (*PresignedRequest, error) {
+	if options == nil {
+		options = &PresignPutOptions{}
+	}
+
+	input := &s3.PutObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}
+	if options.ContentType != "" {
+		input.ContentType = aws.String(options.ContentType)
+	}
+	if options.ContentMD5 != "" {
+		input.ContentMD5 = aws.String(options.ContentMD5)
+	}
+	if len(options.Metadata) > 0 {
+		input.Metadata = aws.StringMap(options.Metadata)
+	}
+	if options.ACL != "" {
+		input.ACL = aws.String(options.ACL)
+	}
+	if options.StorageClass != "" {
+		input.StorageClass = aws.String(options.StorageClass)
+	}
+
+	req, _ := c.s3Client.PutObjectRequest(input)
+	url, signed, err := req.PresignRequest(expiration)
+	if err != nil {
+		return nil, fmt.Errorf("failed to presign upload to s3://%s/%s: %w", bucket, key, err)
+	}
+
+	// The SDK returns lower-case names; canonicalize them for http.Header.Get
+	header := make(http.Header, len(signed))
+	for name, values := range signed {
+		for _, value := range values {
+			header.Add(name, value)
+		}
+	}
+
+	return &PresignedRequest{
+		Method:  http.MethodPut,
+		URL:     url,
+		Header:  header,
+		Expires: time.Now().Add(expiration),
+	}, nil
+}
+
+// PostPolicyOptions contains options for PresignPost. Exactly one of Key and
+// KeyPrefix must be set.
+type PostPolicyOptions struct {
+	Key                 string            // Exact key the upload is stored under
+	KeyPrefix           string            // Allow any key under this prefix; the form key defaults to prefix + "${filename}"
+	ContentType         string            // Exact Content-Type the upload must have
+	ContentTypePrefix   string            // Content-Type prefix, e.g. "image/"
+	MinContentLength    int64             // Minimum size in bytes
+	MaxContentLength    int64             // Maximum size in bytes (0 for the 5GB POST limit)
+	Metadata            map[string]string // Stored as x-amz-meta-* and fixed by the policy
+	ACL                 string
+	SuccessActionStatus int // e.g. 201 to get an XML response instead of 204
+}
+
+// PresignedPost holds everything a browser needs for an HTML form upload:
+// POST multipart/form-data to URL with Fields followed by a "file" field.
+type PresignedPost struct {
+	URL     string
+	Fields  map[string]string
+	Expires time.Time
+}
+
+// PresignPost generates a signed POST policy for browser uploads directly to
+// S3. The policy restricts the key, content type and size of the upload.
+func (c *Client) PresignPost(bucket string, expiration time.Duration, options *PostPolicyOptions) (*PresignedPost, error) {
+	if options == nil || (options.Key == "") == (options.KeyPrefix == "") {
+		return nil, fmt.Errorf("exactly one of Key and KeyPrefix is required")
+	}
+	if options.ContentType != "" && options.ContentTypePrefix != "" {
+		return nil, fmt.Errorf("ContentType and ContentTypePrefix are mutually exclusive")
+	}
+	if options.MinContentLength < 0 || (options.MaxContentLength > 0 && options.MinContentLength > options.MaxContentLength) {
+		return nil, fmt.Errorf("invalid content length range %d-%d", options.MinContentLength, options.MaxContentLength)
+	}
+
+	creds, err := c.s3Client.Config.Credentials.GetWithContext(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get credentials: %w", err)
+	}
+	bucketURL, err := c.bucketURL(bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	date := now.Format("20060102")
+	region := aws.StringValue(c.s3Client.Config.Region)
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", date, region)
+
+	fields := map[string]string{
+		"x-amz-algorithm":  "AWS4-HMAC-SHA256",
+		"x-amz-credential": creds.AccessKeyID + "/" + scope,
+		"x-amz-date":       now.Format("20060102T150405Z"),
+	}
+	if creds.SessionToken != "" {
+		fields["x-amz-security-token"] = creds.SessionToken
+	}
+	if options.ACL != "" {
+		fields["acl"] = options.ACL
+	}
+	if options.ContentType != "" {
+		fields["Content-Type"] = options.ContentType
+	}
+	if options.SuccessActionStatus != 0 {
+		fields["success_action_status"] = fmt.Sprint(options.SuccessActionStatus)
+	}
+	for name, value := range options.Metadata {
+		fields["x-amz-meta-"+strings.ToLower(name)] = value
+	}
+
+	conditions := []interface{}{map[string]string{"bucket": bucket}}
+	for _, name := range sortedKeys(fields) {
+		conditions = append(conditions, map[string]string{name: fields[name]})
+	}
+	if options.Key != "" {
+		fields["key"] = options.Key
+		conditions = append(conditions, map[string]string{"key": options.Key})
+	} else {
+		fields["key"] = options.KeyPrefix + "${filename}"
+		conditions = append(conditions, []string{"starts-with", "$key", options.KeyPrefix})
+	}
+	if options.ContentTypePrefix != "" {
+		conditions = append(conditions, []string{"starts-with", "$Content-Type", options.ContentTypePrefix})
+	}
+	if options.MinContentLength > 0 || options.MaxContentLength > 0 {
+		maxLength := options.MaxContentLength
+		if maxLength <= 0 {
+			maxLength = maxPostObjectSize
+		}
+		conditions = append(conditions, []interface{}{"content-length-range", options.MinContentLength, maxLength})
+	}
+
+	expires := now.Add(expiration)
+	policy, err := json.Marshal(map[string]interface{}{
+		"expiration": expires.Format("2006-01-02T15:04:05.000Z"),
+		"conditions": conditions,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode POST policy: %w", err)
+	}
+
+	encoded := base64.StdEncoding.EncodeToString(policy)
+	fields["policy"] = encoded
+	fields["x-amz-signature"] = hex.EncodeToString(hmacSHA256(signingKey(creds.SecretAccessKey, date, region), encoded))
+
+	return &PresignedPost{URL: bucketURL, Fields: fields, Expires: expires}, nil
+}
+
+// PresignedPart is a presigned URL for uploading one part of a multipart upload
+type PresignedPart struct {
+	PartNumber int64
+	URL        string
+}
+
+// PresignedMultipartUpload is a multipart upload whose parts can be uploaded
+// directly by a client with presigned PUTs. The client must send each part
+// as exactly PartSize bytes, except the last one. Complete it with
+// CompleteMultipartUpload or discard it with AbortMultipartUpload.
+type PresignedMultipartUpload struct {
+	Bucket   string
+	Key      string
+	UploadID string
+	PartSize int64
+	Parts    []PresignedPart
+	Expires  time.Time
+}
+
+// PresignMultipartUpload starts a multipart upload for an object of size
+// bytes and presigns a PUT URL for each part. A partSize of 0 uses 64MB, or
+// larger if needed to stay within S3's 10000 part limit.
+func (c *Client) PresignMultipartUpload(bucket, key string, size, partSize int64, expiration time.Duration, options *UploadOptions) (*PresignedMultipartUpload, error) {
+	return c.PresignMultipartUploadWithContext(context.Background(), bucket, key, size, partSize, expiration, options)
+}
+
+// PresignMultipartUploadWithContext is like PresignMultipartUpload but uses ctx for the S3 requests
+func (c *Client) PresignMultipartUploadWithContext(ctx context.Context, bucket, key string, size, partSize int64, expiration time.Duration, options *UploadOptions) (*PresignedMultipartUpload, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("invalid upload size %d", size)
+	}
+	if partSize <= 0 {
+		partSize = 64 * 1024 * 1024
+		for (size+partSize-1)/partSize > s3manager.MaxUploadParts {
+			partSize *= 2
+		}
+	}
+	count := (size + partSize - 1) / partSize
+	if count > s3manager.MaxUploadParts {
+		return nil, fmt.Errorf("part size %d is too small for %d bytes: %d parts exceeds the limit of %d", partSize, size, count, s3manager.MaxUploadParts)
+	}
+
+	created, err := c.s3Client.CreateMultipartUploadWithContext(ctx, createUploadInput(bucket, key, options))
+	if err != nil {
+		return nil, fmt.Errorf("failed to start multipart upload to s3://%s/%s: %w", bucket, key, err)
+	}
+
+	upload := &PresignedMultipartUpload{
+		Bucket:   bucket,
+		Key:      key,
+		UploadID: aws.StringValue(created.UploadId),
+		PartSize: partSize,
+		Expires:  time.Now().Add(expiration),
+	}
+	for number := int64(1); number <= count; number++ {
+		url, err := c.PresignUploadPart(bucket, key, upload.UploadID, number, expiration)
+		if err != nil {
+			c.abortUpload(bucket, key, created.UploadId)
+			return nil, err
+		}
+		upload.Parts = append(upload.Parts, PresignedPart{PartNumber: number, URL: url})
+	}
+	return upload, nil
+}
+
+// PresignUploadPart generates a presigned PUT URL for one part of an existing
+// multipart upload, e.g. to replace an expired URL
+func (c *Client) PresignUploadPart(bucket, key, uploadID string, partNumber int64, expiration time.Duration) (string, error) {
+	req, _ := c.s3Client.UploadPartRequest(&s3.UploadPartInput{
+		Bucket:     aws.String(bucket),
+		Key:        aws.String(key),
+		UploadId:   aws.String(uploadID),
+		PartNumber: aws.Int64(partNumber),
+	})
+
+	url, err := req.Presign(expiration)
+	if err != nil {
+		return "", fmt.Errorf("failed to presign part %d of upload %s: %w", partNumber, uploadID, err)
+	}
+	return url, nil
+}
+
+// CompleteMultipartUpload completes an upload whose parts were sent by a
+// client. The parts are listed from S3, so the client does not need to
+// report their ETags, but parts 1 to partCount must all be present; pass
+// len(PresignedMultipartUpload.Parts). A missing or extra part fails
+// instead of producing a truncated object.
+func (c *Client) CompleteMultipartUpload(bucket, key, uploadID string, partCount int64) (string, error) {
+	return c.CompleteMultipartUploadWithContext(context.Background(), bucket, key, uploadID, partCount)
+}
+
+// CompleteMultipartUploadWithContext is like CompleteMultipartUpload but uses ctx for the S3 requests
+func (c *Client) CompleteMultipartUploadWithContext(ctx context.Context, bucket, key, uploadID string, partCount int64) (string, error) {
+	if partCount <= 0 {
+		return "", fmt.Errorf("invalid part count %d for upload %s", partCount, uploadID)
+	}
+	uploaded, err := c.listUploadedParts(ctx, bucket, key, uploadID)
+	if err != nil {
+		return "", err
+	}
+	for number := int64(1); number <= partCount; number++ {
+		if _, ok := uploaded[number]; !ok {
+			return "", fmt.Errorf("failed to complete upload %s: part %d of %d was not uploaded", uploadID, number, partCount)
+		}
+	}
+	if int64(len(uploaded)) != partCount {
+		return "", fmt.Errorf("failed to complete upload %s: expected %d parts, found %d", uploadID, partCount, len(uploaded))
+	}
+
+	checkpoint := &uploadCheckpoint{Parts: uploaded}
+	output, err := c.s3Client.CompleteMultipartUploadWithContext(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(bucket),
+		Key:             aws.String(key),
+		UploadId:        aws.String(uploadID),
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: checkpoint.completedParts()},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to complete upload to s3://%s/%s: %w", bucket, key, err)
+	}
+	return strings.Trim(aws.StringValue(output.ETag), `"`), nil
+}
+
+// bucketURL returns the endpoint URL of bucket, honouring the client's
+// endpoint and addressing style
+func (c *Client) bucketURL(bucket string) (string, error) {
+	req, _ := c.s3Client.HeadBucketRequest(&s3.HeadBucketInput{Bucket: aws.String(bucket)})
+	if err := req.Build(); err != nil {
+		return "", fmt.Errorf("failed to resolve URL of bucket %s: %w", bucket, err)
+	}
+
+	u := *req.HTTPRequest.URL
+	u.RawQuery = ""
+	if !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+		u.RawPath = ""
+	}
+	return u.String(), nil
+}
+
+// signingKey derives the SigV4 signing key for S3 in region on date
+func signingKey(secret, date, region string) []byte {
+	key := hmacSHA256([]byte("AWS4"+secret), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	return hmacSHA256(key, "aws4_request")
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of data
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// sortedKeys returns the keys of m in order
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
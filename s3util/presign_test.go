@@ -0,0 +1,218 @@
+package s3util
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPresignPut(t *testing.T) {
+	f, client := newFakeS3(t)
+
+	req, err := client.PresignPut("bucket", "uploads/a.json", 15*time.Minute, &PresignPutOptions{
+		ContentType: "application/json",
+		Metadata:    map[string]string{"owner": "alice"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, http.MethodPut, req.Method)
+	assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
+	assert.Equal(t, "alice", req.Header.Get("X-Amz-Meta-Owner"))
+
+	u, err := url.Parse(req.URL)
+	require.NoError(t, err)
+	assert.Equal(t, "/bucket/uploads/a.json", u.Path)
+	assert.Equal(t, "900", u.Query().Get("X-Amz-Expires"))
+	assert.Contains(t, u.Query().Get("X-Amz-SignedHeaders"), "content-type")
+	assert.Contains(t, u.Query().Get("X-Amz-SignedHeaders"), "x-amz-meta-owner")
+
+	httpReq, err := http.NewRequest(req.Method, req.URL, strings.NewReader(`{"ok":true}`))
+	require.NoError(t, err)
+	httpReq.Header = req.Header
+	resp, err := http.DefaultClient.Do(httpReq)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	obj, ok := f.Object("bucket", "uploads/a.json")
+	require.True(t, ok)
+	assert.Equal(t, `{"ok":true}`, string(obj.Data))
+}
+
+func TestPresignPost(t *testing.T) {
+	f, client := newFakeS3(t)
+
+	post, err := client.PresignPost("bucket", time.Hour, &PostPolicyOptions{
+		KeyPrefix:         "avatars/",
+		ContentTypePrefix: "image/",
+		MaxContentLength:  16,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, f.URL+"/bucket/", post.URL)
+	assert.Equal(t, "avatars/${filename}", post.Fields["key"])
+	assert.Equal(t, "AWS4-HMAC-SHA256", post.Fields["x-amz-algorithm"])
+	assert.True(t, strings.HasPrefix(post.Fields["x-amz-credential"], "test/"))
+	assert.True(t, strings.HasSuffix(post.Fields["x-amz-credential"], "/us-east-1/s3/aws4_request"))
+
+	// The signature is the HMAC of the encoded policy with the derived key
+	date := post.Fields["x-amz-date"][:8]
+	expected := hex.EncodeToString(hmacSHA256(signingKey("test", date, "us-east-1"), post.Fields["policy"]))
+	assert.Equal(t, expected, post.Fields["x-amz-signature"])
+
+	policy, err := base64.StdEncoding.DecodeString(post.Fields["policy"])
+	require.NoError(t, err)
+	var document struct {
+		Expiration string          `json:"expiration"`
+		Conditions json.RawMessage `json:"conditions"`
+	}
+	require.NoError(t, json.Unmarshal(policy, &document))
+	assert.Contains(t, string(document.Conditions), `["starts-with","$key","avatars/"]`)
+	assert.Contains(t, string(document.Conditions), `["content-length-range",0,16]`)
+	assert.Contains(t, string(document.Conditions), `{"bucket":"bucket"}`)
+
+	submit := func(fields map[string]string, filename, data string) int {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		for name, value := range fields {
+			require.NoError(t, mw.WriteField(name, value))
+		}
+		fw, err := mw.CreateFormFile("file", filename)
+		require.NoError(t, err)
+		fw.Write([]byte(data))
+		require.NoError(t, mw.Close())
+
+		resp, err := http.Post(post.URL, mw.FormDataContentType(), &body)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	withType := func(contentType string) map[string]string {
+		fields := map[string]string{"Content-Type": contentType}
+		for name, value := range post.Fields {
+			fields[name] = value
+		}
+		return fields
+	}
+
+	assert.Equal(t, http.StatusNoContent, submit(withType("image/png"), "me.png", "png-data"))
+	obj, ok := f.Object("bucket", "avatars/me.png")
+	require.True(t, ok)
+	assert.Equal(t, "png-data", string(obj.Data))
+
+	assert.Equal(t, http.StatusForbidden, submit(withType("image/png"), "big.png", strings.Repeat("x", 17)))
+	assert.Equal(t, http.StatusForbidden, submit(withType("text/html"), "x.html", "<html>"))
+	escaped := withType("image/png")
+	escaped["key"] = "other/${filename}"
+	assert.Equal(t, http.StatusForbidden, submit(escaped, "x.png", "data"))
+	assert.Equal(t, []string{"avatars/me.png"}, f.Keys("bucket"))
+}
+
+func TestPresignPost_Validation(t *testing.T) {
+	_, client := newFakeS3(t)
+
+	_, err := client.PresignPost("bucket", time.Hour, nil)
+	assert.Error(t, err)
+	_, err = client.PresignPost("bucket", time.Hour, &PostPolicyOptions{Key: "a", KeyPrefix: "b/"})
+	assert.Error(t, err)
+	_, err = client.PresignPost("bucket", time.Hour, &PostPolicyOptions{Key: "a", ContentType: "text/plain", ContentTypePrefix: "text/"})
+	assert.Error(t, err)
+	_, err = client.PresignPost("bucket", time.Hour, &PostPolicyOptions{Key: "a", MinContentLength: 10, MaxContentLength: 5})
+	assert.Error(t, err)
+
+	post, err := client.PresignPost("bucket", time.Hour, &PostPolicyOptions{
+		Key:                 "exact.txt",
+		ContentType:         "text/plain",
+		Metadata:            map[string]string{"Owner": "bob"},
+		SuccessActionStatus: 201,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "exact.txt", post.Fields["key"])
+	assert.Equal(t, "text/plain", post.Fields["Content-Type"])
+	assert.Equal(t, "bob", post.Fields["x-amz-meta-owner"])
+	assert.Equal(t, "201", post.Fields["success_action_status"])
+
+	// A minimum alone is enforced with the 5GB POST limit as the maximum
+	post, err = client.PresignPost("bucket", time.Hour, &PostPolicyOptions{Key: "a", MinContentLength: 10})
+	require.NoError(t, err)
+	policy, err := base64.StdEncoding.DecodeString(post.Fields["policy"])
+	require.NoError(t, err)
+	assert.Contains(t, string(policy), `["content-length-range",10,5368709120]`)
+	_, err = client.PresignPost("bucket", time.Hour, &PostPolicyOptions{Key: "a", MinContentLength: -1})
+	assert.Error(t, err)
+}
+
+func TestPresignMultipartUpload(t *testing.T) {
+	f, client := newFakeS3(t)
+	data := []byte(strings.Repeat("0123456789", 2) + "abcde")
+
+	upload, err := client.PresignMultipartUpload("bucket", "big.bin", int64(len(data)), 10, time.Hour, nil)
+	require.NoError(t, err)
+	assert.NotEmpty(t, upload.UploadID)
+	assert.Equal(t, int64(10), upload.PartSize)
+	require.Len(t, upload.Parts, 3)
+
+	put := func(i int) {
+		end := (i + 1) * 10
+		if end > len(data) {
+			end = len(data)
+		}
+		req, err := http.NewRequest(http.MethodPut, upload.Parts[i].URL, bytes.NewReader(data[i*10:end]))
+		require.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	// Upload the parts out of order, as a browser might, leaving a gap
+	put(2)
+	put(0)
+	_, err = client.CompleteMultipartUpload("bucket", "big.bin", upload.UploadID, int64(len(upload.Parts)))
+	assert.ErrorContains(t, err, "part 2 of 3 was not uploaded")
+	_, err = client.CompleteMultipartUpload("bucket", "big.bin", upload.UploadID, 1)
+	assert.ErrorContains(t, err, "expected 1 parts, found 2")
+
+	put(1)
+	for i, part := range upload.Parts {
+		assert.Equal(t, int64(i+1), part.PartNumber)
+	}
+
+	etag, err := client.CompleteMultipartUpload("bucket", "big.bin", upload.UploadID, int64(len(upload.Parts)))
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(etag, "-3"), etag)
+
+	obj, ok := f.Object("bucket", "big.bin")
+	require.True(t, ok)
+	assert.Equal(t, data, obj.Data)
+
+	uploads, err := client.ListIncompleteUploads("bucket", "")
+	require.NoError(t, err)
+	assert.Empty(t, uploads)
+}
+
+func TestPresignMultipartUpload_Validation(t *testing.T) {
+	_, client := newFakeS3(t)
+
+	_, err := client.PresignMultipartUpload("bucket", "k", 0, 0, time.Hour, nil)
+	assert.Error(t, err)
+	_, err = client.PresignMultipartUpload("bucket", "k", 20000, 1, time.Hour, nil)
+	assert.Error(t, err)
+
+	upload, err := client.PresignMultipartUpload("bucket", "k", 1, 0, time.Hour, nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(64*1024*1024), upload.PartSize)
+	assert.Len(t, upload.Parts, 1)
+
+	_, err = client.CompleteMultipartUpload("bucket", "k", upload.UploadID, 1)
+	assert.Error(t, err, "completing without parts fails")
+	require.NoError(t, client.AbortMultipartUpload("bucket", "k", upload.UploadID))
+}
@@ -0,0 +1,254 @@
+package s3util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/jelech/goutils/cacheutil"
+)
+
+// ReaderOptions contains options for OpenReader
+type ReaderOptions struct {
+	BlockSize   int64  // Bytes fetched per ranged GET (default 1MB)
+	CacheBlocks int    // Blocks kept in the LRU block cache (default 16)
+	ReadAhead   int    // Blocks prefetched in the background by sequential Reads (default 2, negative disables)
+	VersionID   string // Read a specific object version
+}
+
+// ObjectReader reads an S3 object with ranged GETs. It implements io.Reader,
+// io.Seeker, io.ReaderAt and io.Closer. Data is fetched in fixed-size blocks
+// that are kept in an LRU cache, and sequential Reads prefetch the following
+// blocks. ReadAt is safe for concurrent use; Read and Seek are not.
+//
+// The reader is pinned to the ETag seen when it was opened, so reads fail
+// rather than mix data if the object is overwritten.
+type ObjectReader struct {
+	client    *Client
+	bucket    string
+	key       string
+	etag      string
+	versionID string
+	size      int64
+	options   ReaderOptions
+
+	cache  cacheutil.Cache
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu       sync.Mutex
+	inflight map[int64]*blockFetch
+	offset   int64 // Used by Read and Seek
+}
+
+// blockFetch is a block being downloaded; done is closed when data or err is set
+type blockFetch struct {
+	done chan struct{}
+	data []byte
+	err  error
+}
+
+// OpenReader opens an object for random access without downloading it.
+// Only the object's metadata is fetched until data is read.
+func (c *Client) OpenReader(bucket, key string, options *ReaderOptions) (*ObjectReader, error) {
+	return c.OpenReaderWithContext(context.Background(), bucket, key, options)
+}
+
+// OpenReaderWithContext is like OpenReader but uses ctx for the S3 requests.
+// Cancelling ctx also fails later reads.
+func (c *Client) OpenReaderWithContext(ctx context.Context, bucket, key string, options *ReaderOptions) (*ObjectReader, error) {
+	config := ReaderOptions{}
+	if options != nil {
+		config = *options
+	}
+	if config.BlockSize <= 0 {
+		config.BlockSize = 1024 * 1024
+	}
+	if config.CacheBlocks <= 0 {
+		config.CacheBlocks = 16
+	}
+	if config.ReadAhead == 0 {
+		config.ReadAhead = 2
+	}
+
+	input := &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}
+	if config.VersionID != "" {
+		input.VersionId = aws.String(config.VersionID)
+	}
+	head, err := c.s3Client.HeadObjectWithContext(ctx, input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open s3://%s/%s: %w", bucket, key, err)
+	}
+
+	readerCtx, cancel := context.WithCancel(ctx)
+	return &ObjectReader{
+		client:    c,
+		bucket:    bucket,
+		key:       key,
+		etag:      aws.StringValue(head.ETag),
+		versionID: config.VersionID,
+		size:      aws.Int64Value(head.ContentLength),
+		options:   config,
+		cache:     cacheutil.NewLRUCache(config.CacheBlocks),
+		ctx:       readerCtx,
+		cancel:    cancel,
+		inflight:  make(map[int64]*blockFetch),
+	}, nil
+}
+
+// Size returns the object's size in bytes
+func (r *ObjectReader) Size() int64 {
+	return r.size
+}
+
+// ReadAt implements io.ReaderAt
+func (r *ObjectReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("negative offset %d", off)
+	}
+
+	n := 0
+	for n < len(p) && off < r.size {
+		index := off / r.options.BlockSize
+		data, err := r.block(index)
+		if err != nil {
+			return n, err
+		}
+		copied := copy(p[n:], data[off-index*r.options.BlockSize:])
+		n += copied
+		off += int64(copied)
+	}
+
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Read implements io.Reader
+func (r *ObjectReader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+
+	n, err := r.ReadAt(p, r.offset)
+	r.offset += int64(n)
+	if n > 0 && errors.Is(err, io.EOF) {
+		err = nil
+	}
+	if n > 0 {
+		r.readAhead((r.offset - 1) / r.options.BlockSize)
+	}
+	return n, err
+}
+
+// Seek implements io.Seeker
+func (r *ObjectReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, fmt.Errorf("invalid whence %d", whence)
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("negative position %d", offset)
+	}
+
+	r.offset = offset
+	return offset, nil
+}
+
+// Close stops any read-ahead in progress and releases the block cache
+func (r *ObjectReader) Close() error {
+	r.cancel()
+	return r.cache.Clear()
+}
+
+// readAhead starts background fetches of the blocks after index
+func (r *ObjectReader) readAhead(index int64) {
+	last := (r.size - 1) / r.options.BlockSize
+	for i := index + 1; i <= index+int64(r.options.ReadAhead) && i <= last; i++ {
+		r.fetch(i)
+	}
+}
+
+// block returns the data of block index, waiting for an in-flight fetch if needed
+func (r *ObjectReader) block(index int64) ([]byte, error) {
+	fetch := r.fetch(index)
+	<-fetch.done
+	return fetch.data, fetch.err
+}
+
+// fetch returns the cached or in-flight fetch of block index, starting one if needed
+func (r *ObjectReader) fetch(index int64) *blockFetch {
+	cacheKey := strconv.FormatInt(index, 10)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if data, ok := r.cache.Get(cacheKey); ok {
+		fetch := &blockFetch{done: make(chan struct{}), data: data.([]byte)}
+		close(fetch.done)
+		return fetch
+	}
+	if fetch, ok := r.inflight[index]; ok {
+		return fetch
+	}
+
+	fetch := &blockFetch{done: make(chan struct{})}
+	r.inflight[index] = fetch
+	go func() {
+		fetch.data, fetch.err = r.download(index)
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		delete(r.inflight, index)
+		if fetch.err == nil {
+			r.cache.Set(cacheKey, fetch.data, 0)
+		}
+		close(fetch.done)
+	}()
+	return fetch
+}
+
+// download fetches block index with a ranged GET
+func (r *ObjectReader) download(index int64) ([]byte, error) {
+	start := index * r.options.BlockSize
+	length := r.options.BlockSize
+	if start+length > r.size {
+		length = r.size - start
+	}
+
+	input := &s3.GetObjectInput{
+		Bucket:  aws.String(r.bucket),
+		Key:     aws.String(r.key),
+		Range:   aws.String(httpRange(start, length)),
+		IfMatch: aws.String(r.etag),
+	}
+	if r.versionID != "" {
+		input.VersionId = aws.String(r.versionID)
+	}
+
+	output, err := r.client.s3Client.GetObjectWithContext(r.ctx, input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read s3://%s/%s at offset %d: %w", r.bucket, r.key, start, err)
+	}
+	defer output.Body.Close()
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(output.Body, data); err != nil {
+		return nil, fmt.Errorf("failed to read s3://%s/%s at offset %d: %w", r.bucket, r.key, start, err)
+	}
+	return data, nil
+}
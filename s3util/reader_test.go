@@ -0,0 +1,145 @@
+package s3util
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestObjectReader_ReadSeek(t *testing.T) {
+	f, client := newFakeS3(t)
+	data := strings.Repeat("0123456789", 10)
+	f.PutObject("bucket", "obj", []byte(data))
+
+	r, err := client.OpenReader("bucket", "obj", &ReaderOptions{BlockSize: 16, ReadAhead: -1})
+	require.NoError(t, err)
+	defer r.Close()
+	assert.Equal(t, int64(100), r.Size())
+
+	all, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, data, string(all))
+	assert.Equal(t, 7, countRequests(f, "GET /bucket/obj"))
+
+	pos, err := r.Seek(-5, io.SeekEnd)
+	require.NoError(t, err)
+	assert.Equal(t, int64(95), pos)
+	tail, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, "56789", string(tail))
+
+	_, err = r.Seek(10, io.SeekStart)
+	require.NoError(t, err)
+	_, err = r.Seek(3, io.SeekCurrent)
+	require.NoError(t, err)
+	buf := make([]byte, 4)
+	_, err = io.ReadFull(r, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "3456", string(buf))
+
+	// Everything was served from the block cache
+	assert.Equal(t, 7, countRequests(f, "GET /bucket/obj"))
+
+	_, err = r.Seek(-1, io.SeekStart)
+	assert.Error(t, err)
+}
+
+func TestObjectReader_ReadAt(t *testing.T) {
+	f, client := newFakeS3(t)
+	data := strings.Repeat("abcdefghij", 5)
+	f.PutObject("bucket", "obj", []byte(data))
+
+	r, err := client.OpenReader("bucket", "obj", &ReaderOptions{BlockSize: 8, CacheBlocks: 2, ReadAhead: -1})
+	require.NoError(t, err)
+	defer r.Close()
+
+	buf := make([]byte, 10)
+	n, err := r.ReadAt(buf, 6)
+	require.NoError(t, err)
+	assert.Equal(t, 10, n)
+	assert.Equal(t, data[6:16], string(buf))
+
+	n, err = r.ReadAt(buf, 45)
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, data[45:], string(buf[:n]))
+
+	n, err = r.ReadAt(buf, 100)
+	assert.Equal(t, io.EOF, err)
+	assert.Zero(t, n)
+}
+
+func TestObjectReader_ReadAhead(t *testing.T) {
+	f, client := newFakeS3(t)
+	f.PutObject("bucket", "obj", []byte(strings.Repeat("x", 64)))
+
+	r, err := client.OpenReader("bucket", "obj", &ReaderOptions{BlockSize: 8, ReadAhead: 3})
+	require.NoError(t, err)
+	defer r.Close()
+
+	buf := make([]byte, 8)
+	_, err = io.ReadFull(r, buf)
+	require.NoError(t, err)
+
+	// Blocks 1 to 3 were prefetched; reading them adds no requests
+	require.Eventually(t, func() bool {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		return len(r.inflight) == 0 && r.cache.Size() == 4
+	}, time.Second, 5*time.Millisecond)
+	before := countRequests(f, "GET /bucket/obj")
+	_, err = r.ReadAt(make([]byte, 24), 8)
+	require.NoError(t, err)
+	assert.Equal(t, before, countRequests(f, "GET /bucket/obj"))
+}
+
+func TestObjectReader_Zip(t *testing.T) {
+	f, client := newFakeS3(t)
+
+	var archive bytes.Buffer
+	zw := zip.NewWriter(&archive)
+	for _, name := range []string{"a.txt", "b.txt"} {
+		w, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(strings.Repeat(name, 1000)))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	f.PutObject("bucket", "archive.zip", archive.Bytes())
+
+	r, err := client.OpenReader("bucket", "archive.zip", &ReaderOptions{BlockSize: 512})
+	require.NoError(t, err)
+	defer r.Close()
+
+	zr, err := zip.NewReader(r, r.Size())
+	require.NoError(t, err)
+	require.Len(t, zr.File, 2)
+
+	rc, err := zr.File[1].Open()
+	require.NoError(t, err)
+	content, err := io.ReadAll(rc)
+	rc.Close()
+	require.NoError(t, err)
+	assert.Equal(t, strings.Repeat("b.txt", 1000), string(content))
+}
+
+func TestObjectReader_Overwritten(t *testing.T) {
+	f, client := newFakeS3(t)
+	f.PutObject("bucket", "obj", []byte("original content"))
+
+	r, err := client.OpenReader("bucket", "obj", &ReaderOptions{ReadAhead: -1})
+	require.NoError(t, err)
+	defer r.Close()
+
+	f.PutObject("bucket", "obj", []byte("replaced content"))
+	_, err = io.ReadAll(r)
+	assert.Error(t, err)
+
+	_, err = client.OpenReader("bucket", "missing", nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,497 @@
+package s3util
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// ResumableOptions contains options for ResumableUpload
+type ResumableOptions struct {
+	PartSize       int64  // Bytes per part (default 64MB, at least 5MB); raised if the file would need over 10000 parts
+	Concurrency    int    // Parallel part uploads (default 4)
+	CheckpointFile string // Where progress is saved (default filename + ".s3upload")
+	UploadOptions  *UploadOptions
+}
+
+// IncompleteUpload is a multipart upload that was started but never completed or aborted
+type IncompleteUpload struct {
+	Key          string
+	UploadID     string
+	Initiated    time.Time
+	StorageClass string
+}
+
+// minPartSize is the smallest part S3 accepts for all but the last part.
+// Tests lower it to exercise multipart uploads with small files.
+var minPartSize int64 = s3manager.MinUploadPartSize
+
+// uploadCheckpoint is the persisted state of a resumable upload
+type uploadCheckpoint struct {
+	Bucket   string           `json:"bucket"`
+	Key      string           `json:"key"`
+	UploadID string           `json:"upload_id"`
+	Size     int64            `json:"size"`
+	ModTime  time.Time        `json:"mod_time"`
+	PartSize int64            `json:"part_size"`
+	Parts    map[int64]string `json:"parts"` // Part number -> ETag
+
+	ChecksumAlgorithm ChecksumAlgorithm `json:"checksum_algorithm,omitempty"`
+	Checksums         map[int64][]byte  `json:"checksums,omitempty"` // Part number -> checksum
+}
+
+// ResumableUpload uploads a file in parts, saving the upload ID and the ETag
+// of every completed part to a checkpoint file. If the upload is interrupted,
+// calling ResumableUpload again with the same arguments uploads only the
+// missing parts. The checkpoint is removed once the upload completes; a failed
+// upload is left in place so it can be resumed or aborted with AbortStaleUploads.
+// Files no larger than one part are read into memory and uploaded with a
+// single PutObject request. UploadOptions.Verify and ChecksumAlgorithm apply
+// to both paths.
+func (c *Client) ResumableUpload(bucket, key, filename string, options *ResumableOptions) (*s3manager.UploadOutput, error) {
+	return c.ResumableUploadWithContext(context.Background(), bucket, key, filename, options)
+}
+
+// ResumableUploadWithContext is like ResumableUpload but uses ctx for the S3
+// requests. A cancelled upload keeps its checkpoint and can be resumed.
+func (c *Client) ResumableUploadWithContext(ctx context.Context, bucket, key, filename string, options *ResumableOptions) (*s3manager.UploadOutput, error) {
+	options = resumableDefaults(options, filename)
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %s: %w", filename, err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat file %s: %w", filename, err)
+	}
+	if options.UploadOptions.ChecksumAlgorithm != "" {
+		if _, err := options.UploadOptions.ChecksumAlgorithm.newHash(); err != nil {
+			return nil, err
+		}
+	}
+	if info.Size() <= options.PartSize {
+		data, err := io.ReadAll(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file %s: %w", filename, err)
+		}
+		return c.checkedPut(ctx, bucket, key, data, options.UploadOptions)
+	}
+	if options.PartSize, err = resumablePartSize(info.Size(), options.PartSize); err != nil {
+		return nil, err
+	}
+
+	checkpoint, err := c.resumeCheckpoint(ctx, bucket, key, info, options)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.uploadMissingParts(ctx, file, checkpoint, options); err != nil {
+		return nil, fmt.Errorf("failed to upload s3://%s/%s (progress saved to %s): %w",
+			bucket, key, options.CheckpointFile, err)
+	}
+
+	output, err := c.completeCheckedUpload(ctx, bucket, key, checkpoint.UploadID, checkpoint.checkedParts(), options.UploadOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.Remove(options.CheckpointFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to remove checkpoint %s: %w", options.CheckpointFile, err)
+	}
+	return output, nil
+}
+
+// resumablePartSize checks partSize against S3's minimum part size and raises
+// it, like s3manager, when size would need more than the maximum number of parts
+func resumablePartSize(size, partSize int64) (int64, error) {
+	if partSize < minPartSize {
+		return 0, fmt.Errorf("part size %d is below the S3 minimum of %d bytes", partSize, minPartSize)
+	}
+	if (size+partSize-1)/partSize > s3manager.MaxUploadParts {
+		partSize = (size + s3manager.MaxUploadParts - 1) / s3manager.MaxUploadParts
+	}
+	return partSize, nil
+}
+
+// resumeCheckpoint loads a matching checkpoint and reconciles it with the parts
+// S3 still has, or starts a new upload
+func (c *Client) resumeCheckpoint(ctx context.Context, bucket, key string, info os.FileInfo, options *ResumableOptions) (*uploadCheckpoint, error) {
+	saved, err := loadCheckpoint(options.CheckpointFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if saved != nil {
+		algorithm := options.UploadOptions.ChecksumAlgorithm
+		matches := saved.Bucket == bucket && saved.Key == key && saved.Size == info.Size() &&
+			saved.ModTime.Equal(info.ModTime()) && saved.PartSize == options.PartSize &&
+			saved.ChecksumAlgorithm == algorithm
+		if matches {
+			uploaded, err := c.listUploadedParts(ctx, bucket, key, saved.UploadID)
+			if err == nil {
+				for number, etag := range saved.Parts {
+					if uploaded[number] != etag || (algorithm != "" && saved.Checksums[number] == nil) {
+						delete(saved.Parts, number)
+					}
+				}
+				return saved, nil
+			}
+			if !isNoSuchUpload(err) {
+				return nil, err
+			}
+		} else if saved.Bucket != "" && saved.UploadID != "" {
+			// The file or target changed, so the old parts are useless
+			c.abortUpload(saved.Bucket, saved.Key, aws.String(saved.UploadID))
+		}
+	}
+
+	input := createUploadInput(bucket, key, options.UploadOptions)
+	if options.UploadOptions.ChecksumAlgorithm != "" {
+		input.ChecksumAlgorithm = aws.String(string(options.UploadOptions.ChecksumAlgorithm))
+	}
+	created, err := c.s3Client.CreateMultipartUploadWithContext(ctx, input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start multipart upload to s3://%s/%s: %w", bucket, key, err)
+	}
+
+	checkpoint := &uploadCheckpoint{
+		Bucket:   bucket,
+		Key:      key,
+		UploadID: aws.StringValue(created.UploadId),
+		Size:     info.Size(),
+		ModTime:  info.ModTime(),
+		PartSize: options.PartSize,
+		Parts:    make(map[int64]string),
+
+		ChecksumAlgorithm: options.UploadOptions.ChecksumAlgorithm,
+		Checksums:         make(map[int64][]byte),
+	}
+	if err := checkpoint.save(options.CheckpointFile); err != nil {
+		c.abortUpload(bucket, key, created.UploadId)
+		return nil, err
+	}
+	return checkpoint, nil
+}
+
+// uploadMissingParts uploads the parts not yet recorded in checkpoint, saving
+// the checkpoint after each one. Each part is read into memory so it can be
+// sent with Content-MD5 and any configured checksum. It stops at the first error.
+func (c *Client) uploadMissingParts(ctx context.Context, file *os.File, checkpoint *uploadCheckpoint, options *ResumableOptions) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		firstErr error
+		sem      = make(chan struct{}, options.Concurrency)
+	)
+	fail := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if firstErr == nil {
+			firstErr = err
+			cancel()
+		}
+	}
+
+	// Collect the missing parts first; workers update checkpoint.Parts as they finish
+	var missing []int64
+	total := (checkpoint.Size + checkpoint.PartSize - 1) / checkpoint.PartSize
+	for number := int64(1); number <= total; number++ {
+		if _, done := checkpoint.Parts[number]; !done {
+			missing = append(missing, number)
+		}
+	}
+
+	for _, number := range missing {
+		if ctx.Err() != nil {
+			break
+		}
+
+		offset := (number - 1) * checkpoint.PartSize
+		size := checkpoint.PartSize
+		if offset+size > checkpoint.Size {
+			size = checkpoint.Size - offset
+		}
+
+		number := number
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			data := make([]byte, size)
+			if _, err := file.ReadAt(data, offset); err != nil {
+				fail(fmt.Errorf("failed to read part %d: %w", number, err))
+				return
+			}
+			part, err := c.uploadCheckedPart(ctx, checkpoint.Bucket, checkpoint.Key, checkpoint.UploadID, number, data, options.UploadOptions)
+			if err != nil {
+				fail(err)
+				return
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			checkpoint.Parts[number] = part.etag
+			if part.checksum != nil {
+				checkpoint.Checksums[number] = part.checksum
+			}
+			if err := checkpoint.save(options.CheckpointFile); err != nil && firstErr == nil {
+				firstErr = err
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if firstErr == nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return firstErr
+}
+
+// listUploadedParts returns the unquoted ETag of every part S3 has for the upload
+func (c *Client) listUploadedParts(ctx context.Context, bucket, key, uploadID string) (map[int64]string, error) {
+	parts := make(map[int64]string)
+	err := c.s3Client.ListPartsPagesWithContext(ctx, &s3.ListPartsInput{
+		Bucket:   aws.String(bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadID),
+	}, func(page *s3.ListPartsOutput, lastPage bool) bool {
+		for _, part := range page.Parts {
+			parts[aws.Int64Value(part.PartNumber)] = strings.Trim(aws.StringValue(part.ETag), `"`)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list parts of upload %s: %w", uploadID, err)
+	}
+	return parts, nil
+}
+
+// ListIncompleteUploads lists the multipart uploads in progress under prefix,
+// ordered by key and then initiation time
+func (c *Client) ListIncompleteUploads(bucket, prefix string) ([]IncompleteUpload, error) {
+	return c.ListIncompleteUploadsWithContext(context.Background(), bucket, prefix)
+}
+
+// ListIncompleteUploadsWithContext is like ListIncompleteUploads but uses ctx for the S3 requests
+func (c *Client) ListIncompleteUploadsWithContext(ctx context.Context, bucket, prefix string) ([]IncompleteUpload, error) {
+	var uploads []IncompleteUpload
+	err := c.s3Client.ListMultipartUploadsPagesWithContext(ctx, &s3.ListMultipartUploadsInput{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	}, func(page *s3.ListMultipartUploadsOutput, lastPage bool) bool {
+		for _, upload := range page.Uploads {
+			uploads = append(uploads, IncompleteUpload{
+				Key:          aws.StringValue(upload.Key),
+				UploadID:     aws.StringValue(upload.UploadId),
+				Initiated:    aws.TimeValue(upload.Initiated),
+				StorageClass: aws.StringValue(upload.StorageClass),
+			})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list multipart uploads in s3://%s/%s: %w", bucket, prefix, err)
+	}
+
+	sort.SliceStable(uploads, func(i, j int) bool {
+		if uploads[i].Key != uploads[j].Key {
+			return uploads[i].Key < uploads[j].Key
+		}
+		return uploads[i].Initiated.Before(uploads[j].Initiated)
+	})
+	return uploads, nil
+}
+
+// AbortMultipartUpload aborts an upload and deletes its parts
+func (c *Client) AbortMultipartUpload(bucket, key, uploadID string) error {
+	return c.AbortMultipartUploadWithContext(context.Background(), bucket, key, uploadID)
+}
+
+// AbortMultipartUploadWithContext is like AbortMultipartUpload but uses ctx for the S3 requests
+func (c *Client) AbortMultipartUploadWithContext(ctx context.Context, bucket, key, uploadID string) error {
+	_, err := c.s3Client.AbortMultipartUploadWithContext(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadID),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to abort upload %s to s3://%s/%s: %w", uploadID, bucket, key, err)
+	}
+	return nil
+}
+
+// AbortStaleUploads aborts the incomplete uploads under prefix that were
+// initiated more than olderThan ago and returns them. Uploads that could not
+// be aborted are reported in the error and left out of the result.
+func (c *Client) AbortStaleUploads(bucket, prefix string, olderThan time.Duration) ([]IncompleteUpload, error) {
+	return c.AbortStaleUploadsWithContext(context.Background(), bucket, prefix, olderThan)
+}
+
+// AbortStaleUploadsWithContext is like AbortStaleUploads but uses ctx for the S3 requests
+func (c *Client) AbortStaleUploadsWithContext(ctx context.Context, bucket, prefix string, olderThan time.Duration) ([]IncompleteUpload, error) {
+	uploads, err := c.ListIncompleteUploadsWithContext(ctx, bucket, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	cutoff := time.Now().Add(-olderThan)
+	var aborted []IncompleteUpload
+	var errs []error
+	for _, upload := range uploads {
+		if !upload.Initiated.Before(cutoff) {
+			continue
+		}
+		if err := c.AbortMultipartUploadWithContext(ctx, bucket, upload.Key, upload.UploadID); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		aborted = append(aborted, upload)
+	}
+	return aborted, errors.Join(errs...)
+}
+
+// completedParts returns the recorded parts in part number order
+func (cp *uploadCheckpoint) completedParts() []*s3.CompletedPart {
+	parts := make([]*s3.CompletedPart, 0, len(cp.Parts))
+	for number, etag := range cp.Parts {
+		parts = append(parts, &s3.CompletedPart{PartNumber: aws.Int64(number), ETag: aws.String(`"` + etag + `"`)})
+	}
+	sort.Slice(parts, func(i, j int) bool {
+		return aws.Int64Value(parts[i].PartNumber) < aws.Int64Value(parts[j].PartNumber)
+	})
+	return parts
+}
+
+// checkedParts returns the recorded parts in part number order. The MD5 of a
+// part is taken from its ETag, which is only an MD5 digest when etagIsMD5 holds.
+func (cp *uploadCheckpoint) checkedParts() []checkedPart {
+	parts := make([]checkedPart, 0, len(cp.Parts))
+	for number, etag := range cp.Parts {
+		digest, _ := hex.DecodeString(etag)
+		parts = append(parts, checkedPart{number: number, etag: etag, md5: digest, checksum: cp.Checksums[number]})
+	}
+	sort.Slice(parts, func(i, j int) bool { return parts[i].number < parts[j].number })
+	return parts
+}
+
+// save writes the checkpoint atomically, so a crash never leaves a truncated file
+func (cp *uploadCheckpoint) save(filename string) error {
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return fmt.Errorf("failed to encode checkpoint: %w", err)
+	}
+
+	tmp := filename + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write checkpoint %s: %w", filename, err)
+	}
+	if err := os.Rename(tmp, filename); err != nil {
+		return fmt.Errorf("failed to write checkpoint %s: %w", filename, err)
+	}
+	return nil
+}
+
+// loadCheckpoint reads a checkpoint file, returning nil if it does not exist.
+// A corrupt checkpoint is treated as missing.
+func loadCheckpoint(filename string) (*uploadCheckpoint, error) {
+	data, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint %s: %w", filename, err)
+	}
+
+	var checkpoint uploadCheckpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil || checkpoint.Parts == nil {
+		return nil, nil
+	}
+	if checkpoint.Checksums == nil {
+		checkpoint.Checksums = make(map[int64][]byte)
+	}
+	return &checkpoint, nil
+}
+
+// createUploadInput builds a CreateMultipartUpload request from upload options
+func createUploadInput(bucket, key string, options *UploadOptions) *s3.CreateMultipartUploadInput {
+	input := &s3.CreateMultipartUploadInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}
+	if options == nil {
+		return input
+	}
+
+	if options.ContentType != "" {
+		input.ContentType = aws.String(options.ContentType)
+	}
+	if options.ContentEncoding != "" {
+		input.ContentEncoding = aws.String(options.ContentEncoding)
+	}
+	if options.Metadata != nil {
+		input.Metadata = options.Metadata
+	}
+	if options.ACL != "" {
+		input.ACL = aws.String(options.ACL)
+	}
+	if options.StorageClass != "" {
+		input.StorageClass = aws.String(options.StorageClass)
+	}
+	if options.ServerSideEncryption != "" {
+		input.ServerSideEncryption = aws.String(options.ServerSideEncryption)
+	}
+	if options.KMSKeyID != "" {
+		input.SSEKMSKeyId = aws.String(options.KMSKeyID)
+	}
+	return input
+}
+
+// isNoSuchUpload reports whether err means the multipart upload no longer exists
+func isNoSuchUpload(err error) bool {
+	var awsErr awserr.Error
+	return errors.As(err, &awsErr) && awsErr.Code() == s3.ErrCodeNoSuchUpload
+}
+
+// resumableDefaults returns a copy of options with defaults applied
+func resumableDefaults(options *ResumableOptions, filename string) *ResumableOptions {
+	config := ResumableOptions{}
+	if options != nil {
+		config = *options
+	}
+	if config.PartSize <= 0 {
+		config.PartSize = 64 * 1024 * 1024
+	}
+	if config.Concurrency <= 0 {
+		config.Concurrency = 4
+	}
+	if config.CheckpointFile == "" {
+		config.CheckpointFile = filepath.Clean(filename) + ".s3upload"
+	}
+	if config.UploadOptions == nil {
+		config.UploadOptions = &UploadOptions{}
+	}
+	return &config
+}
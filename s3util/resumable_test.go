@@ -0,0 +1,219 @@
+package s3util
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestFile writes data to a file in a temporary directory
+func writeTestFile(t *testing.T, data string) string {
+	filename := filepath.Join(t.TempDir(), "data.bin")
+	require.NoError(t, os.WriteFile(filename, []byte(data), 0644))
+	return filename
+}
+
+// allowSmallParts lowers the minimum part size for the duration of the test
+func allowSmallParts(t *testing.T) {
+	minPartSize = 1
+	t.Cleanup(func() { minPartSize = s3manager.MinUploadPartSize })
+}
+
+func TestResumableUpload(t *testing.T) {
+	allowSmallParts(t)
+	f, client := newFakeS3(t)
+	data := strings.Repeat("0123456789", 10)
+	filename := writeTestFile(t, data)
+
+	output, err := client.ResumableUpload("bucket", "big.bin", filename, &ResumableOptions{PartSize: 30, Concurrency: 2})
+	require.NoError(t, err)
+	assert.NotEmpty(t, output.UploadID)
+
+	obj, ok := f.Object("bucket", "big.bin")
+	require.True(t, ok)
+	assert.Equal(t, data, string(obj.Data))
+	assert.True(t, strings.HasSuffix(obj.ETag, "-4"))
+	assert.NoFileExists(t, filename+".s3upload")
+}
+
+func TestResumableUpload_Resume(t *testing.T) {
+	allowSmallParts(t)
+	f, client := newFakeS3(t)
+	data := strings.Repeat("abcdefghij", 10)
+	filename := writeTestFile(t, data)
+	checkpoint := filepath.Join(t.TempDir(), "upload.checkpoint")
+	options := &ResumableOptions{PartSize: 20, Concurrency: 1, CheckpointFile: checkpoint}
+
+	f.FailPart(3)
+	_, err := client.ResumableUpload("bucket", "big.bin", filename, options)
+	require.Error(t, err)
+	assert.FileExists(t, checkpoint)
+
+	saved, err := loadCheckpoint(checkpoint)
+	require.NoError(t, err)
+	assert.Len(t, saved.Parts, 2)
+
+	uploads, err := client.ListIncompleteUploads("bucket", "")
+	require.NoError(t, err)
+	require.Len(t, uploads, 1)
+	assert.Equal(t, saved.UploadID, uploads[0].UploadID)
+
+	// The second run reuses the upload and only sends parts 3 to 5
+	before := countRequests(f, "PUT /bucket/big.bin?partNumber=")
+	output, err := client.ResumableUpload("bucket", "big.bin", filename, options)
+	require.NoError(t, err)
+	assert.Equal(t, saved.UploadID, output.UploadID)
+	assert.Equal(t, 3, countRequests(f, "PUT /bucket/big.bin?partNumber=")-before)
+
+	obj, ok := f.Object("bucket", "big.bin")
+	require.True(t, ok)
+	assert.Equal(t, data, string(obj.Data))
+	assert.NoFileExists(t, checkpoint)
+
+	uploads, err = client.ListIncompleteUploads("bucket", "")
+	require.NoError(t, err)
+	assert.Empty(t, uploads)
+}
+
+func TestResumableUpload_ChangedFileRestarts(t *testing.T) {
+	allowSmallParts(t)
+	f, client := newFakeS3(t)
+	filename := writeTestFile(t, strings.Repeat("x", 50))
+	options := &ResumableOptions{PartSize: 20, Concurrency: 1}
+
+	f.FailPart(2)
+	_, err := client.ResumableUpload("bucket", "obj", filename, options)
+	require.Error(t, err)
+	saved, err := loadCheckpoint(filename + ".s3upload")
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(filename, []byte(strings.Repeat("y", 60)), 0644))
+	output, err := client.ResumableUpload("bucket", "obj", filename, options)
+	require.NoError(t, err)
+	assert.NotEqual(t, saved.UploadID, output.UploadID)
+
+	obj, _ := f.Object("bucket", "obj")
+	assert.Equal(t, strings.Repeat("y", 60), string(obj.Data))
+
+	// The abandoned upload was aborted rather than left behind
+	uploads, err := client.ListIncompleteUploads("bucket", "")
+	require.NoError(t, err)
+	assert.Empty(t, uploads)
+}
+
+func TestResumableUpload_SmallFile(t *testing.T) {
+	f, client := newFakeS3(t)
+	filename := writeTestFile(t, "small")
+
+	_, err := client.ResumableUpload("bucket", "small.txt", filename, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 0, countRequests(f, "POST /bucket/small.txt?uploads"))
+	obj, _ := f.Object("bucket", "small.txt")
+	assert.Equal(t, "small", string(obj.Data))
+}
+
+func TestAbortStaleUploads(t *testing.T) {
+	f, client := newFakeS3(t)
+	for _, key := range []string{"tmp/a", "tmp/b", "keep/c"} {
+		_, err := client.GetS3Client().CreateMultipartUpload(createUploadInput("bucket", key, nil))
+		require.NoError(t, err)
+	}
+
+	aborted, err := client.AbortStaleUploads("bucket", "tmp/", time.Hour)
+	require.NoError(t, err)
+	assert.Empty(t, aborted)
+
+	aborted, err = client.AbortStaleUploads("bucket", "tmp/", 0)
+	require.NoError(t, err)
+	require.Len(t, aborted, 2)
+	assert.Equal(t, "tmp/a", aborted[0].Key)
+	assert.Equal(t, "tmp/b", aborted[1].Key)
+
+	uploads, err := client.ListIncompleteUploads("bucket", "")
+	require.NoError(t, err)
+	require.Len(t, uploads, 1)
+	assert.Equal(t, "keep/c", uploads[0].Key)
+	assert.Equal(t, 2, countRequests(f, "DELETE /bucket/tmp/"))
+}
+
+func TestResumableUpload_PartSize(t *testing.T) {
+	f, client := newFakeS3(t)
+	filename := writeTestFile(t, strings.Repeat("x", 50))
+
+	_, err := client.ResumableUpload("bucket", "obj", filename, &ResumableOptions{PartSize: 20})
+	assert.ErrorContains(t, err, "below the S3 minimum")
+	assert.Empty(t, f.Requests(), "nothing is uploaded with an invalid part size")
+	assert.NoFileExists(t, filename+".s3upload")
+
+	partSize, err := resumablePartSize(100*1024*1024*1024, 5*1024*1024)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10737419), partSize)
+	assert.LessOrEqual(t, (100*1024*1024*1024+partSize-1)/partSize, int64(s3manager.MaxUploadParts))
+
+	partSize, err = resumablePartSize(100, 64*1024*1024)
+	require.NoError(t, err)
+	assert.Equal(t, int64(64*1024*1024), partSize)
+}
+
+func TestResumableUpload_SinglePut(t *testing.T) {
+	f, client := newFakeS3(t)
+	data := strings.Repeat("z", 6*1024*1024)
+	filename := writeTestFile(t, data)
+
+	// Larger than the uploader's 5MB parts, but within one 64MB part
+	_, err := client.ResumableUpload("bucket", "obj", filename, nil)
+	require.NoError(t, err)
+	_, err = client.ResumableUpload("bucket", "checked", filename, &ResumableOptions{
+		UploadOptions: &UploadOptions{Verify: true, ChecksumAlgorithm: ChecksumSHA256},
+	})
+	require.NoError(t, err)
+
+	for _, key := range []string{"obj", "checked"} {
+		assert.Equal(t, 0, countRequests(f, "POST /bucket/"+key+"?uploads"))
+		assert.Equal(t, 1, countRequests(f, "PUT /bucket/"+key))
+		obj, ok := f.Object("bucket", key)
+		require.True(t, ok)
+		assert.Equal(t, len(data), len(obj.Data))
+	}
+	checked, _ := f.Object("bucket", "checked")
+	assert.Len(t, checked.Checksums, 1)
+}
+
+func TestResumableUpload_Integrity(t *testing.T) {
+	allowSmallParts(t)
+	f, client := newFakeS3(t)
+	data := strings.Repeat("0123456789", 10)
+	filename := writeTestFile(t, data)
+	options := &ResumableOptions{
+		PartSize:      20,
+		Concurrency:   1,
+		UploadOptions: &UploadOptions{Verify: true, ChecksumAlgorithm: ChecksumSHA256},
+	}
+
+	f.FailPart(3)
+	_, err := client.ResumableUpload("bucket", "big.bin", filename, options)
+	require.Error(t, err)
+	saved, err := loadCheckpoint(filename + ".s3upload")
+	require.NoError(t, err)
+	assert.Equal(t, ChecksumSHA256, saved.ChecksumAlgorithm)
+	assert.Len(t, saved.Checksums, 2)
+
+	// The resumed upload completes with the checksums of the earlier parts
+	_, err = client.ResumableUpload("bucket", "big.bin", filename, options)
+	require.NoError(t, err)
+	obj, ok := f.Object("bucket", "big.bin")
+	require.True(t, ok)
+	assert.Equal(t, data, string(obj.Data))
+	assert.Len(t, obj.Checksums, 1)
+
+	_, err = client.ResumableUpload("bucket", "big.bin", filename, &ResumableOptions{
+		UploadOptions: &UploadOptions{ChecksumAlgorithm: "MD4"},
+	})
+	assert.Error(t, err)
+}
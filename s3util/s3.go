@@ -2,8 +2,10 @@ package s3util
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
@@ -13,6 +15,7 @@ import (
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/jelech/goutils/retryutil"
 )
 
 // Client wraps AWS S3 client with convenient methods
@@ -24,52 +27,66 @@ type Client struct {
 	region     string
 }
 
-// Config holds S3 client configuration
+// Config holds S3 client configuration. Credentials are resolved in order:
+// AccessKeyID/SecretAccessKey, then Profile, then the SDK default chain
+// (environment, shared files, instance role). RoleARN is then assumed on top.
 type Config struct {
 	Region           string
 	AccessKeyID      string
 	SecretAccessKey  string
 	SessionToken     string
+	Profile          string // Named profile from the shared config and credentials files
 	Endpoint         string
 	DisableSSL       bool
 	S3ForcePathStyle bool
-}
 
-// NewClient creates a new S3 client with the given configuration
-func NewClient(config *Config) (*Client, error) {
-	awsConfig := &aws.Config{
-		Region: aws.String(config.Region),
-	}
+	RoleARN         string        // Role to assume with STS
+	RoleSessionName string        // Defaults to a generated name
+	ExternalID      string        // Required by some cross-account roles
+	RoleDuration    time.Duration // Assumed credential lifetime (default 15 minutes)
 
-	if config.Endpoint != "" {
-		awsConfig.Endpoint = aws.String(config.Endpoint)
-	}
+	MaxRetries   int                // SDK retries per request (0 for the SDK default of 3, negative disables)
+	RetryOptions []retryutil.Option // Use retryutil backoff instead of the SDK's; overrides MaxRetries
+	HTTPClient   *http.Client       // Custom HTTP client, e.g. with proxy or timeout settings
+	Logger       Logger             // Logs one line per S3 request
+	LogLevel     aws.LogLevelType   // SDK debug logging sent to Logger (default off)
 
-	if config.DisableSSL {
-		awsConfig.DisableSSL = aws.Bool(true)
-	}
-
-	if config.S3ForcePathStyle {
-		awsConfig.S3ForcePathStyle = aws.Bool(true)
-	}
+	PartSize    int64 // Default part size of uploads and downloads (default 5MB)
+	Concurrency int   // Default parts transferred in parallel (default 5)
+}
 
-	// Create session
-	sess, err := session.NewSession(awsConfig)
+// NewClient creates a new S3 client with the given configuration
+func NewClient(config *Config) (*Client, error) {
+	sess, err := newSession(config)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create AWS session: %w", err)
+		return nil, err
 	}
 
-	// Create S3 client and upload/download managers
+	// Create S3 client and upload/download managers sharing its handlers
 	s3Client := s3.New(sess)
-	uploader := s3manager.NewUploader(sess)
-	downloader := s3manager.NewDownloader(sess)
+	uploader := s3manager.NewUploaderWithClient(s3Client, func(u *s3manager.Uploader) {
+		if config.PartSize > 0 {
+			u.PartSize = config.PartSize
+		}
+		if config.Concurrency > 0 {
+			u.Concurrency = config.Concurrency
+		}
+	})
+	downloader := s3manager.NewDownloaderWithClient(s3Client, func(d *s3manager.Downloader) {
+		if config.PartSize > 0 {
+			d.PartSize = config.PartSize
+		}
+		if config.Concurrency > 0 {
+			d.Concurrency = config.Concurrency
+		}
+	})
 
 	return &Client{
 		s3Client:   s3Client,
 		uploader:   uploader,
 		downloader: downloader,
 		session:    sess,
-		region:     config.Region,
+		region:     aws.StringValue(sess.Config.Region),
 	}, nil
 }
 
@@ -86,7 +103,12 @@ func NewClientFromSession(sess *session.Session) *Client {
 
 // GetObject downloads an object from S3 and returns its content as bytes
 func (c *Client) GetObject(bucket, key string) ([]byte, error) {
-	result, err := c.s3Client.GetObject(&s3.GetObjectInput{
+	return c.GetObjectWithContext(context.Background(), bucket, key)
+}
+
+// GetObjectWithContext is like GetObject but uses ctx for the S3 requests
+func (c *Client) GetObjectWithContext(ctx context.Context, bucket, key string) ([]byte, error) {
+	result, err := c.s3Client.GetObjectWithContext(ctx, &s3.GetObjectInput{
 		Bucket: aws.String(bucket),
 		Key:    aws.String(key),
 	})
@@ -105,16 +127,26 @@ func (c *Client) GetObject(bucket, key string) ([]byte, error) {
 
 // GetObjectFromPath downloads an object using S3 path string
 func (c *Client) GetObjectFromPath(s3Path string) ([]byte, error) {
+	return c.GetObjectFromPathWithContext(context.Background(), s3Path)
+}
+
+// GetObjectFromPathWithContext is like GetObjectFromPath but uses ctx for the S3 requests
+func (c *Client) GetObjectFromPathWithContext(ctx context.Context, s3Path string) ([]byte, error) {
 	path, err := ParseS3Path(s3Path)
 	if err != nil {
 		return nil, err
 	}
 
-	return c.GetObject(path.Bucket, path.Key)
+	return c.GetObjectWithContext(ctx, path.Bucket, path.Key)
 }
 
 // PutObject uploads data to S3
 func (c *Client) PutObject(bucket, key string, data []byte, contentType string) error {
+	return c.PutObjectWithContext(context.Background(), bucket, key, data, contentType)
+}
+
+// PutObjectWithContext is like PutObject but uses ctx for the S3 requests
+func (c *Client) PutObjectWithContext(ctx context.Context, bucket, key string, data []byte, contentType string) error {
 	input := &s3.PutObjectInput{
 		Bucket: aws.String(bucket),
 		Key:    aws.String(key),
@@ -125,7 +157,7 @@ func (c *Client) PutObject(bucket, key string, data []byte, contentType string)
 		input.ContentType = aws.String(contentType)
 	}
 
-	_, err := c.s3Client.PutObject(input)
+	_, err := c.s3Client.PutObjectWithContext(ctx, input)
 	if err != nil {
 		return fmt.Errorf("failed to put object s3://%s/%s: %w", bucket, key, err)
 	}
@@ -135,16 +167,26 @@ func (c *Client) PutObject(bucket, key string, data []byte, contentType string)
 
 // PutObjectFromPath uploads data using S3 path string
 func (c *Client) PutObjectFromPath(s3Path string, data []byte, contentType string) error {
+	return c.PutObjectFromPathWithContext(context.Background(), s3Path, data, contentType)
+}
+
+// PutObjectFromPathWithContext is like PutObjectFromPath but uses ctx for the S3 requests
+func (c *Client) PutObjectFromPathWithContext(ctx context.Context, s3Path string, data []byte, contentType string) error {
 	path, err := ParseS3Path(s3Path)
 	if err != nil {
 		return err
 	}
 
-	return c.PutObject(path.Bucket, path.Key, data, contentType)
+	return c.PutObjectWithContext(ctx, path.Bucket, path.Key, data, contentType)
 }
 
 // DownloadFile downloads an S3 object directly to a file
 func (c *Client) DownloadFile(bucket, key, filename string) error {
+	return c.DownloadFileWithContext(context.Background(), bucket, key, filename)
+}
+
+// DownloadFileWithContext is like DownloadFile but uses ctx for the S3 requests
+func (c *Client) DownloadFileWithContext(ctx context.Context, bucket, key, filename string) error {
 	// Create the directories in the path if they don't exist
 	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
 		return fmt.Errorf("failed to create directories: %w", err)
@@ -158,7 +200,7 @@ func (c *Client) DownloadFile(bucket, key, filename string) error {
 	defer file.Close()
 
 	// Download the file
-	_, err = c.downloader.Download(file, &s3.GetObjectInput{
+	_, err = c.downloader.DownloadWithContext(ctx, file, &s3.GetObjectInput{
 		Bucket: aws.String(bucket),
 		Key:    aws.String(key),
 	})
@@ -171,17 +213,27 @@ func (c *Client) DownloadFile(bucket, key, filename string) error {
 
 // DownloadFileFromPath downloads using S3 path string
 func (c *Client) DownloadFileFromPath(s3Path, filename string) error {
+	return c.DownloadFileFromPathWithContext(context.Background(), s3Path, filename)
+}
+
+// DownloadFileFromPathWithContext is like DownloadFileFromPath but uses ctx for the S3 requests
+func (c *Client) DownloadFileFromPathWithContext(ctx context.Context, s3Path, filename string) error {
 	path, err := ParseS3Path(s3Path)
 	if err != nil {
 		return err
 	}
 
-	return c.DownloadFile(path.Bucket, path.Key, filename)
+	return c.DownloadFileWithContext(ctx, path.Bucket, path.Key, filename)
 }
 
 // ObjectExists checks if an object exists in S3
 func (c *Client) ObjectExists(bucket, key string) (bool, error) {
-	_, err := c.s3Client.HeadObject(&s3.HeadObjectInput{
+	return c.ObjectExistsWithContext(context.Background(), bucket, key)
+}
+
+// ObjectExistsWithContext is like ObjectExists but uses ctx for the S3 requests
+func (c *Client) ObjectExistsWithContext(ctx context.Context, bucket, key string) (bool, error) {
+	_, err := c.s3Client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
 		Bucket: aws.String(bucket),
 		Key:    aws.String(key),
 	})
@@ -197,17 +249,27 @@ func (c *Client) ObjectExists(bucket, key string) (bool, error) {
 
 // ObjectExistsFromPath checks if an object exists using S3 path string
 func (c *Client) ObjectExistsFromPath(s3Path string) (bool, error) {
+	return c.ObjectExistsFromPathWithContext(context.Background(), s3Path)
+}
+
+// ObjectExistsFromPathWithContext is like ObjectExistsFromPath but uses ctx for the S3 requests
+func (c *Client) ObjectExistsFromPathWithContext(ctx context.Context, s3Path string) (bool, error) {
 	path, err := ParseS3Path(s3Path)
 	if err != nil {
 		return false, err
 	}
 
-	return c.ObjectExists(path.Bucket, path.Key)
+	return c.ObjectExistsWithContext(ctx, path.Bucket, path.Key)
 }
 
 // DeleteObject deletes an object from S3
 func (c *Client) DeleteObject(bucket, key string) error {
-	_, err := c.s3Client.DeleteObject(&s3.DeleteObjectInput{
+	return c.DeleteObjectWithContext(context.Background(), bucket, key)
+}
+
+// DeleteObjectWithContext is like DeleteObject but uses ctx for the S3 requests
+func (c *Client) DeleteObjectWithContext(ctx context.Context, bucket, key string) error {
+	_, err := c.s3Client.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
 		Bucket: aws.String(bucket),
 		Key:    aws.String(key),
 	})
@@ -220,16 +282,27 @@ func (c *Client) DeleteObject(bucket, key string) error {
 
 // DeleteObjectFromPath deletes an object using S3 path string
 func (c *Client) DeleteObjectFromPath(s3Path string) error {
+	return c.DeleteObjectFromPathWithContext(context.Background(), s3Path)
+}
+
+// DeleteObjectFromPathWithContext is like DeleteObjectFromPath but uses ctx for the S3 requests
+func (c *Client) DeleteObjectFromPathWithContext(ctx context.Context, s3Path string) error {
 	path, err := ParseS3Path(s3Path)
 	if err != nil {
 		return err
 	}
 
-	return c.DeleteObject(path.Bucket, path.Key)
+	return c.DeleteObjectWithContext(ctx, path.Bucket, path.Key)
 }
 
-// ListObjects lists objects in a bucket with optional prefix
+// ListObjects lists objects in a bucket with optional prefix, following
+// continuation tokens until maxKeys objects are returned (all if maxKeys <= 0)
 func (c *Client) ListObjects(bucket, prefix string, maxKeys int64) ([]*s3.Object, error) {
+	return c.ListObjectsWithContext(context.Background(), bucket, prefix, maxKeys)
+}
+
+// ListObjectsWithContext is like ListObjects but uses ctx for the S3 requests
+func (c *Client) ListObjectsWithContext(ctx context.Context, bucket, prefix string, maxKeys int64) ([]*s3.Object, error) {
 	input := &s3.ListObjectsV2Input{
 		Bucket: aws.String(bucket),
 	}
@@ -238,16 +311,25 @@ func (c *Client) ListObjects(bucket, prefix string, maxKeys int64) ([]*s3.Object
 		input.Prefix = aws.String(prefix)
 	}
 
-	if maxKeys > 0 {
+	if maxKeys > 0 && maxKeys < 1000 {
 		input.MaxKeys = aws.Int64(maxKeys)
 	}
 
-	result, err := c.s3Client.ListObjectsV2(input)
+	var objects []*s3.Object
+	err := c.s3Client.ListObjectsV2PagesWithContext(ctx, input, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, object := range page.Contents {
+			if maxKeys > 0 && int64(len(objects)) >= maxKeys {
+				return false
+			}
+			objects = append(objects, object)
+		}
+		return maxKeys <= 0 || int64(len(objects)) < maxKeys
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to list objects in s3://%s: %w", bucket, err)
 	}
 
-	return result.Contents, nil
+	return objects, nil
 }
 
 // GetPresignedURL generates a presigned URL for an S3 object
@@ -275,20 +357,22 @@ func (c *Client) GetPresignedURLFromPath(s3Path string, expiration time.Duration
 	return c.GetPresignedURL(path.Bucket, path.Key, expiration)
 }
 
-// CopyObject copies an object within S3
+// CopyObject copies an object within S3. Objects over 5GB must be copied with MultipartCopy.
 func (c *Client) CopyObject(sourceBucket, sourceKey, destBucket, destKey string) error {
-	copySource := fmt.Sprintf("%s/%s", sourceBucket, sourceKey)
+	return c.CopyObjectWithContext(context.Background(), sourceBucket, sourceKey, destBucket, destKey)
+}
 
-	_, err := c.s3Client.CopyObject(&s3.CopyObjectInput{
-		Bucket:     aws.String(destBucket),
-		Key:        aws.String(destKey),
-		CopySource: aws.String(copySource),
+// CopyObjectWithContext is like CopyObject but uses ctx for the S3 requests
+func (c *Client) CopyObjectWithContext(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey string) error {
+	_, err := c.s3Client.CopyObjectWithContext(ctx, &s3.CopyObjectInput{
+		Bucket:     aws.String(dstBucket),
+		Key:        aws.String(dstKey),
+		CopySource: aws.String(copySource(srcBucket, srcKey)),
 	})
 	if err != nil {
 		return fmt.Errorf("failed to copy s3://%s/%s to s3://%s/%s: %w",
-			sourceBucket, sourceKey, destBucket, destKey, err)
+			srcBucket, srcKey, dstBucket, dstKey, err)
 	}
-
 	return nil
 }
 
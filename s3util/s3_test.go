@@ -2,11 +2,16 @@ package s3util
 
 import (
 	"bytes"
+	"io"
+	"net/http"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/jelech/goutils/s3util/s3test"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -339,23 +344,48 @@ func BenchmarkS3PathString(b *testing.B) {
 	}
 }
 
-// Integration test helpers (require actual S3 or LocalStack)
-func TestIntegrationHelpers(t *testing.T) {
-	// Skip if no integration test environment
+// testConfig returns a Config pointed at server
+func testConfig(server *s3test.Server) *Config {
+	return &Config{
+		Region:           "us-east-1",
+		AccessKeyID:      "test",
+		SecretAccessKey:  "test",
+		Endpoint:         server.URL,
+		DisableSSL:       true,
+		S3ForcePathStyle: true,
+	}
+}
+
+// newFakeS3 starts an s3test server and returns it with a client pointed at it
+func newFakeS3(t *testing.T) (*s3test.Server, *Client) {
+	server := s3test.NewServer()
+	t.Cleanup(server.Close)
+
+	client, err := NewClient(testConfig(server))
+	require.NoError(t, err)
+	return server, client
+}
+
+// integrationClient returns a client for S3_ENDPOINT (e.g. LocalStack) when
+// S3_INTEGRATION_TEST is set, and for an in-process s3test server otherwise
+func integrationClient(t *testing.T) *Client {
 	if os.Getenv("S3_INTEGRATION_TEST") == "" {
-		t.Skip("Set S3_INTEGRATION_TEST=1 to run integration tests")
+		_, client := newFakeS3(t)
+		return client
 	}
 
-	// Example integration test setup
-	config := &Config{
+	client, err := NewClient(&Config{
 		Region:           "us-east-1",
 		Endpoint:         os.Getenv("S3_ENDPOINT"), // e.g., http://localhost:4566
 		DisableSSL:       true,
 		S3ForcePathStyle: true,
-	}
-
-	client, err := NewClient(config)
+	})
 	require.NoError(t, err)
+	return client
+}
+
+func TestIntegrationHelpers(t *testing.T) {
+	client := integrationClient(t)
 
 	// Test bucket and key for integration tests
 	testBucket := "test-bucket-" + time.Now().Format("20060102-150405")
@@ -375,8 +405,97 @@ func TestIntegrationHelpers(t *testing.T) {
 		require.NoError(t, err)
 		assert.Equal(t, testData, retrievedData)
 
+		exists, err := client.ObjectExists(testBucket, testKey)
+		require.NoError(t, err)
+		assert.True(t, exists)
+
 		// Clean up
 		err = client.DeleteObject(testBucket, testKey)
 		assert.NoError(t, err)
+
+		exists, err = client.ObjectExists(testBucket, testKey)
+		require.NoError(t, err)
+		assert.False(t, exists)
 	})
 }
+
+func TestClient_ObjectOperations(t *testing.T) {
+	f, client := newFakeS3(t)
+
+	require.NoError(t, client.PutObjectFromPath("s3://bucket/docs/a.txt", []byte("alpha"), "text/plain"))
+	require.NoError(t, client.PutObject("bucket", "docs/b.txt", []byte("bravo"), ""))
+	assert.Equal(t, []string{"docs/a.txt", "docs/b.txt"}, f.Keys("bucket"))
+
+	data, err := client.GetObjectFromPath("s3://bucket/docs/a.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "alpha", string(data))
+
+	_, err = client.GetObject("bucket", "missing")
+	assert.Error(t, err)
+
+	exists, err := client.ObjectExistsFromPath("s3://bucket/docs/b.txt")
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	objects, err := client.ListObjects("bucket", "docs/", 0)
+	require.NoError(t, err)
+	require.Len(t, objects, 2)
+	assert.Equal(t, "docs/a.txt", aws.StringValue(objects[0].Key))
+	assert.Equal(t, int64(5), aws.Int64Value(objects[0].Size))
+
+	require.NoError(t, client.CopyObject("bucket", "docs/a.txt", "backup", "docs/a copy.txt"))
+	copied, ok := f.Object("backup", "docs/a copy.txt")
+	require.True(t, ok)
+	assert.Equal(t, "alpha", string(copied.Data))
+
+	filename := filepath.Join(t.TempDir(), "nested", "b.txt")
+	require.NoError(t, client.DownloadFileFromPath("s3://bucket/docs/b.txt", filename))
+	contents, err := os.ReadFile(filename)
+	require.NoError(t, err)
+	assert.Equal(t, "bravo", string(contents))
+
+	presigned, err := client.GetPresignedURLFromPath("s3://bucket/docs/a.txt", time.Minute)
+	require.NoError(t, err)
+	resp, err := http.Get(presigned)
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "alpha", string(body))
+
+	require.NoError(t, client.DeleteObjectFromPath("s3://bucket/docs/a.txt"))
+	assert.Equal(t, []string{"docs/b.txt"}, f.Keys("bucket"))
+}
+
+func TestClient_UploadDownload(t *testing.T) {
+	f, client := newFakeS3(t)
+	large := bytes.Repeat([]byte("0123456789abcdef"), 700*1024) // 11.2MB, three 5MB parts
+
+	_, err := client.UploadString("bucket", "small.txt", "hello", &UploadOptions{ContentType: "text/plain"})
+	require.NoError(t, err)
+	_, err = client.UploadBytes("bucket", "large.bin", large, nil)
+	require.NoError(t, err)
+
+	obj, ok := f.Object("bucket", "large.bin")
+	require.True(t, ok)
+	assert.Len(t, obj.PartSizes, 3)
+
+	text, err := client.DownloadString("bucket", "small.txt", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", text)
+
+	data, err := client.DownloadBytes("bucket", "large.bin", nil)
+	require.NoError(t, err)
+	assert.Equal(t, large, data)
+
+	buf := &aws.WriteAtBuffer{}
+	n, err := client.PartialDownload("bucket", "large.bin", 16, 31, buf)
+	require.NoError(t, err)
+	assert.Equal(t, int64(16), n)
+	assert.Equal(t, "0123456789abcdef", string(buf.Bytes()))
+
+	buf = &aws.WriteAtBuffer{}
+	n, err = client.ConcurrentDownload("bucket", "large.bin", buf, 5*1024*1024, 3)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(large)), n)
+	assert.Equal(t, large, buf.Bytes())
+}
@@ -0,0 +1,196 @@
+package s3test
+
+import (
+	"encoding/xml"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type listResult struct {
+	XMLName               xml.Name     `xml:"ListBucketResult"`
+	Name                  string       `xml:"Name"`
+	Prefix                string       `xml:"Prefix"`
+	KeyCount              int          `xml:"KeyCount"`
+	IsTruncated           bool         `xml:"IsTruncated"`
+	NextContinuationToken string       `xml:"NextContinuationToken,omitempty"`
+	Contents              []listObject `xml:"Contents"`
+	CommonPrefixes        []listPrefix `xml:"CommonPrefixes"`
+}
+
+type listObject struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int    `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+type listPrefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+// listV2 implements ListObjectsV2. The continuation token is the last entry returned.
+func (s *Server) listV2(w http.ResponseWriter, bucket string, query map[string][]string) {
+	get := func(name string) string {
+		if values := query[name]; len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+	prefix, delimiter := get("prefix"), get("delimiter")
+	after := get("start-after")
+	if token := get("continuation-token"); token != "" {
+		after = token
+	}
+	maxKeys := 1000
+	if value := get("max-keys"); value != "" {
+		maxKeys, _ = strconv.Atoi(value)
+	}
+
+	result := listResult{Name: bucket, Prefix: prefix}
+	lastPrefix := ""
+	for _, key := range s.liveKeys(bucket) {
+		if !strings.HasPrefix(key, prefix) || key <= after {
+			continue
+		}
+		if delimiter != "" && strings.HasSuffix(after, delimiter) && strings.HasPrefix(key, after) {
+			continue
+		}
+
+		entry := key
+		commonPrefix := ""
+		if delimiter != "" {
+			if i := strings.Index(key[len(prefix):], delimiter); i >= 0 {
+				commonPrefix = key[:len(prefix)+i+len(delimiter)]
+				if commonPrefix == lastPrefix {
+					continue
+				}
+				entry = commonPrefix
+			}
+		}
+
+		if result.KeyCount == maxKeys {
+			result.IsTruncated = true
+			break
+		}
+		result.KeyCount++
+		result.NextContinuationToken = entry
+
+		if commonPrefix != "" {
+			lastPrefix = commonPrefix
+			result.CommonPrefixes = append(result.CommonPrefixes, listPrefix{Prefix: commonPrefix})
+			continue
+		}
+		obj, _ := s.latest(bucket, key)
+		result.Contents = append(result.Contents, listObject{
+			Key:          key,
+			LastModified: obj.modified.Format("2006-01-02T15:04:05.000Z"),
+			ETag:         `"` + obj.etag + `"`,
+			Size:         len(obj.data),
+			StorageClass: "STANDARD",
+		})
+	}
+	if !result.IsTruncated {
+		result.NextContinuationToken = ""
+	}
+
+	writeXML(w, result)
+}
+
+type versionsResult struct {
+	XMLName             xml.Name            `xml:"ListVersionsResult"`
+	Name                string              `xml:"Name"`
+	IsTruncated         bool                `xml:"IsTruncated"`
+	NextKeyMarker       string              `xml:"NextKeyMarker,omitempty"`
+	NextVersionIDMarker string              `xml:"NextVersionIdMarker,omitempty"`
+	Versions            []versionEntry      `xml:"Version"`
+	DeleteMarkers       []deleteMarkerEntry `xml:"DeleteMarker"`
+}
+
+type versionEntry struct {
+	Key          string `xml:"Key"`
+	VersionID    string `xml:"VersionId"`
+	IsLatest     bool   `xml:"IsLatest"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int    `xml:"Size"`
+}
+
+type deleteMarkerEntry struct {
+	Key          string `xml:"Key"`
+	VersionID    string `xml:"VersionId"`
+	IsLatest     bool   `xml:"IsLatest"`
+	LastModified string `xml:"LastModified"`
+}
+
+// listVersions implements ListObjectVersions with key and version markers
+func (s *Server) listVersions(w http.ResponseWriter, bucket string, query map[string][]string) {
+	get := func(name string) string {
+		if values := query[name]; len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+	prefix, keyMarker, versionMarker := get("prefix"), get("key-marker"), get("version-id-marker")
+	maxKeys := 1000
+	if value := get("max-keys"); value != "" {
+		maxKeys, _ = strconv.Atoi(value)
+	}
+
+	var keys []string
+	for key := range s.bucket(bucket) {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	result := versionsResult{Name: bucket}
+	count := 0
+	skipping := versionMarker != ""
+	for _, key := range keys {
+		if key < keyMarker || (key == keyMarker && !skipping) {
+			continue
+		}
+		versions := s.bucket(bucket)[key]
+		for i := len(versions) - 1; i >= 0; i-- {
+			v := versions[i]
+			if skipping {
+				if key == keyMarker && v.versionID == versionMarker {
+					skipping = false
+				}
+				continue
+			}
+			if count == maxKeys {
+				result.IsTruncated = true
+				writeVersions(w, result)
+				return
+			}
+			count++
+			result.NextKeyMarker, result.NextVersionIDMarker = key, v.versionID
+
+			modified := v.modified.Format("2006-01-02T15:04:05.000Z")
+			if v.deleteMarker {
+				result.DeleteMarkers = append(result.DeleteMarkers, deleteMarkerEntry{
+					Key: key, VersionID: v.versionID, IsLatest: i == len(versions)-1, LastModified: modified,
+				})
+				continue
+			}
+			result.Versions = append(result.Versions, versionEntry{
+				Key: key, VersionID: v.versionID, IsLatest: i == len(versions)-1,
+				LastModified: modified, ETag: `"` + v.etag + `"`, Size: len(v.data),
+			})
+		}
+	}
+
+	writeVersions(w, result)
+}
+
+func writeVersions(w http.ResponseWriter, result versionsResult) {
+	if !result.IsTruncated {
+		result.NextKeyMarker, result.NextVersionIDMarker = "", ""
+	}
+	writeXML(w, result)
+}
@@ -0,0 +1,160 @@
+package s3test
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// objectHeaders are the request headers stored with an object and returned
+// by GET and HEAD, besides x-amz-meta-*
+var objectHeaders = []string{
+	"Content-Type",
+	"Content-Encoding",
+	"Content-Language",
+	"Content-Disposition",
+	"Cache-Control",
+	"Expires",
+	"X-Amz-Storage-Class",
+	"X-Amz-Server-Side-Encryption",
+	"X-Amz-Website-Redirect-Location",
+}
+
+// objectHeader extracts the headers stored with an object from a request
+func objectHeader(h http.Header) http.Header {
+	stored := make(http.Header)
+	for _, name := range objectHeaders {
+		if value := h.Get(name); value != "" {
+			stored.Set(name, value)
+		}
+	}
+	for name, values := range h {
+		if strings.HasPrefix(strings.ToLower(name), "x-amz-meta-") {
+			stored[http.CanonicalHeaderKey(name)] = append([]string(nil), values...)
+		}
+	}
+	return stored
+}
+
+// parseTagging parses an x-amz-tagging header ("k1=v1&k2=v2")
+func parseTagging(value string) (map[string]string, bool) {
+	if value == "" {
+		return nil, true
+	}
+	query, err := url.ParseQuery(value)
+	if err != nil {
+		return nil, false
+	}
+	tags := make(map[string]string, len(query))
+	for key, values := range query {
+		tags[key] = values[0]
+	}
+	return tags, true
+}
+
+func copyTags(tags map[string]string) map[string]string {
+	if tags == nil {
+		return nil
+	}
+	copied := make(map[string]string, len(tags))
+	for key, value := range tags {
+		copied[key] = value
+	}
+	return copied
+}
+
+type tagging struct {
+	XMLName xml.Name `xml:"Tagging"`
+	TagSet  []struct {
+		Key   string `xml:"Key"`
+		Value string `xml:"Value"`
+	} `xml:"TagSet>Tag"`
+}
+
+// objectTagging implements GetObjectTagging, PutObjectTagging and
+// DeleteObjectTagging on the latest version of an object
+func (s *Server) objectTagging(w http.ResponseWriter, r *http.Request, bucket, key string, body []byte) {
+	obj, ok := s.latest(bucket, key)
+	if !ok {
+		writeError(w, http.StatusNotFound, "NoSuchKey")
+		return
+	}
+	w.Header().Set("x-amz-version-id", obj.versionID)
+
+	switch r.Method {
+	case http.MethodGet:
+		var result tagging
+		keys := make([]string, 0, len(obj.tags))
+		for key := range obj.tags {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			result.TagSet = append(result.TagSet, struct {
+				Key   string `xml:"Key"`
+				Value string `xml:"Value"`
+			}{key, obj.tags[key]})
+		}
+		writeXML(w, result)
+	case http.MethodPut:
+		var req tagging
+		if err := xml.Unmarshal(body, &req); err != nil || len(req.TagSet) > 10 {
+			writeError(w, http.StatusBadRequest, "MalformedXML")
+			return
+		}
+		tags := make(map[string]string, len(req.TagSet))
+		for _, tag := range req.TagSet {
+			if _, dup := tags[tag.Key]; dup {
+				writeError(w, http.StatusBadRequest, "InvalidTag")
+				return
+			}
+			tags[tag.Key] = tag.Value
+		}
+		obj.tags = tags
+	case http.MethodDelete:
+		obj.tags = nil
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// bucketLifecycle implements Get, Put and DeleteBucketLifecycleConfiguration.
+// The configuration is stored as sent and never applied.
+func (s *Server) bucketLifecycle(w http.ResponseWriter, r *http.Request, bucket string, body []byte) {
+	switch r.Method {
+	case http.MethodGet:
+		config, ok := s.lifecycles[bucket]
+		if !ok {
+			writeError(w, http.StatusNotFound, "NoSuchLifecycleConfiguration")
+			return
+		}
+		w.Header().Set("Content-Type", "application/xml")
+		w.Write(config)
+	case http.MethodPut:
+		var config struct {
+			XMLName xml.Name `xml:"LifecycleConfiguration"`
+			Rules   []struct {
+				ID string `xml:"ID"`
+			} `xml:"Rule"`
+		}
+		if err := xml.Unmarshal(body, &config); err != nil || len(config.Rules) == 0 || len(config.Rules) > 1000 {
+			writeError(w, http.StatusBadRequest, "MalformedXML")
+			return
+		}
+		s.lifecycles[bucket] = append([]byte(nil), body...)
+	case http.MethodDelete:
+		delete(s.lifecycles, bucket)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// LifecycleConfiguration returns the raw lifecycle configuration XML of
+// bucket, or false if none is set
+func (s *Server) LifecycleConfiguration(bucket string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	config, ok := s.lifecycles[bucket]
+	return append([]byte(nil), config...), ok
+}
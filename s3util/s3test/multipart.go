@@ -0,0 +1,231 @@
+package s3test
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FailPart makes the next UploadPart call for part number fail
+func (s *Server) FailPart(number int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.partErrors[number] = true
+}
+
+// multipartUpload is an in-progress multipart upload
+type multipartUpload struct {
+	bucket, key string
+	parts       map[int][]byte
+	checksums   map[int][]byte // Raw part checksums for algorithm
+	algorithm   string         // "sha256", "crc32c" or empty
+	initiated   time.Time
+	header      http.Header // Stored with the completed object
+	tags        map[string]string
+}
+
+type initiateResult struct {
+	XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	UploadID string   `xml:"UploadId"`
+}
+
+type copyResult struct {
+	XMLName xml.Name
+	ETag    string `xml:"ETag"`
+}
+
+// uploadPart implements UploadPart and UploadPartCopy
+func (s *Server) uploadPart(w http.ResponseWriter, r *http.Request, query map[string][]string, body []byte) {
+	upload, ok := s.uploads[query["uploadId"][0]]
+	if !ok {
+		writeError(w, http.StatusNotFound, "NoSuchUpload")
+		return
+	}
+	number, _ := strconv.Atoi(query["partNumber"][0])
+	if s.partErrors[number] {
+		delete(s.partErrors, number)
+		writeError(w, http.StatusForbidden, "AccessDenied")
+		return
+	}
+
+	data := body
+	copied := r.Header.Get("x-amz-copy-source") != ""
+	if copied {
+		if _, data, ok = s.copySource(w, r); !ok {
+			return
+		}
+	}
+	if !copied {
+		checksums, ok := checkDigests(w, r, data)
+		if !ok {
+			return
+		}
+		if value, ok := checksums["x-amz-checksum-"+upload.algorithm]; ok {
+			upload.checksums[number], _ = base64.StdEncoding.DecodeString(value)
+		}
+	}
+	upload.parts[number] = append([]byte(nil), data...)
+
+	sum := md5.Sum(data)
+	etag := `"` + hex.EncodeToString(sum[:]) + `"`
+	if copied {
+		writeXML(w, copyResult{XMLName: xml.Name{Local: "CopyPartResult"}, ETag: etag})
+		return
+	}
+	w.Header().Set("ETag", etag)
+}
+
+type listPartsResult struct {
+	XMLName     xml.Name `xml:"ListPartsResult"`
+	Bucket      string   `xml:"Bucket"`
+	Key         string   `xml:"Key"`
+	UploadID    string   `xml:"UploadId"`
+	IsTruncated bool     `xml:"IsTruncated"`
+	Parts       []struct {
+		PartNumber int    `xml:"PartNumber"`
+		ETag       string `xml:"ETag"`
+		Size       int    `xml:"Size"`
+	} `xml:"Part"`
+}
+
+// listParts implements ListParts, returning every part in one page
+func (s *Server) listParts(w http.ResponseWriter, id string) {
+	upload, ok := s.uploads[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "NoSuchUpload")
+		return
+	}
+
+	result := listPartsResult{Bucket: upload.bucket, Key: upload.key, UploadID: id}
+	numbers := make([]int, 0, len(upload.parts))
+	for number := range upload.parts {
+		numbers = append(numbers, number)
+	}
+	sort.Ints(numbers)
+	for _, number := range numbers {
+		sum := md5.Sum(upload.parts[number])
+		result.Parts = append(result.Parts, struct {
+			PartNumber int    `xml:"PartNumber"`
+			ETag       string `xml:"ETag"`
+			Size       int    `xml:"Size"`
+		}{number, `"` + hex.EncodeToString(sum[:]) + `"`, len(upload.parts[number])})
+	}
+	writeXML(w, result)
+}
+
+type listUploadsResult struct {
+	XMLName     xml.Name `xml:"ListMultipartUploadsResult"`
+	Bucket      string   `xml:"Bucket"`
+	Prefix      string   `xml:"Prefix"`
+	IsTruncated bool     `xml:"IsTruncated"`
+	Uploads     []struct {
+		Key       string `xml:"Key"`
+		UploadID  string `xml:"UploadId"`
+		Initiated string `xml:"Initiated"`
+	} `xml:"Upload"`
+}
+
+// listUploads implements ListMultipartUploads, returning every upload in one page
+func (s *Server) listUploads(w http.ResponseWriter, bucket string, query map[string][]string) {
+	prefix := ""
+	if values := query["prefix"]; len(values) > 0 {
+		prefix = values[0]
+	}
+
+	result := listUploadsResult{Bucket: bucket, Prefix: prefix}
+	ids := make([]string, 0, len(s.uploads))
+	for id, upload := range s.uploads {
+		if upload.bucket == bucket && strings.HasPrefix(upload.key, prefix) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		a, b := s.uploads[ids[i]], s.uploads[ids[j]]
+		if a.key != b.key {
+			return a.key < b.key
+		}
+		return a.initiated.Before(b.initiated)
+	})
+	for _, id := range ids {
+		upload := s.uploads[id]
+		result.Uploads = append(result.Uploads, struct {
+			Key       string `xml:"Key"`
+			UploadID  string `xml:"UploadId"`
+			Initiated string `xml:"Initiated"`
+		}{upload.key, id, upload.initiated.Format(time.RFC3339Nano)})
+	}
+	writeXML(w, result)
+}
+
+type completeRequest struct {
+	Parts []struct {
+		PartNumber int    `xml:"PartNumber"`
+		ETag       string `xml:"ETag"`
+	} `xml:"Part"`
+}
+
+type completeResult struct {
+	XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+	Bucket  string   `xml:"Bucket"`
+	Key     string   `xml:"Key"`
+	ETag    string   `xml:"ETag"`
+}
+
+// completeUpload assembles the parts and stores the object with a composite ETag
+func (s *Server) completeUpload(w http.ResponseWriter, id string, body []byte) {
+	upload, ok := s.uploads[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "NoSuchUpload")
+		return
+	}
+	var req completeRequest
+	if err := xml.Unmarshal(body, &req); err != nil || len(req.Parts) == 0 {
+		writeError(w, http.StatusBadRequest, "MalformedXML")
+		return
+	}
+
+	var data, digests, checksums []byte
+	var sizes []int
+	for i, part := range req.Parts {
+		partData, ok := upload.parts[part.PartNumber]
+		if !ok || (i > 0 && part.PartNumber <= req.Parts[i-1].PartNumber) {
+			writeError(w, http.StatusBadRequest, "InvalidPart")
+			return
+		}
+		sum := md5.Sum(partData)
+		if strings.Trim(part.ETag, `"`) != hex.EncodeToString(sum[:]) {
+			writeError(w, http.StatusBadRequest, "InvalidPart")
+			return
+		}
+		data = append(data, partData...)
+		digests = append(digests, sum[:]...)
+		checksums = append(checksums, upload.checksums[part.PartNumber]...)
+		sizes = append(sizes, len(partData))
+	}
+	delete(s.uploads, id)
+
+	obj := s.putLocked(upload.bucket, upload.key, data)
+	composite := md5.Sum(digests)
+	obj.etag = fmt.Sprintf("%s-%d", hex.EncodeToString(composite[:]), len(req.Parts))
+	obj.partSizes = sizes
+	obj.header = upload.header
+	obj.tags = upload.tags
+	if newHash, ok := checksumHeaders["x-amz-checksum-"+upload.algorithm]; ok {
+		h := newHash()
+		h.Write(checksums)
+		obj.checksums = map[string]string{
+			"x-amz-checksum-" + upload.algorithm: fmt.Sprintf("%s-%d", base64.StdEncoding.EncodeToString(h.Sum(nil)), len(req.Parts)),
+		}
+	}
+	writeXML(w, completeResult{Bucket: upload.bucket, Key: upload.key, ETag: `"` + obj.etag + `"`})
+}
@@ -0,0 +1,673 @@
+// Package s3test provides an in-process fake S3 server for tests. It
+// implements the subset of the S3 REST API used by s3util: object GET, PUT,
+// HEAD and DELETE with Range and If-Match, ListObjectsV2, ListObjectVersions,
+// DeleteObjects, CopyObject (with metadata and tagging directives), multipart
+// uploads (including UploadPartCopy and ListParts), Content-MD5 and
+// SHA256/CRC32C checksums, object tagging, bucket lifecycle configuration and
+// browser POST uploads. Object metadata and tags are stored and returned.
+// Buckets are created on first use, every bucket is versioned and
+// requests are not authenticated.
+//
+// Point a client at the server with path-style addressing:
+//
+//	server := s3test.NewServer()
+//	defer server.Close()
+//	client, err := s3util.NewClient(&s3util.Config{
+//		Region:           "us-east-1",
+//		AccessKeyID:      "test",
+//		SecretAccessKey:  "test",
+//		Endpoint:         server.URL,
+//		DisableSSL:       true,
+//		S3ForcePathStyle: true,
+//	})
+package s3test
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Server is an in-memory S3 server using path-style addressing. It is safe
+// for concurrent use.
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	buckets  map[string]map[string][]*storedObject // bucket -> key -> versions, newest last
+	versions int
+	requests []string // "METHOD /path?query"
+
+	uploads      map[string]*multipartUpload
+	uploadID     int
+	deleteErrors map[string]bool
+	getErrors    map[string]bool
+	partErrors   map[int]bool
+	lifecycles   map[string][]byte // bucket -> LifecycleConfiguration XML
+}
+
+// Object is a snapshot of a stored object version
+type Object struct {
+	Data         []byte
+	ETag         string // Without quotes; multipart objects have a composite "md5-N" ETag
+	VersionID    string
+	LastModified time.Time
+	Checksums    map[string]string // x-amz-checksum-* header -> value
+	PartSizes    []int             // Part sizes of multipart objects, nil otherwise
+	ContentType  string
+	Metadata     map[string]string // User metadata with lower-case keys, without the x-amz-meta- prefix
+	StorageClass string            // Empty for STANDARD
+	Tags         map[string]string
+}
+
+// storedObject is a stored object version or delete marker
+type storedObject struct {
+	data         []byte
+	etag         string
+	modified     time.Time
+	versionID    string
+	deleteMarker bool
+	checksums    map[string]string
+	partSizes    []int
+	header       http.Header // Content-Type, x-amz-meta-* and other stored headers
+	tags         map[string]string
+}
+
+// NewServer starts a new fake S3 server. Call Close when done.
+func NewServer() *Server {
+	s := &Server{
+		buckets:      make(map[string]map[string][]*storedObject),
+		uploads:      make(map[string]*multipartUpload),
+		deleteErrors: make(map[string]bool),
+		getErrors:    make(map[string]bool),
+		partErrors:   make(map[int]bool),
+		lifecycles:   make(map[string][]byte),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// PutObject stores a new version of an object directly, bypassing HTTP
+func (s *Server) PutObject(bucket, key string, data []byte) Object {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.putLocked(bucket, key, data).snapshot()
+}
+
+// Object returns the latest version of an object, or false if it does not
+// exist or its latest version is a delete marker
+func (s *Server) Object(bucket, key string) (Object, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	obj, ok := s.latest(bucket, key)
+	if !ok {
+		return Object{}, false
+	}
+	return obj.snapshot(), true
+}
+
+// Keys returns the keys of all live objects in bucket, sorted
+func (s *Server) Keys(bucket string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.liveKeys(bucket)
+}
+
+// Requests returns the requests received so far as "METHOD /path?query"
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.requests...)
+}
+
+// snapshot copies the object for callers outside the lock
+func (o *storedObject) snapshot() Object {
+	obj := Object{
+		Data:         append([]byte(nil), o.data...),
+		ETag:         o.etag,
+		VersionID:    o.versionID,
+		LastModified: o.modified,
+		ContentType:  o.header.Get("Content-Type"),
+		StorageClass: o.header.Get("X-Amz-Storage-Class"),
+		Tags:         copyTags(o.tags),
+	}
+	for name := range o.header {
+		if meta, ok := strings.CutPrefix(strings.ToLower(name), "x-amz-meta-"); ok {
+			if obj.Metadata == nil {
+				obj.Metadata = make(map[string]string)
+			}
+			obj.Metadata[meta] = o.header.Get(name)
+		}
+	}
+	if o.partSizes != nil {
+		obj.PartSizes = append([]int(nil), o.partSizes...)
+	}
+	if o.checksums != nil {
+		obj.Checksums = make(map[string]string, len(o.checksums))
+		for header, value := range o.checksums {
+			obj.Checksums[header] = value
+		}
+	}
+	return obj
+}
+
+func (s *Server) putLocked(bucket, key string, data []byte) *storedObject {
+	sum := md5.Sum(data)
+	s.versions++
+	obj := &storedObject{
+		data:      append([]byte(nil), data...),
+		etag:      hex.EncodeToString(sum[:]),
+		modified:  time.Now().UTC(),
+		versionID: fmt.Sprintf("v%d", s.versions),
+	}
+	s.bucket(bucket)[key] = append(s.bucket(bucket)[key], obj)
+	return obj
+}
+
+func (s *Server) bucket(name string) map[string][]*storedObject {
+	if s.buckets[name] == nil {
+		s.buckets[name] = make(map[string][]*storedObject)
+	}
+	return s.buckets[name]
+}
+
+func (s *Server) latest(bucket, key string) (*storedObject, bool) {
+	versions := s.bucket(bucket)[key]
+	if len(versions) == 0 || versions[len(versions)-1].deleteMarker {
+		return nil, false
+	}
+	return versions[len(versions)-1], true
+}
+
+func (s *Server) liveKeys(bucket string) []string {
+	var keys []string
+	for key := range s.bucket(bucket) {
+		if _, ok := s.latest(bucket, key); ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	query := r.URL.Query()
+	body, _ := io.ReadAll(r.Body)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, r.Method+" "+r.URL.RequestURI())
+
+	switch {
+	case key == "" && query.Has("lifecycle"):
+		s.bucketLifecycle(w, r, bucket, body)
+	case key == "" && r.Method == http.MethodGet && query.Has("uploads"):
+		s.listUploads(w, bucket, query)
+	case key == "" && r.Method == http.MethodGet && query.Has("versions"):
+		s.listVersions(w, bucket, query)
+	case key == "" && r.Method == http.MethodGet:
+		s.listV2(w, bucket, query)
+	case key == "" && r.Method == http.MethodPost && query.Has("delete"):
+		s.deleteObjects(w, bucket, body)
+	case key == "" && r.Method == http.MethodPost:
+		s.postObject(w, r, bucket, body)
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		s.uploadID++
+		id := fmt.Sprintf("upload-%d", s.uploadID)
+		s.uploads[id] = &multipartUpload{
+			bucket:    bucket,
+			key:       key,
+			parts:     make(map[int][]byte),
+			checksums: make(map[int][]byte),
+			algorithm: strings.ToLower(r.Header.Get("x-amz-checksum-algorithm")),
+			initiated: time.Now().UTC(),
+			header:    objectHeader(r.Header),
+		}
+		tags, ok := parseTagging(r.Header.Get("x-amz-tagging"))
+		if !ok {
+			writeError(w, http.StatusBadRequest, "InvalidArgument")
+			return
+		}
+		s.uploads[id].tags = tags
+		writeXML(w, initiateResult{Bucket: bucket, Key: key, UploadID: id})
+	case r.Method == http.MethodGet && query.Has("uploadId"):
+		s.listParts(w, query.Get("uploadId"))
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		s.completeUpload(w, query.Get("uploadId"), body)
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		delete(s.uploads, query.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+		s.uploadPart(w, r, query, body)
+	case query.Has("tagging"):
+		s.objectTagging(w, r, bucket, key, body)
+	case r.Method == http.MethodPut && r.Header.Get("x-amz-copy-source") != "":
+		obj, ok := s.copyObject(w, r, bucket, key)
+		if !ok {
+			return
+		}
+		writeXML(w, copyResult{XMLName: xml.Name{Local: "CopyObjectResult"}, ETag: `"` + obj.etag + `"`})
+	case r.Method == http.MethodPut:
+		checksums, ok := checkDigests(w, r, body)
+		if !ok {
+			return
+		}
+		tags, ok := parseTagging(r.Header.Get("x-amz-tagging"))
+		if !ok {
+			writeError(w, http.StatusBadRequest, "InvalidArgument")
+			return
+		}
+		obj := s.putLocked(bucket, key, body)
+		obj.checksums = checksums
+		obj.header = objectHeader(r.Header)
+		obj.tags = tags
+		w.Header().Set("ETag", `"`+obj.etag+`"`)
+		w.Header().Set("x-amz-version-id", obj.versionID)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		obj, ok := s.latest(bucket, key)
+		if !ok {
+			writeError(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		if r.Method == http.MethodGet && s.getErrors[key] {
+			writeError(w, http.StatusForbidden, "AccessDenied")
+			return
+		}
+		if ifMatch := r.Header.Get("If-Match"); ifMatch != "" && strings.Trim(ifMatch, `"`) != obj.etag {
+			writeError(w, http.StatusPreconditionFailed, "PreconditionFailed")
+			return
+		}
+		data, status := obj.data, http.StatusOK
+		if number, err := strconv.Atoi(query.Get("partNumber")); err == nil && obj.partSizes != nil {
+			if number < 1 || number > len(obj.partSizes) {
+				writeError(w, http.StatusRequestedRangeNotSatisfiable, "InvalidPartNumber")
+				return
+			}
+			start := 0
+			for _, size := range obj.partSizes[:number-1] {
+				start += size
+			}
+			data = data[start : start+obj.partSizes[number-1]]
+			w.Header().Set("x-amz-mp-parts-count", strconv.Itoa(len(obj.partSizes)))
+		}
+		if r.Header.Get("x-amz-checksum-mode") == "ENABLED" {
+			for header, value := range obj.checksums {
+				w.Header().Set(header, value)
+			}
+		}
+		if byteRange := r.Header.Get("Range"); byteRange != "" && r.Method == http.MethodGet {
+			start, end, ok := parseRange(byteRange, len(data))
+			if !ok {
+				writeError(w, http.StatusRequestedRangeNotSatisfiable, "InvalidRange")
+				return
+			}
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(data)))
+			data, status = data[start:end+1], http.StatusPartialContent
+		}
+		for name, values := range obj.header {
+			w.Header()[name] = values
+		}
+		if obj.header.Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", "binary/octet-stream")
+		}
+		if len(obj.tags) > 0 {
+			w.Header().Set("x-amz-tagging-count", strconv.Itoa(len(obj.tags)))
+		}
+		w.Header().Set("ETag", `"`+obj.etag+`"`)
+		w.Header().Set("Last-Modified", obj.modified.Format(http.TimeFormat))
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.Header().Set("x-amz-version-id", obj.versionID)
+		w.WriteHeader(status)
+		if r.Method == http.MethodGet {
+			w.Write(data)
+		}
+	case r.Method == http.MethodDelete:
+		s.deleteLocked(bucket, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+// checksumHeaders maps the supported x-amz-checksum-* headers to their hashes
+var checksumHeaders = map[string]func() hash.Hash{
+	"x-amz-checksum-sha256": sha256.New,
+	"x-amz-checksum-crc32c": func() hash.Hash { return crc32.New(crc32.MakeTable(crc32.Castagnoli)) },
+}
+
+// checkDigests validates Content-MD5 and x-amz-checksum-* request headers
+// against body like S3 does, returning the checksums to store
+func checkDigests(w http.ResponseWriter, r *http.Request, body []byte) (map[string]string, bool) {
+	if contentMD5 := r.Header.Get("Content-MD5"); contentMD5 != "" {
+		sum := md5.Sum(body)
+		if contentMD5 != base64.StdEncoding.EncodeToString(sum[:]) {
+			writeError(w, http.StatusBadRequest, "BadDigest")
+			return nil, false
+		}
+	}
+
+	checksums := make(map[string]string)
+	for header, newHash := range checksumHeaders {
+		value := r.Header.Get(header)
+		if value == "" {
+			continue
+		}
+		h := newHash()
+		h.Write(body)
+		if value != base64.StdEncoding.EncodeToString(h.Sum(nil)) {
+			writeError(w, http.StatusBadRequest, "BadDigest")
+			return nil, false
+		}
+		checksums[header] = value
+		w.Header().Set(header, value)
+	}
+	return checksums, true
+}
+
+// Corrupt flips a byte of the latest version of an object without updating its ETag
+func (s *Server) Corrupt(bucket, key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	obj, ok := s.latest(bucket, key)
+	if ok && len(obj.data) > 0 {
+		data := append([]byte(nil), obj.data...)
+		data[len(data)/2] ^= 0xff
+		obj.data = data
+	}
+}
+
+// parseRange parses "bytes=start-end" or "bytes=start-" against size
+func parseRange(byteRange string, size int) (start, end int, ok bool) {
+	spec, found := strings.CutPrefix(byteRange, "bytes=")
+	if !found {
+		return 0, 0, false
+	}
+	from, to, _ := strings.Cut(spec, "-")
+	start, err := strconv.Atoi(from)
+	if err != nil || start >= size {
+		return 0, 0, false
+	}
+	end = size - 1
+	if to != "" {
+		if end, err = strconv.Atoi(to); err != nil || end < start {
+			return 0, 0, false
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+	return start, end, true
+}
+
+// postObject handles a browser form upload, enforcing the policy's
+// conditions. The signature is not checked.
+func (s *Server) postObject(w http.ResponseWriter, r *http.Request, bucket string, body []byte) {
+	_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "MalformedPOSTRequest")
+		return
+	}
+	fields := make(map[string]string)
+	var file []byte
+	filename := ""
+	mr := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "MalformedPOSTRequest")
+			return
+		}
+		data, _ := io.ReadAll(part)
+		if part.FormName() == "file" {
+			file, filename = data, part.FileName()
+			break // S3 ignores fields after the file
+		}
+		fields[strings.ToLower(part.FormName())] = string(data)
+	}
+	key := strings.ReplaceAll(fields["key"], "${filename}", filename)
+
+	encoded, _ := base64.StdEncoding.DecodeString(fields["policy"])
+	var policy struct {
+		Conditions []interface{} `json:"conditions"`
+	}
+	if err := json.Unmarshal(encoded, &policy); err != nil {
+		writeError(w, http.StatusForbidden, "InvalidPolicyDocument")
+		return
+	}
+	for _, condition := range policy.Conditions {
+		ok := true
+		switch c := condition.(type) {
+		case map[string]interface{}:
+			for name, value := range c {
+				actual := fields[strings.ToLower(name)]
+				if name == "bucket" {
+					actual = bucket
+				}
+				ok = ok && actual == value
+			}
+		case []interface{}:
+			switch c[0] {
+			case "starts-with":
+				name := strings.ToLower(strings.TrimPrefix(c[1].(string), "$"))
+				actual := fields[name]
+				if name == "key" {
+					actual = key
+				}
+				ok = strings.HasPrefix(actual, c[2].(string))
+			case "content-length-range":
+				ok = float64(len(file)) >= c[1].(float64) && float64(len(file)) <= c[2].(float64)
+			}
+		}
+		if !ok {
+			writeError(w, http.StatusForbidden, "AccessDenied")
+			return
+		}
+	}
+
+	obj := s.putLocked(bucket, key, file)
+	obj.header = make(http.Header)
+	for name, value := range fields {
+		if name == "content-type" || name == "cache-control" || strings.HasPrefix(name, "x-amz-meta-") {
+			obj.header.Set(name, value)
+		}
+	}
+	w.Header().Set("ETag", `"`+obj.etag+`"`)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deleteLocked adds a delete marker if the object exists
+func (s *Server) deleteLocked(bucket, key string) {
+	if _, ok := s.latest(bucket, key); !ok {
+		return
+	}
+	s.versions++
+	s.bucket(bucket)[key] = append(s.bucket(bucket)[key], &storedObject{
+		modified:     time.Now().UTC(),
+		versionID:    fmt.Sprintf("v%d", s.versions),
+		deleteMarker: true,
+	})
+}
+
+// FailDelete makes DeleteObjects report an error for key
+func (s *Server) FailDelete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.deleteErrors[key] = true
+}
+
+// FailGet makes GetObject on key fail with AccessDenied
+func (s *Server) FailGet(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.getErrors[key] = true
+}
+
+type deleteRequest struct {
+	Objects []struct {
+		Key string `xml:"Key"`
+	} `xml:"Object"`
+	Quiet bool `xml:"Quiet"`
+}
+
+type deleteResult struct {
+	XMLName xml.Name `xml:"DeleteResult"`
+	Deleted []struct {
+		Key string `xml:"Key"`
+	} `xml:"Deleted"`
+	Errors []deleteError `xml:"Error"`
+}
+
+type deleteError struct {
+	Key     string `xml:"Key"`
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// deleteObjects implements the batch DeleteObjects API
+func (s *Server) deleteObjects(w http.ResponseWriter, bucket string, body []byte) {
+	var req deleteRequest
+	if err := xml.Unmarshal(body, &req); err != nil || len(req.Objects) > 1000 {
+		writeError(w, http.StatusBadRequest, "MalformedXML")
+		return
+	}
+
+	var result deleteResult
+	for _, object := range req.Objects {
+		if s.deleteErrors[object.Key] {
+			result.Errors = append(result.Errors, deleteError{Key: object.Key, Code: "AccessDenied", Message: "Access Denied"})
+			continue
+		}
+		s.deleteLocked(bucket, object.Key)
+		if !req.Quiet {
+			result.Deleted = append(result.Deleted, struct {
+				Key string `xml:"Key"`
+			}{object.Key})
+		}
+	}
+	writeXML(w, result)
+}
+
+// copyObject implements CopyObject. Metadata and tags are copied from the
+// source unless x-amz-metadata-directive or x-amz-tagging-directive is
+// REPLACE, and like S3 an object can only be copied onto itself when
+// something changes.
+func (s *Server) copyObject(w http.ResponseWriter, r *http.Request, bucket, key string) (*storedObject, bool) {
+	src, data, ok := s.copySource(w, r)
+	if !ok {
+		return nil, false
+	}
+	replaceMetadata := r.Header.Get("x-amz-metadata-directive") == "REPLACE"
+	replaceTags := r.Header.Get("x-amz-tagging-directive") == "REPLACE"
+	if current, ok := s.latest(bucket, key); ok && current == src && !replaceMetadata &&
+		r.Header.Get("x-amz-storage-class") == "" && r.Header.Get("x-amz-server-side-encryption") == "" {
+		writeError(w, http.StatusBadRequest, "InvalidRequest")
+		return nil, false
+	}
+
+	header := src.header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	if replaceMetadata {
+		header = objectHeader(r.Header)
+	} else {
+		// The storage class and encryption are never copied implicitly
+		header.Del("X-Amz-Storage-Class")
+		header.Del("X-Amz-Server-Side-Encryption")
+		for _, name := range []string{"X-Amz-Storage-Class", "X-Amz-Server-Side-Encryption"} {
+			if value := r.Header.Get(name); value != "" {
+				header.Set(name, value)
+			}
+		}
+	}
+	tags := copyTags(src.tags)
+	if replaceTags {
+		if tags, ok = parseTagging(r.Header.Get("x-amz-tagging")); !ok {
+			writeError(w, http.StatusBadRequest, "InvalidArgument")
+			return nil, false
+		}
+	}
+
+	obj := s.putLocked(bucket, key, data)
+	obj.header = header
+	obj.tags = tags
+	return obj, true
+}
+
+// copySource reads the object named by x-amz-copy-source, applying
+// x-amz-copy-source-if-match and x-amz-copy-source-range
+func (s *Server) copySource(w http.ResponseWriter, r *http.Request) (*storedObject, []byte, bool) {
+	source, err := url.PathUnescape(r.Header.Get("x-amz-copy-source"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "InvalidArgument")
+		return nil, nil, false
+	}
+	srcBucket, srcKey, _ := strings.Cut(strings.TrimPrefix(source, "/"), "/")
+	obj, ok := s.latest(srcBucket, srcKey)
+	if !ok {
+		writeError(w, http.StatusNotFound, "NoSuchKey")
+		return nil, nil, false
+	}
+	if ifMatch := r.Header.Get("x-amz-copy-source-if-match"); ifMatch != "" && strings.Trim(ifMatch, `"`) != obj.etag {
+		writeError(w, http.StatusPreconditionFailed, "PreconditionFailed")
+		return nil, nil, false
+	}
+
+	data := obj.data
+	if byteRange := r.Header.Get("x-amz-copy-source-range"); byteRange != "" {
+		// Unlike GET, a copy range must name its last byte, within the object
+		start, end, ok := parseRange(byteRange, len(data))
+		if _, last, _ := strings.Cut(byteRange, "-"); !ok || last != strconv.Itoa(end) {
+			writeError(w, http.StatusRequestedRangeNotSatisfiable, "InvalidRange")
+			return nil, nil, false
+		}
+		data = data[start : end+1]
+	}
+	return obj, data, true
+}
+
+func writeXML(w http.ResponseWriter, v interface{}) {
+	data, err := xml.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.Write([]byte(xml.Header))
+	w.Write(data)
+}
+
+func writeError(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, code)
+}
@@ -0,0 +1,366 @@
+package s3test
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newClient starts a server and returns it with an SDK client pointed at it
+func newClient(t *testing.T) (*Server, *s3.S3) {
+	server := NewServer()
+	t.Cleanup(server.Close)
+
+	sess, err := session.NewSession(&aws.Config{
+		Region:           aws.String("us-east-1"),
+		Endpoint:         aws.String(server.URL),
+		S3ForcePathStyle: aws.Bool(true),
+		DisableSSL:       aws.Bool(true),
+		Credentials:      credentials.NewStaticCredentials("test", "test", ""),
+	})
+	require.NoError(t, err)
+	return server, s3.New(sess)
+}
+
+// errorCode returns the S3 error code of err
+func errorCode(err error) string {
+	if awsErr, ok := err.(awserr.Error); ok {
+		return awsErr.Code()
+	}
+	return ""
+}
+
+func TestServer_Objects(t *testing.T) {
+	server, client := newClient(t)
+
+	put, err := client.PutObject(&s3.PutObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("dir/file.txt"),
+		Body:   strings.NewReader("hello world"),
+	})
+	require.NoError(t, err)
+	sum := md5.Sum([]byte("hello world"))
+	assert.Equal(t, `"`+hex.EncodeToString(sum[:])+`"`, aws.StringValue(put.ETag))
+
+	get, err := client.GetObject(&s3.GetObjectInput{Bucket: aws.String("bucket"), Key: aws.String("dir/file.txt")})
+	require.NoError(t, err)
+	data, _ := io.ReadAll(get.Body)
+	get.Body.Close()
+	assert.Equal(t, "hello world", string(data))
+
+	ranged, err := client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("dir/file.txt"),
+		Range:  aws.String("bytes=6-"),
+	})
+	require.NoError(t, err)
+	data, _ = io.ReadAll(ranged.Body)
+	ranged.Body.Close()
+	assert.Equal(t, "world", string(data))
+	assert.Equal(t, "bytes 6-10/11", aws.StringValue(ranged.ContentRange))
+
+	head, err := client.HeadObject(&s3.HeadObjectInput{Bucket: aws.String("bucket"), Key: aws.String("dir/file.txt")})
+	require.NoError(t, err)
+	assert.Equal(t, int64(11), aws.Int64Value(head.ContentLength))
+
+	_, err = client.GetObject(&s3.GetObjectInput{
+		Bucket:  aws.String("bucket"),
+		Key:     aws.String("dir/file.txt"),
+		IfMatch: aws.String(`"other"`),
+	})
+	assert.Equal(t, "PreconditionFailed", errorCode(err))
+
+	_, err = client.CopyObject(&s3.CopyObjectInput{
+		Bucket:     aws.String("other"),
+		Key:        aws.String("copy.txt"),
+		CopySource: aws.String("bucket/dir/file.txt"),
+	})
+	require.NoError(t, err)
+	copied, ok := server.Object("other", "copy.txt")
+	require.True(t, ok)
+	assert.Equal(t, "hello world", string(copied.Data))
+
+	_, err = client.DeleteObject(&s3.DeleteObjectInput{Bucket: aws.String("bucket"), Key: aws.String("dir/file.txt")})
+	require.NoError(t, err)
+	_, err = client.GetObject(&s3.GetObjectInput{Bucket: aws.String("bucket"), Key: aws.String("dir/file.txt")})
+	assert.Equal(t, s3.ErrCodeNoSuchKey, errorCode(err))
+	assert.Empty(t, server.Keys("bucket"))
+
+	assert.Equal(t, []string{
+		"PUT /bucket/dir/file.txt",
+		"GET /bucket/dir/file.txt",
+		"GET /bucket/dir/file.txt",
+		"HEAD /bucket/dir/file.txt",
+		"GET /bucket/dir/file.txt",
+		"PUT /other/copy.txt",
+		"DELETE /bucket/dir/file.txt",
+		"GET /bucket/dir/file.txt",
+	}, server.Requests())
+}
+
+func TestServer_ListObjectsV2(t *testing.T) {
+	server, client := newClient(t)
+	for i := 0; i < 5; i++ {
+		server.PutObject("bucket", fmt.Sprintf("logs/%d.txt", i), []byte("x"))
+	}
+	server.PutObject("bucket", "logs/archive/old.txt", []byte("x"))
+	server.PutObject("bucket", "readme", []byte("x"))
+
+	var keys []string
+	pages := 0
+	err := client.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket:  aws.String("bucket"),
+		Prefix:  aws.String("logs/"),
+		MaxKeys: aws.Int64(2),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		pages++
+		for _, object := range page.Contents {
+			keys = append(keys, aws.StringValue(object.Key))
+		}
+		return true
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, pages)
+	assert.Equal(t, []string{"logs/0.txt", "logs/1.txt", "logs/2.txt", "logs/3.txt", "logs/4.txt", "logs/archive/old.txt"}, keys)
+
+	listed, err := client.ListObjectsV2(&s3.ListObjectsV2Input{
+		Bucket:    aws.String("bucket"),
+		Delimiter: aws.String("/"),
+	})
+	require.NoError(t, err)
+	require.Len(t, listed.Contents, 1)
+	assert.Equal(t, "readme", aws.StringValue(listed.Contents[0].Key))
+	require.Len(t, listed.CommonPrefixes, 1)
+	assert.Equal(t, "logs/", aws.StringValue(listed.CommonPrefixes[0].Prefix))
+}
+
+func TestServer_MultipartUpload(t *testing.T) {
+	server, client := newClient(t)
+	server.PutObject("bucket", "source", []byte("0123456789"))
+
+	created, err := client.CreateMultipartUpload(&s3.CreateMultipartUploadInput{Bucket: aws.String("bucket"), Key: aws.String("big")})
+	require.NoError(t, err)
+	uploadID := created.UploadId
+
+	server.FailPart(1)
+	_, err = client.UploadPart(&s3.UploadPartInput{
+		Bucket: aws.String("bucket"), Key: aws.String("big"), UploadId: uploadID,
+		PartNumber: aws.Int64(1), Body: bytes.NewReader([]byte("first-")),
+	})
+	assert.Equal(t, "AccessDenied", errorCode(err), "FailPart fails once")
+
+	part1, err := client.UploadPart(&s3.UploadPartInput{
+		Bucket: aws.String("bucket"), Key: aws.String("big"), UploadId: uploadID,
+		PartNumber: aws.Int64(1), Body: bytes.NewReader([]byte("first-")),
+	})
+	require.NoError(t, err)
+	part2, err := client.UploadPartCopy(&s3.UploadPartCopyInput{
+		Bucket: aws.String("bucket"), Key: aws.String("big"), UploadId: uploadID,
+		PartNumber: aws.Int64(2), CopySource: aws.String("bucket/source"), CopySourceRange: aws.String("bytes=2-5"),
+	})
+	require.NoError(t, err)
+
+	for _, byteRange := range []string{"bytes=8-20", "bytes=5-2", "bytes=4-", "bytes=x"} {
+		_, err = client.UploadPartCopy(&s3.UploadPartCopyInput{
+			Bucket: aws.String("bucket"), Key: aws.String("big"), UploadId: uploadID,
+			PartNumber: aws.Int64(3), CopySource: aws.String("bucket/source"), CopySourceRange: aws.String(byteRange),
+		})
+		assert.Equal(t, "InvalidRange", errorCode(err), byteRange)
+	}
+
+	parts, err := client.ListParts(&s3.ListPartsInput{Bucket: aws.String("bucket"), Key: aws.String("big"), UploadId: uploadID})
+	require.NoError(t, err)
+	assert.Len(t, parts.Parts, 2)
+
+	uploads, err := client.ListMultipartUploads(&s3.ListMultipartUploadsInput{Bucket: aws.String("bucket")})
+	require.NoError(t, err)
+	require.Len(t, uploads.Uploads, 1)
+	assert.Equal(t, aws.StringValue(uploadID), aws.StringValue(uploads.Uploads[0].UploadId))
+
+	completed, err := client.CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
+		Bucket: aws.String("bucket"), Key: aws.String("big"), UploadId: uploadID,
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: []*s3.CompletedPart{
+			{PartNumber: aws.Int64(1), ETag: part1.ETag},
+			{PartNumber: aws.Int64(2), ETag: part2.CopyPartResult.ETag},
+		}},
+	})
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(aws.StringValue(completed.ETag), `-2"`))
+
+	obj, ok := server.Object("bucket", "big")
+	require.True(t, ok)
+	assert.Equal(t, "first-2345", string(obj.Data))
+	assert.Equal(t, []int{6, 4}, obj.PartSizes)
+
+	_, err = client.UploadPart(&s3.UploadPartInput{
+		Bucket: aws.String("bucket"), Key: aws.String("big"), UploadId: uploadID,
+		PartNumber: aws.Int64(3), Body: bytes.NewReader([]byte("late")),
+	})
+	assert.Equal(t, s3.ErrCodeNoSuchUpload, errorCode(err))
+}
+
+func TestServer_DeleteObjectsAndVersions(t *testing.T) {
+	server, client := newClient(t)
+	server.PutObject("bucket", "a", []byte("1"))
+	server.PutObject("bucket", "a", []byte("2"))
+	server.PutObject("bucket", "b", []byte("3"))
+	server.FailDelete("b")
+
+	result, err := client.DeleteObjects(&s3.DeleteObjectsInput{
+		Bucket: aws.String("bucket"),
+		Delete: &s3.Delete{Objects: []*s3.ObjectIdentifier{{Key: aws.String("a")}, {Key: aws.String("b")}}},
+	})
+	require.NoError(t, err)
+	require.Len(t, result.Deleted, 1)
+	require.Len(t, result.Errors, 1)
+	assert.Equal(t, "b", aws.StringValue(result.Errors[0].Key))
+	assert.Equal(t, []string{"b"}, server.Keys("bucket"))
+
+	versions, err := client.ListObjectVersions(&s3.ListObjectVersionsInput{Bucket: aws.String("bucket"), Prefix: aws.String("a")})
+	require.NoError(t, err)
+	assert.Len(t, versions.Versions, 2)
+	require.Len(t, versions.DeleteMarkers, 1)
+	assert.True(t, aws.BoolValue(versions.DeleteMarkers[0].IsLatest))
+}
+
+func TestServer_Integrity(t *testing.T) {
+	server, client := newClient(t)
+
+	_, err := client.PutObject(&s3.PutObjectInput{
+		Bucket:         aws.String("bucket"),
+		Key:            aws.String("key"),
+		Body:           strings.NewReader("data"),
+		ChecksumSHA256: aws.String("AAAA"),
+	})
+	assert.Equal(t, "BadDigest", errorCode(err))
+	_, ok := server.Object("bucket", "key")
+	assert.False(t, ok)
+
+	stored := server.PutObject("bucket", "key", []byte("data"))
+	server.Corrupt("bucket", "key")
+	obj, ok := server.Object("bucket", "key")
+	require.True(t, ok)
+	assert.Equal(t, stored.ETag, obj.ETag)
+	assert.NotEqual(t, stored.Data, obj.Data)
+
+	// Snapshots are copies
+	obj.Data[0] = 'x'
+	again, _ := server.Object("bucket", "key")
+	assert.NotEqual(t, obj.Data, again.Data)
+}
+
+func TestServer_MetadataAndTagging(t *testing.T) {
+	server, client := newClient(t)
+
+	_, err := client.PutObject(&s3.PutObjectInput{
+		Bucket:      aws.String("bucket"),
+		Key:         aws.String("doc"),
+		Body:        strings.NewReader("text"),
+		ContentType: aws.String("text/plain"),
+		Metadata:    map[string]*string{"Owner": aws.String("alice")},
+		Tagging:     aws.String("team=data&tier=hot"),
+	})
+	require.NoError(t, err)
+
+	head, err := client.HeadObject(&s3.HeadObjectInput{Bucket: aws.String("bucket"), Key: aws.String("doc")})
+	require.NoError(t, err)
+	assert.Equal(t, "text/plain", aws.StringValue(head.ContentType))
+	assert.Equal(t, "alice", aws.StringValue(head.Metadata["Owner"]))
+
+	tags, err := client.GetObjectTagging(&s3.GetObjectTaggingInput{Bucket: aws.String("bucket"), Key: aws.String("doc")})
+	require.NoError(t, err)
+	require.Len(t, tags.TagSet, 2)
+	assert.Equal(t, "team", aws.StringValue(tags.TagSet[0].Key))
+
+	// Copying onto itself needs a change
+	_, err = client.CopyObject(&s3.CopyObjectInput{
+		Bucket: aws.String("bucket"), Key: aws.String("doc"), CopySource: aws.String("bucket/doc"),
+	})
+	assert.Equal(t, "InvalidRequest", errorCode(err))
+
+	_, err = client.CopyObject(&s3.CopyObjectInput{
+		Bucket: aws.String("bucket"), Key: aws.String("doc"), CopySource: aws.String("bucket/doc"),
+		CopySourceIfMatch: aws.String(`"stale"`), MetadataDirective: aws.String("REPLACE"),
+	})
+	assert.Equal(t, "PreconditionFailed", errorCode(err))
+
+	_, err = client.CopyObject(&s3.CopyObjectInput{
+		Bucket: aws.String("bucket"), Key: aws.String("doc"), CopySource: aws.String("bucket/doc"),
+		MetadataDirective: aws.String("REPLACE"), ContentType: aws.String("text/markdown"),
+		Metadata: map[string]*string{"Owner": aws.String("bob")},
+	})
+	require.NoError(t, err)
+	obj, ok := server.Object("bucket", "doc")
+	require.True(t, ok)
+	assert.Equal(t, "text", string(obj.Data))
+	assert.Equal(t, "text/markdown", obj.ContentType)
+	assert.Equal(t, map[string]string{"owner": "bob"}, obj.Metadata)
+	assert.Equal(t, map[string]string{"team": "data", "tier": "hot"}, obj.Tags, "tags are copied by default")
+
+	_, err = client.PutObjectTagging(&s3.PutObjectTaggingInput{
+		Bucket:  aws.String("bucket"),
+		Key:     aws.String("doc"),
+		Tagging: &s3.Tagging{TagSet: []*s3.Tag{{Key: aws.String("tier"), Value: aws.String("cold")}}},
+	})
+	require.NoError(t, err)
+	obj, _ = server.Object("bucket", "doc")
+	assert.Equal(t, map[string]string{"tier": "cold"}, obj.Tags)
+
+	_, err = client.DeleteObjectTagging(&s3.DeleteObjectTaggingInput{Bucket: aws.String("bucket"), Key: aws.String("doc")})
+	require.NoError(t, err)
+	obj, _ = server.Object("bucket", "doc")
+	assert.Empty(t, obj.Tags)
+
+	_, err = client.GetObjectTagging(&s3.GetObjectTaggingInput{Bucket: aws.String("bucket"), Key: aws.String("missing")})
+	assert.Equal(t, s3.ErrCodeNoSuchKey, errorCode(err))
+
+	plain := server.PutObject("bucket", "plain", []byte("x"))
+	assert.Empty(t, plain.ContentType)
+	head, err = client.HeadObject(&s3.HeadObjectInput{Bucket: aws.String("bucket"), Key: aws.String("plain")})
+	require.NoError(t, err)
+	assert.Equal(t, "binary/octet-stream", aws.StringValue(head.ContentType))
+}
+
+func TestServer_Lifecycle(t *testing.T) {
+	server, client := newClient(t)
+
+	_, err := client.GetBucketLifecycleConfiguration(&s3.GetBucketLifecycleConfigurationInput{Bucket: aws.String("bucket")})
+	assert.Equal(t, "NoSuchLifecycleConfiguration", errorCode(err))
+
+	_, err = client.PutBucketLifecycleConfiguration(&s3.PutBucketLifecycleConfigurationInput{
+		Bucket: aws.String("bucket"),
+		LifecycleConfiguration: &s3.BucketLifecycleConfiguration{Rules: []*s3.LifecycleRule{{
+			ID:         aws.String("expire-logs"),
+			Status:     aws.String(s3.ExpirationStatusEnabled),
+			Filter:     &s3.LifecycleRuleFilter{Prefix: aws.String("logs/")},
+			Expiration: &s3.LifecycleExpiration{Days: aws.Int64(30)},
+		}}},
+	})
+	require.NoError(t, err)
+	raw, ok := server.LifecycleConfiguration("bucket")
+	require.True(t, ok)
+	assert.Contains(t, string(raw), "expire-logs")
+
+	got, err := client.GetBucketLifecycleConfiguration(&s3.GetBucketLifecycleConfigurationInput{Bucket: aws.String("bucket")})
+	require.NoError(t, err)
+	require.Len(t, got.Rules, 1)
+	assert.Equal(t, "logs/", aws.StringValue(got.Rules[0].Filter.Prefix))
+	assert.Equal(t, int64(30), aws.Int64Value(got.Rules[0].Expiration.Days))
+
+	_, err = client.DeleteBucketLifecycle(&s3.DeleteBucketLifecycleInput{Bucket: aws.String("bucket")})
+	require.NoError(t, err)
+	_, ok = server.LifecycleConfiguration("bucket")
+	assert.False(t, ok)
+}
@@ -0,0 +1,254 @@
+package s3util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+var (
+	// ErrNotExist is returned (wrapped) when an object does not exist
+	ErrNotExist = errors.New("object does not exist")
+	// ErrNotSupported is returned by stores that do not support an operation
+	ErrNotSupported = errors.New("operation not supported by this store")
+)
+
+// ObjectStore is a bucket-like key/value store. Keys use forward slashes and
+// are relative to the store's root. Implementations are safe for concurrent use.
+type ObjectStore interface {
+	// Get opens the object for reading
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// GetRange reads length bytes starting at offset; a negative length reads
+	// to the end. A zero length returns an empty reader without looking up
+	// the object, an offset at or past the end of an existing object returns
+	// an empty reader, and a negative offset is an error.
+	GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error)
+	// Put stores the contents of r under key
+	Put(ctx context.Context, key string, r io.Reader, contentType string) error
+	// Stat returns the object's metadata
+	Stat(ctx context.Context, key string) (ObjectSummary, error)
+	// List calls fn for every object whose key starts with prefix, in key order.
+	// Returning ErrStopWalk from fn stops the listing without error.
+	List(ctx context.Context, prefix string, fn func(ObjectSummary) error) error
+	// Delete removes the object; deleting a missing object is not an error
+	Delete(ctx context.Context, key string) error
+	// Copy copies srcKey to dstKey within the store
+	Copy(ctx context.Context, srcKey, dstKey string) error
+	// PresignGet returns a URL for downloading the object, or ErrNotSupported
+	PresignGet(ctx context.Context, key string, expiration time.Duration) (string, error)
+}
+
+// OpenStore opens a store from a URL:
+//
+//	s3://bucket/prefix  an S3Store using client
+//	file:///path/to/dir a LocalStore rooted at the directory
+//	mem://name          the shared MemoryStore registered under name
+//
+// client is only required for s3:// URLs.
+func OpenStore(rawURL string, client *Client) (ObjectStore, error) {
+	scheme, rest, ok := strings.Cut(rawURL, "://")
+	if !ok {
+		return nil, fmt.Errorf("invalid store URL %q: missing scheme", rawURL)
+	}
+
+	switch scheme {
+	case "s3":
+		if client == nil {
+			return nil, fmt.Errorf("an S3 client is required to open %s", rawURL)
+		}
+		path, err := ParseS3Path(rawURL)
+		if err != nil {
+			return nil, err
+		}
+		return NewS3Store(client, path.Bucket, path.Key), nil
+	case "file":
+		if rest == "" {
+			return nil, fmt.Errorf("invalid store URL %q: missing path", rawURL)
+		}
+		return NewLocalStore(rest)
+	case "mem":
+		return SharedMemoryStore(rest), nil
+	default:
+		return nil, fmt.Errorf("unsupported store scheme %q", scheme)
+	}
+}
+
+// S3Store is an ObjectStore backed by an S3 bucket and key prefix
+type S3Store struct {
+	client *Client
+	bucket string
+	prefix string
+}
+
+// NewS3Store creates a store for the objects under prefix in bucket. A
+// non-empty prefix is treated as a directory.
+func NewS3Store(client *Client, bucket, prefix string) *S3Store {
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return &S3Store{client: client, bucket: bucket, prefix: prefix}
+}
+
+// Get implements ObjectStore
+func (s *S3Store) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	return s.GetRange(ctx, key, 0, -1)
+}
+
+// GetRange implements ObjectStore
+func (s *S3Store) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	if empty, err := emptyRange(key, offset, length); empty || err != nil {
+		return emptyReader(err)
+	}
+
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.prefix + key),
+	}
+	if offset > 0 || length >= 0 {
+		input.Range = aws.String(httpRange(offset, length))
+	}
+
+	output, err := s.client.s3Client.GetObjectWithContext(ctx, input)
+	if err != nil {
+		var reqErr awserr.RequestFailure
+		if errors.As(err, &reqErr) && reqErr.StatusCode() == http.StatusRequestedRangeNotSatisfiable {
+			// The offset is past the end of the object
+			return emptyReader(nil)
+		}
+		return nil, s.wrapError("get", key, err)
+	}
+	return output.Body, nil
+}
+
+// Put implements ObjectStore
+func (s *S3Store) Put(ctx context.Context, key string, r io.Reader, contentType string) error {
+	input := &s3manager.UploadInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.prefix + key),
+		Body:   r,
+	}
+	if contentType != "" {
+		input.ContentType = aws.String(contentType)
+	}
+
+	if _, err := s.client.uploader.UploadWithContext(ctx, input); err != nil {
+		return s.wrapError("put", key, err)
+	}
+	return nil
+}
+
+// Stat implements ObjectStore
+func (s *S3Store) Stat(ctx context.Context, key string) (ObjectSummary, error) {
+	output, err := s.client.s3Client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.prefix + key),
+	})
+	if err != nil {
+		return ObjectSummary{}, s.wrapError("stat", key, err)
+	}
+
+	return ObjectSummary{
+		Key:          key,
+		Size:         aws.Int64Value(output.ContentLength),
+		ETag:         strings.Trim(aws.StringValue(output.ETag), `"`),
+		LastModified: aws.TimeValue(output.LastModified),
+		StorageClass: aws.StringValue(output.StorageClass),
+	}, nil
+}
+
+// List implements ObjectStore
+func (s *S3Store) List(ctx context.Context, prefix string, fn func(ObjectSummary) error) error {
+	it := s.client.IterateWithContext(ctx, s.bucket, &ListOptions{Prefix: s.prefix + prefix})
+	return walk(it, func(object ObjectSummary) error {
+		object.Key = strings.TrimPrefix(object.Key, s.prefix)
+		return fn(object)
+	})
+}
+
+// Delete implements ObjectStore
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	_, err := s.client.s3Client.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.prefix + key),
+	})
+	if err != nil {
+		return s.wrapError("delete", key, err)
+	}
+	return nil
+}
+
+// Copy implements ObjectStore. Objects over 5GB are copied with UploadPartCopy,
+// which keeps their metadata and tags like CopyObject does.
+func (s *S3Store) Copy(ctx context.Context, srcKey, dstKey string) error {
+	info, err := s.Stat(ctx, srcKey)
+	if err != nil {
+		return err
+	}
+	if info.Size > maxCopyObjectSize {
+		return s.client.MultipartCopyWithContext(ctx, s.bucket, s.prefix+srcKey, s.bucket, s.prefix+dstKey, info.Size, 0)
+	}
+	return s.client.CopyObjectWithContext(ctx, s.bucket, s.prefix+srcKey, s.bucket, s.prefix+dstKey)
+}
+
+// PresignGet implements ObjectStore
+func (s *S3Store) PresignGet(ctx context.Context, key string, expiration time.Duration) (string, error) {
+	return s.client.GetPresignedURL(s.bucket, s.prefix+key, expiration)
+}
+
+// wrapError adds context to an S3 error, mapping missing objects to ErrNotExist
+func (s *S3Store) wrapError(operation, key string, err error) error {
+	if isNotFound(err) {
+		return fmt.Errorf("failed to %s s3://%s/%s%s: %w", operation, s.bucket, s.prefix, key, ErrNotExist)
+	}
+	return fmt.Errorf("failed to %s s3://%s/%s%s: %w", operation, s.bucket, s.prefix, key, err)
+}
+
+// isNotFound reports whether err is an S3 missing object or bucket error
+func isNotFound(err error) bool {
+	var reqErr awserr.RequestFailure
+	if errors.As(err, &reqErr) && reqErr.StatusCode() == http.StatusNotFound {
+		return true
+	}
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) {
+		switch awsErr.Code() {
+		case s3.ErrCodeNoSuchKey, "NotFound":
+			return true
+		}
+	}
+	return false
+}
+
+// emptyRange validates GetRange arguments and reports whether the range is
+// empty regardless of the object
+func emptyRange(key string, offset, length int64) (bool, error) {
+	if offset < 0 {
+		return false, fmt.Errorf("invalid offset %d for %s", offset, key)
+	}
+	return length == 0, nil
+}
+
+// emptyReader returns a reader with no data, or err if it is not nil
+func emptyReader(err error) (io.ReadCloser, error) {
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(strings.NewReader("")), nil
+}
+
+// httpRange formats an HTTP Range header value. A negative length reads to the end.
+func httpRange(offset, length int64) string {
+	if length < 0 {
+		return fmt.Sprintf("bytes=%d-", offset)
+	}
+	return fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)
+}
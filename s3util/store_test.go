@@ -0,0 +1,156 @@
+package s3util
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readObject reads the whole object from store
+func readObject(t *testing.T, store ObjectStore, key string, offset, length int64) string {
+	rc, err := store.GetRange(context.Background(), key, offset, length)
+	require.NoError(t, err)
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	return string(data)
+}
+
+// testObjectStore runs the behaviour shared by every ObjectStore implementation
+func testObjectStore(t *testing.T, store ObjectStore) {
+	ctx := context.Background()
+
+	require.NoError(t, store.Put(ctx, "docs/a.txt", strings.NewReader("hello world"), "text/plain"))
+	require.NoError(t, store.Put(ctx, "docs/nested/b.txt", strings.NewReader("bbb"), ""))
+	require.NoError(t, store.Put(ctx, "other.txt", strings.NewReader("o"), ""))
+
+	assert.Equal(t, "hello world", readObject(t, store, "docs/a.txt", 0, -1))
+	assert.Equal(t, "world", readObject(t, store, "docs/a.txt", 6, -1))
+	assert.Equal(t, "lo w", readObject(t, store, "docs/a.txt", 3, 4))
+	assert.Equal(t, "", readObject(t, store, "docs/a.txt", 3, 0))
+	assert.Equal(t, "", readObject(t, store, "docs/a.txt", 11, -1))
+	assert.Equal(t, "", readObject(t, store, "docs/a.txt", 50, 5))
+	assert.Equal(t, "", readObject(t, store, "missing", 0, 0))
+	_, err := store.GetRange(ctx, "docs/a.txt", -1, 5)
+	assert.Error(t, err)
+	_, err = store.GetRange(ctx, "missing", 50, 5)
+	assert.ErrorIs(t, err, ErrNotExist)
+
+	info, err := store.Stat(ctx, "docs/a.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "docs/a.txt", info.Key)
+	assert.Equal(t, int64(11), info.Size)
+	assert.WithinDuration(t, time.Now(), info.LastModified, time.Minute)
+
+	_, err = store.Stat(ctx, "missing")
+	assert.ErrorIs(t, err, ErrNotExist)
+	_, err = store.Get(ctx, "missing")
+	assert.ErrorIs(t, err, ErrNotExist)
+
+	var keys []string
+	require.NoError(t, store.List(ctx, "docs/", func(object ObjectSummary) error {
+		keys = append(keys, object.Key)
+		return nil
+	}))
+	assert.Equal(t, []string{"docs/a.txt", "docs/nested/b.txt"}, keys)
+
+	keys = nil
+	require.NoError(t, store.List(ctx, "", func(object ObjectSummary) error {
+		keys = append(keys, object.Key)
+		return ErrStopWalk
+	}))
+	assert.Equal(t, []string{"docs/a.txt"}, keys)
+
+	require.NoError(t, store.Copy(ctx, "docs/a.txt", "copy/a.txt"))
+	assert.Equal(t, "hello world", readObject(t, store, "copy/a.txt", 0, -1))
+	assert.ErrorIs(t, store.Copy(ctx, "missing", "x"), ErrNotExist)
+
+	require.NoError(t, store.Delete(ctx, "docs/a.txt"))
+	require.NoError(t, store.Delete(ctx, "docs/a.txt"))
+	_, err = store.Stat(ctx, "docs/a.txt")
+	assert.ErrorIs(t, err, ErrNotExist)
+}
+
+func TestS3Store(t *testing.T) {
+	f, client := newFakeS3(t)
+	store := NewS3Store(client, "bucket", "root")
+	testObjectStore(t, store)
+
+	assert.Contains(t, f.Keys("bucket"), "root/copy/a.txt")
+
+	url, err := store.PresignGet(context.Background(), "other.txt", time.Minute)
+	require.NoError(t, err)
+	assert.Contains(t, url, "/bucket/root/other.txt")
+}
+
+func TestLocalStore(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewLocalStore(dir)
+	require.NoError(t, err)
+	testObjectStore(t, store)
+
+	assert.FileExists(t, filepath.Join(dir, "copy", "a.txt"))
+	info, err := os.Stat(filepath.Join(dir, "copy", "a.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0644), info.Mode().Perm())
+
+	_, err = store.PresignGet(context.Background(), "other.txt", time.Minute)
+	assert.ErrorIs(t, err, ErrNotSupported)
+	assert.Error(t, store.Put(context.Background(), "../escape.txt", strings.NewReader("x"), ""))
+}
+
+func TestLocalStore_FilesystemRoot(t *testing.T) {
+	store, err := NewLocalStore("/")
+	require.NoError(t, err)
+
+	name, err := store.path("tmp/a.txt")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join("/", "tmp", "a.txt"), name)
+	for _, key := range []string{"", ".", "..", "../etc/passwd", "a/../../b"} {
+		_, err := store.path(key)
+		assert.Error(t, err, key)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+	testObjectStore(t, store)
+
+	info, err := store.Stat(context.Background(), "other.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "d95679752134a2d9eb61dbd7b91c4bcc", info.ETag)
+}
+
+func TestOpenStore(t *testing.T) {
+	_, client := newFakeS3(t)
+
+	store, err := OpenStore("s3://bucket/prefix", client)
+	require.NoError(t, err)
+	assert.IsType(t, &S3Store{}, store)
+
+	_, err = OpenStore("s3://bucket/prefix", nil)
+	assert.Error(t, err)
+
+	dir := t.TempDir()
+	store, err = OpenStore("file://"+filepath.ToSlash(dir), nil)
+	require.NoError(t, err)
+	assert.Equal(t, dir, store.(*LocalStore).Root())
+
+	first, err := OpenStore("mem://shared-test", nil)
+	require.NoError(t, err)
+	second, err := OpenStore("mem://shared-test", nil)
+	require.NoError(t, err)
+	assert.Same(t, first, second)
+
+	_, err = OpenStore("ftp://host/x", nil)
+	assert.Error(t, err)
+	_, err = OpenStore("no-scheme", nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,453 @@
+package s3util
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// CompareMode selects how sync decides that a file has changed
+type CompareMode int
+
+const (
+	// CompareETag compares size and the local MD5 against the ETag. Multipart
+	// ETags are not MD5 digests, so those objects fall back to CompareMTime.
+	CompareETag CompareMode = iota
+	// CompareMTime compares size and modification time; the newer side wins
+	CompareMTime
+	// CompareSize compares only the size
+	CompareSize
+)
+
+// SyncOptions contains options for SyncUp and SyncDown
+type SyncOptions struct {
+	Include       []string // Glob patterns of relative paths to sync (all if empty)
+	Exclude       []string // Glob patterns of relative paths to skip; applied after Include
+	Delete        bool     // Delete destination files that do not exist at the source
+	DryRun        bool     // Report what would change without changing anything
+	Concurrency   int      // Parallel transfers (default 8)
+	Compare       CompareMode
+	UploadOptions *UploadOptions // Used by SyncUp
+}
+
+// SyncReport describes the changes made, or planned in dry-run mode.
+// Paths are relative to the synced directory and prefix.
+type SyncReport struct {
+	Transferred []string
+	Deleted     []string
+	Unchanged   []string
+	Failed      map[string]error
+	Bytes       int64 // Bytes transferred
+	DryRun      bool
+}
+
+// syncFile is a file on either side of a sync
+type syncFile struct {
+	path    string // Local path or S3 key
+	size    int64
+	modTime time.Time
+	etag    string // S3 only
+}
+
+// syncTask is a unit of work executed by the sync worker pool
+type syncTask struct {
+	rel string
+	run func() (transferred bool, bytes int64, err error)
+	del bool
+}
+
+// SyncUp uploads new and changed files from localDir to s3Prefix
+// (s3://bucket/prefix), like "aws s3 sync localDir s3Prefix"
+func (c *Client) SyncUp(localDir, s3Prefix string, options *SyncOptions) (*SyncReport, error) {
+	return c.SyncUpWithContext(context.Background(), localDir, s3Prefix, options)
+}
+
+// SyncUpWithContext is like SyncUp but uses ctx for the S3 requests
+func (c *Client) SyncUpWithContext(ctx context.Context, localDir, s3Prefix string, options *SyncOptions) (*SyncReport, error) {
+	options = syncDefaults(options)
+	bucket, prefix, err := syncPrefix(s3Prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	local, err := localFiles(localDir)
+	if err != nil {
+		return nil, err
+	}
+	remote, err := c.remoteFiles(ctx, bucket, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var tasks []syncTask
+	for rel, src := range local {
+		if !syncIncluded(rel, options) {
+			continue
+		}
+		rel, src := rel, src
+		key := prefix + rel
+		dst, exists := remote[rel]
+
+		tasks = append(tasks, syncTask{rel: rel, run: func() (bool, int64, error) {
+			if exists {
+				changed, err := needsUpload(src, dst, options.Compare)
+				if err != nil || !changed {
+					return false, 0, err
+				}
+			}
+			if options.DryRun {
+				return true, src.size, nil
+			}
+			if _, err := c.UploadFileWithContext(ctx, bucket, key, src.path, options.UploadOptions); err != nil {
+				return false, 0, err
+			}
+			return true, src.size, nil
+		}})
+	}
+
+	if options.Delete {
+		for rel, dst := range remote {
+			if _, ok := local[rel]; ok || !syncIncluded(rel, options) {
+				continue
+			}
+			key := dst.path
+			tasks = append(tasks, syncTask{rel: rel, del: true, run: func() (bool, int64, error) {
+				if options.DryRun {
+					return true, 0, nil
+				}
+				return true, 0, c.DeleteObjectWithContext(ctx, bucket, key)
+			}})
+		}
+	}
+
+	return runSync(tasks, options)
+}
+
+// SyncDown downloads new and changed objects under s3Prefix into localDir,
+// like "aws s3 sync s3Prefix localDir". Downloaded files get the object's
+// modification time.
+func (c *Client) SyncDown(s3Prefix, localDir string, options *SyncOptions) (*SyncReport, error) {
+	return c.SyncDownWithContext(context.Background(), s3Prefix, localDir, options)
+}
+
+// SyncDownWithContext is like SyncDown but uses ctx for the S3 requests
+func (c *Client) SyncDownWithContext(ctx context.Context, s3Prefix, localDir string, options *SyncOptions) (*SyncReport, error) {
+	options = syncDefaults(options)
+	bucket, prefix, err := syncPrefix(s3Prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	remote, err := c.remoteFiles(ctx, bucket, prefix)
+	if err != nil {
+		return nil, err
+	}
+	local, err := localFiles(localDir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	root := filepath.Clean(localDir)
+	var tasks []syncTask
+	for rel, src := range remote {
+		if !syncIncluded(rel, options) {
+			continue
+		}
+		rel, src := rel, src
+		target := filepath.Join(root, filepath.FromSlash(rel))
+		if !strings.HasPrefix(target, root+string(filepath.Separator)) {
+			tasks = append(tasks, syncTask{rel: rel, run: func() (bool, int64, error) {
+				return false, 0, fmt.Errorf("key %s escapes the destination directory", src.path)
+			}})
+			continue
+		}
+		dst, exists := local[rel]
+
+		tasks = append(tasks, syncTask{rel: rel, run: func() (bool, int64, error) {
+			if exists {
+				changed, err := needsDownload(src, dst, options.Compare)
+				if err != nil || !changed {
+					return false, 0, err
+				}
+			}
+			if options.DryRun {
+				return true, src.size, nil
+			}
+			if err := c.downloadReplacing(ctx, bucket, src.path, target, src.modTime); err != nil {
+				return false, 0, err
+			}
+			return true, src.size, nil
+		}})
+	}
+
+	if options.Delete {
+		for rel, dst := range local {
+			if _, ok := remote[rel]; ok || !syncIncluded(rel, options) {
+				continue
+			}
+			file := dst.path
+			tasks = append(tasks, syncTask{rel: rel, del: true, run: func() (bool, int64, error) {
+				if options.DryRun {
+					return true, 0, nil
+				}
+				return true, 0, os.Remove(file)
+			}})
+		}
+	}
+
+	return runSync(tasks, options)
+}
+
+// downloadReplacing downloads an object to a temporary file next to target
+// and renames it over target only once the download succeeded, so a failed
+// sync leaves the previous local copy intact
+func (c *Client) downloadReplacing(ctx context.Context, bucket, key, target string, modTime time.Time) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return fmt.Errorf("failed to create directories: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".tmp-"+filepath.Base(target)+"-*")
+	if err != nil {
+		return fmt.Errorf("failed to create file for %s: %w", target, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = c.downloader.DownloadWithContext(ctx, tmp, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to download s3://%s/%s to %s: %w", bucket, key, target, err)
+	}
+	// CreateTemp uses 0600; give the file the mode os.Create would
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", target, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", target, err)
+	}
+	if err := os.Chtimes(tmp.Name(), modTime, modTime); err != nil {
+		return fmt.Errorf("failed to set modification time: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return fmt.Errorf("failed to write %s: %w", target, err)
+	}
+	return nil
+}
+
+// runSync executes tasks with bounded concurrency and builds the report
+func runSync(tasks []syncTask, options *SyncOptions) (*SyncReport, error) {
+	report := &SyncReport{Failed: make(map[string]error), DryRun: options.DryRun}
+
+	var (
+		mu  sync.Mutex
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, options.Concurrency)
+	)
+	for _, task := range tasks {
+		task := task
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			changed, bytes, err := task.run()
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err != nil:
+				report.Failed[task.rel] = err
+			case task.del:
+				report.Deleted = append(report.Deleted, task.rel)
+			case changed:
+				report.Transferred = append(report.Transferred, task.rel)
+				report.Bytes += bytes
+			default:
+				report.Unchanged = append(report.Unchanged, task.rel)
+			}
+		}()
+	}
+	wg.Wait()
+
+	sort.Strings(report.Transferred)
+	sort.Strings(report.Deleted)
+	sort.Strings(report.Unchanged)
+
+	if len(report.Failed) > 0 {
+		return report, fmt.Errorf("failed to sync %d files", len(report.Failed))
+	}
+	return report, nil
+}
+
+// needsUpload reports whether the local file differs from the object
+func needsUpload(local, remote syncFile, mode CompareMode) (bool, error) {
+	if local.size != remote.size {
+		return true, nil
+	}
+
+	switch mode {
+	case CompareSize:
+		return false, nil
+	case CompareETag:
+		if remote.etag != "" && !strings.Contains(remote.etag, "-") {
+			sum, err := fileMD5(local.path)
+			if err != nil {
+				return false, err
+			}
+			return sum != remote.etag, nil
+		}
+	}
+	return local.modTime.After(remote.modTime), nil
+}
+
+// needsDownload reports whether the object differs from the local file
+func needsDownload(remote, local syncFile, mode CompareMode) (bool, error) {
+	if local.size != remote.size {
+		return true, nil
+	}
+
+	switch mode {
+	case CompareSize:
+		return false, nil
+	case CompareETag:
+		if remote.etag != "" && !strings.Contains(remote.etag, "-") {
+			sum, err := fileMD5(local.path)
+			if err != nil {
+				return false, err
+			}
+			return sum != remote.etag, nil
+		}
+	}
+	return remote.modTime.After(local.modTime), nil
+}
+
+// localFiles returns the regular files under dir, keyed by slash-separated relative path
+func localFiles(dir string) (map[string]syncFile, error) {
+	files := make(map[string]syncFile)
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = syncFile{path: p, size: info.Size(), modTime: info.ModTime()}
+		return nil
+	})
+	if err != nil {
+		return files, fmt.Errorf("failed to read directory %s: %w", dir, err)
+	}
+	return files, nil
+}
+
+// remoteFiles returns the objects under prefix, keyed by path relative to the prefix
+func (c *Client) remoteFiles(ctx context.Context, bucket, prefix string) (map[string]syncFile, error) {
+	files := make(map[string]syncFile)
+	err := c.WalkPrefixWithContext(ctx, bucket, prefix, func(object ObjectSummary) error {
+		rel := strings.TrimPrefix(object.Key, prefix)
+		if rel == "" || strings.HasSuffix(rel, "/") {
+			return nil // Directory placeholder
+		}
+		files[rel] = syncFile{
+			path:    object.Key,
+			size:    object.Size,
+			modTime: object.LastModified,
+			etag:    object.ETag,
+		}
+		return nil
+	})
+	return files, err
+}
+
+// syncPrefix parses an s3:// prefix, treating it as a directory
+func syncPrefix(s3Prefix string) (bucket, prefix string, err error) {
+	p, err := ParseS3Path(s3Prefix)
+	if err != nil {
+		return "", "", err
+	}
+	prefix = p.Key
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return p.Bucket, prefix, nil
+}
+
+// syncDefaults returns a copy of options with defaults applied
+func syncDefaults(options *SyncOptions) *SyncOptions {
+	config := SyncOptions{}
+	if options != nil {
+		config = *options
+	}
+	if config.Concurrency <= 0 {
+		config.Concurrency = 8
+	}
+	return &config
+}
+
+// syncIncluded applies the include and exclude patterns to a relative path
+func syncIncluded(rel string, options *SyncOptions) bool {
+	if len(options.Include) > 0 && !matchAny(options.Include, rel) {
+		return false
+	}
+	return !matchAny(options.Exclude, rel)
+}
+
+// matchAny reports whether rel matches any pattern. Patterns without a slash
+// are also matched against the base name, so "*.log" matches "a/b.log".
+func matchAny(patterns []string, rel string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, rel); ok {
+			return true
+		}
+		if !strings.Contains(pattern, "/") {
+			if ok, _ := path.Match(pattern, path.Base(rel)); ok {
+				return true
+			}
+		}
+		// "dir/*" style patterns also match everything below dir
+		if strings.HasSuffix(pattern, "/*") && strings.HasPrefix(rel, strings.TrimSuffix(pattern, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+// fileMD5 returns the hex MD5 digest of a file
+func fileMD5(filename string) (string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file %s: %w", filename, err)
+	}
+	defer file.Close()
+
+	hash := md5.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("failed to hash file %s: %w", filename, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
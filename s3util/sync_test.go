@@ -0,0 +1,151 @@
+package s3util
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeFiles creates files under dir from a map of relative path to content
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for rel, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(rel))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0755))
+		require.NoError(t, os.WriteFile(p, []byte(content), 0644))
+	}
+}
+
+func TestSyncUp(t *testing.T) {
+	f, client := newFakeS3(t)
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"index.html":     "<html>",
+		"css/site.css":   "body{}",
+		"debug.log":      "noise",
+		"img/logo.png":   "png",
+		"img/unused.tmp": "tmp",
+	})
+	f.PutObject("bucket", "site/css/site.css", []byte("body{}"))
+	f.PutObject("bucket", "site/stale.html", []byte("old"))
+
+	options := &SyncOptions{Exclude: []string{"*.log", "*.tmp"}, Delete: true}
+
+	report, err := client.SyncUp(dir, "s3://bucket/site", &SyncOptions{Exclude: options.Exclude, Delete: true, DryRun: true})
+	require.NoError(t, err)
+	assert.True(t, report.DryRun)
+	assert.Equal(t, []string{"img/logo.png", "index.html"}, report.Transferred)
+	assert.Equal(t, []string{"stale.html"}, report.Deleted)
+	assert.Equal(t, []string{"css/site.css"}, report.Unchanged)
+	assert.Equal(t, []string{"site/css/site.css", "site/stale.html"}, f.Keys("bucket"))
+
+	report, err = client.SyncUp(dir, "s3://bucket/site/", options)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"img/logo.png", "index.html"}, report.Transferred)
+	assert.Equal(t, int64(len("png")+len("<html>")), report.Bytes)
+	assert.Equal(t, []string{"site/css/site.css", "site/img/logo.png", "site/index.html"}, f.Keys("bucket"))
+
+	// A second run with the same content changes nothing
+	report, err = client.SyncUp(dir, "s3://bucket/site", options)
+	require.NoError(t, err)
+	assert.Empty(t, report.Transferred)
+	assert.Empty(t, report.Deleted)
+	assert.Len(t, report.Unchanged, 3)
+
+	// Same size, different content is detected through the ETag
+	writeFiles(t, dir, map[string]string{"index.html": "<HTML>"})
+	report, err = client.SyncUp(dir, "s3://bucket/site", options)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"index.html"}, report.Transferred)
+	obj, ok := f.Object("bucket", "site/index.html")
+	require.True(t, ok)
+	assert.Equal(t, "<HTML>", string(obj.Data))
+}
+
+func TestSyncUp_Include(t *testing.T) {
+	f, client := newFakeS3(t)
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.csv": "1", "b.json": "2", "data/c.csv": "3"})
+
+	report, err := client.SyncUp(dir, "s3://bucket/", &SyncOptions{Include: []string{"*.csv"}, Concurrency: 1})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a.csv", "data/c.csv"}, report.Transferred)
+	assert.Equal(t, []string{"a.csv", "data/c.csv"}, f.Keys("bucket"))
+}
+
+func TestSyncDown(t *testing.T) {
+	f, client := newFakeS3(t)
+	f.PutObject("bucket", "backup/a.txt", []byte("aaa"))
+	f.PutObject("bucket", "backup/nested/b.txt", []byte("bbb"))
+	f.PutObject("bucket", "backup/dir/", nil)
+
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"extra.txt": "x", "nested/b.txt": "old"})
+	past := time.Now().Add(-time.Hour)
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "nested", "b.txt"), past, past))
+
+	report, err := client.SyncDown("s3://bucket/backup", dir, &SyncOptions{Compare: CompareMTime, Delete: true})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a.txt", "nested/b.txt"}, report.Transferred)
+	assert.Equal(t, []string{"extra.txt"}, report.Deleted)
+
+	data, err := os.ReadFile(filepath.Join(dir, "nested", "b.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "bbb", string(data))
+	assert.NoFileExists(t, filepath.Join(dir, "extra.txt"))
+
+	// Downloaded files carry the object's modification time, so nothing changes next time
+	obj, _ := f.Object("bucket", "backup/a.txt")
+	info, err := os.Stat(filepath.Join(dir, "a.txt"))
+	require.NoError(t, err)
+	assert.WithinDuration(t, obj.LastModified, info.ModTime(), time.Second)
+	assert.Equal(t, os.FileMode(0644), info.Mode().Perm())
+
+	report, err = client.SyncDown("s3://bucket/backup", dir, &SyncOptions{Compare: CompareMTime})
+	require.NoError(t, err)
+	assert.Empty(t, report.Transferred)
+	assert.Len(t, report.Unchanged, 2)
+}
+
+func TestSyncDown_FailureKeepsLocalCopy(t *testing.T) {
+	f, client := newFakeS3(t)
+	f.PutObject("bucket", "backup/a.txt", []byte("new"))
+	f.FailGet("backup/a.txt")
+
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "old"})
+	past := time.Now().Add(-time.Hour)
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "a.txt"), past, past))
+
+	report, err := client.SyncDown("s3://bucket/backup", dir, &SyncOptions{Compare: CompareMTime})
+	require.Error(t, err)
+	assert.Contains(t, report.Failed, "a.txt")
+
+	data, err := os.ReadFile(filepath.Join(dir, "a.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "old", string(data))
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "the temporary file is removed")
+}
+
+func TestSyncDown_RejectsEscapingKeys(t *testing.T) {
+	f, client := newFakeS3(t)
+	f.PutObject("bucket", "p/../../evil.txt", []byte("x"))
+
+	dir := t.TempDir()
+	report, err := client.SyncDown("s3://bucket/p", dir, nil)
+	require.Error(t, err)
+	assert.Len(t, report.Failed, 1)
+}
+
+func TestMatchAny(t *testing.T) {
+	assert.True(t, matchAny([]string{"*.log"}, "a/b/c.log"))
+	assert.True(t, matchAny([]string{"logs/*"}, "logs/2024/01.txt"))
+	assert.True(t, matchAny([]string{"a/*.txt"}, "a/b.txt"))
+	assert.False(t, matchAny([]string{"a/*.txt"}, "b/a/b.txt"))
+	assert.False(t, matchAny(nil, "x"))
+}
@@ -2,6 +2,7 @@ package s3util
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"os"
@@ -19,10 +20,26 @@ type UploadOptions struct {
 	StorageClass         string
 	ServerSideEncryption string
 	KMSKeyID             string
+
+	// Verify sends Content-MD5 with every request and checks the returned
+	// ETags, including the composite ETag of multipart uploads
+	Verify bool
+	// ChecksumAlgorithm also sends an SHA256 or CRC32C checksum that S3
+	// validates and stores; DownloadOptions.Verify checks it later
+	ChecksumAlgorithm ChecksumAlgorithm
 }
 
 // UploadFromReader uploads data from an io.Reader to S3
 func (c *Client) UploadFromReader(bucket, key string, reader io.Reader, options *UploadOptions) (*s3manager.UploadOutput, error) {
+	return c.UploadFromReaderWithContext(context.Background(), bucket, key, reader, options)
+}
+
+// UploadFromReaderWithContext is like UploadFromReader but uses ctx for the S3 requests
+func (c *Client) UploadFromReaderWithContext(ctx context.Context, bucket, key string, reader io.Reader, options *UploadOptions) (*s3manager.UploadOutput, error) {
+	if options.integrityRequested() {
+		return c.checkedUpload(ctx, bucket, key, reader, 0, 0, options)
+	}
+
 	input := &s3manager.UploadInput{
 		Bucket: aws.String(bucket),
 		Key:    aws.String(key),
@@ -53,7 +70,7 @@ func (c *Client) UploadFromReader(bucket, key string, reader io.Reader, options
 		}
 	}
 
-	result, err := c.uploader.Upload(input)
+	result, err := c.uploader.UploadWithContext(ctx, input)
 	if err != nil {
 		return nil, fmt.Errorf("failed to upload to s3://%s/%s: %w", bucket, key, err)
 	}
@@ -63,61 +80,101 @@ func (c *Client) UploadFromReader(bucket, key string, reader io.Reader, options
 
 // UploadFromReaderToPath uploads data from an io.Reader using S3 path string
 func (c *Client) UploadFromReaderToPath(s3Path string, reader io.Reader, options *UploadOptions) (*s3manager.UploadOutput, error) {
+	return c.UploadFromReaderToPathWithContext(context.Background(), s3Path, reader, options)
+}
+
+// UploadFromReaderToPathWithContext is like UploadFromReaderToPath but uses ctx for the S3 requests
+func (c *Client) UploadFromReaderToPathWithContext(ctx context.Context, s3Path string, reader io.Reader, options *UploadOptions) (*s3manager.UploadOutput, error) {
 	path, err := ParseS3Path(s3Path)
 	if err != nil {
 		return nil, err
 	}
 
-	return c.UploadFromReader(path.Bucket, path.Key, reader, options)
+	return c.UploadFromReaderWithContext(ctx, path.Bucket, path.Key, reader, options)
 }
 
 // UploadBytes uploads byte data to S3
 func (c *Client) UploadBytes(bucket, key string, data []byte, options *UploadOptions) (*s3manager.UploadOutput, error) {
+	return c.UploadBytesWithContext(context.Background(), bucket, key, data, options)
+}
+
+// UploadBytesWithContext is like UploadBytes but uses ctx for the S3 requests
+func (c *Client) UploadBytesWithContext(ctx context.Context, bucket, key string, data []byte, options *UploadOptions) (*s3manager.UploadOutput, error) {
 	reader := bytes.NewReader(data)
-	return c.UploadFromReader(bucket, key, reader, options)
+	return c.UploadFromReaderWithContext(ctx, bucket, key, reader, options)
 }
 
 // UploadBytesToPath uploads byte data using S3 path string
 func (c *Client) UploadBytesToPath(s3Path string, data []byte, options *UploadOptions) (*s3manager.UploadOutput, error) {
+	return c.UploadBytesToPathWithContext(context.Background(), s3Path, data, options)
+}
+
+// UploadBytesToPathWithContext is like UploadBytesToPath but uses ctx for the S3 requests
+func (c *Client) UploadBytesToPathWithContext(ctx context.Context, s3Path string, data []byte, options *UploadOptions) (*s3manager.UploadOutput, error) {
 	reader := bytes.NewReader(data)
-	return c.UploadFromReaderToPath(s3Path, reader, options)
+	return c.UploadFromReaderToPathWithContext(ctx, s3Path, reader, options)
 }
 
 // UploadString uploads string data to S3
 func (c *Client) UploadString(bucket, key string, data string, options *UploadOptions) (*s3manager.UploadOutput, error) {
+	return c.UploadStringWithContext(context.Background(), bucket, key, data, options)
+}
+
+// UploadStringWithContext is like UploadString but uses ctx for the S3 requests
+func (c *Client) UploadStringWithContext(ctx context.Context, bucket, key string, data string, options *UploadOptions) (*s3manager.UploadOutput, error) {
 	reader := bytes.NewReader([]byte(data))
-	return c.UploadFromReader(bucket, key, reader, options)
+	return c.UploadFromReaderWithContext(ctx, bucket, key, reader, options)
 }
 
 // UploadStringToPath uploads string data using S3 path string
 func (c *Client) UploadStringToPath(s3Path string, data string, options *UploadOptions) (*s3manager.UploadOutput, error) {
+	return c.UploadStringToPathWithContext(context.Background(), s3Path, data, options)
+}
+
+// UploadStringToPathWithContext is like UploadStringToPath but uses ctx for the S3 requests
+func (c *Client) UploadStringToPathWithContext(ctx context.Context, s3Path string, data string, options *UploadOptions) (*s3manager.UploadOutput, error) {
 	reader := bytes.NewReader([]byte(data))
-	return c.UploadFromReaderToPath(s3Path, reader, options)
+	return c.UploadFromReaderToPathWithContext(ctx, s3Path, reader, options)
 }
 
 // UploadFile uploads a file to S3
 func (c *Client) UploadFile(bucket, key, filename string, options *UploadOptions) (*s3manager.UploadOutput, error) {
+	return c.UploadFileWithContext(context.Background(), bucket, key, filename, options)
+}
+
+// UploadFileWithContext is like UploadFile but uses ctx for the S3 requests
+func (c *Client) UploadFileWithContext(ctx context.Context, bucket, key, filename string, options *UploadOptions) (*s3manager.UploadOutput, error) {
 	file, err := os.Open(filename)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open file %s: %w", filename, err)
 	}
 	defer file.Close()
 
-	return c.UploadFromReader(bucket, key, file, options)
+	return c.UploadFromReaderWithContext(ctx, bucket, key, file, options)
 }
 
 // UploadFileToPath uploads a file using S3 path string
 func (c *Client) UploadFileToPath(filename, s3Path string, options *UploadOptions) (*s3manager.UploadOutput, error) {
+	return c.UploadFileToPathWithContext(context.Background(), filename, s3Path, options)
+}
+
+// UploadFileToPathWithContext is like UploadFileToPath but uses ctx for the S3 requests
+func (c *Client) UploadFileToPathWithContext(ctx context.Context, filename, s3Path string, options *UploadOptions) (*s3manager.UploadOutput, error) {
 	path, err := ParseS3Path(s3Path)
 	if err != nil {
 		return nil, err
 	}
 
-	return c.UploadFile(path.Bucket, path.Key, filename, options)
+	return c.UploadFileWithContext(ctx, path.Bucket, path.Key, filename, options)
 }
 
 // StreamUpload uploads data from an io.Reader with progress callback
 func (c *Client) StreamUpload(bucket, key string, reader io.Reader, size int64, options *UploadOptions, progressFn func(written, total int64)) (*s3manager.UploadOutput, error) {
+	return c.StreamUploadWithContext(context.Background(), bucket, key, reader, size, options, progressFn)
+}
+
+// StreamUploadWithContext is like StreamUpload but uses ctx for the S3 requests
+func (c *Client) StreamUploadWithContext(ctx context.Context, bucket, key string, reader io.Reader, size int64, options *UploadOptions, progressFn func(written, total int64)) (*s3manager.UploadOutput, error) {
 	var progressReader io.Reader = reader
 
 	if progressFn != nil && size > 0 {
@@ -128,7 +185,7 @@ func (c *Client) StreamUpload(bucket, key string, reader io.Reader, size int64,
 		}
 	}
 
-	return c.UploadFromReader(bucket, key, progressReader, options)
+	return c.UploadFromReaderWithContext(ctx, bucket, key, progressReader, options)
 }
 
 // progressReaderWrapper wraps an io.Reader to track progress
@@ -152,6 +209,15 @@ func (pr *progressReaderWrapper) Read(p []byte) (int, error) {
 
 // MultipartUpload performs a multipart upload for large files
 func (c *Client) MultipartUpload(bucket, key string, reader io.Reader, partSize int64, options *UploadOptions) (*s3manager.UploadOutput, error) {
+	return c.MultipartUploadWithContext(context.Background(), bucket, key, reader, partSize, options)
+}
+
+// MultipartUploadWithContext is like MultipartUpload but uses ctx for the S3 requests
+func (c *Client) MultipartUploadWithContext(ctx context.Context, bucket, key string, reader io.Reader, partSize int64, options *UploadOptions) (*s3manager.UploadOutput, error) {
+	if options.integrityRequested() {
+		return c.checkedUpload(ctx, bucket, key, reader, partSize, 0, options)
+	}
+
 	uploader := s3manager.NewUploaderWithClient(c.s3Client, func(u *s3manager.Uploader) {
 		if partSize > 0 {
 			u.PartSize = partSize
@@ -188,7 +254,7 @@ func (c *Client) MultipartUpload(bucket, key string, reader io.Reader, partSize
 		}
 	}
 
-	result, err := uploader.Upload(input)
+	result, err := uploader.UploadWithContext(ctx, input)
 	if err != nil {
 		return nil, fmt.Errorf("failed to multipart upload to s3://%s/%s: %w", bucket, key, err)
 	}
@@ -198,6 +264,15 @@ func (c *Client) MultipartUpload(bucket, key string, reader io.Reader, partSize
 
 // ConcurrentUpload uploads multiple parts concurrently
 func (c *Client) ConcurrentUpload(bucket, key string, reader io.Reader, partSize int64, concurrency int, options *UploadOptions) (*s3manager.UploadOutput, error) {
+	return c.ConcurrentUploadWithContext(context.Background(), bucket, key, reader, partSize, concurrency, options)
+}
+
+// ConcurrentUploadWithContext is like ConcurrentUpload but uses ctx for the S3 requests
+func (c *Client) ConcurrentUploadWithContext(ctx context.Context, bucket, key string, reader io.Reader, partSize int64, concurrency int, options *UploadOptions) (*s3manager.UploadOutput, error) {
+	if options.integrityRequested() {
+		return c.checkedUpload(ctx, bucket, key, reader, partSize, concurrency, options)
+	}
+
 	uploader := s3manager.NewUploaderWithClient(c.s3Client, func(u *s3manager.Uploader) {
 		if partSize > 0 {
 			u.PartSize = partSize
@@ -237,7 +312,7 @@ func (c *Client) ConcurrentUpload(bucket, key string, reader io.Reader, partSize
 		}
 	}
 
-	result, err := uploader.Upload(input)
+	result, err := uploader.UploadWithContext(ctx, input)
 	if err != nil {
 		return nil, fmt.Errorf("failed to concurrent upload to s3://%s/%s: %w", bucket, key, err)
 	}
@@ -0,0 +1,238 @@
+package s3util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// errWriterClosed is returned when an ObjectWriter is used after Close or Abort
+var errWriterClosed = errors.New("s3util: writer is closed")
+
+// WriterOptions contains options for Create
+type WriterOptions struct {
+	PartSize      int64 // Bytes buffered per part (default 8MB; S3 requires at least 5MB). Objects are limited to 10000 parts.
+	Concurrency   int   // Parts uploaded in parallel (default 4)
+	UploadOptions *UploadOptions
+}
+
+// ObjectWriter streams data to an S3 object. Data is buffered into parts
+// that are uploaded in the background while writing continues; Write blocks
+// once Concurrency parts are in flight, so memory use stays below
+// PartSize * (Concurrency + 1). Small objects are sent with a single PUT on
+// Close. S3 allows at most 10000 parts, so an object can hold at most
+// PartSize * 10000 bytes (about 78GiB with the default part size); writing
+// more fails. An ObjectWriter is not safe for concurrent use.
+type ObjectWriter struct {
+	client  *Client
+	bucket  string
+	key     string
+	options WriterOptions
+	upload  *UploadOptions
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	buf      []byte
+	uploadID string
+	number   int64
+	closed   bool
+	sem      chan struct{}
+	wg       sync.WaitGroup
+
+	mu    sync.Mutex
+	parts []checkedPart
+	err   error
+}
+
+// Create returns a writer that uploads everything written to it to
+// s3://bucket/key. Nothing is visible in S3 until Close returns successfully;
+// call Abort to discard the upload instead.
+func (c *Client) Create(bucket, key string, options *WriterOptions) (*ObjectWriter, error) {
+	return c.CreateWithContext(context.Background(), bucket, key, options)
+}
+
+// CreateWithContext is like Create but uses ctx for the S3 requests.
+// Cancelling ctx fails the writer; Abort still removes the uploaded parts.
+func (c *Client) CreateWithContext(ctx context.Context, bucket, key string, options *WriterOptions) (*ObjectWriter, error) {
+	config := WriterOptions{}
+	if options != nil {
+		config = *options
+	}
+	if config.PartSize <= 0 {
+		config.PartSize = 8 * 1024 * 1024
+	}
+	if config.PartSize < minPartSize {
+		return nil, fmt.Errorf("part size %d is below the S3 minimum of %d bytes", config.PartSize, minPartSize)
+	}
+	if config.Concurrency <= 0 {
+		config.Concurrency = 4
+	}
+
+	upload := &UploadOptions{}
+	if config.UploadOptions != nil {
+		upload = config.UploadOptions
+	}
+	if upload.ChecksumAlgorithm != "" {
+		if _, err := upload.ChecksumAlgorithm.newHash(); err != nil {
+			return nil, err
+		}
+	}
+
+	writerCtx, cancel := context.WithCancel(ctx)
+	return &ObjectWriter{
+		client:  c,
+		bucket:  bucket,
+		key:     key,
+		options: config,
+		upload:  upload,
+		ctx:     writerCtx,
+		cancel:  cancel,
+		buf:     make([]byte, 0, config.PartSize),
+		sem:     make(chan struct{}, config.Concurrency),
+	}, nil
+}
+
+// Write implements io.Writer. It returns the first error from a background
+// part upload.
+func (w *ObjectWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errWriterClosed
+	}
+
+	n := 0
+	for len(p) > 0 {
+		if err := w.failure(); err != nil {
+			return n, err
+		}
+
+		copied := copy(w.buf[len(w.buf):cap(w.buf)], p)
+		w.buf = w.buf[:len(w.buf)+copied]
+		p = p[copied:]
+		n += copied
+
+		if int64(len(w.buf)) == w.options.PartSize {
+			if err := w.flushPart(); err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, nil
+}
+
+// Close uploads any buffered data and completes the upload. On error the
+// upload is aborted.
+func (w *ObjectWriter) Close() error {
+	if w.closed {
+		return errWriterClosed
+	}
+	w.closed = true
+	defer w.cancel()
+
+	if w.uploadID == "" {
+		_, err := w.client.checkedPut(w.ctx, w.bucket, w.key, w.buf, w.upload)
+		return err
+	}
+
+	if len(w.buf) > 0 {
+		if err := w.flushPart(); err != nil {
+			w.abort()
+			return err
+		}
+	}
+	w.wg.Wait()
+	if err := w.failure(); err != nil {
+		w.abort()
+		return err
+	}
+
+	sort.Slice(w.parts, func(i, j int) bool { return w.parts[i].number < w.parts[j].number })
+	if _, err := w.client.completeCheckedUpload(w.ctx, w.bucket, w.key, w.uploadID, w.parts, w.upload); err != nil {
+		w.abort()
+		return err
+	}
+	return nil
+}
+
+// Abort cancels the upload and deletes any uploaded parts. Calling Abort
+// after Close has no effect.
+func (w *ObjectWriter) Abort() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	w.cancel()
+	w.wg.Wait()
+	return w.abort()
+}
+
+// flushPart starts a background upload of the buffered part, creating the
+// multipart upload first if needed. It blocks while Concurrency parts are
+// in flight.
+func (w *ObjectWriter) flushPart() error {
+	if w.number == s3manager.MaxUploadParts {
+		return fmt.Errorf("object s3://%s/%s exceeds %d parts of %d bytes", w.bucket, w.key, s3manager.MaxUploadParts, w.options.PartSize)
+	}
+	if w.uploadID == "" {
+		input := createUploadInput(w.bucket, w.key, w.upload)
+		if w.upload.ChecksumAlgorithm != "" {
+			input.ChecksumAlgorithm = aws.String(string(w.upload.ChecksumAlgorithm))
+		}
+		created, err := w.client.s3Client.CreateMultipartUploadWithContext(w.ctx, input)
+		if err != nil {
+			return fmt.Errorf("failed to start multipart upload to s3://%s/%s: %w", w.bucket, w.key, err)
+		}
+		w.uploadID = aws.StringValue(created.UploadId)
+	}
+
+	select {
+	case w.sem <- struct{}{}:
+	case <-w.ctx.Done():
+		return w.ctx.Err()
+	}
+
+	w.number++
+	number, data := w.number, w.buf
+	w.buf = make([]byte, 0, w.options.PartSize)
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		defer func() { <-w.sem }()
+
+		part, err := w.client.uploadCheckedPart(w.ctx, w.bucket, w.key, w.uploadID, number, data, w.upload)
+
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		if err != nil {
+			if w.err == nil {
+				w.err = err
+				w.cancel()
+			}
+			return
+		}
+		w.parts = append(w.parts, part)
+	}()
+	return nil
+}
+
+// failure returns the first background error
+func (w *ObjectWriter) failure() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.err
+}
+
+// abort aborts the multipart upload, if one was started
+func (w *ObjectWriter) abort() error {
+	if w.uploadID == "" {
+		return nil
+	}
+	return w.client.AbortMultipartUpload(w.bucket, w.key, w.uploadID)
+}
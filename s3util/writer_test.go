@@ -0,0 +1,129 @@
+package s3util
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestObjectWriter_SmallObject(t *testing.T) {
+	allowSmallParts(t)
+	f, client := newFakeS3(t)
+
+	w, err := client.Create("bucket", "small.txt", &WriterOptions{PartSize: 64})
+	require.NoError(t, err)
+	_, err = io.WriteString(w, "hello ")
+	require.NoError(t, err)
+	_, err = io.WriteString(w, "world")
+	require.NoError(t, err)
+
+	_, ok := f.Object("bucket", "small.txt")
+	assert.False(t, ok, "nothing is visible before Close")
+
+	require.NoError(t, w.Close())
+	obj, ok := f.Object("bucket", "small.txt")
+	require.True(t, ok)
+	assert.Equal(t, "hello world", string(obj.Data))
+	assert.Equal(t, 0, countRequests(f, "POST /bucket/small.txt?uploads"))
+
+	_, err = w.Write([]byte("x"))
+	assert.Error(t, err)
+	assert.Error(t, w.Close())
+}
+
+func TestObjectWriter_Multipart(t *testing.T) {
+	allowSmallParts(t)
+	f, client := newFakeS3(t)
+
+	w, err := client.Create("bucket", "data.csv.gz", &WriterOptions{
+		PartSize:      256,
+		Concurrency:   2,
+		UploadOptions: &UploadOptions{Verify: true, ChecksumAlgorithm: ChecksumSHA256},
+	})
+	require.NoError(t, err)
+
+	gz := gzip.NewWriter(w)
+	cw := csv.NewWriter(gz)
+	for i := 0; i < 500; i++ {
+		require.NoError(t, cw.Write([]string{strconv.Itoa(i), strings.Repeat("v", i%17)}))
+	}
+	cw.Flush()
+	require.NoError(t, cw.Error())
+	require.NoError(t, gz.Close())
+	require.NoError(t, w.Close())
+
+	obj, ok := f.Object("bucket", "data.csv.gz")
+	require.True(t, ok)
+	assert.Greater(t, len(obj.PartSizes), 1)
+	assert.Len(t, obj.Checksums, 1)
+
+	gr, err := gzip.NewReader(strings.NewReader(string(obj.Data)))
+	require.NoError(t, err)
+	records, err := csv.NewReader(gr).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 500)
+	assert.Equal(t, []string{"499", strings.Repeat("v", 499%17)}, records[499])
+}
+
+func TestObjectWriter_Abort(t *testing.T) {
+	allowSmallParts(t)
+	f, client := newFakeS3(t)
+
+	w, err := client.Create("bucket", "partial", &WriterOptions{PartSize: 10})
+	require.NoError(t, err)
+	_, err = w.Write([]byte(strings.Repeat("a", 35)))
+	require.NoError(t, err)
+
+	require.NoError(t, w.Abort())
+	_, ok := f.Object("bucket", "partial")
+	assert.False(t, ok)
+
+	uploads, err := client.ListIncompleteUploads("bucket", "")
+	require.NoError(t, err)
+	assert.Empty(t, uploads)
+	assert.Error(t, w.Close())
+}
+
+func TestObjectWriter_PartFailure(t *testing.T) {
+	allowSmallParts(t)
+	f, client := newFakeS3(t)
+	f.FailPart(2)
+
+	w, err := client.Create("bucket", "obj", &WriterOptions{PartSize: 10, Concurrency: 1})
+	require.NoError(t, err)
+
+	// The failure surfaces from a later Write or from Close
+	_, writeErr := w.Write([]byte(strings.Repeat("b", 50)))
+	closeErr := w.Close()
+	if writeErr == nil {
+		assert.Error(t, closeErr)
+	}
+
+	_, ok := f.Object("bucket", "obj")
+	assert.False(t, ok)
+	uploads, err := client.ListIncompleteUploads("bucket", "")
+	require.NoError(t, err)
+	assert.Empty(t, uploads)
+}
+
+func TestObjectWriter_PartSize(t *testing.T) {
+	_, client := newFakeS3(t)
+
+	_, err := client.Create("bucket", "obj", &WriterOptions{PartSize: 1 << 20})
+	assert.ErrorContains(t, err, "below the S3 minimum")
+
+	allowSmallParts(t)
+	w, err := client.Create("bucket", "obj", &WriterOptions{PartSize: 1, Concurrency: 16})
+	require.NoError(t, err)
+	n, err := w.Write(make([]byte, s3manager.MaxUploadParts+1))
+	assert.ErrorContains(t, err, "exceeds 10000 parts")
+	assert.Equal(t, s3manager.MaxUploadParts+1, n)
+	require.NoError(t, w.Abort())
+}